@@ -0,0 +1,42 @@
+-- 测试 collectgarbage 和 __gc 终结器
+local log = {}
+local function tracked(name)
+  return setmetatable({name = name}, {__gc = function(o) log[#log + 1] = o.name end})
+end
+
+local a, b = tracked("a"), tracked("b")
+local keep = tracked("keep")
+a, b = nil, nil
+collectgarbage()
+table.sort(log)
+print(table.concat(log, " "))  --> a b
+
+-- 后登记的先终结
+log = {}
+local x, y = tracked("x"), tracked("y")
+x, y = nil, nil
+collectgarbage()
+print(table.concat(log, " "))  --> y x
+
+-- 复活：__gc 可以把对象存起来
+local saved
+setmetatable({v = 42}, {__gc = function(o) saved = o end})
+collectgarbage()
+print(saved and saved.v)  --> 42
+
+-- 元表设置之后才加上的 __gc 不生效
+local mt = {}
+setmetatable({}, mt)
+mt.__gc = function() print("never") end
+collectgarbage()
+
+-- __gc 出错变成警告
+warn("@on")
+setmetatable({}, {__gc = function() error("boom", 0) end})
+collectgarbage()
+
+print(collectgarbage("count") > 0, collectgarbage("isrunning"), collectgarbage("step"))
+
+-- 退出时关闭状态，剩下的终结器都会运行
+setmetatable({}, {__gc = function() print("closed") end})
+print(keep.name)
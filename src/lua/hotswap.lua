@@ -0,0 +1,9 @@
+-- 测试 hotswap 模块：参数检查，以及不带模块名时更新全局变量
+local hotswap = require "hotswap"
+print(pcall(hotswap.update))
+print(pcall(hotswap.update, {}))
+print(pcall(hotswap.update, "x = 1", {}))
+print(pcall(hotswap.reload))
+
+function greet() return "old" end
+print(hotswap.update("function greet() return 'new' end"), greet())
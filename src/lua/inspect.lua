@@ -0,0 +1,20 @@
+-- 测试 inspect 模块：环、元表，以及键很多的嵌套表不会把栈用完
+local inspect = require "inspect"
+
+print(inspect({1, 2, a = {b = true}}))
+
+local t = {name = "loop"}
+t.self = t
+print(inspect(t))
+
+print(inspect(setmetatable({}, {__index = {}})))
+
+local wide = {}
+for i = 1, 40 do wide["k" .. i] = {x = {y = i}} end
+local s = inspect(wide)
+print(#s, s:find("k40 = ", 1, true) ~= nil)
+
+local deep = {}
+local node = deep
+for i = 1, 100 do node.next = {i = i}; node = node.next end
+print(#inspect(deep) > 0)
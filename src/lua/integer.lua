@@ -0,0 +1,53 @@
+-- 测试整数溢出回绕和整数/浮点数转换，出错时 assert 失败
+local maxi, mini = math.maxinteger, math.mininteger
+
+local function check(f, msg)
+  local ok, err = pcall(f)
+  assert(not ok and string.find(err, msg, 1, true), err)
+end
+
+-- 整数运算按补码回绕
+assert(maxi + 1 == mini and mini - 1 == maxi)
+assert(maxi * 2 == -2 and -mini == mini)
+assert(mini // -1 == mini and mini % -1 == 0)
+assert(1 << 63 == mini and 1 << 64 == 0 and -1 >> 1 == maxi)
+assert(0xffffffffffffffff == -1 and 0x10000000000000000 == 0)
+
+-- // 和 % 的两个操作数都是整数时结果也是整数
+assert(math.type(7 // 2) == "integer" and math.type(7 % 2) == "integer")
+assert(math.type(7.0 // 2) == "float" and math.type(7 % 2.0) == "float")
+assert(-5 // 2 == -3 and -5 % 2 == 1 and 5 % -2 == -1)
+assert(-5.5 % 2 == 0.5 and 5.5 % -2 == -0.5)
+check(function() return 1 // 0 end, "attempt to perform 'n//0'")
+check(function() return 1 % 0 end, "attempt to perform 'n%0'")
+assert(1 // 0.0 == math.huge and -1 // 0.0 == -math.huge)
+
+-- 超出整数范围的数字字面量是浮点数
+assert(math.type(9223372036854775807) == "integer")
+assert(math.type(9223372036854775808) == "float")
+assert(math.type(-9223372036854775808) == "float")
+
+-- 浮点数只有在值恰好是整数时才能转换成整数
+assert(3.0 | 0 == 3 and "3.0" | 0 == 3 and 2^53 | 0 == 9007199254740992)
+check(function() return 1.5 | 0 end, "has no integer representation")
+check(function() return 2^63 | 0 end, "has no integer representation")
+check(function() return math.huge | 0 end, "has no integer representation")
+check(function() return (0/0) | 0 end, "has no integer representation")
+assert(math.tointeger(3.0) == 3 and math.tointeger(3.5) == nil)
+assert(math.tointeger(2^63) == nil and math.tointeger(-2^63) == mini)
+check(function() return string.rep("x", 1.5) end, "has no integer representation")
+assert(math.type(math.floor(3.7)) == "integer" and math.type(math.floor(1e100)) == "float")
+
+-- 整数和浮点数的比较是精确的，不先把整数转换成浮点数
+assert(maxi < 2^63 and maxi ~= 2^63 and maxi + 0.0 == 2^63)
+assert(mini == -2^63 and not (mini < -2^63) and mini <= -2^63)
+assert((2^53 | 0) + 1 > 2^53 and (2^53 | 0) + 1 ~= 2^53)
+assert(not (1 < 0/0) and not (0/0 <= 1) and not (maxi < 0/0))
+assert(3 < 3.5 and not (3 <= 2.5) and -3 < -2.5 and 4.0 <= 4)
+
+-- 值是整数的浮点数键被规范成整数键
+local t = {}
+t[1.0], t[2^53] = "a", "b"
+assert(t[1] == "a" and t[2^53 | 0] == "b" and math.type(next(t)) == "integer")
+
+print("ok")
@@ -0,0 +1,19 @@
+-- 测试 io 文件：文件是 userdata，不能用元表伪造；没关闭的文件由 __gc 关闭
+local name = os.tmpname()
+
+local f = assert(io.open(name, "w"))
+f:write("hello\n")
+print(io.type(f), getmetatable(f).__name)
+local fake = setmetatable({}, getmetatable(io.stdout))
+print(io.type(fake), pcall(io.stdout.write, fake, "x"))
+f:close()
+print(io.type(f), pcall(f.write, f, "x"))
+for l in io.lines(name) do print(l) end
+
+do
+  local g = io.open(name, "w")
+  g:write("flushed by __gc\n")
+end
+collectgarbage()
+print(io.open(name):read("a"))
+os.remove(name)
@@ -0,0 +1,17 @@
+-- 测试方法调用 obj:m(args)，参数不能覆盖 self 寄存器
+local counter = {n = 10}
+
+function counter:add(a, b)
+  return self.n + a + b
+end
+
+function counter:concat(...)
+  return self.n .. ":" .. table.concat({...}, ",")
+end
+
+print(counter:add(1, 2))
+print(counter:concat("a", "b", "c"))
+print(counter:add(counter:add(1, 1), 3))
+
+local s = "hello"
+print(s:sub(2, 4), s:rep(2, "-"))
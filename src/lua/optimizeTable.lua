@@ -1,4 +1,4 @@
-start_t = clock() -- 开始时间（纳秒）
+start_t = os.clock() -- 开始时间（秒）
 
 x = {}
 i = 0  -- 开始下标
@@ -15,7 +15,7 @@ while( i < max_index) do
     i = i + gap
 end
 
-end_t = clock()   -- 结束时间（纳秒）
-print( (end_t - start_t) /1e9) -- 运行耗时（秒）
+end_t = os.clock()   -- 结束时间（秒）
+print(end_t - start_t) -- 运行耗时（秒）
 
 
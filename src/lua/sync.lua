@@ -0,0 +1,28 @@
+-- 测试 sync 模块：共享对象是 userdata，解锁未锁住的 mutex 只是一个 Lua 错误
+local sync = require "sync"
+
+local m = sync.mutex()
+print(pcall(m.unlock, m))
+m:lock()
+print(m:trylock())
+m:unlock()
+print(pcall(m.unlock, m))
+print(m:with(function(a, b) return a + b end, 1, 2))
+print(pcall(m.with, m, function() error("boom", 0) end), m:trylock())
+m:unlock()
+
+local hits = sync.table("hits")
+hits:set("/", 1)
+hits:incr("/")
+hits:update("/", function(n) return n * 10 end)
+print(hits:get("/"), hits:len(), hits:name(), sync.table("hits"):get("/"))
+print(pcall(hits.set, hits, "f", print))
+print(pcall(hits.incr, hits, "/", "x"))
+
+local n = sync.atomic("jobs", 5)
+print(n:add(), n:add(10), n:cas(16, 0), n:get())
+print(pcall(n.set, n, "x"))
+
+print(pcall(m.lock, {}))
+print(pcall(rawset, m, "lock", 1))
+print(getmetatable(m).__name, getmetatable(hits).__name, getmetatable(n).__name)
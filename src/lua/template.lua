@@ -0,0 +1,11 @@
+-- 测试 template 模块：源码参数必须是字符串，compile 得到的函数可以反复渲染
+local template = require "template"
+
+print(pcall(template.compile))
+print(pcall(template.render, {}))
+print(pcall(template.render, "x", nil, {}))
+
+local page = template.compile("<%= title %>!")
+print(page({ title = "a" }), page({ title = "<b>" }))
+print(template.render("<% for i = 1, n do %><%- i %><% end %>", { n = 3 }))
+print(template.render("<%- n * 2 %>", { n = 21 }))
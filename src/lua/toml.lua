@@ -0,0 +1,22 @@
+-- 测试 toml/yaml 模块：环、整数范围、非法日期和错误信息
+local toml, yaml = require "toml", require "yaml"
+
+local t = {a = {}}
+t.a.b = t
+print(pcall(toml.encode, t))
+print(pcall(yaml.encode, t))
+
+local shared = {}
+print(toml.encode({x = shared, y = {z = shared}}))
+
+print(toml.decode("x = 9223372036854775807").x)
+print(toml.decode("x = 9223372036854775808"))
+print(toml.decode("x = 0xffffffffffffffffff"))
+
+print(toml.decode("d = 2024-02-29").d)
+print(toml.decode("d = 2023-02-30"))
+print(toml.decode("d = 1979-05-27T25:32:00Z"))
+
+print(toml.encode({f = print}))
+print(yaml.encode({f = print}))
+print(yaml.decode("{[1]: 2}"))
@@ -0,0 +1,11 @@
+-- 测试 __tostring 必须返回字符串：tostring、print 和 string.format 一致
+local bad = setmetatable({}, {__tostring = function() return {} end})
+print(pcall(tostring, bad))
+print(pcall(print, bad))
+print(pcall(string.format, "%s", bad))
+print(pcall(tostring, setmetatable({}, {__tostring = function() end})))
+
+local good = setmetatable({}, {__tostring = function() return "good" end})
+print(tostring(good), string.format("[%s]", good))
+print(tostring(setmetatable({}, {__tostring = function() return 42 end})))
+print(string.format("%s %s %s", 1, 2.5, nil))
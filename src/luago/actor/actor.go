@@ -0,0 +1,205 @@
+package actor
+
+import (
+	"errors"
+	"fmt"
+	. "luago/api"
+	"os"
+	"sync"
+)
+
+const PERMS_TABLE = "_ACTOR_PERMS"     /* registry: value -> key, for persisting */
+const UNPERMS_TABLE = "_ACTOR_UNPERMS" /* registry: key -> value, for unpersisting */
+
+/*
+Actor 模型：每个 actor 是一个由自己的 goroutine 独占的 LuaState，
+带一个信箱，actor 之间只通过消息通信。
+
+	sys := actor.New(newState)  // newState 创建新的（已打开标准库的）状态
+	sys.Open(ls)                // 宿主的状态也成为 actor，得到全局 actor 表
+	...
+	sys.Wait()                  // 等待所有 spawn 出来的 actor 结束
+
+脚本侧：
+
+	local id = actor.spawn([[
+		local msg, from = actor.receive()
+		actor.send(from, msg * 2)
+	]], ...)                     -- 额外参数作为 chunk 的 ...
+	actor.send(id, 21)
+	print(actor.receive(1.5))    -- 42  1，超时（秒）返回 nil
+	print(actor.self())
+
+消息用 Persist 序列化后投递，接收方得到的是副本；函数也可以发送，
+它的全局变量在接收方的环境里解析。Go 函数不能发送。
+*/
+type System struct {
+	newState func() LuaState
+	OnError  func(id int64, err error) /* errors of spawned actors, default: print to stderr */
+
+	mu     sync.Mutex
+	actors map[int64]*Actor
+	nextId int64
+	closed bool
+	wg     sync.WaitGroup
+}
+
+type Actor struct {
+	id  int64
+	ls  LuaState
+	sys *System
+	box *mailbox
+}
+
+type message struct {
+	from int64
+	data []byte /* persisted value */
+}
+
+func New(newState func() LuaState) *System {
+	return &System{
+		newState: newState,
+		actors:   map[int64]*Actor{},
+		OnError: func(id int64, err error) {
+			fmt.Fprintf(os.Stderr, "actor %d: %v\n", id, err)
+		},
+	}
+}
+
+// Open makes ls an actor owned by the calling goroutine and installs
+// the global actor table.
+func (self *System) Open(ls LuaState) *Actor {
+	a := self.add(ls)
+	a.open()
+	return a
+}
+
+func (self *System) add(ls LuaState) *Actor {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	self.nextId++
+	a := &Actor{id: self.nextId, ls: ls, sys: self, box: newMailbox()}
+	self.actors[a.id] = a
+	return a
+}
+
+func (self *System) remove(a *Actor) {
+	self.mu.Lock()
+	delete(self.actors, a.id)
+	self.mu.Unlock()
+	a.box.close()
+}
+
+func (self *System) lookup(id int64) *Actor {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	return self.actors[id]
+}
+
+// Wait blocks until all spawned actors have finished.
+func (self *System) Wait() {
+	self.wg.Wait()
+}
+
+// Close interrupts all actors and wakes those waiting for messages.
+func (self *System) Close() {
+	self.mu.Lock()
+	self.closed = true
+	actors := make([]*Actor, 0, len(self.actors))
+	for _, a := range self.actors {
+		actors = append(actors, a)
+	}
+	self.mu.Unlock()
+
+	for _, a := range actors {
+		a.ls.Interrupt("actor system closed")
+		a.box.close()
+	}
+}
+
+// spawn starts a new actor running chunk, args are persisted arguments
+func (self *System) spawn(chunk []byte, chunkName string, args []byte) (int64, error) {
+	self.mu.Lock()
+	closed := self.closed
+	self.mu.Unlock()
+	if closed {
+		return 0, errors.New("actor system closed")
+	}
+
+	ls := self.newState()
+	a := self.add(ls)
+	a.open()
+
+	self.wg.Add(1)
+	go func() {
+		defer self.wg.Done()
+		defer ls.Close() /* stops its suspended coroutines */
+		defer self.remove(a)
+		if err := a.run(chunk, chunkName, args); err != nil && self.OnError != nil {
+			self.OnError(a.id, err)
+		}
+	}()
+	return a.id, nil
+}
+
+func (self *Actor) Id() int64 {
+	return self.id
+}
+
+func (self *Actor) run(chunk []byte, chunkName string, args []byte) error {
+	ls := self.ls
+	if ls.Load(chunk, chunkName, "bt") != LUA_OK {
+		return errors.New(ls.ToString(-1))
+	}
+	nArgs, err := self.unpack(args)
+	if err != nil {
+		return err
+	}
+	if ls.PCall(nArgs, 0, 0) != LUA_OK {
+		return errors.New(errorValue(ls))
+	}
+	return nil
+}
+
+// unpack pushes the values of a persisted argument table
+func (self *Actor) unpack(args []byte) (int, error) {
+	ls := self.ls
+	if err := self.decode(args); err != nil {
+		return 0, err
+	}
+	ls.GetField(-1, "n")
+	n, _ := ls.ToIntegerX(-1)
+	ls.Pop(1)
+	for i := int64(1); i <= n; i++ {
+		ls.GetI(-int(i), i)
+	}
+	ls.Remove(-int(n) - 1)
+	return int(n), nil
+}
+
+// encode persists the value at idx, the actor's globals stand for the
+// receiver's ones
+func (self *Actor) encode(idx int) ([]byte, error) {
+	ls := self.ls
+	idx = ls.AbsIndex(idx)
+	ls.GetField(LUA_REGISTRYINDEX, PERMS_TABLE)
+	defer ls.Pop(1)
+	return ls.Persist(idx, ls.GetTop())
+}
+
+// decode pushes the value persisted in data
+func (self *Actor) decode(data []byte) error {
+	ls := self.ls
+	ls.GetField(LUA_REGISTRYINDEX, UNPERMS_TABLE)
+	err := ls.Unpersist(data, ls.GetTop())
+	if err != nil {
+		ls.Pop(1)
+		return err
+	}
+	ls.Remove(-2)
+	return nil
+}
+
+func errorValue(ls LuaState) string {
+	return ls.ErrorMessage(-1)
+}
@@ -0,0 +1,114 @@
+package actor
+
+import (
+	. "luago/api"
+	"time"
+)
+
+// open installs the global actor table and the permanents tables
+func (self *Actor) open() {
+	ls := self.ls
+	ls.NewTable()
+	ls.PushGlobalTable()
+	ls.PushString("_G")
+	ls.SetTable(-3)
+	ls.SetField(LUA_REGISTRYINDEX, PERMS_TABLE)
+
+	ls.NewTable()
+	ls.PushGlobalTable()
+	ls.SetField(-2, "_G")
+	ls.SetField(LUA_REGISTRYINDEX, UNPERMS_TABLE)
+
+	ls.NewTable()
+	ls.PushGoFunction(self.luaSpawn)
+	ls.SetField(-2, "spawn")
+	ls.PushGoFunction(self.luaSend)
+	ls.SetField(-2, "send")
+	ls.PushGoFunction(self.luaReceive)
+	ls.SetField(-2, "receive")
+	ls.PushGoFunction(self.luaSelf)
+	ls.SetField(-2, "self")
+	ls.SetGlobal("actor")
+}
+
+// actor.spawn (source, ...)
+func (self *Actor) luaSpawn(ls LuaState) int {
+	source, ok := ls.ToStringX(1)
+	if !ok {
+		return raise(ls, "actor.spawn: source string expected")
+	}
+
+	n := ls.GetTop() - 1
+	ls.CreateTable(n, 1)
+	for i := 1; i <= n; i++ {
+		ls.PushValue(i + 1)
+		ls.SetI(-2, int64(i))
+	}
+	ls.PushInteger(int64(n))
+	ls.SetField(-2, "n")
+	args, err := self.encode(-1)
+	if err != nil {
+		return raise(ls, "actor.spawn: "+err.Error())
+	}
+
+	id, err := self.sys.spawn([]byte(source), "=actor", args)
+	if err != nil {
+		return raise(ls, "actor.spawn: "+err.Error())
+	}
+	ls.PushInteger(id)
+	return 1
+}
+
+// actor.send (id, msg), returns false if the actor is gone
+func (self *Actor) luaSend(ls LuaState) int {
+	id, ok := ls.ToIntegerX(1)
+	if !ok {
+		return raise(ls, "actor.send: actor id expected")
+	}
+	ls.SetTop(2)
+	data, err := self.encode(2)
+	if err != nil {
+		return raise(ls, "actor.send: "+err.Error())
+	}
+
+	to := self.sys.lookup(id)
+	ls.PushBoolean(to != nil && to.box.put(message{self.id, data}))
+	return 1
+}
+
+// actor.receive ([timeout]), returns msg, sender or nil on timeout
+func (self *Actor) luaReceive(ls LuaState) int {
+	timeout := time.Duration(-1)
+	if !ls.IsNoneOrNil(1) {
+		secs, ok := ls.ToNumberX(1)
+		if !ok {
+			return raise(ls, "actor.receive: timeout must be a number")
+		}
+		timeout = time.Duration(secs * float64(time.Second))
+		if timeout < 0 {
+			timeout = 0
+		}
+	}
+
+	msg, ok := self.box.get(timeout)
+	if !ok {
+		ls.PushNil()
+		return 1
+	}
+	if err := self.decode(msg.data); err != nil {
+		return raise(ls, "actor.receive: "+err.Error())
+	}
+	ls.PushInteger(msg.from)
+	return 2
+}
+
+// actor.self ()
+func (self *Actor) luaSelf(ls LuaState) int {
+	ls.PushInteger(self.id)
+	return 1
+}
+
+func raise(ls LuaState, msg string) int {
+	ls.PushString(msg)
+	return ls.Error()
+}
@@ -0,0 +1,77 @@
+package actor
+
+import (
+	"sync"
+	"time"
+)
+
+/* 无界信箱：发送方从不阻塞，接收方可以带超时等待 */
+type mailbox struct {
+	mu     sync.Mutex
+	queue  []message
+	signal chan struct{} /* one pending wake up */
+	done   chan struct{} /* closed with the mailbox */
+	closed bool
+}
+
+func newMailbox() *mailbox {
+	return &mailbox{
+		signal: make(chan struct{}, 1),
+		done:   make(chan struct{}),
+	}
+}
+
+func (self *mailbox) put(msg message) bool {
+	self.mu.Lock()
+	if self.closed {
+		self.mu.Unlock()
+		return false
+	}
+	self.queue = append(self.queue, msg)
+	self.mu.Unlock()
+
+	select {
+	case self.signal <- struct{}{}:
+	default:
+	}
+	return true
+}
+
+// get waits for a message, timeout < 0 waits forever
+func (self *mailbox) get(timeout time.Duration) (message, bool) {
+	var expired <-chan time.Time
+	if timeout >= 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		expired = timer.C
+	}
+
+	for {
+		self.mu.Lock()
+		if len(self.queue) > 0 {
+			msg := self.queue[0]
+			self.queue[0] = message{}
+			self.queue = self.queue[1:]
+			self.mu.Unlock()
+			return msg, true
+		}
+		self.mu.Unlock()
+
+		select {
+		case <-self.signal:
+		case <-self.done:
+			return message{}, false
+		case <-expired:
+			return message{}, false
+		}
+	}
+}
+
+func (self *mailbox) close() {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	if !self.closed {
+		self.closed = true
+		close(self.done)
+	}
+}
@@ -0,0 +1,25 @@
+package api
+
+type AllocKind = int
+
+/* kinds of objects reported to Allocator.Alloc and the alloc hook */
+const (
+	ALLOC_TABLE AllocKind = iota
+	ALLOC_STRING
+	ALLOC_STACK
+	ALLOC_CLOSURE
+	ALLOC_USERDATA
+)
+
+// Allocator is consulted whenever the state creates a table, a string,
+// a closure or a call stack. Alloc gets the approximate size in bytes;
+// returning an error aborts the operation with a Lua error. Close is
+// called by LuaState.Close.
+type Allocator interface {
+	Alloc(kind AllocKind, size int) error
+	Close()
+}
+
+// AllocHook observes the same allocations as the Allocator, after they
+// have been accepted. It cannot refuse them; see LuaState.SetAllocHook.
+type AllocHook func(kind AllocKind, size int)
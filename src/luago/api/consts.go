@@ -1,10 +1,22 @@
 package api
 
+const LUA_VERSION = "Lua 5.3"
+
 const LUA_MINSTACK = 20
+const LUA_MULTRET = -1
 const LUAI_MAXSTACK = 1000000
 const LUA_REGISTRYINDEX = -LUAI_MAXSTACK - 1000
+const LUA_RIDX_MAINTHREAD int64 = 1
 const LUA_RIDX_GLOBALS int64 = 2
 
+/* special references, see LuaState.Ref */
+const LUA_NOREF = -2
+const LUA_REFNIL = -1
+
+/* registry keys of the tables of loaded and preloaded modules */
+const LUA_LOADED_TABLE = "_LOADED"
+const LUA_PRELOAD_TABLE = "_PRELOAD"
+
 /* basic types */
 const (
 	LUA_TNONE = iota - 1 // -1
@@ -44,6 +56,23 @@ const (
 	LUA_OPLE        // <=
 )
 
+/* garbage-collection options */
+const (
+	LUA_GCSTOP       = 0
+	LUA_GCRESTART    = 1
+	LUA_GCCOLLECT    = 2
+	LUA_GCCOUNT      = 3
+	LUA_GCCOUNTB     = 4
+	LUA_GCSTEP       = 5
+	LUA_GCSETPAUSE   = 6
+	LUA_GCSETSTEPMUL = 7
+	LUA_GCISRUNNING  = 9
+)
+
+/* default values of the pause and the step multiplier */
+const LUAI_GCPAUSE = 200
+const LUAI_GCMUL = 200
+
 /* thread status */
 const (
 	LUA_OK = iota
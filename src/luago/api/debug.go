@@ -0,0 +1,44 @@
+package api
+
+// LuaDebug carries information about a function or an activation
+// record, like lua_Debug. GetStack fills its private part, GetInfo
+// the fields selected by its options.
+// http://www.lua.org/manual/5.3/manual.html#lua_Debug
+type LuaDebug struct {
+	Event           int
+	Name            string // (n)
+	NameWhat        string // (n) "global", "local", "method", "field", "upvalue", ...
+	What            string // (S) "Lua", "C" (Go functions) or "main"
+	Source          string // (S)
+	ShortSrc        string // (S)
+	CurrentLine     int    // (l)
+	LineDefined     int    // (S)
+	LastLineDefined int    // (S)
+	NUps            int    // (u) number of upvalues
+	NParams         int    // (u) number of parameters
+	IsVararg        bool   // (u)
+	IsTailCall      bool   // (t)
+	/* private part */
+	CallInfo interface{} // active function
+}
+
+// LuaHook is called by the VM on the events selected by SetHook.
+// http://www.lua.org/manual/5.3/manual.html#lua_Hook
+type LuaHook func(ls LuaState, ar *LuaDebug)
+
+/* event codes */
+const (
+	LUA_HOOKCALL = iota
+	LUA_HOOKRET
+	LUA_HOOKLINE
+	LUA_HOOKCOUNT
+	LUA_HOOKTAILCALL
+)
+
+/* event masks */
+const (
+	LUA_MASKCALL  = 1 << LUA_HOOKCALL
+	LUA_MASKRET   = 1 << LUA_HOOKRET
+	LUA_MASKLINE  = 1 << LUA_HOOKLINE
+	LUA_MASKCOUNT = 1 << LUA_HOOKCOUNT
+)
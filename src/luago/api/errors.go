@@ -0,0 +1,15 @@
+package api
+
+// ErrInfo describes an error being turned into a message, see
+// LuaState.SetErrorFormatter.
+type ErrInfo struct {
+	Value     interface{} // the error object, strings and numbers as Go values
+	Message   string      // the default message for Value
+	Traceback string      // "stack traceback:\n\t...", "" when not asked for
+	Source    string      // where the traceback starts, "" when unknown
+	Line      int
+}
+
+// ErrorFormatter renders an error for tracebacks, the CLI and hosts
+// reporting uncaught errors.
+type ErrorFormatter func(info ErrInfo) string
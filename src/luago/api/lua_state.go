@@ -6,11 +6,24 @@ type CompareOp = int
 
 type GoFunction func(LuaState) int
 
+// KContext and KFunction are the context and the continuation of
+// CallK, PCallK and YieldK.
+type KContext = int
+type KFunction func(ls LuaState, status int, ctx KContext) int
+
 func LuaUpvalueIndex(i int) int {
 	return LUA_REGISTRYINDEX - i
 }
 
 type LuaState interface {
+	/* state manipulation */
+	Close() /* required: suspended coroutines keep an unclosed state alive */
+	SetAllocHook(hook AllocHook) AllocHook
+	GC(what, data int) int
+	SetErrorFormatter(f ErrorFormatter) ErrorFormatter
+	AtPanic(f GoFunction) GoFunction
+	SetWarnF(f WarnFunction) WarnFunction
+	Warning(msg string, tocont bool)
 	/* basic stack manipulation */
 	GetTop() int
 	AbsIndex(idx int) int
@@ -37,6 +50,8 @@ type LuaState interface {
 	IsThread(idx int) bool
 	IsFunction(idx int) bool
 	IsGoFunction(idx int) bool
+	IsUserData(idx int) bool
+	IsLightUserData(idx int) bool
 	ToBoolean(idx int) bool
 	ToInteger(idx int) int64
 	ToIntegerX(idx int) (int64, bool)
@@ -45,6 +60,8 @@ type LuaState interface {
 	ToString(idx int) string
 	ToStringX(idx int) (string, bool)
 	ToGoFunction(idx int) GoFunction
+	ToUserData(idx int) interface{}
+	ToPointer(idx int) uintptr
 	RawLen(idx int) uint
 	/* push functions (Go -> stack) */
 	PushNil()
@@ -55,6 +72,7 @@ type LuaState interface {
 	PushGoFunction(f GoFunction)
 	PushGoClosure(f GoFunction, n int)
 	PushGlobalTable()
+	PushLightUserData(p interface{})
 	/* Comparison and arithmetic functions */
 	Arith(op ArithOp)
 	Compare(idx1, idx2 int, op CompareOp) bool
@@ -62,6 +80,8 @@ type LuaState interface {
 	/* get functions (Lua -> stack) */
 	NewTable()
 	CreateTable(nArr, nRec int)
+	NewUserData(v interface{})
+	NewUserDataUV(v interface{}, nUValue int)
 	GetTable(idx int) LuaType
 	GetField(idx int, k string) LuaType
 	GetI(idx int, i int64) LuaType
@@ -69,6 +89,7 @@ type LuaState interface {
 	RawGetI(idx int, i int64) LuaType
 	GetMetatable(idx int) bool
 	GetGlobal(name string) LuaType
+	GetIUserValue(idx, n int) LuaType
 	/* set functions (stack -> Lua) */
 	SetTable(idx int)
 	SetField(idx int, k string)
@@ -77,14 +98,60 @@ type LuaState interface {
 	RawSetI(idx int, i int64)
 	SetMetatable(idx int)
 	SetGlobal(name string)
+	SetIUserValue(idx, n int) bool
 	Register(name string, f GoFunction)
+	PreloadModule(name string, loader GoFunction)
+	Ref(idx int) int
+	Unref(idx, ref int)
 	/* 'load' and 'call' functions (load and run Lua code) */
 	Load(chunk []byte, chunkName, mode string) int
 	Call(nArgs, nResults int)
 	PCall(nArgs, nResults, msgh int) int
+	CallK(nArgs, nResults int, ctx KContext, k KFunction)
+	PCallK(nArgs, nResults, msgh int, ctx KContext, k KFunction) int
 	/* miscellaneous functions */
 	Len(idx int)
 	Concat(n int)
+	StringToNumber(s string) bool
 	Next(idx int) bool
 	Error() int
+	ToClose(idx int)
+	CloseSlot(idx int)
+	/* coroutine functions */
+	NewThread() LuaState
+	Resume(from LuaState, nArgs int) int
+	Yield(nResults int) int
+	YieldK(nResults int, ctx KContext, k KFunction) int
+	Status() int
+	IsYieldable() bool
+	ToThread(idx int) LuaState
+	PushThread() bool
+	XMove(to LuaState, n int)
+	CloseThread(from LuaState) int
+	/* persistence */
+	Persist(idx, permsIdx int) ([]byte, error)
+	Unpersist(data []byte, permsIdx int) error
+	/* interruption */
+	Interrupt(msg string)
+	ClearInterrupt()
+	/* debug */
+	Traceback(msg string, level int) string
+	ErrorTraceback() string
+	Where(level int)
+	GetStack(level int, ar *LuaDebug) bool
+	GetInfo(what string, ar *LuaDebug) bool
+	GetLocal(ar *LuaDebug, n int) (string, bool)
+	SetLocal(ar *LuaDebug, n int) (string, bool)
+	GetUpvalue(funcIdx, n int) (string, bool)
+	SetUpvalue(funcIdx, n int) (string, bool)
+	UpvalueId(funcIdx, n int) uintptr
+	UpvalueJoin(funcIdx1, n1, funcIdx2, n2 int)
+	SetHook(f LuaHook, mask, count int)
+	GetHook() LuaHook
+	GetHookMask() int
+	GetHookCount() int
+	ErrorMessage(idx int) string
+	/* hot code swap */
+	ReloadModule(name string) error
+	HotSwap(chunk []byte, chunkName, modName string) error
 }
@@ -0,0 +1,6 @@
+package api
+
+// WarnFunction receives the warnings of Lua code, see
+// LuaState.SetWarnF. A message may come in pieces: tocont is true for
+// all of them but the last.
+type WarnFunction func(msg string, tocont bool)
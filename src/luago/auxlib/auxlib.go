@@ -0,0 +1,366 @@
+package auxlib
+
+import (
+	"fmt"
+	. "luago/api"
+)
+
+/*
+辅助库：对应 lauxlib 的 luaL_* 函数，是写标准库和 Go 绑定用的积木。
+参数检查出错时和 Lua 一样报告 "bad argument #n to 'f' (...)"，函数名
+从调用信息里取（方法调用时参数序号减一，self 出错时报告 "calling 'f'
+on bad self"），取不到时到 package.loaded 里找；错误信息前面加上调用
+者的位置（见 LuaState.Where）。
+
+	func open(ls LuaState) int {
+		auxlib.NewLib(ls, map[string]GoFunction{"greet": greet})
+		return 1
+	}
+
+	func greet(ls LuaState) int {
+		name := auxlib.CheckString(ls, 1)
+		times := auxlib.OptInteger(ls, 2, 1)
+		...
+	}
+
+CheckUData 检查的是用 NewMetatable 在注册表里登记过的元表：
+
+	auxlib.NewMetatable(ls, "Conn")
+	...
+	ls.NewUserData(conn)
+	auxlib.SetMetatable(ls, "Conn")
+	...
+	conn := auxlib.CheckUData(ls, 1, "Conn").(*Conn)
+*/
+
+// Error raises an error built from format, with the position of the
+// calling Lua code prepended.
+// http://www.lua.org/manual/5.3/manual.html#luaL_error
+func Error(ls LuaState, format string, a ...interface{}) int {
+	ls.Where(1)
+	ls.PushString(fmt.Sprintf(format, a...))
+	ls.Concat(2)
+	return ls.Error()
+}
+
+// ArgError raises "bad argument #arg to 'f' (extramsg)" for the running
+// Go function.
+// http://www.lua.org/manual/5.3/manual.html#luaL_argerror
+func ArgError(ls LuaState, arg int, extramsg string) int {
+	var ar LuaDebug
+	if !ls.GetStack(0, &ar) { /* no stack frame? */
+		return Error(ls, "bad argument #%d (%s)", arg, extramsg)
+	}
+	ls.GetInfo("n", &ar)
+	if ar.NameWhat == "method" { /* do not count 'self' */
+		arg--
+		if arg == 0 { /* error is in the self argument itself? */
+			return Error(ls, "calling '%s' on bad self (%s)", ar.Name, extramsg)
+		}
+	}
+	if ar.Name == "" {
+		ar.Name = "?"
+		if name, found := globalFuncName(ls, &ar); found {
+			ar.Name = name
+		}
+	}
+	return Error(ls, "bad argument #%d to '%s' (%s)", arg, ar.Name, extramsg)
+}
+
+// searches package.loaded for the running function, to name it
+// "mod.f", or "f" for a global function
+func globalFuncName(ls LuaState, ar *LuaDebug) (string, bool) {
+	top := ls.GetTop()
+	defer ls.SetTop(top)
+	ls.GetInfo("f", ar) /* push function */
+	ls.GetField(LUA_REGISTRYINDEX, LUA_LOADED_TABLE)
+	if !ls.IsTable(-1) {
+		return "", false
+	}
+	ls.PushNil()
+	for ls.Next(-2) { /* for each module */
+		if ls.IsTable(-1) {
+			ls.PushNil()
+			for ls.Next(-2) { /* for each field */
+				if ls.RawEqual(top+1, -1) && ls.Type(-2) == LUA_TSTRING {
+					mod, field := ls.ToString(-4), ls.ToString(-2)
+					if mod == "_G" {
+						return field, true
+					}
+					return mod + "." + field, true
+				}
+				ls.Pop(1)
+			}
+		}
+		ls.Pop(1)
+	}
+	return "", false
+}
+
+// ArgCheck raises ArgError if cond is false.
+// http://www.lua.org/manual/5.3/manual.html#luaL_argcheck
+func ArgCheck(ls LuaState, cond bool, arg int, extramsg string) {
+	if !cond {
+		ArgError(ls, arg, extramsg)
+	}
+}
+
+// TypeError raises "tname expected, got <type>" for argument arg; the
+// type is the __name of its metatable when that is a string.
+// http://www.lua.org/manual/5.4/manual.html#luaL_typeerror
+func TypeError(ls LuaState, arg int, tname string) int {
+	var typeArg string
+	if GetMetafield(ls, arg, "__name") == LUA_TSTRING {
+		typeArg = ls.ToString(-1) /* use the given type name */
+	} else if ls.Type(arg) == LUA_TLIGHTUSERDATA {
+		typeArg = "light userdata" /* special name for messages */
+	} else {
+		typeArg = TypeName(ls, arg) /* standard name */
+	}
+	return ArgError(ls, arg, tname+" expected, got "+typeArg)
+}
+
+// TypeName returns the name of the type of the value at idx, "no
+// value" for a non-valid index.
+// http://www.lua.org/manual/5.3/manual.html#luaL_typename
+func TypeName(ls LuaState, idx int) string {
+	return ls.TypeName(ls.Type(idx))
+}
+
+func tagError(ls LuaState, arg int, tag LuaType) {
+	TypeError(ls, arg, ls.TypeName(tag))
+}
+
+// CheckAny raises an error if there is no argument arg.
+// http://www.lua.org/manual/5.3/manual.html#luaL_checkany
+func CheckAny(ls LuaState, arg int) {
+	if ls.IsNone(arg) {
+		ArgError(ls, arg, "value expected")
+	}
+}
+
+// CheckType raises an error if argument arg is not of type t.
+// http://www.lua.org/manual/5.3/manual.html#luaL_checktype
+func CheckType(ls LuaState, arg int, t LuaType) {
+	if ls.Type(arg) != t {
+		tagError(ls, arg, t)
+	}
+}
+
+// CheckString returns argument arg as a string; numbers are converted.
+// http://www.lua.org/manual/5.3/manual.html#luaL_checkstring
+func CheckString(ls LuaState, arg int) string {
+	s, ok := ls.ToStringX(arg)
+	if !ok {
+		tagError(ls, arg, LUA_TSTRING)
+	}
+	return s
+}
+
+// OptString is CheckString, with def for an absent or nil argument.
+// http://www.lua.org/manual/5.3/manual.html#luaL_optstring
+func OptString(ls LuaState, arg int, def string) string {
+	if ls.IsNoneOrNil(arg) {
+		return def
+	}
+	return CheckString(ls, arg)
+}
+
+// CheckNumber returns argument arg as a number; strings are converted.
+// http://www.lua.org/manual/5.3/manual.html#luaL_checknumber
+func CheckNumber(ls LuaState, arg int) float64 {
+	n, ok := ls.ToNumberX(arg)
+	if !ok {
+		tagError(ls, arg, LUA_TNUMBER)
+	}
+	return n
+}
+
+// OptNumber is CheckNumber, with def for an absent or nil argument.
+// http://www.lua.org/manual/5.3/manual.html#luaL_optnumber
+func OptNumber(ls LuaState, arg int, def float64) float64 {
+	if ls.IsNoneOrNil(arg) {
+		return def
+	}
+	return CheckNumber(ls, arg)
+}
+
+// CheckInteger returns argument arg as an integer; floats with an
+// exact integer value and strings are converted.
+// http://www.lua.org/manual/5.3/manual.html#luaL_checkinteger
+func CheckInteger(ls LuaState, arg int) int64 {
+	i, ok := ls.ToIntegerX(arg)
+	if !ok {
+		if ls.IsNumber(arg) {
+			ArgError(ls, arg, "number has no integer representation")
+		}
+		tagError(ls, arg, LUA_TNUMBER)
+	}
+	return i
+}
+
+// OptInteger is CheckInteger, with def for an absent or nil argument.
+// http://www.lua.org/manual/5.3/manual.html#luaL_optinteger
+func OptInteger(ls LuaState, arg int, def int64) int64 {
+	if ls.IsNoneOrNil(arg) {
+		return def
+	}
+	return CheckInteger(ls, arg)
+}
+
+// CheckOption returns the index in options of argument arg, a string
+// (def if it is absent or nil; an empty def makes it required), and
+// raises an error if it is not one.
+// http://www.lua.org/manual/5.3/manual.html#luaL_checkoption
+func CheckOption(ls LuaState, arg int, def string, options []string) int {
+	name := def
+	if def == "" || !ls.IsNoneOrNil(arg) {
+		name = CheckString(ls, arg)
+	}
+	for i, opt := range options {
+		if opt == name {
+			return i
+		}
+	}
+	return ArgError(ls, arg, fmt.Sprintf("invalid option '%s'", name))
+}
+
+// GetMetafield pushes field of the metatable of the value at obj and
+// returns its type; it pushes nothing and returns LUA_TNIL if there is
+// no metatable or no such field.
+// http://www.lua.org/manual/5.3/manual.html#luaL_getmetafield
+func GetMetafield(ls LuaState, obj int, field string) LuaType {
+	if !ls.GetMetatable(obj) { /* no metatable? */
+		return LUA_TNIL
+	}
+	ls.PushString(field)
+	tt := ls.RawGet(-2)
+	if tt == LUA_TNIL { /* is metafield nil? */
+		ls.Pop(2) /* remove metatable and metafield */
+	} else {
+		ls.Remove(-2) /* remove only metatable */
+	}
+	return tt
+}
+
+// NewMetatable creates the metatable of the userdata type tname in
+// the registry, with __name = tname, and pushes it; it returns false,
+// pushing the existing one, if the registry already has the key.
+// http://www.lua.org/manual/5.3/manual.html#luaL_newmetatable
+func NewMetatable(ls LuaState, tname string) bool {
+	if ls.GetField(LUA_REGISTRYINDEX, tname) != LUA_TNIL {
+		return false /* leave previous value on top, but return false */
+	}
+	ls.Pop(1)
+	ls.CreateTable(0, 2) /* create metatable */
+	ls.PushString(tname)
+	ls.SetField(-2, "__name") /* metatable.__name = tname */
+	ls.PushValue(-1)
+	ls.SetField(LUA_REGISTRYINDEX, tname) /* registry.name = metatable */
+	return true
+}
+
+// GetMetatable pushes the metatable of tname from the registry.
+// http://www.lua.org/manual/5.3/manual.html#luaL_getmetatable
+func GetMetatable(ls LuaState, tname string) LuaType {
+	return ls.GetField(LUA_REGISTRYINDEX, tname)
+}
+
+// SetMetatable sets the metatable of tname to the value on top.
+// http://www.lua.org/manual/5.3/manual.html#luaL_setmetatable
+func SetMetatable(ls LuaState, tname string) {
+	GetMetatable(ls, tname)
+	ls.SetMetatable(-2)
+}
+
+// TestUData returns the Go value of the userdata at arg if its
+// metatable is the one of tname, nil otherwise.
+// http://www.lua.org/manual/5.3/manual.html#luaL_testudata
+func TestUData(ls LuaState, arg int, tname string) interface{} {
+	if !ls.IsUserData(arg) || !ls.GetMetatable(arg) {
+		return nil
+	}
+	GetMetatable(ls, tname)
+	same := ls.RawEqual(-1, -2)
+	ls.Pop(2)
+	if !same {
+		return nil
+	}
+	return ls.ToUserData(arg)
+}
+
+// CheckUData is TestUData raising a type error instead of returning
+// nil.
+// http://www.lua.org/manual/5.3/manual.html#luaL_checkudata
+func CheckUData(ls LuaState, arg int, tname string) interface{} {
+	if !ls.IsUserData(arg) || !ls.GetMetatable(arg) {
+		TypeError(ls, arg, tname)
+	}
+	GetMetatable(ls, tname)
+	same := ls.RawEqual(-1, -2)
+	ls.Pop(2)
+	if !same {
+		TypeError(ls, arg, tname)
+	}
+	return ls.ToUserData(arg)
+}
+
+// SetFuncs sets the functions of funcs into the table on top, below
+// nup upvalues that all of them share, and pops the upvalues. A nil
+// function sets the field to false, as a placeholder.
+// http://www.lua.org/manual/5.3/manual.html#luaL_setfuncs
+func SetFuncs(ls LuaState, funcs map[string]GoFunction, nup int) {
+	ls.CheckStack(nup)
+	for name, f := range funcs {
+		if f == nil {
+			ls.PushBoolean(false)
+		} else {
+			for i := 0; i < nup; i++ { /* copy upvalues to the top */
+				ls.PushValue(-nup)
+			}
+			ls.PushGoClosure(f, nup) /* closure with those upvalues */
+		}
+		ls.SetField(-(nup + 2), name)
+	}
+	ls.Pop(nup) /* remove upvalues */
+}
+
+// NewLib creates a table with the functions of funcs and pushes it.
+// http://www.lua.org/manual/5.3/manual.html#luaL_newlib
+func NewLib(ls LuaState, funcs map[string]GoFunction) {
+	ls.CreateTable(0, len(funcs))
+	SetFuncs(ls, funcs, 0)
+}
+
+// ToLString converts the value at idx to a string like tostring does,
+// following __tostring and __name, and pushes it.
+// http://www.lua.org/manual/5.3/manual.html#luaL_tolstring
+func ToLString(ls LuaState, idx int) string {
+	idx = ls.AbsIndex(idx)
+	if GetMetafield(ls, idx, "__tostring") != LUA_TNIL { /* metafield? */
+		ls.PushValue(idx)
+		ls.Call(1, 1)
+		if !ls.IsString(-1) {
+			Error(ls, "'__tostring' must return a string")
+		}
+		return ls.ToString(-1)
+	}
+	switch ls.Type(idx) {
+	case LUA_TNUMBER, LUA_TSTRING:
+		ls.PushValue(idx) /* ToString converts numbers in place */
+	case LUA_TBOOLEAN:
+		ls.PushString(fmt.Sprintf("%t", ls.ToBoolean(idx)))
+	case LUA_TNIL:
+		ls.PushString("nil")
+	default:
+		kind := TypeName(ls, idx)
+		if tt := GetMetafield(ls, idx, "__name"); tt == LUA_TSTRING {
+			kind = ls.ToString(-1) /* use the name as the kind */
+			ls.Pop(1)
+		} else if tt != LUA_TNIL {
+			ls.Pop(1) /* remove a __name that is not a string */
+		}
+		ls.PushString(fmt.Sprintf("%s: 0x%x", kind, ls.ToPointer(idx)))
+	}
+	return ls.ToString(-1)
+}
@@ -0,0 +1,68 @@
+package auxlib
+
+import (
+	. "luago/api"
+	"strings"
+)
+
+/*
+字符串缓冲区：对应 luaL_Buffer。拼接长字符串时先在 Go 这边攒起来，最后
+一次压栈，不用在栈上反复 Concat（每次都复制前面已经拼好的部分）。
+Buffer 实现了 io.Writer，可以直接交给 fmt.Fprintf。
+
+	var b auxlib.Buffer
+	b.Init(ls)
+	for i := int64(1); i <= n; i++ {
+		ls.GetI(1, i)
+		b.AddValue()
+	}
+	b.PushResult()
+*/
+
+type Buffer struct {
+	ls LuaState
+	sb strings.Builder
+}
+
+// Init prepares the buffer for use with ls, discarding its contents.
+// http://www.lua.org/manual/5.3/manual.html#luaL_buffinit
+func (self *Buffer) Init(ls LuaState) {
+	self.ls = ls
+	self.sb.Reset()
+}
+
+// AddChar adds the byte c to the buffer.
+// http://www.lua.org/manual/5.3/manual.html#luaL_addchar
+func (self *Buffer) AddChar(c byte) {
+	self.sb.WriteByte(c)
+}
+
+// AddString adds s to the buffer.
+// http://www.lua.org/manual/5.3/manual.html#luaL_addlstring
+func (self *Buffer) AddString(s string) {
+	self.sb.WriteString(s)
+}
+
+// AddValue adds the value on top of the stack, a string or a number,
+// to the buffer and pops it.
+// http://www.lua.org/manual/5.3/manual.html#luaL_addvalue
+func (self *Buffer) AddValue() {
+	self.sb.WriteString(self.ls.ToString(-1))
+	self.ls.Pop(1)
+}
+
+// Write adds p to the buffer, for fmt.Fprintf and io.Copy.
+func (self *Buffer) Write(p []byte) (int, error) {
+	return self.sb.Write(p)
+}
+
+// Len returns the number of bytes in the buffer.
+func (self *Buffer) Len() int {
+	return self.sb.Len()
+}
+
+// PushResult pushes the contents of the buffer as a string.
+// http://www.lua.org/manual/5.3/manual.html#luaL_pushresult
+func (self *Buffer) PushResult() {
+	self.ls.PushString(self.sb.String())
+}
@@ -0,0 +1,142 @@
+package auxlib
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	. "luago/api"
+	"luago/vfs"
+	"os"
+	"strings"
+)
+
+/*
+加载和执行：Load 和 PCall 出错时不 panic，而是返回状态码并把错误值压栈，
+这里的 LoadString、LoadFile 也是这样。DoString、DoFile 把加载和保护调用
+合在一起，出错时弹出错误值，返回 *LuaError，适合 Go 代码直接用：
+
+	if err := auxlib.DoString(ls, `print("hi")`); err != nil {
+		if e := err.(*auxlib.LuaError); e.Status == LUA_ERRSYNTAX {
+			...
+		}
+	}
+
+成功时和 luaL_dostring 一样，chunk 的返回值留在栈上。
+*/
+
+// LuaError is a failed load or call: its status and the error value
+// as a string.
+type LuaError struct {
+	Status  int
+	Message string
+}
+
+func (self *LuaError) Error() string {
+	return self.Message
+}
+
+// pops the error value of a failed load or call
+func popError(ls LuaState, status int) error {
+	msg, ok := ls.ToStringX(-1)
+	if !ok {
+		msg = fmt.Sprintf("(error object is a %s value)", TypeName(ls, -1))
+	}
+	ls.Pop(1)
+	return &LuaError{status, msg}
+}
+
+// LoadString loads the chunk s, named after itself, without running it.
+// http://www.lua.org/manual/5.3/manual.html#luaL_loadstring
+func LoadString(ls LuaState, s string) int {
+	return ls.Load([]byte(s), stringChunkName(s), "bt")
+}
+
+// the name of a chunk loaded from s, like luaO_chunkid: the first
+// line of s, shortened to fit in LUA_IDSIZE
+func stringChunkName(s string) string {
+	const LUA_IDSIZE = 60
+	const PRE, RETS, POS = "[string \"", "...", "\"]"
+	bufflen := LUA_IDSIZE - len(PRE+RETS+POS) - 1 /* save space for prefix+suffix+'\0' */
+	nl := strings.IndexByte(s, '\n')
+	if len(s) < bufflen && nl < 0 { /* small one-line source? */
+		return PRE + s + POS /* keep it */
+	}
+	if nl >= 0 {
+		s = s[:nl] /* stop at first newline */
+	}
+	if len(s) > bufflen {
+		s = s[:bufflen]
+	}
+	return PRE + s + RETS + POS
+}
+
+// LoadFile loads the file filename, or the standard input if it is "",
+// without running it; a first line starting with '#' is skipped.
+// http://www.lua.org/manual/5.3/manual.html#luaL_loadfile
+func LoadFile(ls LuaState, filename string) int {
+	return LoadFileX(ls, filename, "bt")
+}
+
+// LoadFileX is LoadFile with the mode of Load ("b", "t" or "bt").
+// http://www.lua.org/manual/5.3/manual.html#luaL_loadfilex
+func LoadFileX(ls LuaState, filename, mode string) int {
+	var chunk []byte
+	var err error
+	name, chunkName := filename, filename
+	if filename == "" {
+		name, chunkName = "stdin", "=stdin"
+		chunk, err = ioutil.ReadAll(os.Stdin)
+	} else {
+		chunk, err = vfs.ReadFile(filename)
+	}
+	if err != nil {
+		what := "open"
+		if filename != "" && vfs.Exists(filename) {
+			what = "read"
+		}
+		if e, ok := err.(*os.PathError); ok { /* like strerror, without "op path:" */
+			err = e.Err
+		}
+		msg := err.Error()
+		if msg != "" {
+			msg = strings.ToUpper(msg[:1]) + msg[1:]
+		}
+		ls.PushString(fmt.Sprintf("cannot %s %s: %s", what, name, msg))
+		return LUA_ERRFILE
+	}
+	if len(chunk) > 0 && chunk[0] == '#' { /* first line is a comment (Unix exec. file)? */
+		if nl := bytes.IndexByte(chunk, '\n'); nl >= 0 {
+			chunk = chunk[nl:] /* keep the newline to preserve line numbers */
+		} else {
+			chunk = nil
+		}
+	}
+	return ls.Load(chunk, chunkName, mode)
+}
+
+// DoString loads and runs the chunk s in protected mode, leaving its
+// results on the stack.
+// http://www.lua.org/manual/5.3/manual.html#luaL_dostring
+func DoString(ls LuaState, s string) error {
+	if status := LoadString(ls, s); status != LUA_OK {
+		return popError(ls, status)
+	}
+	return doCall(ls)
+}
+
+// DoFile loads and runs the file filename in protected mode, leaving
+// its results on the stack.
+// http://www.lua.org/manual/5.3/manual.html#luaL_dofile
+func DoFile(ls LuaState, filename string) error {
+	if status := LoadFile(ls, filename); status != LUA_OK {
+		return popError(ls, status)
+	}
+	return doCall(ls)
+}
+
+func doCall(ls LuaState) error {
+	if status := ls.PCall(0, LUA_MULTRET, 0); status != LUA_OK {
+		return popError(ls, status)
+	}
+	return nil
+}
@@ -0,0 +1,35 @@
+package auxlib
+
+import (
+	"io"
+	. "luago/api"
+)
+
+// NewWarnF returns the warning function of the standalone lua, which
+// writes "Lua warning: <msg>" lines to w. Warnings start off; the
+// control messages "@on" and "@off" turn them on and off.
+// http://www.lua.org/manual/5.4/manual.html#luaL_newstate
+func NewWarnF(w io.Writer) WarnFunction {
+	on, cont := false, false
+	return func(msg string, tocont bool) {
+		if !cont && !tocont && len(msg) > 0 && msg[0] == '@' { /* control message? */
+			switch msg {
+			case "@off":
+				on = false
+			case "@on":
+				on = true
+			} /* other control messages are ignored */
+			return
+		}
+		if !on {
+			return
+		}
+		if !cont { /* first piece of a message? */
+			io.WriteString(w, "Lua warning: ")
+		}
+		io.WriteString(w, msg)
+		if cont = tocont; !cont { /* last piece? */
+			io.WriteString(w, "\n")
+		}
+	}
+}
@@ -23,6 +23,9 @@ const (
 	TAG_LONG_STR  = 0x14
 )
 
+// longer string constants are dumped with TAG_LONG_STR
+const LUAI_MAXSHORTLEN = 40
+
 type binaryChunk struct {
 	header
 	sizeUpvalues byte // ?
@@ -56,6 +59,7 @@ type Prototype struct {
 	Upvalues        []Upvalue     // Upvalue列表
 	Protos          []*Prototype  // 子函数原型
 	LineInfo        []uint32      // 行号表
+	ColumnInfo      []uint32      // 列号表（不写入二进制chunk，Undump后为空）
 	LocVars         []LocVar      // 局部变量表
 	UpvalueNames    []string      // Upvalue名列表
 }
@@ -76,9 +80,43 @@ func IsBinaryChunk(data []byte) bool {
 		string(data[:4]) == LUA_SIGNATURE
 }
 
-func Undump(data []byte) *Prototype {
+// LoadError reports a binary chunk that is malformed or was produced for
+// a different platform
+type LoadError struct {
+	Chunk string
+	Msg   string
+}
+
+func (self *LoadError) Error() string {
+	return self.Chunk + ": " + self.Msg + " precompiled chunk"
+}
+
+// Load decodes and verifies a binary chunk, bad data never panics
+func Load(data []byte, chunkName string) (proto *Prototype, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			e, ok := r.(*LoadError)
+			if !ok {
+				panic(r)
+			}
+			e.Chunk = chunkName
+			proto, err = nil, e
+		}
+	}()
+
 	reader := &reader{data}
 	reader.checkHeader()
 	reader.readByte() // size_upvalues
-	return reader.readProto("")
+	proto = reader.readProto("")
+	verify(proto, nil)
+	return proto, nil
+}
+
+// Undump is Load with errors raised as panics
+func Undump(data []byte) *Prototype {
+	proto, err := Load(data, "?")
+	if err != nil {
+		panic(err.Error())
+	}
+	return proto
 }
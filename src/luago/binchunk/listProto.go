@@ -3,6 +3,7 @@ package binchunk
 import (
 	"fmt"
 	. "luago/vm"
+	"strings"
 )
 
 func ListProto(f *Prototype) {
@@ -43,48 +44,60 @@ func printCode(f *Prototype) {
 		}
 
 		i := Instruction(c)
-		fmt.Printf("\t%d\t[%s]\t%s \t", pc+1, line, i.OpName())
-		printOperands(i)
-		fmt.Printf("\n")
+		fmt.Printf("\t%d\t[%s]\t%s \t%s\n", pc+1, line, i.OpName(), operandsToString(i))
 	}
 }
 
-func printOperands(i Instruction) {
+// FormatInstruction disassembles one instruction the way luac -l does
+func FormatInstruction(c uint32) string {
+	i := Instruction(c)
+	return strings.TrimSpace(i.OpName()) + " " + operandsToString(i)
+}
+
+// FormatConstant renders a constant the way luac -l does
+func FormatConstant(k interface{}) string {
+	return constantToString(k)
+}
+
+func operandsToString(i Instruction) string {
 	switch i.OpMode() {
 	case IABC:
 		a, b, c := i.ABC()
 
-		fmt.Printf("%d", a)
+		s := fmt.Sprintf("%d", a)
 		if i.BMode() != OpArgN {
 			if b > 0xFF {
-				fmt.Printf(" %d", -1-b&0xFF)
+				s += fmt.Sprintf(" %d", -1-b&0xFF)
 			} else {
-				fmt.Printf(" %d", b)
+				s += fmt.Sprintf(" %d", b)
 			}
 		}
 		if i.CMode() != OpArgN {
 			if c > 0xFF {
-				fmt.Printf(" %d", -1-c&0xFF)
+				s += fmt.Sprintf(" %d", -1-c&0xFF)
 			} else {
-				fmt.Printf(" %d", c)
+				s += fmt.Sprintf(" %d", c)
 			}
 		}
+		return s
 	case IABx:
 		a, bx := i.ABx()
 
-		fmt.Printf("%d", a)
+		s := fmt.Sprintf("%d", a)
 		if i.BMode() == OpArgK {
-			fmt.Printf(" %d", -1-bx)
+			s += fmt.Sprintf(" %d", -1-bx)
 		} else if i.BMode() == OpArgU {
-			fmt.Printf(" %d", bx)
+			s += fmt.Sprintf(" %d", bx)
 		}
+		return s
 	case IAsBx:
 		a, sbx := i.AsBx()
-		fmt.Printf("%d %d", a, sbx)
+		return fmt.Sprintf("%d %d", a, sbx)
 	case IAx:
 		ax := i.Ax()
-		fmt.Printf("%d", -1-ax)
+		return fmt.Sprintf("%d", -1-ax)
 	}
+	return ""
 }
 
 func printDetail(f *Prototype) {
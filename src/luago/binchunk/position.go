@@ -0,0 +1,42 @@
+package binchunk
+
+// 指令在（嵌套）函数原型中的位置
+type CodeLocation struct {
+	Proto *Prototype
+	PC    int
+}
+
+// SourcePosition maps a program counter of this prototype back to the
+// source file, line and column it was generated from. line is 0 when
+// the chunk carries no line information (e.g. it was stripped), col is
+// 0 when column information is unavailable, which is always the case
+// for undumped chunks since the binary format has no column table.
+func (self *Prototype) SourcePosition(pc int) (file string, line, col int) {
+	file = self.Source
+	if pc < 0 || pc >= len(self.Code) {
+		return
+	}
+	if pc < len(self.LineInfo) {
+		line = int(self.LineInfo[pc])
+	}
+	if pc < len(self.ColumnInfo) {
+		col = int(self.ColumnInfo[pc])
+	}
+	return
+}
+
+// LocateLine is the reverse of SourcePosition: it returns every
+// instruction of this prototype and its sub functions that was
+// generated from the given source line, in prototype order.
+func (self *Prototype) LocateLine(line int) []CodeLocation {
+	var locs []CodeLocation
+	for pc, l := range self.LineInfo {
+		if int(l) == line {
+			locs = append(locs, CodeLocation{self, pc})
+		}
+	}
+	for _, subProto := range self.Protos {
+		locs = append(locs, subProto.LocateLine(line)...)
+	}
+	return locs
+}
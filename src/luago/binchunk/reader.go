@@ -5,34 +5,70 @@ import (
 	"math"
 )
 
+/*
+读取时检查剩余长度，数据有误时以 *LoadError panic，由 Load 恢复。
+数组长度先和剩余字节数比较再分配，损坏的长度字段不会导致巨大的分配。
+*/
 type reader struct {
 	data []byte
 }
 
+// error aborts reading with a message in the style of luac
+func (self *reader) error(why string) {
+	panic(&LoadError{Msg: why})
+}
+
+func (self *reader) need(n uint) {
+	if uint(len(self.data)) < n {
+		self.error("truncated")
+	}
+}
+
 func (self *reader) readByte() byte {
+	self.need(1)
 	b := self.data[0]
 	self.data = self.data[1:]
 	return b
 }
 
 func (self *reader) readBytes(n uint) []byte {
+	self.need(n)
 	bytes := self.data[:n]
 	self.data = self.data[n:]
 	return bytes
 }
 
 func (self *reader) readUint32() uint32 {
+	self.need(4)
 	i := binary.LittleEndian.Uint32(self.data)
 	self.data = self.data[4:]
 	return i
 }
 
 func (self *reader) readUint64() uint64 {
+	self.need(8)
 	i := binary.LittleEndian.Uint64(self.data)
 	self.data = self.data[8:]
 	return i
 }
 
+// readCount reads the length of an array whose elements take at least
+// minSize bytes each
+func (self *reader) readCount(minSize uint) int {
+	n := uint(self.readUint32())
+	if n > uint(len(self.data))/minSize {
+		self.truncatedOrCorrupted(n * minSize)
+	}
+	return int(n)
+}
+
+func (self *reader) truncatedOrCorrupted(size uint) {
+	if size > 1<<30 {
+		self.error("corrupted")
+	}
+	self.error("truncated")
+}
+
 func (self *reader) readLuaInteger() int64 {
 	return int64(self.readUint64())
 }
@@ -47,7 +83,11 @@ func (self *reader) readString() string {
 		return ""
 	}
 	if size == 0xFF {
-		size = uint(self.readUint64()) // size_t
+		size64 := self.readUint64() // size_t
+		if size64 == 0 || size64-1 > uint64(len(self.data)) {
+			self.truncatedOrCorrupted(uint(size64))
+		}
+		size = uint(size64)
 	}
 	bytes := self.readBytes(size - 1)
 	return string(bytes) // todo
@@ -55,37 +95,37 @@ func (self *reader) readString() string {
 
 func (self *reader) checkHeader() {
 	if string(self.readBytes(4)) != LUA_SIGNATURE {
-		panic("not a precompiled chunk!")
+		self.error("not a")
 	}
 	if self.readByte() != LUAC_VERSION {
-		panic("version mismatch!")
+		self.error("version mismatch in")
 	}
 	if self.readByte() != LUAC_FORMAT {
-		panic("format mismatch!")
+		self.error("format mismatch in")
 	}
 	if string(self.readBytes(6)) != LUAC_DATA {
-		panic("corrupted!")
+		self.error("corrupted")
 	}
 	if self.readByte() != CINT_SIZE {
-		panic("int size mismatch!")
+		self.error("int size mismatch in")
 	}
 	if self.readByte() != CSIZET_SIZE {
-		panic("size_t size mismatch!")
+		self.error("size_t size mismatch in")
 	}
 	if self.readByte() != INSTRUCTION_SIZE {
-		panic("instruction size mismatch!")
+		self.error("Instruction size mismatch in")
 	}
 	if self.readByte() != LUA_INTEGER_SIZE {
-		panic("lua_Integer size mismatch!")
+		self.error("lua_Integer size mismatch in")
 	}
 	if self.readByte() != LUA_NUMBER_SIZE {
-		panic("lua_Number size mismatch!")
+		self.error("lua_Number size mismatch in")
 	}
 	if self.readLuaInteger() != LUAC_INT {
-		panic("endianness mismatch!")
+		self.error("endianness mismatch in")
 	}
 	if self.readLuaNumber() != LUAC_NUM {
-		panic("float format mismatch!")
+		self.error("float format mismatch in")
 	}
 }
 
@@ -112,7 +152,7 @@ func (self *reader) readProto(parentSource string) *Prototype {
 }
 
 func (self *reader) readCode() []uint32 {
-	code := make([]uint32, self.readUint32())
+	code := make([]uint32, self.readCount(4))
 	for i := range code {
 		code[i] = self.readUint32()
 	}
@@ -120,7 +160,7 @@ func (self *reader) readCode() []uint32 {
 }
 
 func (self *reader) readConstants() []interface{} {
-	constants := make([]interface{}, self.readUint32())
+	constants := make([]interface{}, self.readCount(1))
 	for i := range constants {
 		constants[i] = self.readConstant()
 	}
@@ -140,12 +180,13 @@ func (self *reader) readConstant() interface{} {
 	case TAG_SHORT_STR, TAG_LONG_STR:
 		return self.readString()
 	default:
-		panic("corrupted!") // todo
+		self.error("corrupted")
+		return nil
 	}
 }
 
 func (self *reader) readUpvalues() []Upvalue {
-	upvalues := make([]Upvalue, self.readUint32())
+	upvalues := make([]Upvalue, self.readCount(2))
 	for i := range upvalues {
 		upvalues[i] = Upvalue{
 			Instack: self.readByte(),
@@ -156,7 +197,7 @@ func (self *reader) readUpvalues() []Upvalue {
 }
 
 func (self *reader) readProtos(parentSource string) []*Prototype {
-	protos := make([]*Prototype, self.readUint32())
+	protos := make([]*Prototype, self.readCount(1))
 	for i := range protos {
 		protos[i] = self.readProto(parentSource)
 	}
@@ -164,7 +205,7 @@ func (self *reader) readProtos(parentSource string) []*Prototype {
 }
 
 func (self *reader) readLineInfo() []uint32 {
-	lineInfo := make([]uint32, self.readUint32())
+	lineInfo := make([]uint32, self.readCount(4))
 	for i := range lineInfo {
 		lineInfo[i] = self.readUint32()
 	}
@@ -172,7 +213,7 @@ func (self *reader) readLineInfo() []uint32 {
 }
 
 func (self *reader) readLocVars() []LocVar {
-	locVars := make([]LocVar, self.readUint32())
+	locVars := make([]LocVar, self.readCount(9))
 	for i := range locVars {
 		locVars[i] = LocVar{
 			VarName: self.readString(),
@@ -184,7 +225,7 @@ func (self *reader) readLocVars() []LocVar {
 }
 
 func (self *reader) readUpvalueNames() []string {
-	names := make([]string, self.readUint32())
+	names := make([]string, self.readCount(1))
 	for i := range names {
 		names[i] = self.readString()
 	}
@@ -0,0 +1,109 @@
+package binchunk
+
+import (
+	"fmt"
+	. "luago/vm"
+)
+
+/*
+加载时检查原型的结构，保证虚拟机执行时的下标都在范围内：
+操作码合法（扩展操作码要已注册），常量、子函数、upvalue 的索引不越界，跳转目标在代码内，
+函数以 RETURN 结束。寄存器不检查，越界时栈会报错。
+*/
+func verify(proto, parent *Prototype) {
+	v := verifier{proto}
+	if len(proto.Code) == 0 || Instruction(proto.Code[len(proto.Code)-1]).Opcode() != OP_RETURN {
+		v.error(len(proto.Code)-1, "missing return")
+	}
+	if len(proto.LineInfo) != 0 && len(proto.LineInfo) != len(proto.Code) {
+		v.error(-1, "bad line info")
+	}
+	if parent != nil {
+		for _, uv := range proto.Upvalues {
+			if uv.Instack == 1 && uv.Idx >= parent.MaxStackSize ||
+				uv.Instack != 1 && int(uv.Idx) >= len(parent.Upvalues) {
+				v.error(-1, "bad upvalue")
+			}
+		}
+	}
+	for pc := range proto.Code {
+		v.checkInstruction(pc)
+	}
+	for _, p := range proto.Protos {
+		verify(p, proto)
+	}
+}
+
+type verifier struct {
+	proto *Prototype
+}
+
+func (self verifier) error(pc int, why string) {
+	where := fmt.Sprintf("function at line %d", self.proto.LineDefined)
+	if self.proto.LineDefined == 0 {
+		where = "main function"
+	}
+	if pc >= 0 {
+		where += fmt.Sprintf(", pc %d", pc+1)
+	}
+	panic(&LoadError{Msg: why + " (" + where + ") in"})
+}
+
+func (self verifier) checkInstruction(pc int) {
+	p := self.proto
+	i := Instruction(p.Code[pc])
+	op := i.Opcode()
+	if op > OP_TBC && !IsExtOp(op) {
+		self.error(pc, fmt.Sprintf("unknown opcode %d", op))
+	}
+
+	switch i.OpMode() {
+	case IABC:
+		_, b, c := i.ABC()
+		if i.BMode() == OpArgK && b > 0xFF && b&0xFF >= len(p.Constants) ||
+			i.CMode() == OpArgK && c > 0xFF && c&0xFF >= len(p.Constants) {
+			self.error(pc, "bad constant index")
+		}
+	case IAsBx:
+		if _, sbx := i.AsBx(); pc+1+sbx < 0 || pc+1+sbx >= len(p.Code) {
+			self.error(pc, "bad jump")
+		}
+	}
+
+	switch op {
+	case OP_LOADK:
+		if _, bx := i.ABx(); bx >= len(p.Constants) {
+			self.error(pc, "bad constant index")
+		}
+	case OP_LOADKX:
+		if ax, ok := self.extraArg(pc); !ok || ax >= len(p.Constants) {
+			self.error(pc, "bad constant index")
+		}
+	case OP_SETLIST:
+		if _, _, c := i.ABC(); c == 0 {
+			if _, ok := self.extraArg(pc); !ok {
+				self.error(pc, "missing extra argument")
+			}
+		}
+	case OP_GETUPVAL, OP_SETUPVAL, OP_GETTABUP:
+		if _, b, _ := i.ABC(); b >= len(p.Upvalues) {
+			self.error(pc, "bad upvalue index")
+		}
+	case OP_SETTABUP:
+		if a, _, _ := i.ABC(); a >= len(p.Upvalues) {
+			self.error(pc, "bad upvalue index")
+		}
+	case OP_CLOSURE:
+		if _, bx := i.ABx(); bx >= len(p.Protos) {
+			self.error(pc, "bad function index")
+		}
+	}
+}
+
+func (self verifier) extraArg(pc int) (int, bool) {
+	if pc+1 >= len(self.proto.Code) {
+		return 0, false
+	}
+	next := Instruction(self.proto.Code[pc+1])
+	return next.Ax(), next.Opcode() == OP_EXTRAARG
+}
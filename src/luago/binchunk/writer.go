@@ -4,8 +4,7 @@ import (
 	"bytes"
 	"encoding/binary"
 	"io"
-	"log"
-	"os"
+	"luago/vfs"
 )
 
 
@@ -29,23 +28,26 @@ func (d *dumpState) writeUint32(i uint32) {
 	d.write(i)
 }
 
+// like luac's DumpString of a non-NULL string: the size counts a
+// trailing '\0' that is not written
 func (d *dumpState) writeString(s string) {
-	s_byte := []byte(s)
-	size := len(s)
-	if size == 0 { // null str
+	size := len(s) + 1
+	if size < 0xFF { // short str
 		d.write(uint8(size))
-		//	d.writeByte(0)
-	} else if size <= 0xFD { //short str
-		size++
-		d.write(uint8(size))
-		d.write(s_byte)
-		//d.writeByte(0)
 	} else { // long str
-		size++
 		d.write(uint8(0xFF))
 		d.write(uint64(size))
-		d.write(s_byte)
-		//d.writeByte(0)
+	}
+	d.write([]byte(s))
+}
+
+// luac writes a NULL string (size 0) for the source of a function
+// that has the source of its parent, and for stripped chunks
+func (d *dumpState) writeSource(source, parentSource string) {
+	if source == "" || source == parentSource {
+		d.writeByte(0)
+	} else {
+		d.writeString(source)
 	}
 }
 
@@ -95,7 +97,7 @@ func (d *dumpState) writeConstants(p *Prototype) {
 			}
 		case string:
 			{
-				if len(o) <= 0xFD {
+				if len(o) <= LUAI_MAXSHORTLEN {
 					d.write(uint8(TAG_SHORT_STR))
 				} else {
 					d.write(uint8(TAG_LONG_STR))
@@ -121,7 +123,7 @@ func (d *dumpState) writePrototypes(p *Prototype) {
 	d.writeUint32(uint32(len(p.Protos)))
 
 	for _, o := range p.Protos {
-		d.dumpFunction(o)
+		d.dumpFunction(o, p.Source)
 	}
 }
 
@@ -150,8 +152,8 @@ func (d *dumpState) writeUpvalueNames(p *Prototype) {
 	}
 }
 
-func (d *dumpState) dumpFunction(p *Prototype) {
-	d.writeString(p.Source)
+func (d *dumpState) dumpFunction(p *Prototype, parentSource string) {
+	d.writeSource(p.Source, parentSource)
 	d.writeUint32(p.LineDefined)
 	d.writeUint32(p.LastLineDefined)
 	d.writeByte(p.NumParams)
@@ -166,9 +168,9 @@ func (d *dumpState) dumpFunction(p *Prototype) {
 	d.writeUpvalueNames(p)
 }
 
-// 主函数 upvalues数量是1 ：_ENV变量
-func (d *dumpState) dumpSizeUpvalues() {
-	d.err = binary.Write(d.out, d.order, uint8(0))
+// 主函数的 upvalue 数量（通常是 1：_ENV），luac 写在头部之后
+func (d *dumpState) dumpSizeUpvalues(p *Prototype) {
+	d.writeByte(byte(len(p.Upvalues)))
 }
 
 func (d *dumpState) dumpHeader() {
@@ -189,29 +191,25 @@ func (d *dumpState) dumpHeader() {
 }
 
 func Dump(p *Prototype) error {
+	data, err := DumpBytes(p)
+	if err != nil {
+		return err
+	}
+	return writeToFile(*bytes.NewBuffer(data))
+}
+
+// DumpBytes 把原型编码为二进制chunk，格式与 luac 5.3 相同，可以用Undump还原
+func DumpBytes(p *Prototype) ([]byte, error) {
 	var buffer bytes.Buffer
 	d := dumpState{out: &buffer, order: binary.LittleEndian}
 
 	d.dumpHeader()
-	d.dumpSizeUpvalues()
-	d.dumpFunction(p)
-	d.err = writeToFile(buffer)
-	return d.err
+	d.dumpSizeUpvalues(p)
+	d.dumpFunction(p, "")
+	return buffer.Bytes(), d.err
 }
 
 func writeToFile(buffer bytes.Buffer) error {
 	fileName := "my_luac.out"
-	file, err := os.Create(fileName)
-	if err != nil {
-		log.Fatal("Error while opening file", err)
-		return err
-	}
-	defer file.Close()
-
-	_, err = file.Write(buffer.Bytes())
-	if err != nil {
-		log.Fatal("Error while writing file", err)
-		return err
-	}
-	return nil
+	return vfs.WriteFile(fileName, buffer.Bytes())
 }
@@ -0,0 +1,28 @@
+package main
+
+import (
+	. "luago/api"
+	"luago/auxlib"
+	"luago/sandbox"
+	"luago/state"
+	"luago/stdlib"
+	"os"
+)
+
+// newState creates a state with the standard libraries opened.
+// LUAGO_BACKEND=ast runs text chunks with the experimental syntax tree
+// evaluator instead of the VM, to compare the two; LUAGO_SANDBOX=1 locks the
+// sandbox down for untrusted scripts.
+func newState() LuaState {
+	var opts []state.Option
+	if os.Getenv("LUAGO_BACKEND") == "ast" {
+		opts = append(opts, state.WithBackend(state.ASTEval))
+	}
+	if os.Getenv("LUAGO_SANDBOX") != "" {
+		sandbox.Lockdown()
+	}
+	ls := state.New(opts...)
+	ls.SetWarnF(auxlib.NewWarnF(os.Stderr)) /* off until warn("@on") */
+	stdlib.OpenLibs(ls)
+	return ls
+}
@@ -35,22 +35,25 @@ type StringExp struct {
 
 // unop exp
 type UnopExp struct {
-	Line int // line of operator
-	Op   int // operator
-	Exp  Exp
+	Line   int // line of operator
+	Column int // column of operator
+	Op     int // operator
+	Exp    Exp
 }
 
 // exp1 op exp2
 type BinopExp struct {
-	Line int // line of operator
-	Op   int // operator
-	Exp1 Exp
-	Exp2 Exp
+	Line   int // line of operator
+	Column int // column of operator
+	Op     int // operator
+	Exp1   Exp
+	Exp2   Exp
 }
 
 type ConcatExp struct {
-	Line int // line of last ..
-	Exps []Exp
+	Line   int // line of last ..
+	Column int // column of last ..
+	Exps   []Exp
 }
 
 // tableconstructor ::= ‘{’ [fieldlist] ‘}’
@@ -86,8 +89,9 @@ prefixexp ::= Name |
 */
 
 type NameExp struct {
-	Line int
-	Name string
+	Line   int
+	Column int
+	Name   string
 }
 
 type ParensExp struct {
@@ -96,6 +100,7 @@ type ParensExp struct {
 
 type TableAccessExp struct {
 	LastLine  int // line of `]` ?
+	Column    int // column of `[` or the key name
 	PrefixExp Exp
 	KeyExp    Exp
 }
@@ -107,6 +112,7 @@ args ::= '(' [explist] ')' | tableconstructor | Literalstring
 type FuncCallExp struct {
 	Line      int // line of `(` ?
 	LastLine  int // line of ')'
+	Column    int // column of the first token of args
 	PrefixExp Exp
 	NameExp   *StringExp
 	Args      []Exp
@@ -3,15 +3,43 @@ package codegen
 import . "luago/compiler/ast"
 
 func cgBlock(fi *funcInfo, node *Block) {
-	for _, stat := range node.Stats {
-		cgStat(fi, stat)
+	cgStatList(fi, node, true)
+}
+
+// endsScope is false for the body of repeat-until: its locals are
+// still in scope in the condition, even after a label at its end
+func cgStatList(fi *funcInfo, node *Block, endsScope bool) {
+	for i, stat := range node.Stats {
+		if label, ok := stat.(*LabelStat); ok {
+			fi.setPosition(positionOfStat(stat))
+			cgLabelStat(fi, label, endsScope && onlyLabelsAfter(node, i))
+		} else {
+			cgStat(fi, stat)
+		}
 	}
 
 	if node.RetExps != nil {
+		if len(node.RetExps) > 0 {
+			fi.setPosition(positionOfExp(node.RetExps[0]))
+		}
 		cgRetStat(fi, node.RetExps)
 	}
 }
 
+// whether the i-th statement of the block is followed only by labels,
+// the void statements luac skips before checking for the block end
+func onlyLabelsAfter(node *Block, i int) bool {
+	if node.RetExps != nil {
+		return false
+	}
+	for _, stat := range node.Stats[i+1:] {
+		if _, ok := stat.(*LabelStat); !ok {
+			return false
+		}
+	}
+	return true
+}
+
 func cgRetStat(fi *funcInfo, exps []Exp) {
 	nExps := len(exps)
 	if nExps == 0 {
@@ -1,6 +1,7 @@
 package codegen
 
 import (
+	"fmt"
 	. "luago/compiler/ast"
 	. "luago/compiler/lexer"
 
@@ -9,6 +10,8 @@ import (
 
 // todo: rename to evalExp()?
 func cgExp(fi *funcInfo, node Exp, a, n int) {
+	oldLine, oldColumn := fi.setPosition(positionOfExp(node))
+
 	switch exp := node.(type) {
 	case *NilExp:
 		fi.emitLoadNil(a, n)
@@ -43,11 +46,50 @@ func cgExp(fi *funcInfo, node Exp, a, n int) {
 	case *FuncCallExp:
 		cgFuncCallExp(fi, exp, a, n)
 	}
+
+	fi.restorePosition(oldLine, oldColumn)
+}
+
+func positionOfExp(node Exp) (line, column int) {
+	switch exp := node.(type) {
+	case *NilExp:
+		return exp.Line, 0
+	case *FalseExp:
+		return exp.Line, 0
+	case *TrueExp:
+		return exp.Line, 0
+	case *VarargExp:
+		return exp.Line, 0
+	case *IntegerExp:
+		return exp.Line, 0
+	case *FloatExp:
+		return exp.Line, 0
+	case *StringExp:
+		return exp.Line, 0
+	case *FuncDefExp:
+		return exp.Line, 0
+	case *TableConstructorExp:
+		return exp.Line, 0
+	case *UnopExp:
+		return exp.Line, exp.Column
+	case *BinopExp:
+		return exp.Line, exp.Column
+	case *ConcatExp:
+		return exp.Line, exp.Column
+	case *NameExp:
+		return exp.Line, exp.Column
+	case *TableAccessExp:
+		return exp.LastLine, exp.Column
+	case *FuncCallExp:
+		return exp.Line, exp.Column
+	default:
+		return 0, 0
+	}
 }
 
 func cgVarargExp(fi *funcInfo, node *VarargExp, a, n int) {
 	if !fi.isVararg {
-		panic("cannot use '...' outside a vararg function")
+		fi.error("cannot use '...' outside a vararg function")
 	}
 	fi.emitVararg(a, n)
 }
@@ -55,6 +97,7 @@ func cgVarargExp(fi *funcInfo, node *VarargExp, a, n int) {
 // f[a] := function(args) body end
 func cgFuncDefExp(fi *funcInfo, node *FuncDefExp, a int) {
 	subFI := newFuncInfo(fi, node)
+	subFI.setPosition(node.Line, 0)
 	fi.subFuncs = append(fi.subFuncs, subFI)
 
 	for _, param := range node.ParList {
@@ -63,9 +106,17 @@ func cgFuncDefExp(fi *funcInfo, node *FuncDefExp, a int) {
 
 	cgBlock(subFI, node.Block)
 	subFI.exitScope()
+	subFI.setPosition(node.LastLine, 0)
+	if len(subFI.gotos) > 0 {
+		gt := subFI.gotos[0]
+		subFI.error(fmt.Sprintf("no visible label '%s' for <goto> at line %d", gt.name, gt.line))
+	}
 	subFI.emitReturn(0, 0)
 
 	bx := len(fi.subFuncs) - 1
+	if bx > MAXARG_Bx {
+		fi.errorLimit(MAXARG_Bx, "functions")
+	}
 	fi.emitClosure(a, bx)
 }
 
@@ -101,7 +152,7 @@ func cgTableConstructorExp(fi *funcInfo, node *TableConstructorExp, a int) {
 					n = 50
 				}
 				fi.freeRegs(n)
-				c := (arrIdx-1)/50 + 1 // todo: c > 0xFF
+				c := (arrIdx-1)/50 + 1
 				if i == nExps-1 && multRet {
 					fi.emitSetList(a, 0, c)
 				} else {
@@ -174,7 +225,9 @@ func cgConcatExp(fi *funcInfo, node *ConcatExp, a int) {
 
 // r[a] := name
 func cgNameExp(fi *funcInfo, node *NameExp, a int) {
-	if r := fi.slotOfLocVar(node.Name); r >= 0 {
+	if locVar := fi.findLocVar(node.Name); locVar != nil && locVar.constExp != nil {
+		cgExp(fi, locVar.constExp, a, 1)
+	} else if r := fi.slotOfLocVar(node.Name); r >= 0 {
 		fi.emitMove(a, r)
 	} else if idx := fi.indexOfUpval(node.Name); idx >= 0 {
 		fi.emitGetUpval(a, idx)
@@ -199,6 +252,9 @@ func cgTableAccessExp(fi *funcInfo, node *TableAccessExp, a int) {
 
 // r[a] := f(args)
 func cgFuncCallExp(fi *funcInfo, node *FuncCallExp, a, n int) {
+	if cgIntrinsic(fi, node, a, n) {
+		return
+	}
 	nArgs := prepFuncCall(fi, node, a)
 	fi.emitCall(a, nArgs, n)
 }
@@ -215,6 +271,7 @@ func prepFuncCall(fi *funcInfo, node *FuncCallExp, a int) int {
 
 	cgExp(fi, node.PrefixExp, a, 1)
 	if node.NameExp != nil {
+		fi.allocReg() /* self */
 		c := 0x100 + fi.indexOfConstant(node.NameExp.Str)
 		fi.emitSelf(a, a, c)
 	}
@@ -230,6 +287,7 @@ func prepFuncCall(fi *funcInfo, node *FuncCallExp, a int) int {
 	fi.freeRegs(nArgs)
 
 	if node.NameExp != nil {
+		fi.freeReg()
 		nArgs++
 	}
 	if lastArgIsVarargOrFuncCall {
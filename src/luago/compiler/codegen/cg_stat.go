@@ -1,8 +1,13 @@
 package codegen
 
-import . "luago/compiler/ast"
+import (
+	"fmt"
+	. "luago/compiler/ast"
+)
 
 func cgStat(fi *funcInfo, node Stat) {
+	fi.setPosition(positionOfStat(node))
+
 	switch stat := node.(type) {
 	case *FuncCallStat:
 		cgFuncCallStat(fi, stat)
@@ -26,13 +31,39 @@ func cgStat(fi *funcInfo, node Stat) {
 		cgLocalVarDeclStat(fi, stat)
 	case *LocalFuncDefStat:
 		cgLocalFuncDefStat(fi, stat)
-	case *LabelStat:
-		cgLabelStat(fi, stat)
 	case *GotoStat:
 		cgGotoStat(fi, stat)
 	}
 }
 
+func positionOfStat(node Stat) (line, column int) {
+	switch stat := node.(type) {
+	case *FuncCallStat:
+		return positionOfExp(stat)
+	case *BreakStat:
+		return stat.Line, 0
+	case *LabelStat:
+		return stat.Line, 0
+	case *GotoStat:
+		return stat.Line, 0
+	case *ForNumStat:
+		return stat.LineOfFor, 0
+	case *ForInStat:
+		return stat.LineOfDo, 0
+	case *AssignStat:
+		if line, column := positionOfExp(stat.VarList[0]); line > 0 {
+			return line, column
+		}
+		return stat.LastLine, 0
+	case *LocalVarDeclStat:
+		return stat.LastLine, 0
+	case *LocalFuncDefStat:
+		return stat.Exp.Line, 0
+	default:
+		return 0, 0
+	}
+}
+
 func cgLocalFuncDefStat(fi *funcInfo, node *LocalFuncDefStat) {
 	r := fi.addLocVar(node.Name)
 	cgFuncDefExp(fi, node.Exp, r)
@@ -94,7 +125,7 @@ func cgRepeatStat(fi *funcInfo, node *RepeatStat) {
 	fi.enterScope(true)
 
 	pcBeforeBlock := fi.pc()
-	cgBlock(fi, node.Block)
+	cgStatList(fi, node.Block, false)
 
 	r := fi.allocReg()
 	cgExp(fi, node.Exp, r, 1)
@@ -172,10 +203,21 @@ func cgForNumStat(fi *funcInfo, node *ForNumStat) {
 func cgForInStat(fi *funcInfo, node *ForInStat) {
 	fi.enterScope(true)
 
-	cgLocalVarDeclStat(fi, &LocalVarDeclStat{
-		NameList: []string{"(for generator)", "(for state)", "(for control)"},
-		ExpList:  node.ExpList,
-	})
+	// as in Lua 5.4, a fourth value is closed when the loop ends. It
+	// is kept below the generator: TFORCALL still sets the variables
+	// from R(A+3), and closing them on each iteration leaves it alone
+	rClosing := fi.allocReg()
+	cgExpListN(fi, node.ExpList, 4)
+	fi.emitMove(rClosing, rClosing+4)
+	fi.freeReg()
+	fi.addLocVar("(for state)")
+	fi.locNames["(for state)"].attrib = "close"
+	for _, name := range []string{"(for generator)", "(for state)", "(for control)"} {
+		fi.addLocVar(name)
+	}
+	fi.emitTBC(rClosing)
+
+	fi.enterScope(false)
 	for _, name := range node.NameList {
 		fi.addLocVar(name)
 	}
@@ -188,14 +230,42 @@ func cgForInStat(fi *funcInfo, node *ForInStat) {
 	rGenerator := fi.slotOfLocVar("(for generator)")
 	fi.emitTForCall(rGenerator, len(node.NameList))
 	fi.emitTForLoop(rGenerator+2, pcJmpToTFC-fi.pc()-1)
+	fi.exitScope()
 
+	fi.closeOpenUpvals() /* the fourth value, when the loop ends */
 	fi.exitScope()
 }
 
 func cgLocalVarDeclStat(fi *funcInfo, node *LocalVarDeclStat) {
-	exps := removeTailNils(node.ExpList)
+	if n := len(node.NameList) - 1; n >= 0 && len(node.ExpList) == n+1 && node.AttribList != nil {
+		// as in Lua 5.4, only the last variable can be a compile-time constant
+		if k, ok := constValueOf(fi, node.ExpList[n]); ok &&
+			node.AttribList[n] == "const" && node.NameList[n] != "_ENV" {
+			cgLocalVarDeclStat(fi, &LocalVarDeclStat{
+				LastLine:   node.LastLine,
+				NameList:   node.NameList[:n],
+				AttribList: node.AttribList[:n],
+				ExpList:    node.ExpList[:n],
+			})
+			fi.addConstLocVar(node.NameList[n], k)
+			return
+		}
+	}
+
+	cgExpListN(fi, node.ExpList, len(node.NameList))
+	for i, name := range node.NameList {
+		fi.addLocVar(name)
+		if node.AttribList != nil {
+			fi.locNames[name].attrib = node.AttribList[i]
+		}
+	}
+}
+
+// cgExpListN evaluates exps adjusted to nNames values into the free
+// registers, which are left free for the variables taking them
+func cgExpListN(fi *funcInfo, exps []Exp, nNames int) {
+	exps = removeTailNils(exps)
 	nExps := len(exps)
-	nNames := len(node.NameList)
 
 	oldRegs := fi.usedRegs
 	if nExps == nNames {
@@ -233,9 +303,19 @@ func cgLocalVarDeclStat(fi *funcInfo, node *LocalVarDeclStat) {
 	}
 
 	fi.usedRegs = oldRegs
-	for _, name := range node.NameList {
-		fi.addLocVar(name)
+}
+
+// the literal value of exp if it is a constant at compile time
+func constValueOf(fi *funcInfo, exp Exp) (Exp, bool) {
+	switch x := exp.(type) {
+	case *NilExp, *TrueExp, *FalseExp, *IntegerExp, *FloatExp, *StringExp:
+		return exp, true
+	case *NameExp:
+		if locVar := fi.findLocVar(x.Name); locVar != nil && locVar.constExp != nil {
+			return locVar.constExp, true
+		}
 	}
+	return nil, false
 }
 
 func cgAssignStat(fi *funcInfo, node *AssignStat) {
@@ -256,6 +336,9 @@ func cgAssignStat(fi *funcInfo, node *AssignStat) {
 			cgExp(fi, taExp.KeyExp, kRegs[i], 1)
 		} else {
 			name := exp.(*NameExp).Name
+			if locVar := fi.findLocVar(name); locVar != nil && locVar.attrib == "const" {
+				fi.error(fmt.Sprintf("attempt to assign to const variable '%s'", name))
+			}
 			if fi.slotOfLocVar(name) < 0 && fi.indexOfUpval(name) < 0 {
 				// global var
 				kRegs[i] = -1
@@ -330,10 +413,54 @@ func cgAssignStat(fi *funcInfo, node *AssignStat) {
 	fi.usedRegs = oldRegs
 }
 
-func cgLabelStat(fi *funcInfo, node *LabelStat) {
-	panic("label statements are not supported!")
+// atBlockEnd tells a label followed only by other labels at the end of
+// its block, the locals of the block are already out of scope there
+func cgLabelStat(fi *funcInfo, node *LabelStat, atBlockEnd bool) {
+	for _, label := range fi.labels {
+		if label.name == node.Name && label.scopeLv == fi.scopeLv {
+			fi.error(fmt.Sprintf("label '%s' already defined on line %d",
+				node.Name, label.line))
+		}
+	}
+
+	label := labelInfo{node.Name, fi.pc() + 1, node.Line, fi.scopeLv, fi.nActVars}
+	if atBlockEnd {
+		label.nActVars = fi.nActVarsOfParent()
+	}
+	fi.labels = append(fi.labels, label)
+
+	gotos := fi.gotos[:0]
+	for _, gt := range fi.gotos {
+		if gt.name != label.name || gt.scopeLv != label.scopeLv {
+			gotos = append(gotos, gt)
+			continue
+		}
+		if gt.nActVars < label.nActVars {
+			fi.error(fmt.Sprintf("<goto %s> at line %d jumps into the scope of local '%s'",
+				gt.name, gt.line, fi.locVarOfSlot(gt.nActVars).name))
+		}
+		fi.fixSbx(gt.pc, label.pc-gt.pc-1)
+		if gt.nActVars > label.nActVars {
+			fi.closeUpvalsOnJmp(gt.pc, label.nActVars+1)
+		}
+	}
+	fi.gotos = gotos
 }
 
+// a goto to a visible label jumps back to it, the others wait for
+// their label in the rest of the block or of the enclosing ones
 func cgGotoStat(fi *funcInfo, node *GotoStat) {
-	panic("goto statements are not supported!")
+	for i := len(fi.labels) - 1; i >= 0; i-- {
+		if label := fi.labels[i]; label.name == node.Name {
+			a := 0
+			if fi.nActVars > label.nActVars { /* leaves the scope of locals */
+				a = label.nActVars + 1
+			}
+			fi.emitJmp(a, label.pc-fi.pc()-2)
+			return
+		}
+	}
+
+	pc := fi.emitJmp(0, 0)
+	fi.gotos = append(fi.gotos, labelInfo{node.Name, pc, node.Line, fi.scopeLv, fi.nActVars})
 }
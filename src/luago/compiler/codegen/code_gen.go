@@ -5,6 +5,7 @@ import . "luago/compiler/ast"
 
 func GenProto(chunk *Block) *Prototype {
 	fd := &FuncDefExp{
+		LastLine: chunk.LastLine,
 		IsVararg: true,
 		Block:    chunk,
 	}
@@ -12,5 +13,14 @@ func GenProto(chunk *Block) *Prototype {
 	fi := newFuncInfo(nil, fd)
 	fi.addLocVar("_ENV")
 	cgFuncDefExp(fi, fd, 0)
-	return toProto(fi.subFuncs[0])
+
+	// as in luac, the main function always has the upvalue _ENV and
+	// no line range
+	proto := toProto(fi.subFuncs[0])
+	if len(proto.Upvalues) == 0 {
+		proto.Upvalues = []Upvalue{{Instack: 1, Idx: 0}}
+		proto.UpvalueNames = []string{"_ENV"}
+	}
+	proto.LastLineDefined = 0
+	return proto
 }
@@ -17,9 +17,10 @@ func toProto(fi *funcInfo) *Prototype {
 		Constants:    getConstants(fi),
 		Upvalues:     getUpvalues(fi),
 		Protos:       toProtos(fi.subFuncs),
-		LineInfo:     []uint32{}, // debug
-		LocVars:      []LocVar{}, // debug
-		UpvalueNames: []string{}, // debug
+		LineInfo:     fi.lineNums,
+		ColumnInfo:   fi.colNums,
+		LocVars:      getLocVars(fi),      // debug
+		UpvalueNames: getUpvalueNames(fi), // debug
 		// add
 		LineDefined:     fi.LineDefined,
 		LastLineDefined: fi.LastLineDefined,
@@ -62,3 +63,23 @@ func getUpvalues(fi *funcInfo) []Upvalue {
 	}
 	return upvals
 }
+
+func getLocVars(fi *funcInfo) []LocVar {
+	locVars := make([]LocVar, len(fi.locVars))
+	for i, locVar := range fi.locVars {
+		locVars[i] = LocVar{
+			VarName: locVar.name,
+			StartPC: uint32(locVar.startPC),
+			EndPC:   uint32(locVar.endPC),
+		}
+	}
+	return locVars
+}
+
+func getUpvalueNames(fi *funcInfo) []string {
+	names := make([]string, len(fi.upvalues))
+	for name, uv := range fi.upvalues {
+		names[uv.index] = name
+	}
+	return names
+}
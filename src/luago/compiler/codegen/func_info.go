@@ -1,6 +1,7 @@
 package codegen
 
 import (
+	"fmt"
 	. "luago/compiler/ast"
 	. "luago/compiler/lexer"
 	. "luago/vm"
@@ -21,6 +22,13 @@ var arithAndBitwiseBinops = map[int]int{
 	TOKEN_OP_SHR:  OP_SHR,
 }
 
+/* limits of the bytecode format, as in luac */
+const (
+	MAXVARS  = 200 // active local variables per function
+	MAXUPVAL = 255 // upvalues per function
+	MAXREGS  = 255 // registers per function
+)
+
 type upvalInfo struct {
 	locVarSlot int
 	upvalIndex int
@@ -32,7 +40,20 @@ type locVarInfo struct {
 	name     string
 	scopeLv  int
 	slot     int
+	startPC  int // first instruction where the variable is active
+	endPC    int // first instruction where it is dead
 	captured bool
+	attrib   string // "const" for read-only variables, "close" for to-be-closed ones
+	constExp Exp    // the value of a compile-time constant, which has no slot
+}
+
+// a label, or a goto waiting for its label
+type labelInfo struct {
+	name     string
+	pc       int // where the label jumps to, or the JMP of the goto
+	line     int
+	scopeLv  int
+	nActVars int // local variables in scope there
 }
 
 type funcInfo struct {
@@ -42,11 +63,19 @@ type funcInfo struct {
 	usedRegs  int
 	maxRegs   int
 	scopeLv   int
+	nActVars  int // local variables in scope
 	locVars   []*locVarInfo
 	locNames  map[string]*locVarInfo
 	upvalues  map[string]upvalInfo
 	breaks    [][]int
+	blockJmps [][]int     // break jumps out of each scope, they close its upvalues
+	labels    []labelInfo // labels of the enclosing blocks
+	gotos     []labelInfo // forward gotos, resolved at their label
 	insts     []uint32
+	lineNums  []uint32
+	colNums   []uint32
+	line      int // source position of the node being generated
+	column    int
 	numParams int
 	isVararg  bool
 	// add
@@ -64,7 +93,10 @@ func newFuncInfo(parent *funcInfo, fd *FuncDefExp) *funcInfo {
 		upvalues:  map[string]upvalInfo{},
 		constants: map[interface{}]int{},
 		breaks:    make([][]int, 1),
+		blockJmps: make([][]int, 1),
 		insts:     make([]uint32, 0, 8),
+		lineNums:  make([]uint32, 0, 8),
+		colNums:   make([]uint32, 0, 8),
 		numParams: len(fd.ParList),
 		isVararg:  fd.IsVararg,
 		// add
@@ -81,6 +113,9 @@ func (self *funcInfo) indexOfConstant(k interface{}) int {
 	}
 
 	idx := len(self.constants)
+	if idx >= MAXARG_Ax {
+		self.errorLimit(MAXARG_Ax, "constants")
+	}
 	self.constants[k] = idx
 	return idx
 }
@@ -89,8 +124,8 @@ func (self *funcInfo) indexOfConstant(k interface{}) int {
 
 func (self *funcInfo) allocReg() int {
 	self.usedRegs++
-	if self.usedRegs >= 255 {
-		panic("function or expression needs too many registers")
+	if self.usedRegs >= MAXREGS {
+		self.error("function or expression needs too many registers")
 	}
 	if self.usedRegs > self.maxRegs {
 		self.maxRegs = self.usedRegs
@@ -128,6 +163,7 @@ func (self *funcInfo) freeRegs(n int) {
 
 func (self *funcInfo) enterScope(breakable bool) {
 	self.scopeLv++
+	self.blockJmps = append(self.blockJmps, nil)
 	if breakable {
 		self.breaks = append(self.breaks, []int{})
 	} else {
@@ -139,11 +175,21 @@ func (self *funcInfo) exitScope() {
 	pendingBreakJmps := self.breaks[len(self.breaks)-1]
 	self.breaks = self.breaks[:len(self.breaks)-1]
 
+	// jumps leaving this scope must close its captured locals,
+	// whichever scope they were emitted in
 	a := self.getJmpArgA()
+	jmps := self.blockJmps[len(self.blockJmps)-1]
+	self.blockJmps = self.blockJmps[:len(self.blockJmps)-1]
+	for _, pc := range jmps {
+		self.closeUpvalsOnJmp(pc, a)
+	}
+	if pendingBreakJmps == nil && len(self.blockJmps) > 0 { // still pending in the enclosing scope
+		parent := len(self.blockJmps) - 1
+		self.blockJmps[parent] = append(self.blockJmps[parent], jmps...)
+	}
+
 	for _, pc := range pendingBreakJmps {
-		sBx := self.pc() - pc
-		i := (sBx+MAXARG_sBx)<<14 | a<<6 | OP_JMP
-		self.insts[pc] = uint32(i)
+		self.fixSbx(pc, self.pc()-pc)
 	}
 
 	self.scopeLv--
@@ -152,10 +198,54 @@ func (self *funcInfo) exitScope() {
 			self.removeLocVar(locVar)
 		}
 	}
+
+	// the labels of the block are not visible any more, and its
+	// pending gotos now leave it from the enclosing block
+	for len(self.labels) > 0 && self.labels[len(self.labels)-1].scopeLv > self.scopeLv {
+		self.labels = self.labels[:len(self.labels)-1]
+	}
+	for i := range self.gotos {
+		if gt := &self.gotos[i]; gt.scopeLv > self.scopeLv {
+			self.closeUpvalsOnJmp(gt.pc, a)
+			gt.scopeLv = self.scopeLv
+			if gt.nActVars > self.nActVars {
+				gt.nActVars = self.nActVars
+			}
+		}
+	}
+}
+
+// the local variables in scope when the current scope was entered
+func (self *funcInfo) nActVarsOfParent() int {
+	n := self.nActVars
+	for _, locVar := range self.locNames {
+		for v := locVar; v != nil && v.scopeLv == self.scopeLv; v = v.prev {
+			if v.constExp == nil {
+				n--
+			}
+		}
+	}
+	return n
+}
+
+// the local variable in slot, for the messages of goto
+func (self *funcInfo) locVarOfSlot(slot int) *locVarInfo {
+	for _, locVar := range self.locNames {
+		for v := locVar; v != nil; v = v.prev {
+			if v.slot == slot {
+				return v
+			}
+		}
+	}
+	return nil
 }
 
 func (self *funcInfo) removeLocVar(locVar *locVarInfo) {
-	self.freeReg()
+	locVar.endPC = self.pc() + 1
+	if locVar.constExp == nil {
+		self.freeReg()
+		self.nActVars--
+	}
 	if locVar.prev == nil {
 		delete(self.locNames, locVar.name)
 	} else if locVar.prev.scopeLv == locVar.scopeLv {
@@ -166,11 +256,15 @@ func (self *funcInfo) removeLocVar(locVar *locVarInfo) {
 }
 
 func (self *funcInfo) addLocVar(name string) int {
+	if self.nActVars++; self.nActVars > MAXVARS {
+		self.errorLimit(MAXVARS, "local variables")
+	}
 	newVar := &locVarInfo{
 		name:    name,
 		prev:    self.locNames[name],
 		scopeLv: self.scopeLv,
 		slot:    self.allocReg(),
+		startPC: self.pc() + 1, // its initialization is already emitted
 	}
 
 	self.locVars = append(self.locVars, newVar)
@@ -179,6 +273,30 @@ func (self *funcInfo) addLocVar(name string) int {
 	return newVar.slot
 }
 
+// addConstLocVar declares a compile-time constant: the variable has
+// no register and its uses are replaced with exp, like in Lua 5.4
+func (self *funcInfo) addConstLocVar(name string, exp Exp) {
+	self.locNames[name] = &locVarInfo{
+		name:     name,
+		prev:     self.locNames[name],
+		scopeLv:  self.scopeLv,
+		slot:     -1,
+		attrib:   "const",
+		constExp: exp,
+	}
+}
+
+// findLocVar returns the local variable name refers to, declared in
+// this function or an enclosing one, nil for a global
+func (self *funcInfo) findLocVar(name string) *locVarInfo {
+	for fi := self; fi != nil; fi = fi.parent {
+		if locVar, found := fi.locNames[name]; found {
+			return locVar
+		}
+	}
+	return nil
+}
+
 func (self *funcInfo) slotOfLocVar(name string) int {
 	if locVar, found := self.locNames[name]; found {
 		return locVar.slot
@@ -187,6 +305,7 @@ func (self *funcInfo) slotOfLocVar(name string) int {
 }
 
 func (self *funcInfo) addBreakJmp(pc int) {
+	self.blockJmps[self.scopeLv] = append(self.blockJmps[self.scopeLv], pc)
 	for i := self.scopeLv; i >= 0; i-- {
 		if self.breaks[i] != nil { // breakable
 			self.breaks[i] = append(self.breaks[i], pc)
@@ -194,7 +313,7 @@ func (self *funcInfo) addBreakJmp(pc int) {
 		}
 	}
 
-	panic("<break> at line ? not inside a loop!")
+	self.error(fmt.Sprintf("<break> at line %d not inside a loop", self.line))
 }
 
 /* upvalues */
@@ -205,13 +324,13 @@ func (self *funcInfo) indexOfUpval(name string) int {
 	}
 	if self.parent != nil {
 		if locVar, found := self.parent.locNames[name]; found {
-			idx := len(self.upvalues)
+			idx := self.newUpvalIndex()
 			self.upvalues[name] = upvalInfo{locVar.slot, -1, idx}
 			locVar.captured = true
 			return idx
 		}
 		if uvIdx := self.parent.indexOfUpval(name); uvIdx >= 0 {
-			idx := len(self.upvalues)
+			idx := self.newUpvalIndex()
 			self.upvalues[name] = upvalInfo{-1, uvIdx, idx}
 			return idx
 		}
@@ -219,6 +338,14 @@ func (self *funcInfo) indexOfUpval(name string) int {
 	return -1
 }
 
+func (self *funcInfo) newUpvalIndex() int {
+	idx := len(self.upvalues)
+	if idx >= MAXUPVAL {
+		self.errorLimit(MAXUPVAL, "upvalues")
+	}
+	return idx
+}
+
 func (self *funcInfo) closeOpenUpvals() {
 	a := self.getJmpArgA()
 	if a > 0 {
@@ -226,16 +353,25 @@ func (self *funcInfo) closeOpenUpvals() {
 	}
 }
 
+// closeUpvalsOnJmp makes the jump at pc also close the upvalues from
+// R(a-1) on, keeping a lower level it may already close from
+func (self *funcInfo) closeUpvalsOnJmp(pc, a int) {
+	i := self.insts[pc]
+	if old := int(i >> 6 & 0xFF); a > 0 && (old == 0 || a < old) {
+		self.insts[pc] = i&^(0xFF<<6) | uint32(a)<<6
+	}
+}
+
 func (self *funcInfo) getJmpArgA() int {
 	hasCapturedLocVars := false
 	minSlotOfLocVars := self.maxRegs
 	for _, locVar := range self.locNames {
 		if locVar.scopeLv == self.scopeLv {
 			for v := locVar; v != nil && v.scopeLv == self.scopeLv; v = v.prev {
-				if v.captured {
+				if v.captured || v.attrib == "close" {
 					hasCapturedLocVars = true
 				}
-				if v.slot < minSlotOfLocVars && v.name[0] != '(' {
+				if v.slot >= 0 && v.slot < minSlotOfLocVars && (v.name[0] != '(' || v.attrib == "close") {
 					minSlotOfLocVars = v.slot
 				}
 			}
@@ -248,37 +384,82 @@ func (self *funcInfo) getJmpArgA() int {
 	}
 }
 
+/* source position */
+
+// setPosition makes the following instructions map back to line and
+// column, and returns the previous position so it can be restored.
+func (self *funcInfo) setPosition(line, column int) (int, int) {
+	oldLine, oldColumn := self.line, self.column
+	if line > 0 {
+		self.line, self.column = line, column
+	}
+	return oldLine, oldColumn
+}
+
+func (self *funcInfo) restorePosition(line, column int) {
+	self.line, self.column = line, column
+}
+
+// error reports a compile error at the current position, the chunk name
+// is filled in by compiler.Compile
+func (self *funcInfo) error(msg string) {
+	panic(&CompileError{Line: self.line, Msg: msg})
+}
+
+// errorLimit reports a limit of the bytecode format the way luac does
+func (self *funcInfo) errorLimit(limit int, what string) {
+	where := "main function"
+	if self.LineDefined > 0 {
+		where = fmt.Sprintf("function at line %d", self.LineDefined)
+	}
+	self.error(fmt.Sprintf("too many %s (limit is %d) in %s", what, limit, where))
+}
+
 /* code */
 
+func (self *funcInfo) emit(i int) {
+	self.insts = append(self.insts, uint32(i))
+	self.lineNums = append(self.lineNums, uint32(self.line))
+	self.colNums = append(self.colNums, uint32(self.column))
+}
+
 func (self *funcInfo) pc() int {
 	return len(self.insts) - 1
 }
 
 func (self *funcInfo) fixSbx(pc, sBx int) {
+	self.checkSbx(sBx)
 	i := self.insts[pc]
 	i = i << 18 >> 18                  // clear sBx
 	i = i | uint32(sBx+MAXARG_sBx)<<14 // reset sBx
 	self.insts[pc] = i
 }
 
+func (self *funcInfo) checkSbx(sBx int) {
+	if sBx < -MAXARG_sBx || sBx > MAXARG_Bx-MAXARG_sBx {
+		self.error("control structure too long")
+	}
+}
+
 func (self *funcInfo) emitABC(opcode, a, b, c int) {
 	i := b<<23 | c<<14 | a<<6 | opcode
-	self.insts = append(self.insts, uint32(i))
+	self.emit(i)
 }
 
 func (self *funcInfo) emitABx(opcode, a, bx int) {
 	i := bx<<14 | a<<6 | opcode
-	self.insts = append(self.insts, uint32(i))
+	self.emit(i)
 }
 
 func (self *funcInfo) emitAsBx(opcode, a, b int) {
+	self.checkSbx(b)
 	i := (b+MAXARG_sBx)<<14 | a<<6 | opcode
-	self.insts = append(self.insts, uint32(i))
+	self.emit(i)
 }
 
 func (self *funcInfo) emitAx(opcode, ax int) {
 	i := ax<<6 | opcode
-	self.insts = append(self.insts, uint32(i))
+	self.emit(i)
 }
 
 // r[a] = r[b]
@@ -325,7 +506,12 @@ func (self *funcInfo) emitNewTable(a, nArr, nRec int) {
 
 // r[a][(c-1)*FPF+i] := r[a+i], 1 <= i <= b
 func (self *funcInfo) emitSetList(a, b, c int) {
-	self.emitABC(OP_SETLIST, a, b, c)
+	if c <= MAXARG_C {
+		self.emitABC(OP_SETLIST, a, b, c)
+	} else {
+		self.emitABC(OP_SETLIST, a, b, 0)
+		self.emitAx(OP_EXTRAARG, c)
+	}
 }
 
 // r[a] := r[b][rk(c)]
@@ -412,6 +598,10 @@ func (self *funcInfo) emitTForLoop(a, sBx int) {
 	self.emitAsBx(OP_TFORLOOP, a, sBx)
 }
 
+func (self *funcInfo) emitTBC(a int) {
+	self.emitABC(OP_TBC, a, 0, 0)
+}
+
 // r[a] = op r[b]
 func (self *funcInfo) emitUnaryOp(op, a, b int) {
 	switch op {
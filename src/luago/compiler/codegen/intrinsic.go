@@ -0,0 +1,78 @@
+package codegen
+
+import (
+	"fmt"
+	. "luago/compiler/ast"
+
+	. "luago/vm"
+)
+
+/*
+内建函数：把对某个全局函数的调用直接编译成一条扩展指令
+（见 vm.RegisterExtOp），省掉取全局变量和函数调用的开销：
+
+	f(x, y)  =>  EXT0 A B 2    -- R(A) := op(R(B), R(B+1))
+
+只在参数个数刚好是 nArgs 且最后一个参数不展开成多个值、结果最多
+取一个、函数名没有被局部变量或 upvalue 遮蔽、_ENV 也不是局部变量
+时替换，其他情况（比如 return f(x) 或 g(f(x))）仍然是普通调用，
+所以宿主程序还要注册同名的全局函数：
+
+	vm.RegisterExtOp(vm.OP_EXT0, "CLAMP", clampOp)
+	codegen.RegisterIntrinsic("clamp", vm.OP_EXT0, 3)
+	ls.Register("clamp", clamp)
+
+注册表是全局的且不加锁，要在编译任何代码之前注册。
+*/
+func RegisterIntrinsic(name string, op, nArgs int) {
+	if op < OP_EXT0 || op >= OP_EXT0+NUM_EXTOPS {
+		panic(fmt.Sprintf("opcode %d is not an extension opcode", op))
+	}
+	if nArgs < 0 || nArgs > MAXARG_C {
+		panic(fmt.Sprintf("bad number of intrinsic arguments: %d", nArgs))
+	}
+	intrinsics[name] = intrinsic{op, nArgs}
+}
+
+type intrinsic struct {
+	op    int
+	nArgs int
+}
+
+var intrinsics = map[string]intrinsic{}
+
+// r[a] := op(args), false if the call is not an intrinsic
+func cgIntrinsic(fi *funcInfo, node *FuncCallExp, a, n int) bool {
+	in, ok := lookupIntrinsic(fi, node)
+	if !ok || n < 0 {
+		return false
+	}
+
+	for _, arg := range node.Args {
+		tmp := fi.allocReg()
+		cgExp(fi, arg, tmp, 1)
+	}
+	b := fi.usedRegs - in.nArgs
+	fi.freeRegs(in.nArgs)
+	fi.emitABC(in.op, a, b, in.nArgs)
+	if n > 1 {
+		fi.emitLoadNil(a+1, n-1)
+	}
+	return true
+}
+
+func lookupIntrinsic(fi *funcInfo, node *FuncCallExp) (intrinsic, bool) {
+	nameExp, ok := node.PrefixExp.(*NameExp)
+	if !ok || node.NameExp != nil {
+		return intrinsic{}, false
+	}
+	in, ok := intrinsics[nameExp.Name]
+	if !ok || in.nArgs != len(node.Args) ||
+		in.nArgs > 0 && isVarargOrFuncCall(node.Args[in.nArgs-1]) ||
+		fi.findLocVar(nameExp.Name) != nil ||
+		fi.indexOfUpval(nameExp.Name) >= 0 ||
+		fi.slotOfLocVar("_ENV") >= 0 {
+		return intrinsic{}, false
+	}
+	return in, true
+}
@@ -1,10 +1,57 @@
 package compiler
 
 import "luago/binchunk"
+import "luago/compiler/ast"
 import "luago/compiler/codegen"
+import "luago/compiler/lexer"
 import "luago/compiler/parser"
 
-func Compile(chunk, chunkName string) *binchunk.Prototype {
-	ast := parser.Parse(chunk, chunkName)
-	return codegen.GenProto(ast)
+type CompileError = lexer.CompileError
+
+// Compile returns a *CompileError for syntax errors and for programs the
+// code generator cannot handle
+func Compile(chunk, chunkName string) (proto *binchunk.Prototype, err error) {
+	defer catchCompileError(chunkName, &err)
+
+	block := parser.Parse(chunk, chunkName)
+	proto = codegen.GenProto(block)
+	setSource(proto, chunkName)
+	return proto, nil
+}
+
+// Parse returns the syntax tree of a chunk, or a *CompileError for
+// syntax errors
+func Parse(chunk, chunkName string) (block *ast.Block, err error) {
+	defer catchCompileError(chunkName, &err)
+
+	return parser.Parse(chunk, chunkName), nil
+}
+
+// ParseWithComments is Parse for tools that also need the comments
+func ParseWithComments(chunk, chunkName string) (block *ast.Block, comments []lexer.Comment, err error) {
+	defer catchCompileError(chunkName, &err)
+
+	block, comments = parser.ParseWithComments(chunk, chunkName)
+	return block, comments, nil
+}
+
+func catchCompileError(chunkName string, err *error) {
+	if r := recover(); r != nil {
+		switch e := r.(type) {
+		case *CompileError:
+			e.Chunk = chunkName
+			*err = e
+		case string: /* internal checks of the code generator */
+			*err = &CompileError{chunkName, 0, e}
+		default:
+			panic(r)
+		}
+	}
+}
+
+func setSource(proto *binchunk.Prototype, source string) {
+	proto.Source = source
+	for _, subProto := range proto.Protos {
+		setSource(subProto, source)
+	}
 }
@@ -3,6 +3,7 @@ package lexer
 import (
 	"bytes"
 	"fmt"
+	"luago/number"
 	"regexp"
 	"strconv"
 	"strings"
@@ -11,7 +12,6 @@ import (
 //var reSpaces = regexp.MustCompile(`^\s+`)
 var reNewLine = regexp.MustCompile("\r\n|\n\r|\n|\r")
 var reIdentifier = regexp.MustCompile(`^[_\d\w]+`)
-var reNumber = regexp.MustCompile(`^0[xX][0-9a-fA-F]*(\.[0-9a-fA-F]*)?([pP][+\-]?[0-9]+)?|^[0-9]*(\.[0-9]*)?([eE][+\-]?[0-9]+)?`)
 var reShortStr = regexp.MustCompile(`(?s)(^'(\\\\|\\'|\\\n|\\z\s*|[^'\n])*')|(^"(\\\\|\\"|\\\n|\\z\s*|[^"\n])*")`)
 var reOpeningLongBracket = regexp.MustCompile(`^\[=*\[`)
 
@@ -20,29 +20,89 @@ var reHexEscapeSeq = regexp.MustCompile(`^\\x[0-9a-fA-F]{2}`)
 var reUnicodeEscapeSeq = regexp.MustCompile(`^\\u\{[0-9a-fA-F]+\}`)
 
 type Lexer struct {
-	chunk         string // source code
-	chunkName     string // source name
-	line          int    // current line number
-	nextToken     string
-	nextTokenKind int
-	nextTokenLine int
+	src             string // whole source code, used to compute columns
+	chunk           string // source code
+	chunkName       string // source name
+	line            int    // current line number
+	column          int    // column of the last token
+	nextToken       string
+	nextTokenKind   int
+	nextTokenLine   int
+	nextTokenColumn int
+	level           int // nesting depth of the parser
+	keepComments    bool
+	comments        []Comment
+}
+
+// a comment, recorded when KeepComments was called
+type Comment struct {
+	Line     int    // line of the --
+	LastLine int    // last line of a long comment
+	Text     string // without the -- and the brackets of a long comment
 }
 
 func NewLexer(chunk, chunkName string) *Lexer {
-	return &Lexer{chunk, chunkName, 1, "", 0, 0}
+	return &Lexer{src: chunk, chunk: chunk, chunkName: chunkName, line: 1}
 }
 
 func (self *Lexer) Line() int {
 	return self.line
 }
 
+func (self *Lexer) ChunkName() string {
+	return self.chunkName
+}
+
+// KeepComments makes the lexer record the comments it skips, for tools
+// such as documentation generators
+func (self *Lexer) KeepComments() {
+	self.keepComments = true
+}
+
+// the comments recorded so far, in source order
+func (self *Lexer) Comments() []Comment {
+	return self.comments
+}
+
+// EnterLevel counts one more level of syntactic nesting for the parser,
+// raising an error past limit. Each call is paired with LeaveLevel.
+func (self *Lexer) EnterLevel(limit int) {
+	self.level++
+	if self.level > limit {
+		self.error("chunk has too many syntax levels")
+	}
+}
+
+func (self *Lexer) LeaveLevel() {
+	self.level--
+}
+
+// 1-based column of the token most recently returned by NextToken
+func (self *Lexer) Column() int {
+	return self.column
+}
+
+// 1-based column of the next token, without consuming it
+func (self *Lexer) LookAheadColumn() int {
+	self.LookAhead()
+	return self.nextTokenColumn
+}
+
+func (self *Lexer) currentColumn() int {
+	pos := len(self.src) - len(self.chunk)
+	return pos - strings.LastIndexAny(self.src[:pos], "\r\n")
+}
+
 func (self *Lexer) LookAhead() int {
 	if self.nextTokenLine > 0 {
 		return self.nextTokenKind
 	}
 	currentLine := self.line
+	currentColumn := self.column
 	line, kind, token := self.NextToken()
 	self.line = currentLine
+	self.nextTokenColumn = self.column
+	self.column = currentColumn
 	self.nextTokenLine = line
 	self.nextTokenKind = kind
 	self.nextToken = token
@@ -67,11 +127,13 @@ func (self *Lexer) NextToken() (line, kind int, token string) {
 		kind = self.nextTokenKind
 		token = self.nextToken
 		self.line = self.nextTokenLine
+		self.column = self.nextTokenColumn
 		self.nextTokenLine = 0
 		return
 	}
 
 	self.skipWhiteSpaces()
+	self.column = self.currentColumn()
 	if len(self.chunk) == 0 {
 		return self.line, TOKEN_EOF, "EOF"
 	}
@@ -224,10 +286,27 @@ func (self *Lexer) test(s string) bool {
 	return strings.HasPrefix(self.chunk, s)
 }
 
+// CompileError is raised (as a panic) by the lexer, the parser and the
+// code generator, compiler.Compile returns it as an error
+type CompileError struct {
+	Chunk string
+	Line  int // 0 if unknown
+	Msg   string
+}
+
+func (self *CompileError) Error() string {
+	chunk := self.Chunk
+	if strings.HasPrefix(chunk, "@") || strings.HasPrefix(chunk, "=") {
+		chunk = chunk[1:] /* like the short source of debug information */
+	}
+	if self.Line > 0 {
+		return fmt.Sprintf("%s:%d: %s", chunk, self.Line, self.Msg)
+	}
+	return chunk + ": " + self.Msg
+}
+
 func (self *Lexer) error(f string, a ...interface{}) {
-	err := fmt.Sprintf(f, a...)
-	err = fmt.Sprintf("%s:%d: %s", self.chunkName, self.line, err)
-	panic(err)
+	panic(&CompileError{self.chunkName, self.line, fmt.Sprintf(f, a...)})
 }
 
 func (self *Lexer) skipWhiteSpaces() {
@@ -249,28 +328,67 @@ func (self *Lexer) skipWhiteSpaces() {
 }
 
 func (self *Lexer) skipComment() {
+	line := self.line
 	self.next(2) // skip --
 
 	// long comment ?
 	if self.test("[") {
 		if reOpeningLongBracket.FindString(self.chunk) != "" {
-			self.scanLongString()
+			text := self.scanLongString()
+			self.addComment(line, text)
 			return
 		}
 	}
 
 	// short comment
+	start := self.chunk
 	for len(self.chunk) > 0 && !isNewLine(self.chunk[0]) {
 		self.next(1)
 	}
+	self.addComment(line, start[:len(start)-len(self.chunk)])
+}
+
+func (self *Lexer) addComment(line int, text string) {
+	if self.keepComments {
+		self.comments = append(self.comments, Comment{line, self.line, text})
+	}
 }
 
 func (self *Lexer) scanIdentifier() string {
 	return self.scan(reIdentifier)
 }
 
+// scanNumber reads a numeral the way luac does: hex digits, dots and
+// signed exponents, plus a letter touching the numeral, then checks the
+// whole token against the numeral grammar
 func (self *Lexer) scanNumber() string {
-	return self.scan(reNumber)
+	expo, n := "Ee", 0
+	if self.test("0x") || self.test("0X") {
+		expo, n = "Pp", 2
+	}
+	for n < len(self.chunk) {
+		c := self.chunk[n]
+		if strings.IndexByte(expo, c) >= 0 {
+			n++
+			if n < len(self.chunk) && (self.chunk[n] == '+' || self.chunk[n] == '-') {
+				n++
+			}
+		} else if isHexDigit(c) || c == '.' {
+			n++
+		} else {
+			break
+		}
+	}
+	if n < len(self.chunk) && (isLetter(self.chunk[n]) || self.chunk[n] == '_') {
+		n++ /* numeral touching a letter, force an error */
+	}
+
+	token := self.chunk[:n]
+	if _, _, _, ok := number.ParseNumeral(token); !ok {
+		self.error("malformed number near '%s'", token)
+	}
+	self.next(n)
+	return token
 }
 
 func (self *Lexer) scan(re *regexp.Regexp) string {
@@ -431,6 +549,10 @@ func isDigit(c byte) bool {
 	return c >= '0' && c <= '9'
 }
 
+func isHexDigit(c byte) bool {
+	return isDigit(c) || c >= 'a' && c <= 'f' || c >= 'A' && c <= 'F'
+}
+
 func isLetter(c byte) bool {
 	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
 }
@@ -5,6 +5,9 @@ import . "luago/compiler/lexer"
 
 // block ::= {stat} [retstat]
 func parseBlock(lexer *Lexer) *Block {
+	lexer.EnterLevel(MaxSyntaxLevels)
+	defer lexer.LeaveLevel()
+
 	return &Block{
 		Stats:    parseStats(lexer),
 		RetExps:  parseRetExps(lexer),
@@ -47,7 +47,7 @@ func parseExp12(lexer *Lexer) Exp {
 	exp := parseExp11(lexer)
 	for lexer.LookAhead() == TOKEN_OP_OR {
 		line, op, _ := lexer.NextToken()
-		lor := &BinopExp{line, op, exp, parseExp11(lexer)}
+		lor := &BinopExp{line, lexer.Column(), op, exp, parseExp11(lexer)}
 		exp = optimizeLogicalOr(lor)
 	}
 	return exp
@@ -58,7 +58,7 @@ func parseExp11(lexer *Lexer) Exp {
 	exp := parseExp10(lexer)
 	for lexer.LookAhead() == TOKEN_OP_AND {
 		line, op, _ := lexer.NextToken()
-		land := &BinopExp{line, op, exp, parseExp10(lexer)}
+		land := &BinopExp{line, lexer.Column(), op, exp, parseExp10(lexer)}
 		exp = optimizeLogicalAnd(land)
 	}
 	return exp
@@ -72,7 +72,7 @@ func parseExp10(lexer *Lexer) Exp {
 		case TOKEN_OP_LT, TOKEN_OP_GT, TOKEN_OP_NE,
 			TOKEN_OP_LE, TOKEN_OP_GE, TOKEN_OP_EQ:
 			line, op, _ := lexer.NextToken()
-			exp = &BinopExp{line, op, exp, parseExp9(lexer)}
+			exp = &BinopExp{line, lexer.Column(), op, exp, parseExp9(lexer)}
 		default:
 			return exp
 		}
@@ -85,7 +85,7 @@ func parseExp9(lexer *Lexer) Exp {
 	exp := parseExp8(lexer)
 	for lexer.LookAhead() == TOKEN_OP_BOR {
 		line, op, _ := lexer.NextToken()
-		bor := &BinopExp{line, op, exp, parseExp8(lexer)}
+		bor := &BinopExp{line, lexer.Column(), op, exp, parseExp8(lexer)}
 		exp = optimizeBitwiseBinaryOp(bor)
 	}
 	return exp
@@ -96,7 +96,7 @@ func parseExp8(lexer *Lexer) Exp {
 	exp := parseExp7(lexer)
 	for lexer.LookAhead() == TOKEN_OP_BXOR {
 		line, op, _ := lexer.NextToken()
-		bxor := &BinopExp{line, op, exp, parseExp7(lexer)}
+		bxor := &BinopExp{line, lexer.Column(), op, exp, parseExp7(lexer)}
 		exp = optimizeBitwiseBinaryOp(bxor)
 	}
 	return exp
@@ -107,7 +107,7 @@ func parseExp7(lexer *Lexer) Exp {
 	exp := parseExp6(lexer)
 	for lexer.LookAhead() == TOKEN_OP_BAND {
 		line, op, _ := lexer.NextToken()
-		band := &BinopExp{line, op, exp, parseExp6(lexer)}
+		band := &BinopExp{line, lexer.Column(), op, exp, parseExp6(lexer)}
 		exp = optimizeBitwiseBinaryOp(band)
 	}
 	return exp
@@ -120,7 +120,7 @@ func parseExp6(lexer *Lexer) Exp {
 		switch lexer.LookAhead() {
 		case TOKEN_OP_SHL, TOKEN_OP_SHR:
 			line, op, _ := lexer.NextToken()
-			shx := &BinopExp{line, op, exp, parseExp5(lexer)}
+			shx := &BinopExp{line, lexer.Column(), op, exp, parseExp5(lexer)}
 			exp = optimizeBitwiseBinaryOp(shx)
 		default:
 			return exp
@@ -136,13 +136,14 @@ func parseExp5(lexer *Lexer) Exp {
 		return exp
 	}
 
-	line := 0
+	line, column := 0, 0
 	exps := []Exp{exp}
 	for lexer.LookAhead() == TOKEN_OP_CONCAT {
 		line, _, _ = lexer.NextToken()
+		column = lexer.Column()
 		exps = append(exps, parseExp4(lexer))
 	}
-	return &ConcatExp{line, exps}
+	return &ConcatExp{line, column, exps}
 }
 
 // x +/- y
@@ -152,7 +153,7 @@ func parseExp4(lexer *Lexer) Exp {
 		switch lexer.LookAhead() {
 		case TOKEN_OP_ADD, TOKEN_OP_SUB:
 			line, op, _ := lexer.NextToken()
-			arith := &BinopExp{line, op, exp, parseExp3(lexer)}
+			arith := &BinopExp{line, lexer.Column(), op, exp, parseExp3(lexer)}
 			exp = optimizeArithBinaryOp(arith)
 		default:
 			return exp
@@ -168,7 +169,7 @@ func parseExp3(lexer *Lexer) Exp {
 		switch lexer.LookAhead() {
 		case TOKEN_OP_MUL, TOKEN_OP_MOD, TOKEN_OP_DIV, TOKEN_OP_IDIV:
 			line, op, _ := lexer.NextToken()
-			arith := &BinopExp{line, op, exp, parseExp2(lexer)}
+			arith := &BinopExp{line, lexer.Column(), op, exp, parseExp2(lexer)}
 			exp = optimizeArithBinaryOp(arith)
 		default:
 			return exp
@@ -179,10 +180,13 @@ func parseExp3(lexer *Lexer) Exp {
 
 // unary
 func parseExp2(lexer *Lexer) Exp {
+	lexer.EnterLevel(MaxSyntaxLevels)
+	defer lexer.LeaveLevel()
+
 	switch lexer.LookAhead() {
 	case TOKEN_OP_UNM, TOKEN_OP_BNOT, TOKEN_OP_LEN, TOKEN_OP_NOT:
 		line, op, _ := lexer.NextToken()
-		exp := &UnopExp{line, op, parseExp2(lexer)}
+		exp := &UnopExp{line, lexer.Column(), op, parseExp2(lexer)}
 		return optimizeUnaryOp(exp) // 优化
 	}
 	return parseExp1(lexer)
@@ -193,7 +197,7 @@ func parseExp1(lexer *Lexer) Exp { // pow is right associative
 	exp := parseExp0(lexer)
 	if lexer.LookAhead() == TOKEN_OP_POW {
 		line, op, _ := lexer.NextToken()
-		exp = &BinopExp{line, op, exp, parseExp2(lexer)}
+		exp = &BinopExp{line, lexer.Column(), op, exp, parseExp2(lexer)}
 	}
 	return optimizePow(exp)
 }
@@ -229,12 +233,12 @@ func parseExp0(lexer *Lexer) Exp {
 
 func parseNumberExp(lexer *Lexer) Exp {
 	line, _, token := lexer.NextToken()
-	if i, ok := number.ParseInteger(token); ok {
+	if i, f, isFloat, ok := number.ParseNumeral(token); ok && !isFloat {
 		return &IntegerExp{line, i}
-	} else if f, ok := number.ParseFloat(token); ok {
+	} else if ok {
 		return &FloatExp{line, f}
-	} else { // todo
-		panic("not a number: " + token)
+	} else {
+		panic(&CompileError{lexer.ChunkName(), line, "malformed number near '" + token + "'"})
 	}
 }
 
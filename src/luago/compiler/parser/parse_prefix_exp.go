@@ -18,7 +18,7 @@ func parsePrefixExp(lexer *Lexer) Exp {
 	var exp Exp
 	if lexer.LookAhead() == TOKEN_IDENTIFIER {
 		line, name := lexer.NextIdentifier() // Name
-		exp = &NameExp{line, name}
+		exp = &NameExp{line, lexer.Column(), name}
 	} else { // ‘(’ exp ‘)’
 		exp = parseParensExp(lexer)
 	}
@@ -44,14 +44,15 @@ func _finishPrefixExp(lexer *Lexer, exp Exp) Exp {
 		switch lexer.LookAhead() {
 		case TOKEN_SEP_LBRACK: // prefixexp ‘[’ exp ‘]’
 			lexer.NextToken()                       // ‘[’
+			column := lexer.Column()                //
 			keyExp := parseExp(lexer)               // exp
 			lexer.NextTokenOfKind(TOKEN_SEP_RBRACK) // ‘]’
-			exp = &TableAccessExp{lexer.Line(), exp, keyExp}
+			exp = &TableAccessExp{lexer.Line(), column, exp, keyExp}
 		case TOKEN_SEP_DOT: // prefixexp ‘.’ Name
 			lexer.NextToken()                    // ‘.’
 			line, name := lexer.NextIdentifier() // Name
 			keyExp := &StringExp{line, name}
-			exp = &TableAccessExp{line, exp, keyExp}
+			exp = &TableAccessExp{line, lexer.Column(), exp, keyExp}
 		case TOKEN_SEP_COLON, // prefixexp ‘:’ Name args
 			TOKEN_SEP_LPAREN, TOKEN_SEP_LCURLY, TOKEN_STRING: // prefixexp args
 			exp = _finishFuncCallExp(lexer, exp)
@@ -66,9 +67,10 @@ func _finishPrefixExp(lexer *Lexer, exp Exp) Exp {
 func _finishFuncCallExp(lexer *Lexer, prefixExp Exp) *FuncCallExp {
 	nameExp := _parseNameExp(lexer)
 	line := lexer.Line() // todo
+	column := lexer.LookAheadColumn()
 	args := _parseArgs(lexer)
 	lastLine := lexer.Line()
-	return &FuncCallExp{line, lastLine, prefixExp, nameExp, args}
+	return &FuncCallExp{line, lastLine, column, prefixExp, nameExp, args}
 }
 
 func _parseNameExp(lexer *Lexer) *StringExp {
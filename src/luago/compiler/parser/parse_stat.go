@@ -68,16 +68,16 @@ func parseBreakStat(lexer *Lexer) *BreakStat {
 // ‘::’ Name ‘::’
 func parseLabelStat(lexer *Lexer) *LabelStat {
 	lexer.NextTokenOfKind(TOKEN_SEP_LABEL) // ::
-	_, name := lexer.NextIdentifier()      // name
+	line, name := lexer.NextIdentifier()   // name
 	lexer.NextTokenOfKind(TOKEN_SEP_LABEL) // ::
-	return &LabelStat{name}
+	return &LabelStat{line, name}
 }
 
 // goto Name
 func parseGotoStat(lexer *Lexer) *GotoStat {
-	lexer.NextTokenOfKind(TOKEN_KW_GOTO) // goto
-	_, name := lexer.NextIdentifier()    // name
-	return &GotoStat{name}
+	line, _ := lexer.NextTokenOfKind(TOKEN_KW_GOTO) // goto
+	_, name := lexer.NextIdentifier()               // name
+	return &GotoStat{line, name}
 }
 
 // do block end
@@ -227,17 +227,51 @@ func _finishLocalFuncDefStat(lexer *Lexer) *LocalFuncDefStat {
 	return &LocalFuncDefStat{name, fdExp}
 }
 
-// local namelist [‘=’ explist]
+// local attnamelist [‘=’ explist]
 func _finishLocalVarDeclStat(lexer *Lexer) *LocalVarDeclStat {
-	_, name0 := lexer.NextIdentifier()        // local Name
-	nameList := _finishNameList(lexer, name0) // { , Name }
+	nameList, attribList := _finishAttNameList(lexer) // attnamelist
 	var expList []Exp = nil
 	if lexer.LookAhead() == TOKEN_OP_ASSIGN {
 		lexer.NextToken()             // ==
 		expList = parseExpList(lexer) // explist
 	}
 	lastLine := lexer.Line()
-	return &LocalVarDeclStat{lastLine, nameList, expList}
+	return &LocalVarDeclStat{lastLine, nameList, attribList, expList}
+}
+
+// attnamelist ::= Name attrib {‘,’ Name attrib}
+func _finishAttNameList(lexer *Lexer) (names, attribs []string) {
+	hasAttrib := false
+	for {
+		_, name := lexer.NextIdentifier() // Name
+		attrib := _parseAttrib(lexer)     // attrib
+		names = append(names, name)
+		attribs = append(attribs, attrib)
+		hasAttrib = hasAttrib || attrib != ""
+		if lexer.LookAhead() != TOKEN_SEP_COMMA {
+			break
+		}
+		lexer.NextToken() // ,
+	}
+	if !hasAttrib {
+		attribs = nil
+	}
+	return
+}
+
+// attrib ::= [‘<’ Name ‘>’], only <const> of Lua 5.4 is supported
+func _parseAttrib(lexer *Lexer) string {
+	if lexer.LookAhead() != TOKEN_OP_LT {
+		return ""
+	}
+	lexer.NextToken()                      // <
+	line, attrib := lexer.NextIdentifier() // Name
+	lexer.NextTokenOfKind(TOKEN_OP_GT)     // >
+	if attrib != "const" {
+		panic(&CompileError{lexer.ChunkName(), line,
+			"unknown attribute '" + attrib + "'"})
+	}
+	return attrib
 }
 
 // varlist ‘=’ explist
@@ -306,19 +340,19 @@ func parseFuncDefStat(lexer *Lexer) *AssignStat {
 // funcname ::= Name {‘.’ Name} [‘:’ Name]
 func _parseFuncName(lexer *Lexer) (exp Exp, hasColon bool) {
 	line, name := lexer.NextIdentifier()
-	exp = &NameExp{line, name}
+	exp = &NameExp{line, lexer.Column(), name}
 
 	for lexer.LookAhead() == TOKEN_SEP_DOT {
 		lexer.NextToken()
 		line, name := lexer.NextIdentifier()
 		idx := &StringExp{line, name}
-		exp = &TableAccessExp{line, exp, idx}
+		exp = &TableAccessExp{line, lexer.Column(), exp, idx}
 	}
 	if lexer.LookAhead() == TOKEN_SEP_COLON {
 		lexer.NextToken()
 		line, name := lexer.NextIdentifier()
 		idx := &StringExp{line, name}
-		exp = &TableAccessExp{line, exp, idx}
+		exp = &TableAccessExp{line, lexer.Column(), exp, idx}
 		hasColon = true
 	}
 
@@ -7,9 +7,24 @@ import (
 
 /* recursive descent parser */
 
+// MaxSyntaxLevels limits how deeply blocks and expressions (parentheses,
+// table constructors, unary operators, nested functions) may nest, so
+// adversarial input cannot exhaust the Go stack.
+var MaxSyntaxLevels = 200
+
 func Parse(chunk, chunkName string) *Block {
 	lexer := NewLexer(chunk, chunkName)
 	block := parseBlock(lexer)
 	lexer.NextTokenOfKind(TOKEN_EOF) // 末尾必须是 EOF,否则语法错误
 	return block
 }
+
+// ParseWithComments also returns the comments of the chunk, which the
+// syntax tree does not keep
+func ParseWithComments(chunk, chunkName string) (*Block, []Comment) {
+	lexer := NewLexer(chunk, chunkName)
+	lexer.KeepComments()
+	block := parseBlock(lexer)
+	lexer.NextTokenOfKind(TOKEN_EOF)
+	return block, lexer.Comments()
+}
@@ -0,0 +1,332 @@
+package console
+
+import (
+	"bufio"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	. "luago/api"
+	"luago/stdlib/inspectlib"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+/*
+远程控制台：把一个正在运行的 LuaState 挂到网络上，运维人员可以用
+telnet / nc 或者 WebSocket 客户端连上来执行 Lua 代码。
+
+	srv, err := console.Listen(ls, ":7000", console.Options{
+		Password: "secret",
+		Timeout:  5 * time.Second,
+	})
+	...
+	srv.Do(func() { ls.Call(0, 0) }) // 宿主自己使用 ls 时同样要持有执行锁
+	srv.Close()
+
+没有设置 Password 时 Listen 会拒绝启动，除非显式设置 Insecure——否则
+任何能连上 addr 的人都拿到了一个不需要认证的 Lua shell。
+
+每行输入是一条命令；能作为表达式求值的行会打印结果，"=expr" 等同于
+"return expr"，":inspect expr" 用 inspect 模块的格式展开表。命令执行期间
+print 的输出发往客户端。
+*/
+type Options struct {
+	Password string        /* required unless Insecure is set */
+	Insecure bool          /* allow an empty Password: no authentication */
+	Timeout  time.Duration /* per command, 0: no limit */
+	Banner   string
+}
+
+type Server struct {
+	ls       LuaState
+	opts     Options
+	listener net.Listener
+	mu       sync.Mutex /* execution mutex, ls is not goroutine-safe */
+
+	connsMu sync.Mutex
+	conns   map[net.Conn]bool
+	closed  bool
+}
+
+// Listen starts serving the console on addr (tcp).
+// Without a Password it fails unless opts.Insecure is set.
+func Listen(ls LuaState, addr string, opts Options) (*Server, error) {
+	if opts.Password == "" && !opts.Insecure {
+		return nil, errors.New("console: empty password, set Options.Insecure to disable authentication")
+	}
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	if opts.Banner == "" {
+		opts.Banner = "luago console"
+	}
+	srv := &Server{
+		ls:       ls,
+		opts:     opts,
+		listener: listener,
+		conns:    map[net.Conn]bool{},
+	}
+	go srv.serve()
+	return srv, nil
+}
+
+// Addr returns the address the console listens on.
+func (self *Server) Addr() net.Addr {
+	return self.listener.Addr()
+}
+
+// Do runs f while holding the execution mutex.
+func (self *Server) Do(f func()) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	f()
+}
+
+// Close stops listening and disconnects all clients.
+func (self *Server) Close() error {
+	self.connsMu.Lock()
+	self.closed = true
+	for conn := range self.conns {
+		conn.Close()
+	}
+	self.connsMu.Unlock()
+	return self.listener.Close()
+}
+
+func (self *Server) serve() {
+	for {
+		conn, err := self.listener.Accept()
+		if err != nil {
+			return
+		}
+		self.connsMu.Lock()
+		if self.closed {
+			self.connsMu.Unlock()
+			conn.Close()
+			return
+		}
+		self.conns[conn] = true
+		self.connsMu.Unlock()
+
+		go func() {
+			defer func() {
+				self.connsMu.Lock()
+				delete(self.conns, conn)
+				self.connsMu.Unlock()
+				conn.Close()
+			}()
+			if lc := accept(conn); lc != nil {
+				newSession(self, lc).run()
+			}
+		}()
+	}
+}
+
+/* line oriented client connection */
+type lineConn interface {
+	ReadLine() (string, error)
+	Write(s string) error
+}
+
+// accept tells WebSocket clients (an HTTP upgrade request) from plain
+// line clients by the first bytes they send.
+func accept(conn net.Conn) lineConn {
+	r := bufio.NewReader(conn)
+	if peek, err := r.Peek(4); err == nil && string(peek) == "GET " {
+		req, err := http.ReadRequest(r)
+		if err != nil {
+			return nil
+		}
+		ws, err := upgrade(conn, r, req)
+		if err != nil {
+			return nil
+		}
+		return ws
+	}
+	return &telnetConn{conn: conn, r: r}
+}
+
+type telnetConn struct {
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+func (self *telnetConn) ReadLine() (string, error) {
+	line, err := self.r.ReadString('\n')
+	if err != nil && line == "" {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+func (self *telnetConn) Write(s string) error {
+	_, err := self.conn.Write([]byte(strings.Replace(s, "\n", "\r\n", -1)))
+	return err
+}
+
+type session struct {
+	srv *Server
+	lc  lineConn
+}
+
+func newSession(srv *Server, lc lineConn) *session {
+	return &session{srv: srv, lc: lc}
+}
+
+func (self *session) run() {
+	if !self.authenticate() {
+		return
+	}
+	self.lc.Write(self.srv.opts.Banner + "\n")
+	for {
+		if self.lc.Write("> ") != nil {
+			return
+		}
+		line, err := self.lc.ReadLine()
+		if err != nil {
+			return
+		}
+		line = strings.TrimSpace(line)
+		switch line {
+		case "":
+			continue
+		case "quit", "exit":
+			return
+		}
+		self.lc.Write(self.execute(line))
+	}
+}
+
+func (self *session) authenticate() bool {
+	password := self.srv.opts.Password
+	if password == "" {
+		return true
+	}
+	for i := 0; i < 3; i++ {
+		if self.lc.Write("password: ") != nil {
+			return false
+		}
+		line, err := self.lc.ReadLine()
+		if err != nil {
+			return false
+		}
+		if subtle.ConstantTimeCompare([]byte(line), []byte(password)) == 1 {
+			return true
+		}
+		time.Sleep(time.Second)
+		self.lc.Write("wrong password\n")
+	}
+	return false
+}
+
+// execute runs one command under the execution mutex and returns its
+// output.
+func (self *session) execute(line string) string {
+	self.srv.mu.Lock()
+	defer self.srv.mu.Unlock()
+
+	ls := self.srv.ls
+	top := ls.GetTop()
+	defer ls.SetTop(top)
+
+	render := format
+	if expr := strings.TrimPrefix(line, ":inspect"); expr != line {
+		line, render = "="+expr, inspect
+	}
+	if strings.HasPrefix(line, "=") {
+		line = "return " + line[1:]
+	}
+	if !load(ls, "return "+line) {
+		ls.Pop(1) /* not an expression, run it as a statement */
+		if !load(ls, line) {
+			return ls.ToString(-1) + "\n"
+		}
+	}
+
+	var out strings.Builder
+	ls.GetGlobal("print")
+	ls.Insert(-2)
+	ls.PushGoFunction(func(ls LuaState) int {
+		out.WriteString(format(ls, 1, ls.GetTop()))
+		return 0
+	})
+	ls.SetGlobal("print")
+
+	status := self.call(ls)
+	nResults := ls.GetTop() - top - 1
+	if status == LUA_OK {
+		out.WriteString(render(ls, top+2, nResults))
+	} else {
+		out.WriteString(fmt.Sprintf("error: %s\n", ls.ToString(-1)))
+	}
+
+	ls.PushValue(top + 1) /* restore print */
+	ls.SetGlobal("print")
+	return out.String()
+}
+
+// call runs the loaded chunk, interrupting it after the timeout
+func (self *session) call(ls LuaState) int {
+	timeout := self.srv.opts.Timeout
+	if timeout <= 0 {
+		return ls.PCall(0, LUA_MULTRET, 0)
+	}
+
+	done := make(chan struct{})
+	finished := make(chan struct{})
+	go func() {
+		defer close(finished)
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		select {
+		case <-done:
+		case <-timer.C:
+			ls.Interrupt(fmt.Sprintf("interrupted: command timed out after %v", timeout))
+		}
+	}()
+
+	status := ls.PCall(0, LUA_MULTRET, 0)
+	close(done)
+	<-finished
+	ls.ClearInterrupt()
+	return status
+}
+
+// load compiles the command, leaving the chunk or the error message
+func load(ls LuaState, code string) bool {
+	return ls.Load([]byte(code), "=console", "t") == LUA_OK
+}
+
+// format renders n values starting at idx like print does
+func format(ls LuaState, idx, n int) string {
+	if n <= 0 {
+		return ""
+	}
+	parts := make([]string, n)
+	for i := 0; i < n; i++ {
+		switch {
+		case ls.IsBoolean(idx + i):
+			parts[i] = fmt.Sprintf("%t", ls.ToBoolean(idx+i))
+		case ls.IsString(idx + i):
+			parts[i] = ls.ToString(idx + i)
+		default:
+			parts[i] = ls.TypeName(ls.Type(idx + i))
+		}
+	}
+	return strings.Join(parts, "\t") + "\n"
+}
+
+// inspect renders n values starting at idx with the inspect module,
+// one per line
+func inspect(ls LuaState, idx, n int) string {
+	var buf strings.Builder
+	for i := 0; i < n; i++ {
+		buf.WriteString(inspectlib.Inspect(ls, idx+i, inspectlib.DefaultOptions))
+		buf.WriteString("\n")
+	}
+	return buf.String()
+}
@@ -0,0 +1,150 @@
+package console
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+)
+
+/*
+最小的 WebSocket (RFC 6455) 服务端：只处理文本帧、ping 和 close，
+每个文本消息是一行命令。
+*/
+
+const wsGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+const (
+	wsOpContinuation = 0x0
+	wsOpText         = 0x1
+	wsOpClose        = 0x8
+	wsOpPing         = 0x9
+	wsOpPong         = 0xA
+)
+
+const wsMaxMessage = 1 << 20
+
+type wsConn struct {
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+func upgrade(conn net.Conn, r *bufio.Reader, req *http.Request) (*wsConn, error) {
+	key := req.Header.Get("Sec-WebSocket-Key")
+	if !strings.EqualFold(req.Header.Get("Upgrade"), "websocket") || key == "" {
+		io.WriteString(conn, "HTTP/1.1 400 Bad Request\r\nConnection: close\r\n\r\n")
+		return nil, errors.New("not a websocket request")
+	}
+
+	h := sha1.New()
+	h.Write([]byte(key + wsGUID))
+	accept := base64.StdEncoding.EncodeToString(h.Sum(nil))
+	_, err := io.WriteString(conn, "HTTP/1.1 101 Switching Protocols\r\n"+
+		"Upgrade: websocket\r\nConnection: Upgrade\r\n"+
+		"Sec-WebSocket-Accept: "+accept+"\r\n\r\n")
+	if err != nil {
+		return nil, err
+	}
+	return &wsConn{conn: conn, r: r}, nil
+}
+
+func (self *wsConn) ReadLine() (string, error) {
+	var msg []byte
+	for {
+		fin, op, payload, err := self.readFrame()
+		if err != nil {
+			return "", err
+		}
+		switch op {
+		case wsOpPing:
+			self.writeFrame(wsOpPong, payload)
+			continue
+		case wsOpPong:
+			continue
+		case wsOpClose:
+			self.writeFrame(wsOpClose, nil)
+			return "", io.EOF
+		}
+		msg = append(msg, payload...)
+		if len(msg) > wsMaxMessage {
+			return "", errors.New("websocket message too large")
+		}
+		if fin {
+			return strings.TrimRight(string(msg), "\r\n"), nil
+		}
+	}
+}
+
+func (self *wsConn) Write(s string) error {
+	return self.writeFrame(wsOpText, []byte(s))
+}
+
+func (self *wsConn) readFrame() (fin bool, op byte, payload []byte, err error) {
+	var head [2]byte
+	if _, err = io.ReadFull(self.r, head[:]); err != nil {
+		return
+	}
+	fin = head[0]&0x80 != 0
+	op = head[0] & 0x0F
+	masked := head[1]&0x80 != 0
+
+	n := uint64(head[1] & 0x7F)
+	switch n {
+	case 126:
+		var ext [2]byte
+		if _, err = io.ReadFull(self.r, ext[:]); err != nil {
+			return
+		}
+		n = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err = io.ReadFull(self.r, ext[:]); err != nil {
+			return
+		}
+		n = binary.BigEndian.Uint64(ext[:])
+	}
+	if n > wsMaxMessage {
+		err = errors.New("websocket frame too large")
+		return
+	}
+
+	var mask [4]byte
+	if masked {
+		if _, err = io.ReadFull(self.r, mask[:]); err != nil {
+			return
+		}
+	}
+	payload = make([]byte, n)
+	if _, err = io.ReadFull(self.r, payload); err != nil {
+		return
+	}
+	if masked {
+		for i := range payload {
+			payload[i] ^= mask[i%4]
+		}
+	}
+	return
+}
+
+// writeFrame sends a single unmasked frame (servers never mask)
+func (self *wsConn) writeFrame(op byte, payload []byte) error {
+	frame := []byte{0x80 | op}
+	n := len(payload)
+	switch {
+	case n < 126:
+		frame = append(frame, byte(n))
+	case n <= 0xFFFF:
+		frame = append(frame, 126, byte(n>>8), byte(n))
+	default:
+		var ext [8]byte
+		binary.BigEndian.PutUint64(ext[:], uint64(n))
+		frame = append(append(frame, 127), ext[:]...)
+	}
+	_, err := self.conn.Write(append(frame, payload...))
+	return err
+}
@@ -0,0 +1,188 @@
+package conv
+
+import (
+	"fmt"
+	. "luago/api"
+	"reflect"
+	"strconv"
+)
+
+const MAX_DEPTH = 200 /* guards ToGo against deep nesting */
+
+// Push converts a Go value to Lua and pushes it onto the stack.
+// Slices and arrays become sequences, maps become tables; nested
+// values are converted recursively.
+func Push(ls LuaState, v interface{}) {
+	switch x := v.(type) {
+	case nil:
+		ls.PushNil()
+	case bool:
+		ls.PushBoolean(x)
+	case int:
+		ls.PushInteger(int64(x))
+	case int8:
+		ls.PushInteger(int64(x))
+	case int16:
+		ls.PushInteger(int64(x))
+	case int32:
+		ls.PushInteger(int64(x))
+	case int64:
+		ls.PushInteger(x)
+	case uint:
+		ls.PushInteger(int64(x))
+	case uint8:
+		ls.PushInteger(int64(x))
+	case uint16:
+		ls.PushInteger(int64(x))
+	case uint32:
+		ls.PushInteger(int64(x))
+	case uint64:
+		ls.PushInteger(int64(x))
+	case float32:
+		ls.PushNumber(float64(x))
+	case float64:
+		ls.PushNumber(x)
+	case string:
+		ls.PushString(x)
+	case []byte:
+		ls.PushString(string(x))
+	case error:
+		ls.PushString(x.Error())
+	case GoFunction:
+		ls.PushGoFunction(x)
+	case func(LuaState) int:
+		ls.PushGoFunction(x)
+	default:
+		pushReflect(ls, reflect.ValueOf(v))
+	}
+}
+
+func pushReflect(ls LuaState, v reflect.Value) {
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			ls.PushNil()
+		} else {
+			Push(ls, v.Elem().Interface())
+		}
+	case reflect.Slice, reflect.Array:
+		checkStack(ls)
+		n := v.Len()
+		ls.CreateTable(n, 0)
+		for i := 0; i < n; i++ {
+			Push(ls, v.Index(i).Interface())
+			ls.RawSetI(-2, int64(i+1))
+		}
+	case reflect.Map:
+		checkStack(ls)
+		ls.CreateTable(0, v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			Push(ls, iter.Key().Interface())
+			Push(ls, iter.Value().Interface())
+			ls.RawSet(-3)
+		}
+	default:
+		panic(fmt.Sprintf("conv: cannot convert %s to a Lua value", v.Type()))
+	}
+}
+
+// a table, a key and a value
+func checkStack(ls LuaState) {
+	if !ls.CheckStack(3) {
+		panic("conv: table nested too deeply")
+	}
+}
+
+// ToGo converts the Lua value at idx to Go: nil, bool, int64, float64,
+// string, GoFunction, []interface{} for sequences and
+// map[string]interface{} for other tables (non-string keys are
+// formatted). Lua functions and other values convert to nil.
+// A table that contains itself raises "conv: cycle detected".
+func ToGo(ls LuaState, idx int) interface{} {
+	return toGo(ls, ls.AbsIndex(idx), 0, map[uintptr]bool{})
+}
+
+// open holds the tables being converted, from the root down to idx
+func toGo(ls LuaState, idx, depth int, open map[uintptr]bool) interface{} {
+	switch ls.Type(idx) {
+	case LUA_TBOOLEAN:
+		return ls.ToBoolean(idx)
+	case LUA_TNUMBER:
+		if ls.IsInteger(idx) {
+			return ls.ToInteger(idx)
+		}
+		return ls.ToNumber(idx)
+	case LUA_TSTRING:
+		return ls.ToString(idx)
+	case LUA_TTABLE:
+		p := ls.ToPointer(idx)
+		if open[p] {
+			panic("conv: cycle detected")
+		}
+		if depth >= MAX_DEPTH {
+			panic("conv: table nested too deeply")
+		}
+		checkStack(ls)
+		open[p] = true
+		v := tableToGo(ls, idx, depth+1, open)
+		delete(open, p) /* shared subtables are not cycles */
+		return v
+	case LUA_TFUNCTION:
+		if f := ls.ToGoFunction(idx); f != nil {
+			return f
+		}
+		return nil
+	case LUA_TUSERDATA, LUA_TLIGHTUSERDATA:
+		return ls.ToUserData(idx)
+	default:
+		return nil
+	}
+}
+
+func tableToGo(ls LuaState, idx, depth int, open map[uintptr]bool) interface{} {
+	if n := int64(ls.RawLen(idx)); n > 0 && isSequence(ls, idx, n) {
+		arr := make([]interface{}, n)
+		for i := int64(1); i <= n; i++ {
+			ls.RawGetI(idx, i)
+			arr[i-1] = toGo(ls, ls.AbsIndex(-1), depth, open)
+			ls.Pop(1)
+		}
+		return arr
+	}
+
+	m := map[string]interface{}{}
+	ls.PushNil()
+	for ls.Next(idx) {
+		m[keyToString(ls, -2)] = toGo(ls, ls.AbsIndex(-1), depth, open)
+		ls.Pop(1)
+	}
+	return m
+}
+
+// a table is a sequence if its keys are exactly 1..n
+func isSequence(ls LuaState, idx int, n int64) bool {
+	count := int64(0)
+	ls.PushNil()
+	for ls.Next(idx) {
+		count++
+		ls.Pop(1)
+	}
+	return count == n
+}
+
+func keyToString(ls LuaState, idx int) string {
+	switch ls.Type(idx) {
+	case LUA_TSTRING:
+		return ls.ToString(idx)
+	case LUA_TNUMBER:
+		if ls.IsInteger(idx) {
+			return strconv.FormatInt(ls.ToInteger(idx), 10)
+		}
+		return strconv.FormatFloat(ls.ToNumber(idx), 'g', -1, 64)
+	case LUA_TBOOLEAN:
+		return strconv.FormatBool(ls.ToBoolean(idx))
+	default:
+		return ls.TypeName(ls.Type(idx))
+	}
+}
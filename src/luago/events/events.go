@@ -0,0 +1,264 @@
+package events
+
+import (
+	"fmt"
+	. "luago/api"
+	"luago/conv"
+	"sync"
+)
+
+const EVENTS_TABLE = "_EVENTS" /* registry table: handler id -> function */
+
+/*
+事件总线：宿主注册事件名，脚本订阅，宿主派发。
+
+	bus := events.New(ls)
+	bus.Register("tick", "quit")
+	bus.Open()                   // 全局 events 表
+	bus.Emit("tick", dt)         // 立即派发
+	bus.Post("quit")             // 入队（可在任意 goroutine 调用）
+	bus.Dispatch()               // 在持有 ls 的 goroutine 上派发队列
+
+脚本侧：
+
+	local id = events.on("tick", function(dt) ... end)
+	events.once("quit", f)
+	events.off("tick", id)
+	events.emit("tick", 0.5)
+*/
+type Bus struct {
+	ls       LuaState
+	handlers map[string][]handler /* registered events and their handlers */
+	nextId   int64
+
+	mu    sync.Mutex /* guards queue */
+	queue []event
+}
+
+type handler struct {
+	id   int64
+	once bool
+}
+
+type event struct {
+	name    string
+	payload []interface{}
+}
+
+func New(ls LuaState) *Bus {
+	return &Bus{
+		ls:       ls,
+		handlers: map[string][]handler{},
+	}
+}
+
+// Register declares the events scripts may subscribe to.
+func (self *Bus) Register(names ...string) {
+	for _, name := range names {
+		if _, found := self.handlers[name]; !found {
+			self.handlers[name] = nil
+		}
+	}
+}
+
+// Open installs the global events table.
+func (self *Bus) Open() {
+	ls := self.ls
+	ls.NewTable()
+	ls.SetField(LUA_REGISTRYINDEX, EVENTS_TABLE)
+
+	ls.NewTable()
+	ls.PushGoFunction(self.luaOn)
+	ls.SetField(-2, "on")
+	ls.PushGoFunction(self.luaOnce)
+	ls.SetField(-2, "once")
+	ls.PushGoFunction(self.luaOff)
+	ls.SetField(-2, "off")
+	ls.PushGoFunction(self.luaEmit)
+	ls.SetField(-2, "emit")
+	ls.SetGlobal("events")
+}
+
+// Emit calls the handlers of the event immediately, converting the
+// payload with conv.Push. Handlers run in protected mode; the first
+// error is returned after all handlers have run.
+func (self *Bus) Emit(name string, payload ...interface{}) error {
+	return self.emit(name, func(ls LuaState) int {
+		for _, v := range payload {
+			conv.Push(ls, v)
+		}
+		return len(payload)
+	})
+}
+
+// pushArgs pushes the handler arguments and returns their number
+func (self *Bus) emit(name string, pushArgs func(LuaState) int) error {
+	handlers, found := self.handlers[name]
+	if !found {
+		return fmt.Errorf("events: unknown event '%s'", name)
+	}
+
+	var firstErr error
+	for _, h := range handlers {
+		if h.once && !self.unlist(name, h.id) {
+			continue /* already fired by a nested emit */
+		}
+		if err := self.call(name, h.id, pushArgs); err != nil && firstErr == nil {
+			firstErr = err
+		}
+		if h.once {
+			self.release(h.id)
+		}
+	}
+	return firstErr
+}
+
+// Post queues the event for the next Dispatch. It is safe to call
+// from any goroutine.
+func (self *Bus) Post(name string, payload ...interface{}) {
+	self.mu.Lock()
+	self.queue = append(self.queue, event{name, payload})
+	self.mu.Unlock()
+}
+
+// Dispatch emits all queued events in order. Events posted by the
+// handlers are delivered by the next Dispatch.
+func (self *Bus) Dispatch() error {
+	self.mu.Lock()
+	queue := self.queue
+	self.queue = nil
+	self.mu.Unlock()
+
+	var firstErr error
+	for _, e := range queue {
+		if err := self.Emit(e.name, e.payload...); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// Pending returns the number of queued events.
+func (self *Bus) Pending() int {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	return len(self.queue)
+}
+
+func (self *Bus) call(name string, id int64, pushArgs func(LuaState) int) error {
+	ls := self.ls
+	top := ls.GetTop()
+	defer ls.SetTop(top)
+
+	ls.GetField(LUA_REGISTRYINDEX, EVENTS_TABLE)
+	if ls.RawGetI(-1, id) != LUA_TFUNCTION {
+		return nil /* removed by an earlier handler */
+	}
+	if ls.PCall(pushArgs(ls), 0, 0) != LUA_OK {
+		return fmt.Errorf("events: error in '%s' handler: %v", name, errorValue(ls))
+	}
+	return nil
+}
+
+func errorValue(ls LuaState) string {
+	return ls.ErrorMessage(-1)
+}
+
+func (self *Bus) add(name string, once bool) int64 {
+	self.nextId++
+	id := self.nextId
+	ls := self.ls
+	ls.GetField(LUA_REGISTRYINDEX, EVENTS_TABLE)
+	ls.PushValue(2)
+	ls.RawSetI(-2, id)
+	ls.Pop(1)
+	self.handlers[name] = append(self.handlers[name], handler{id, once})
+	return id
+}
+
+func (self *Bus) remove(name string, id int64) bool {
+	if self.unlist(name, id) {
+		self.release(id)
+		return true
+	}
+	return false
+}
+
+// unlist removes the handler from the event, it will not be called again
+func (self *Bus) unlist(name string, id int64) bool {
+	handlers := self.handlers[name]
+	for i, h := range handlers {
+		if h.id == id {
+			/* copy, emit may be iterating over the old slice */
+			newHandlers := make([]handler, 0, len(handlers)-1)
+			newHandlers = append(newHandlers, handlers[:i]...)
+			self.handlers[name] = append(newHandlers, handlers[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// release drops the handler function from the registry
+func (self *Bus) release(id int64) {
+	ls := self.ls
+	ls.GetField(LUA_REGISTRYINDEX, EVENTS_TABLE)
+	ls.PushNil()
+	ls.RawSetI(-2, id)
+	ls.Pop(1)
+}
+
+func (self *Bus) checkEvent(ls LuaState) string {
+	name := ls.ToString(1)
+	if _, found := self.handlers[name]; !found {
+		ls.PushString(fmt.Sprintf("unknown event '%s'", name))
+		ls.Error()
+	}
+	return name
+}
+
+// events.on (name, f)
+func (self *Bus) luaOn(ls LuaState) int {
+	name := self.checkEvent(ls)
+	if !ls.IsFunction(2) {
+		ls.PushString("bad argument #2 to 'on' (function expected)")
+		return ls.Error()
+	}
+	ls.PushInteger(self.add(name, false))
+	return 1
+}
+
+// events.once (name, f)
+func (self *Bus) luaOnce(ls LuaState) int {
+	name := self.checkEvent(ls)
+	if !ls.IsFunction(2) {
+		ls.PushString("bad argument #2 to 'once' (function expected)")
+		return ls.Error()
+	}
+	ls.PushInteger(self.add(name, true))
+	return 1
+}
+
+// events.off (name, id)
+func (self *Bus) luaOff(ls LuaState) int {
+	name := self.checkEvent(ls)
+	ls.PushBoolean(self.remove(name, ls.ToInteger(2)))
+	return 1
+}
+
+// events.emit (name, ···)
+func (self *Bus) luaEmit(ls LuaState) int {
+	name := self.checkEvent(ls)
+	nArgs := ls.GetTop() - 1
+	err := self.emit(name, func(ls LuaState) int {
+		for i := 2; i <= nArgs+1; i++ {
+			ls.PushValue(i)
+		}
+		return nArgs
+	})
+	if err != nil {
+		ls.PushString(err.Error())
+		return ls.Error()
+	}
+	return 0
+}
@@ -1,13 +1,16 @@
+//go:build !js
+// +build !js
+
 package main
 
 import (
 	"fmt"
 	"io/ioutil"
+	"luago/actor"
 	. "luago/api"
+	"luago/auxlib"
 	"luago/binchunk"
 	"luago/compiler"
-	"luago/state"
-	"time"
 
 	. "luago/binchunk"
 
@@ -17,119 +20,69 @@ import (
 func main() {
 
 	if len(os.Args) > 1 {
-		data, err := ioutil.ReadFile(os.Args[1])
-		if err != nil {
-			panic(err)
+		if tool, found := tools[os.Args[1]]; found {
+			os.Exit(tool(os.Args[2:]))
 		}
+
 		//testDump(data, os.Args[1])
 		//testUnDump()
 		//TestLexer(string(data), os.Args[1])
 		//	TestParser(string(data), os.Args[1])
 
-		ls := state.New()
-		ls.Register("print", print)
-		ls.Register("getmetatable", getMetatable)
-		ls.Register("setmetatable", setMetatable)
-		ls.Register("next", next)
-		ls.Register("pairs", pairs)
-		ls.Register("ipairs", iPairs)
-		ls.Register("error", error)
-		ls.Register("pcall", pCall)
-		ls.Register("clock", clock)
-		ls.Load(data, os.Args[1], "bt")
-		ls.Call(0, 0)
-
-	}
-
-}
-
-/*
-	当Go函数结束之后，把需要返回的值留在栈顶，然后返回一个整数表示返回值个数。
-*/
-func clock(ls LuaState) int {
-	_time := time.Now().UnixNano()
-	ls.PushInteger(_time)
-	return 1
-}
-
-func print(ls LuaState) int {
-	nArgs := ls.GetTop()
-	for i := 1; i <= nArgs; i++ {
-		if ls.IsBoolean(i) {
-			fmt.Printf("%t", ls.ToBoolean(i))
-		} else if ls.IsString(i) {
-			fmt.Print(ls.ToString(i))
+		actors := actor.New(newState)
+		ls := newState()
+		actors.Open(ls)
+		trace := startTrace(ls)
+		createArgTable(ls, os.Args, 1)
+		if auxlib.LoadFile(ls, os.Args[1]) != LUA_OK {
+			report(ls)
+			os.Exit(1)
+		}
+		nArgs := pushArgs(ls, os.Args[2:])
+		status := docall(ls, nArgs, 0)
+		stopTrace(trace)
+		if status != LUA_OK {
+			report(ls)
 		} else {
-			fmt.Print(ls.TypeName(ls.Type(i)))
+			actors.Wait()
 		}
-		if i < nArgs {
-			fmt.Print("\t")
+		ls.Close() /* runs the pending finalizers and closes open files, like lua.c's lua_close */
+		if status != LUA_OK {
+			os.Exit(1)
 		}
-	}
-	fmt.Println()
-	return 0
-}
 
-func getMetatable(ls LuaState) int {
-	if !ls.GetMetatable(1) {
-		ls.PushNil()
 	}
-	return 1
-}
 
-func setMetatable(ls LuaState) int {
-	ls.SetMetatable(1)
-	return 1
 }
 
-func next(ls LuaState) int {
-	ls.SetTop(2) /* create a 2nd argument if there isn't one */
-	if ls.Next(1) {
-		return 2
-	} else {
-		ls.PushNil()
-		return 1
+// sets the global 'arg' like the standalone lua: arg[0] is the script
+// name, its arguments follow and the interpreter name gets index -1
+func createArgTable(ls LuaState, argv []string, script int) {
+	ls.CreateTable(len(argv)-script-1, script+1)
+	for i, a := range argv {
+		ls.PushString(a)
+		ls.RawSetI(-2, int64(i-script))
 	}
+	ls.SetGlobal("arg")
 }
 
-func pairs(ls LuaState) int {
-	ls.PushGoFunction(next) /* will return generator, */
-	ls.PushValue(1)         /* state, */
-	ls.PushNil()
-	return 3
-}
-
-func iPairs(ls LuaState) int {
-	ls.PushGoFunction(_iPairsAux) /* iteration function */
-	ls.PushValue(1)               /* state */
-	ls.PushInteger(0)             /* initial value */
-	return 3
-}
-
-func _iPairsAux(ls LuaState) int {
-	i := ls.ToInteger(2) + 1
-	ls.PushInteger(i)
-	if ls.GetI(1, i) == LUA_TNIL {
-		return 1
-	} else {
-		return 2
+// the arguments of the script are also passed to the main chunk as ...
+func pushArgs(ls LuaState, args []string) int {
+	if !ls.CheckStack(len(args) + 3) {
+		fmt.Fprintln(os.Stderr, "luago: too many arguments to script")
+		os.Exit(1)
 	}
-}
-
-func error(ls LuaState) int {
-	return ls.Error()
-}
-
-func pCall(ls LuaState) int {
-	nArgs := ls.GetTop() - 1
-	status := ls.PCall(nArgs, -1, 0)
-	ls.PushBoolean(status == LUA_OK)
-	ls.Insert(1)
-	return ls.GetTop()
+	for _, a := range args {
+		ls.PushString(a)
+	}
+	return len(args)
 }
 
 func testDump(data []byte, fileName string) {
-	proto := compiler.Compile(string(data), fileName)
+	proto, err := compiler.Compile(string(data), fileName)
+	if err != nil {
+		panic(err)
+	}
 	fmt.Printf("%+v\n", proto)
 	ListProto(proto)
 	_ = Dump(proto)
@@ -144,15 +97,7 @@ func testUnDump() {
 
 	proto := binchunk.Undump(data)
 	fmt.Printf("undump:\n%+v\n", proto)
-	ls := state.New()
-	ls.Register("print", print)
-	ls.Register("getmetatable", getMetatable)
-	ls.Register("setmetatable", setMetatable)
-	ls.Register("next", next)
-	ls.Register("pairs", pairs)
-	ls.Register("ipairs", iPairs)
-	ls.Register("error", error)
-	ls.Register("pcall", pCall)
+	ls := newState()
 	ls.Load(data, "my_luac.out", "bt")
 	ls.Call(0, 0)
 }
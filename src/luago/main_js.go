@@ -0,0 +1,55 @@
+//go:build js && wasm
+// +build js,wasm
+
+package main
+
+import (
+	. "luago/api"
+	"luago/vfs"
+	"syscall/js"
+)
+
+/*
+浏览器入口：导出全局对象 luago
+
+	luago.run(source [, chunkName])   运行代码，出错时返回错误信息
+	luago.addFile(name, source)       向内存文件系统添加文件，供 require 使用
+*/
+func main() {
+	files := vfs.MapFileSystem{}
+	vfs.FS = files
+	ls := newState()
+
+	luago := js.Global().Get("Object").New()
+	luago.Set("run", js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		chunkName := "=stdin"
+		if len(args) > 1 {
+			chunkName = args[1].String()
+		}
+		return run(ls, args[0].String(), chunkName)
+	}))
+	luago.Set("addFile", js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		files.WriteFile(args[0].String(), []byte(args[1].String()))
+		return nil
+	}))
+	js.Global().Set("luago", luago)
+
+	select {} /* keep the callbacks alive */
+}
+
+func run(ls LuaState, source, chunkName string) interface{} {
+	top := ls.GetTop()
+	defer ls.SetTop(top)
+
+	ls.PushGoFunction(func(ls LuaState) int {
+		if ls.Load([]byte(source), chunkName, "bt") != LUA_OK {
+			return ls.Error()
+		}
+		ls.Call(0, 0)
+		return 0
+	})
+	if ls.PCall(0, 0, 0) != LUA_OK {
+		return ls.ErrorMessage(-1)
+	}
+	return nil
+}
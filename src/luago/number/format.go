@@ -0,0 +1,60 @@
+package number
+
+import (
+	"math"
+	"strconv"
+)
+
+/*
+数字转字符串：小整数的字符串预先生成，其余用 strconv 直接格式化，
+不经过 fmt（fmt.Sprintf 要做参数装箱和格式串解析）。
+浮点数和 Lua 一样按 %.14g 格式化，看起来像整数时加上 ".0"，
+无穷和 NaN 写成 inf、-inf、nan、-nan（和 glibc 一样）。
+*/
+const smallIntMin = -128
+const smallIntMax = 1023
+
+var smallInts [smallIntMax - smallIntMin + 1]string
+
+func init() {
+	for i := range smallInts {
+		smallInts[i] = strconv.Itoa(i + smallIntMin)
+	}
+}
+
+func IntegerToString(i int64) string {
+	if i >= smallIntMin && i <= smallIntMax {
+		return smallInts[i-smallIntMin]
+	}
+	var buf [24]byte
+	return string(strconv.AppendInt(buf[:0], i, 10))
+}
+
+func FloatToString(f float64) string {
+	switch {
+	case math.IsInf(f, 1):
+		return "inf"
+	case math.IsInf(f, -1):
+		return "-inf"
+	case math.IsNaN(f):
+		if math.Signbit(f) {
+			return "-nan"
+		}
+		return "nan"
+	}
+	var buf [32]byte
+	b := strconv.AppendFloat(buf[:0], f, 'g', 14, 64)
+	if looksLikeInt(b) {
+		b = append(b, ".0"...) /* adds '.0' to result */
+	}
+	return string(b)
+}
+
+func looksLikeInt(b []byte) bool {
+	for _, c := range b {
+		if c != '-' && (c < '0' || c > '9') {
+			return false
+		}
+	}
+	return true
+}
@@ -2,10 +2,56 @@ package number
 
 import "math"
 
-// todo: correct?
+// converts f if it has an exact integer representation; the range
+// is checked first, out of range conversions are not defined in Go
 func FloatToInteger(f float64) (int64, bool) {
-	i := int64(f)
-	return i, float64(i) == f
+	if f >= -(1<<63) && f < 1<<63 {
+		i := int64(f)
+		return i, float64(i) == f
+	}
+	return 0, false
+}
+
+// the comparisons of an integer with a float are exact, like
+// LTintfloat and the others of Lua 5.4, instead of converting the
+// integer to a float; nan compares false
+
+// i == f
+func IntEqFloat(i int64, f float64) bool {
+	fi, ok := FloatToInteger(f)
+	return ok && i == fi
+}
+
+// i < f <=> i < ceil(f)
+func IntLtFloat(i int64, f float64) bool {
+	if fi, ok := FloatToInteger(math.Ceil(f)); ok {
+		return i < fi
+	}
+	return f > 0
+}
+
+// i <= f <=> i <= floor(f)
+func IntLeFloat(i int64, f float64) bool {
+	if fi, ok := FloatToInteger(math.Floor(f)); ok {
+		return i <= fi
+	}
+	return f > 0
+}
+
+// f < i <=> floor(f) < i
+func FloatLtInt(f float64, i int64) bool {
+	if fi, ok := FloatToInteger(math.Floor(f)); ok {
+		return fi < i
+	}
+	return f < 0
+}
+
+// f <= i <=> ceil(f) <= i
+func FloatLeInt(f float64, i int64) bool {
+	if fi, ok := FloatToInteger(math.Ceil(f)); ok {
+		return fi <= i
+	}
+	return f < 0
 }
 
 // a % b == a - ((a // b) * b)
@@ -13,15 +59,14 @@ func IMod(a, b int64) int64 {
 	return a - IFloorDiv(a, b)*b
 }
 
-// a % b == a - ((a // b) * b)
+// like fmod, with the sign of the result adjusted to the one of b,
+// as luai_nummod does
 func FMod(a, b float64) float64 {
-	if a > 0 && math.IsInf(b, 1) || a < 0 && math.IsInf(b, -1) {
-		return a
-	}
-	if a > 0 && math.IsInf(b, -1) || a < 0 && math.IsInf(b, 1) {
-		return b
+	m := math.Mod(a, b)
+	if m > 0 && b < 0 || m < 0 && b > 0 {
+		m += b
 	}
-	return a - math.Floor(a/b)*b
+	return m
 }
 
 func IFloorDiv(a, b int64) int64 {
@@ -51,3 +96,44 @@ func ShiftRight(a, n int64) int64 {
 		return ShiftLeft(a, -n)
 	}
 }
+
+// ForLimit converts the float limit of a for loop with an integer
+// initial value and step, like forlimit of Lua 5.4: the limit is
+// rounded toward the loop and clipped to the integer range. skip
+// reports a clipped limit that the loop cannot reach.
+func ForLimit(limit float64, step int64) (lim int64, skip bool) {
+	if step < 0 {
+		limit = math.Ceil(limit)
+	} else {
+		limit = math.Floor(limit)
+	}
+	if i, ok := FloatToInteger(limit); ok {
+		return i, false
+	}
+	if limit > 0 { /* too large; nan is taken as too small */
+		return math.MaxInt64, step < 0
+	}
+	return math.MinInt64, step > 0
+}
+
+// ForCount returns the number of iterations after the first one of a
+// for loop with integer values, like forprep of Lua 5.4; it cannot
+// overflow. skip reports a loop that runs no times. step is not 0.
+func ForCount(init, limit, step int64) (count uint64, skip bool) {
+	if step > 0 {
+		if init > limit {
+			return 0, true
+		}
+		count = uint64(limit) - uint64(init)
+		if step != 1 { /* avoid division in the too common case */
+			count /= uint64(step)
+		}
+	} else {
+		if init < limit {
+			return 0, true
+		}
+		count = uint64(init) - uint64(limit)
+		count /= uint64(-(step + 1)) + 1 /* 'step+1' avoids negating minint */
+	}
+	return count, false
+}
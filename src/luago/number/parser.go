@@ -1,174 +1,246 @@
 package number
 
 import "math"
-import "regexp"
-import "strings"
 import "strconv"
 
-var reInteger = regexp.MustCompile(`^[+-]?[0-9]+$|^-?0x[0-9a-f]+$`)
-var reHexFloat = regexp.MustCompile(`^([0-9a-f]+(\.[0-9a-f]*)?|([0-9a-f]*\.[0-9a-f]+))(p[+\-]?[0-9]+)?$`)
+/*
+Lua 数字字面量的完整文法（与 lua_stringtonumber 一致），
+词法分析、tonumber 和算术运算的字符串转换都用它：
+
+	[空白] [符号] 十进制整数 | 十进制浮点数 [e 指数]
+	              0x 十六进制整数 | 0x 十六进制浮点数 [p 指数] [空白]
+
+十六进制整数溢出时回绕；十进制整数溢出时按浮点数读取；
+inf、nan 之类的写法不是数字。
+*/
+func ParseNumeral(str string) (i int64, f float64, isFloat, ok bool) {
+	s := trimSpace(str)
+	neg := false
+	if len(s) > 0 && (s[0] == '-' || s[0] == '+') {
+		neg = s[0] == '-'
+		s = s[1:]
+	}
+	if len(s) > 1 && s[0] == '0' && (s[1] == 'x' || s[1] == 'X') {
+		i, f, isFloat, ok = parseHex(s[2:])
+	} else {
+		i, f, isFloat, ok = parseDecimal(s, neg)
+		if ok && !isFloat {
+			return i, 0, false, true /* sign already applied */
+		}
+	}
+	if neg {
+		i, f = -i, -f
+	}
+	return
+}
 
+// ParseInteger accepts numerals that denote integers
 func ParseInteger(str string) (int64, bool) {
-	str = strings.TrimSpace(str)
-	str = strings.ToLower(str)
+	i, _, isFloat, ok := ParseNumeral(str)
+	return i, ok && !isFloat
+}
 
-	if !reInteger.MatchString(str) { // float?
+// ParseFloat accepts any numeral, converting integers to floats
+func ParseFloat(str string) (float64, bool) {
+	i, f, isFloat, ok := ParseNumeral(str)
+	if ok && !isFloat {
+		return float64(i), true
+	}
+	return f, ok
+}
+
+// ParseIntegerBase reads an integer numeral in the given base (2 to
+// 36) with an optional sign and surrounding spaces, like the l_str2int
+// of tonumber; it wraps around on overflow
+func ParseIntegerBase(str string, base int) (int64, bool) {
+	s := trimSpace(str)
+	neg := false
+	if len(s) > 0 && (s[0] == '-' || s[0] == '+') {
+		neg = s[0] == '-'
+		s = s[1:]
+	}
+	if len(s) == 0 { /* no digit? */
 		return 0, false
 	}
-	if str[0] == '+' {
-		str = str[1:]
+	var n uint64
+	for i := 0; i < len(s); i++ {
+		digit := digitValue(s[i])
+		if digit < 0 || digit >= base {
+			return 0, false /* invalid numeral */
+		}
+		n = n*uint64(base) + uint64(digit)
 	}
-	if strings.Index(str, "0x") < 0 { // decimal
-		i, err := strconv.ParseInt(str, 10, 64)
-		return i, err == nil
-	}
-
-	// hex
-	var sign int64 = 1
-	if str[0] == '-' {
-		sign = -1
-		str = str[3:]
-	} else {
-		str = str[2:]
+	if neg {
+		n = 0 - n
 	}
+	return int64(n), true
+}
 
-	if len(str) > 16 {
-		str = str[len(str)-16:] // cut long hex string
-	}
+// the value of an alphanumeric digit, -1 for other characters
+func digitValue(c byte) int {
+	switch {
+	case c >= '0' && c <= '9':
+		return int(c - '0')
+	case c >= 'a' && c <= 'z':
+		return int(c-'a') + 10
+	case c >= 'A' && c <= 'Z':
+		return int(c-'A') + 10
+	}
+	return -1
+}
 
-	i, err := strconv.ParseUint(str, 16, 64)
-	return sign * int64(i), err == nil
+// isspace in the C locale
+func isSpace(c byte) bool {
+	return c == ' ' || c >= '\t' && c <= '\r'
 }
 
-func ParseFloat(str string) (float64, bool) {
-	str = strings.TrimSpace(str)
-	str = strings.ToLower(str)
-	if strings.Contains(str, "nan") || strings.Contains(str, "inf") {
-		return 0, false
+func trimSpace(s string) string {
+	for len(s) > 0 && isSpace(s[0]) {
+		s = s[1:]
 	}
-	if strings.HasPrefix(str, "0x") && len(str) > 2 {
-		return parseHexFloat(str[2:])
+	for len(s) > 0 && isSpace(s[len(s)-1]) {
+		s = s[:len(s)-1]
 	}
-	if strings.HasPrefix(str, "+0x") && len(str) > 3 {
-		return parseHexFloat(str[3:])
-	}
-	if strings.HasPrefix(str, "-0x") && len(str) > 3 {
-		f, ok := parseHexFloat(str[3:])
-		return -f, ok
-	}
-	f, err := strconv.ParseFloat(str, 64)
-	return f, err == nil
+	return s
 }
 
-// (0x)ABC.DEFp10
-func parseHexFloat(str string) (float64, bool) {
-	var i16, f16, p10 float64 = 0, 0, 0
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
 
-	if !reHexFloat.MatchString(str) {
-		return 0, false
+func hexValue(c byte) int {
+	switch {
+	case c >= '0' && c <= '9':
+		return int(c - '0')
+	case c >= 'a' && c <= 'f':
+		return int(c-'a') + 10
+	case c >= 'A' && c <= 'F':
+		return int(c-'A') + 10
 	}
+	return -1
+}
 
-	// decimal exponent
-	if idxOfP := strings.Index(str, "p"); idxOfP > 0 {
-		digits := str[idxOfP+1:]
-		str = str[:idxOfP]
-
-		var sign float64 = 1
-		if digits[0] == '-' {
-			sign = -1
+// digits [. digits] [(e|E) [+-] digits]
+func parseDecimal(s string, neg bool) (int64, float64, bool, bool) {
+	n, nDigits, isFloat := 0, 0, false
+	for n < len(s) && isDigit(s[n]) {
+		n, nDigits = n+1, nDigits+1
+	}
+	if n < len(s) && s[n] == '.' {
+		isFloat = true
+		for n++; n < len(s) && isDigit(s[n]); n++ {
+			nDigits++
 		}
-		if digits[0] == '-' || digits[0] == '+' {
-			digits = digits[1:]
+	}
+	if nDigits == 0 {
+		return 0, 0, false, false
+	}
+	if n < len(s) && (s[n] == 'e' || s[n] == 'E') {
+		isFloat = true
+		if n++; n < len(s) && (s[n] == '+' || s[n] == '-') {
+			n++
 		}
-
-		if len(str) == 0 || len(digits) == 0 {
-			return 0, false
+		if n == len(s) || !isDigit(s[n]) {
+			return 0, 0, false, false
 		}
+		for n < len(s) && isDigit(s[n]) {
+			n++
+		}
+	}
+	if n != len(s) {
+		return 0, 0, false, false
+	}
 
-		for i := 0; i < len(digits); i++ {
-			if x, ok := parseDigit(digits[i], 10); ok {
-				p10 = p10*10 + x
-			} else {
-				return 0, false
+	if !isFloat {
+		if u, err := strconv.ParseUint(s, 10, 64); err == nil {
+			if u <= math.MaxInt64 {
+				if neg {
+					return -int64(u), 0, false, true
+				}
+				return int64(u), 0, false, true
+			}
+			if neg && u == 1<<63 {
+				return math.MinInt64, 0, false, true
 			}
 		}
-
-		p10 = sign * p10
+		/* does not fit in an integer, read it as a float */
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil && err.(*strconv.NumError).Err != strconv.ErrRange {
+		return 0, 0, false, false
 	}
+	return 0, f, true, true
+}
 
-	// fractional part
-	if idxOfDot := strings.Index(str, "."); idxOfDot >= 0 {
-		digits := str[idxOfDot+1:]
-		str = str[:idxOfDot]
-		if len(str) == 0 && len(digits) == 0 {
-			return 0, false
+// hexdigits [. hexdigits] [(p|P) [+-] digits], after the 0x
+func parseHex(s string) (int64, float64, bool, bool) {
+	const maxSigDigits = 30
+
+	var u uint64  /* the integer value, wraps around */
+	var m float64 /* the mantissa, of the first significant digits */
+	exp := 0      /* binary exponent correcting the mantissa */
+	nSig, nDigits := 0, 0
+	n, isFloat := 0, false
+	for ; n < len(s); n++ {
+		c := s[n]
+		if c == '.' {
+			if isFloat {
+				break
+			}
+			isFloat = true
+			continue
+		}
+		d := hexValue(c)
+		if d < 0 {
+			break
 		}
-		for i := len(digits) - 1; i >= 0; i-- {
-			if x, ok := parseDigit(digits[i], 16); ok {
-				f16 = (f16 + x) / 16
-			} else {
-				return 0, false
+		nDigits++
+		u = u<<4 + uint64(d)
+		if nSig == 0 && d == 0 { /* leading zero */
+			if isFloat {
+				exp -= 4
 			}
+			continue
 		}
-	}
-
-	// integral part
-	for i := 0; i < len(str); i++ {
-		if x, ok := parseDigit(str[i], 16); ok {
-			i16 = i16*16 + x
-		} else {
-			return 0, false
+		if nSig++; nSig <= maxSigDigits {
+			m = m*16 + float64(d)
+			if isFloat {
+				exp -= 4
+			}
+		} else if !isFloat { /* too many digits, ignore but still count */
+			exp += 4
 		}
 	}
-
-	// (i16 + f16) * 2^p10
-	f := i16 + f16
-	if p10 != 0 {
-		f *= math.Pow(2, p10)
+	if nDigits == 0 {
+		return 0, 0, false, false
 	}
-	return f, true
-}
-
-func parseDigit(digit byte, base int) (float64, bool) {
-	if base == 10 || base == 16 {
-		switch digit {
-		case '0':
-			return 0, true
-		case '1':
-			return 1, true
-		case '2':
-			return 2, true
-		case '3':
-			return 3, true
-		case '4':
-			return 4, true
-		case '5':
-			return 5, true
-		case '6':
-			return 6, true
-		case '7':
-			return 7, true
-		case '8':
-			return 8, true
-		case '9':
-			return 9, true
+	if n < len(s) && (s[n] == 'p' || s[n] == 'P') {
+		isFloat = true
+		n++
+		expNeg := false
+		if n < len(s) && (s[n] == '+' || s[n] == '-') {
+			expNeg = s[n] == '-'
+			n++
 		}
-	}
-	if base == 16 {
-		switch digit {
-		case 'a':
-			return 10, true
-		case 'b':
-			return 11, true
-		case 'c':
-			return 12, true
-		case 'd':
-			return 13, true
-		case 'e':
-			return 14, true
-		case 'f':
-			return 15, true
+		if n == len(s) || !isDigit(s[n]) {
+			return 0, 0, false, false
+		}
+		e := 0
+		for ; n < len(s) && isDigit(s[n]); n++ {
+			if e < 1<<20 { /* saturate, the result is 0 or inf anyway */
+				e = e*10 + int(s[n]-'0')
+			}
 		}
+		if expNeg {
+			e = -e
+		}
+		exp += e
+	}
+	if n != len(s) {
+		return 0, 0, false, false
+	}
+	if !isFloat {
+		return int64(u), 0, false, true
 	}
-	return -1, false
+	return 0, math.Ldexp(m, exp), true, true
 }
@@ -0,0 +1,178 @@
+package pool
+
+import (
+	"errors"
+	"fmt"
+	. "luago/api"
+	"luago/state"
+	"luago/stdlib"
+)
+
+const SNAPSHOT_TABLE = "_POOL_SNAPSHOT" /* registry: globals and loaded modules after init */
+
+/*
+状态池：预先创建若干打开了标准库、执行过初始化的 LuaState，
+每个请求借出一个，用完归还时把全局变量恢复到初始化之后的样子。
+
+	p, err := pool.New(8, func(ls LuaState) error {
+		ls.Register("print", myPrint)
+		return auxlib.DoString(ls, initScript) // 预加载用户模块等
+	})
+	err = p.Do(func(ls LuaState) error {
+		if ls.Load(script, "=request", "t") != LUA_OK {
+			return errors.New(ls.ToString(-1))
+		}
+		ls.Call(0, 0)
+		return nil
+	})
+
+恢复是浅层的：全局变量、package.loaded 和全局表的元表回到快照时的值，
+但脚本对这些值内部的修改（例如往 string 表里加函数）不会被撤销。
+*/
+type Pool struct {
+	states chan LuaState
+	size   int
+}
+
+// New creates size states; init runs on each after the standard
+// libraries are opened.
+func New(size int, init func(ls LuaState) error) (*Pool, error) {
+	if size <= 0 {
+		return nil, errors.New("pool: size must be positive")
+	}
+	p := &Pool{states: make(chan LuaState, size), size: size}
+	for i := 0; i < size; i++ {
+		ls := state.New()
+		stdlib.OpenLibs(ls)
+		if init != nil {
+			if err := protect(ls, init); err != nil {
+				return nil, fmt.Errorf("pool: init: %v", err)
+			}
+		}
+		snapshot(ls)
+		p.states <- ls
+	}
+	return p, nil
+}
+
+// Size returns the number of states in the pool.
+func (self *Pool) Size() int {
+	return self.size
+}
+
+// Get takes a state out of the pool, waiting until one is free.
+func (self *Pool) Get() LuaState {
+	return <-self.states
+}
+
+// Put resets the state and returns it to the pool. The state must not
+// be in the middle of a call.
+func (self *Pool) Put(ls LuaState) {
+	ls.ClearInterrupt()
+	ls.SetTop(0)
+	restore(ls)
+	self.states <- ls
+}
+
+// Do runs f with a state from the pool in protected mode; Lua errors
+// and panics are returned as errors.
+func (self *Pool) Do(f func(ls LuaState) error) error {
+	ls := self.Get()
+	defer self.Put(ls)
+	return protect(ls, f)
+}
+
+func protect(ls LuaState, f func(ls LuaState) error) error {
+	var err error
+	ls.PushGoFunction(func(ls LuaState) int {
+		err = f(ls)
+		return 0
+	})
+	if ls.PCall(0, 0, 0) != LUA_OK {
+		defer ls.Pop(1)
+		return errors.New(ls.ErrorMessage(-1))
+	}
+	return err
+}
+
+// snapshot records shallow copies of the globals and package.loaded
+func snapshot(ls LuaState) {
+	ls.CreateTable(0, 3)
+	ls.PushGlobalTable()
+	copyTable(ls, -1)
+	ls.SetField(-3, "globals")
+	if ls.GetMetatable(-1) {
+		ls.SetField(-3, "metatable")
+	}
+	ls.Pop(1)
+	if ls.GetField(LUA_REGISTRYINDEX, LUA_LOADED_TABLE) == LUA_TTABLE {
+		copyTable(ls, -1)
+		ls.SetField(-3, "loaded")
+	}
+	ls.Pop(1)
+	ls.SetField(LUA_REGISTRYINDEX, SNAPSHOT_TABLE)
+}
+
+func restore(ls LuaState) {
+	ls.GetField(LUA_REGISTRYINDEX, SNAPSHOT_TABLE)
+	ls.PushGlobalTable()
+	ls.GetField(-2, "globals")
+	resetTable(ls, -2, -1)
+	ls.Pop(1)
+	if ls.GetField(-2, "metatable") != LUA_TTABLE {
+		ls.Pop(1)
+		ls.PushNil()
+	}
+	ls.SetMetatable(-2)
+	ls.Pop(1)
+
+	if ls.GetField(-1, "loaded") == LUA_TTABLE {
+		ls.GetField(LUA_REGISTRYINDEX, LUA_LOADED_TABLE)
+		resetTable(ls, -1, -2)
+		ls.Pop(1)
+	}
+	ls.Pop(2)
+}
+
+// copyTable pushes a shallow copy of the table at idx
+func copyTable(ls LuaState, idx int) {
+	idx = ls.AbsIndex(idx)
+	ls.NewTable()
+	ls.PushNil()
+	for ls.Next(idx) {
+		ls.PushValue(-2)
+		ls.Insert(-2)
+		ls.RawSet(-4)
+	}
+}
+
+// resetTable makes the table at idx hold exactly the contents of the
+// table at saved
+func resetTable(ls LuaState, idx, saved int) {
+	idx = ls.AbsIndex(idx)
+	saved = ls.AbsIndex(saved)
+
+	/* collect the keys first, the table cannot change during Next */
+	ls.NewTable()
+	n := int64(0)
+	ls.PushNil()
+	for ls.Next(idx) {
+		ls.Pop(1)
+		n++
+		ls.PushValue(-1)
+		ls.RawSetI(-3, n)
+	}
+	for i := int64(1); i <= n; i++ {
+		ls.RawGetI(-1, i)
+		ls.PushNil()
+		ls.RawSet(idx)
+	}
+	ls.Pop(1)
+
+	ls.PushNil()
+	for ls.Next(saved) {
+		ls.PushValue(-2)
+		ls.Insert(-2)
+		ls.RawSet(idx)
+	}
+}
@@ -0,0 +1,256 @@
+package replay
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	. "luago/api"
+	"os"
+	"strconv"
+	"strings"
+)
+
+/*
+记录和重放：记录模式下，把脚本从不确定的来源（时间、随机数、
+输入、宿主函数）得到的结果按调用顺序写进 trace 文件；重放模式下
+不再调用这些函数，而是按顺序返回记录的结果。线上出问题的脚本
+可以据此在开发环境里确定地复现。
+
+	trace, err := replay.Record("run.trace")   // 或 replay.Replay("run.trace")
+	trace.Install(ls)                          // 包装 Nondeterministic 里的全局函数
+	trace.Install(ls, "host.fetch")            // 或者指定的宿主函数
+	...
+	err = trace.Close()
+
+每次调用占一行，是一个 JSON 字符串数组：函数名和各个结果。
+结果编码为 "n"（nil）、"true"、"false"、"i42"、"f0.5"、"s..."；
+函数出错时函数名后面加 "!"，结果是错误对象。只能记录这些简单值，
+返回表等其他值的函数不能记录。重放时调用的函数和记录的不一致
+（脚本或者宿主改了），报 "replay: trace diverged" 错误。
+
+文件句柄的方法（f:read）不是全局函数，不会被包装。
+一个 Session 只能用于一个 state。
+*/
+type Session struct {
+	replay bool
+	file   *os.File
+	w      *bufio.Writer
+	r      *bufio.Scanner
+	calls  int /* replayed so far */
+	err    error
+}
+
+// the functions Install wraps by default, the missing ones are skipped
+var Nondeterministic = []string{
+	"os.time", "os.clock", "os.date", "os.getenv", "os.tmpname",
+	"math.random",
+	"io.read",
+}
+
+// Record creates the trace file path and records into it.
+func Record(path string) (*Session, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	return &Session{file: file, w: bufio.NewWriter(file)}, nil
+}
+
+// Replay reads the trace file path written by Record.
+func Replay(path string) (*Session, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	r := bufio.NewScanner(file)
+	r.Buffer(nil, 1<<30)
+	return &Session{replay: true, file: file, r: r}, nil
+}
+
+// Install replaces the global functions with the given dotted names
+// (Nondeterministic if none are given) by wrapped ones.
+func (self *Session) Install(ls LuaState, names ...string) {
+	if len(names) == 0 {
+		names = Nondeterministic
+	}
+	for _, name := range names {
+		self.install(ls, name)
+	}
+}
+
+func (self *Session) install(ls LuaState, name string) {
+	top := ls.GetTop()
+	defer ls.SetTop(top)
+
+	path := strings.Split(name, ".")
+	ls.PushGlobalTable()
+	for _, key := range path[:len(path)-1] {
+		if ls.GetField(-1, key) != LUA_TTABLE {
+			return
+		}
+	}
+	field := path[len(path)-1]
+	ls.GetField(-1, field)
+	if !ls.IsGoFunction(-1) {
+		return
+	}
+	ls.PushGoFunction(self.Wrap(name, ls.ToGoFunction(-1)))
+	ls.SetField(-3, field)
+}
+
+// Wrap returns a function that records the results of f, or replays
+// them without calling f.
+func (self *Session) Wrap(name string, f GoFunction) GoFunction {
+	return func(ls LuaState) int {
+		if self.replay {
+			return self.replayCall(ls, name)
+		}
+		return self.recordCall(ls, name, f)
+	}
+}
+
+func (self *Session) recordCall(ls LuaState, name string, f GoFunction) int {
+	failed := true
+	defer func() {
+		if failed {
+			if err := recover(); err != nil {
+				self.write(name+"!", []string{encodeError(err)})
+				panic(err)
+			}
+		}
+	}()
+
+	n := f(ls)
+	failed = false
+	top := ls.GetTop()
+	vals := make([]string, n)
+	for i := range vals {
+		vals[i] = encode(ls, top-n+1+i, name)
+	}
+	self.write(name, vals)
+	return n
+}
+
+func (self *Session) write(name string, vals []string) {
+	if self.err != nil {
+		return
+	}
+	line, _ := json.Marshal(append([]string{name}, vals...))
+	if _, err := self.w.Write(append(line, '\n')); err != nil {
+		self.err = err
+	}
+}
+
+func (self *Session) replayCall(ls LuaState, name string) int {
+	if !self.r.Scan() {
+		if err := self.r.Err(); err != nil {
+			panic("replay: " + err.Error())
+		}
+		panic(fmt.Sprintf("replay: trace diverged: call %d to %s is not in the trace",
+			self.calls+1, name))
+	}
+	self.calls++
+
+	var entry []string
+	if err := json.Unmarshal(self.r.Bytes(), &entry); err != nil || len(entry) == 0 {
+		panic(fmt.Sprintf("replay: malformed trace at call %d", self.calls))
+	}
+	switch entry[0] {
+	case name:
+		ls.CheckStack(len(entry) - 1)
+		for _, val := range entry[1:] {
+			decode(ls, val)
+		}
+		return len(entry) - 1
+	case name + "!":
+		if len(entry) == 2 {
+			decode(ls, entry[1])
+			return ls.Error()
+		}
+	}
+	panic(fmt.Sprintf("replay: trace diverged: call %d to %s, recorded %s",
+		self.calls, name, strings.TrimSuffix(entry[0], "!")))
+}
+
+// Close finishes the trace. After a replay it reports the recorded
+// calls that were not replayed.
+func (self *Session) Close() error {
+	if self == nil {
+		return nil
+	}
+	err := self.err
+	if self.replay {
+		left := 0
+		for self.r.Scan() {
+			left++
+		}
+		if left > 0 && err == nil {
+			err = fmt.Errorf("replay: trace diverged: %d recorded calls were not replayed", left)
+		}
+	} else if ferr := self.w.Flush(); err == nil {
+		err = ferr
+	}
+	if cerr := self.file.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+func encode(ls LuaState, idx int, name string) string {
+	switch ls.Type(idx) {
+	case LUA_TNIL:
+		return "n"
+	case LUA_TBOOLEAN:
+		return strconv.FormatBool(ls.ToBoolean(idx))
+	case LUA_TNUMBER:
+		if ls.IsInteger(idx) {
+			return "i" + strconv.FormatInt(ls.ToInteger(idx), 10)
+		}
+		return "f" + strconv.FormatFloat(ls.ToNumber(idx), 'g', -1, 64)
+	case LUA_TSTRING:
+		s, _ := ls.ToStringX(idx)
+		return "s" + s
+	}
+	panic(fmt.Sprintf("replay: cannot record a %s result of %s",
+		ls.TypeName(ls.Type(idx)), name))
+}
+
+// error objects that cannot be recorded are replaced by a message
+func encodeError(err interface{}) string {
+	switch x := err.(type) {
+	case string:
+		return "s" + x
+	case error:
+		return "s" + x.Error()
+	}
+	return "s" + fmt.Sprintf("%v", err)
+}
+
+func decode(ls LuaState, val string) {
+	if val == "" {
+		panic("replay: malformed trace value")
+	}
+	switch val[0] {
+	case 'n':
+		ls.PushNil()
+		return
+	case 't', 'f':
+		if b, err := strconv.ParseBool(val); err == nil {
+			ls.PushBoolean(b)
+			return
+		}
+		if f, err := strconv.ParseFloat(val[1:], 64); err == nil {
+			ls.PushNumber(f)
+			return
+		}
+	case 'i':
+		if i, err := strconv.ParseInt(val[1:], 10, 64); err == nil {
+			ls.PushInteger(i)
+			return
+		}
+	case 's':
+		ls.PushString(val[1:])
+		return
+	}
+	panic("replay: malformed trace value " + strconv.Quote(val))
+}
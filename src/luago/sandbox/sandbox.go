@@ -0,0 +1,16 @@
+package sandbox
+
+/*
+	sandbox.Exec = false // os.execute 和 io.popen 不再能启动进程
+
+限制不受信任脚本的开关。和 vfs.FS 一样是全局配置，宿主在运行脚本之前
+设置。命令行下设置环境变量 LUAGO_SANDBOX=1 关掉全部开关。
+*/
+
+// Exec allows scripts to run shell commands.
+var Exec = true
+
+// Lockdown turns every switch off.
+func Lockdown() {
+	Exec = false
+}
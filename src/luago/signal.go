@@ -0,0 +1,84 @@
+//go:build !js
+// +build !js
+
+package main
+
+import (
+	"fmt"
+	. "luago/api"
+	"luago/auxlib"
+	"os"
+	"os/signal"
+)
+
+/*
+像 lua.c 的 docall 一样调用栈顶的函数：
+消息处理函数给错误加上 traceback；
+第一次 Ctrl-C 让正在运行的代码抛出可捕获的 "interrupted!" 错误，
+第二次 Ctrl-C（比如 Go 函数阻塞着）直接退出进程。
+
+	if docall(ls, 0, 0) != LUA_OK {
+		report(ls)
+	}
+*/
+func docall(ls LuaState, nArgs, nResults int) int {
+	base := ls.GetTop() - nArgs
+	ls.PushGoFunction(msgHandler)
+	ls.Insert(base)
+
+	sigs := make(chan os.Signal, 2)
+	done := make(chan struct{})
+	signal.Notify(sigs, os.Interrupt)
+	go func() {
+		select {
+		case <-sigs:
+			ls.Interrupt("interrupted!")
+		case <-done:
+			return
+		}
+		select {
+		case <-sigs:
+			fmt.Fprintln(os.Stderr, "luago: interrupted!")
+			os.Exit(130)
+		case <-done:
+		}
+	}()
+
+	status := ls.PCall(nArgs, nResults, base)
+	signal.Stop(sigs)
+	close(done)
+	ls.ClearInterrupt()
+	ls.Remove(base)
+	return status
+}
+
+// the message handler of docall, like lua.c's msghandler
+func msgHandler(ls LuaState) int {
+	msg, ok := ls.ToStringX(1)
+	if !ok { /* is error object not a string? */
+		if hasToString(ls, 1) { /* does it have a metamethod that produces a string? */
+			auxlib.ToLString(ls, 1)
+			return 1 /* that is the message */
+		}
+		msg = fmt.Sprintf("(error object is a %s value)",
+			ls.TypeName(ls.Type(1)))
+	}
+	ls.PushString(ls.Traceback(msg, 1))
+	return 1
+}
+
+func hasToString(ls LuaState, idx int) bool {
+	if !ls.GetMetatable(idx) {
+		return false
+	}
+	tp := ls.GetField(-1, "__tostring")
+	ls.Pop(2)
+	return tp != LUA_TNIL
+}
+
+// prints the error message on top of the stack and pops it
+func report(ls LuaState) {
+	msg, _ := ls.ToStringX(-1)
+	fmt.Fprintf(os.Stderr, "luago: %s\n", msg)
+	ls.Pop(1)
+}
@@ -0,0 +1,186 @@
+package state
+
+import (
+	"errors"
+	. "luago/api"
+	"luago/binchunk"
+	"unsafe"
+)
+
+/* approximate object sizes used for accounting */
+var (
+	tableSize   = int(unsafe.Sizeof(luaTable{}))
+	stackSize   = int(unsafe.Sizeof(luaStack{}))
+	valueSize   = int(unsafe.Sizeof(luaValue(nil)))
+	closureSize = int(unsafe.Sizeof(closure{}))
+	upvalSize   = int(unsafe.Sizeof(upvalue{})) + int(unsafe.Sizeof(&upvalue{}))
+	udataSize   = int(unsafe.Sizeof(userdata{}))
+)
+
+/* 默认分配器：不做任何统计，直接交给 Go 的 GC */
+type defaultAllocator struct{}
+
+func (defaultAllocator) Alloc(kind AllocKind, size int) error { return nil }
+func (defaultAllocator) Close()                               {}
+
+/*
+Arena 从大块内存里切分表和栈槽，统计所有分配并可以设置上限。
+除了创建对象，表的数组部分和哈希部分的增长、栈的扩展也计入用量。
+分配出去的内存在 Close 之前不会归还，Close 时整体丢弃，
+适合生命周期短的状态：GC 面对的是少量大块而不是大量小对象。
+Arena 不是并发安全的，只能给一个状态使用。
+
+	arena := state.NewArena(64 << 20)
+	ls := state.NewWithAllocator(arena)
+	...
+	ls.Close()
+*/
+type Arena struct {
+	limit  int /* 0: no limit */
+	used   int
+	closed bool
+	tables []luaTable
+	slots  []luaValue
+}
+
+const (
+	arenaTables = 256
+	arenaSlots  = 4096
+)
+
+var errArenaClosed = errors.New("arena closed")
+
+func NewArena(limit int) *Arena {
+	return &Arena{limit: limit}
+}
+
+// Used returns the number of bytes allocated so far.
+func (self *Arena) Used() int {
+	return self.used
+}
+
+func (self *Arena) Alloc(kind AllocKind, size int) error {
+	if self.closed {
+		return errArenaClosed
+	}
+	if self.limit > 0 && self.used+size > self.limit {
+		return errors.New("not enough memory")
+	}
+	self.used += size
+	return nil
+}
+
+// Close drops all the memory of the arena.
+func (self *Arena) Close() {
+	self.closed = true
+	self.tables = nil
+	self.slots = nil
+}
+
+func (self *Arena) table() *luaTable {
+	if len(self.tables) == 0 {
+		self.tables = make([]luaTable, arenaTables)
+	}
+	t := &self.tables[0]
+	self.tables = self.tables[1:]
+	return t
+}
+
+func (self *Arena) stackSlots(n int) []luaValue {
+	if n > arenaSlots/4 {
+		return make([]luaValue, n)
+	}
+	if len(self.slots) < n {
+		self.slots = make([]luaValue, arenaSlots)
+	}
+	slots := self.slots[:n:n] /* full slice, growing must not overwrite the rest */
+	self.slots = self.slots[n:]
+	return slots
+}
+
+/*
+分配钩子：只观察不拒绝，可以用来统计各类对象的数量、找泄漏。
+要限制分配请用 Allocator。钩子在分配所在的 goroutine 里同步调用，
+不能调用 Lua API。
+
+	counts := map[AllocKind]int{}
+	ls.SetAllocHook(func(kind AllocKind, size int) { counts[kind]++ })
+*/
+
+// SetAllocHook installs hook (nil removes it) and returns the previous one.
+func (self *luaState) SetAllocHook(hook AllocHook) AllocHook {
+	old := self.allocHook
+	self.allocHook = hook
+	return old
+}
+
+// alloc accounts size bytes, raising the allocator's refusal as a Lua
+// error.
+func (self *globalState) alloc(kind AllocKind, size int) {
+	if err := self.tryAlloc(kind, size); err != nil {
+		panic(err.Error())
+	}
+}
+
+func (self *globalState) tryAlloc(kind AllocKind, size int) error {
+	if err := self.allocator.Alloc(kind, size); err != nil {
+		return err
+	}
+	self.gcDebt += size
+	if self.allocHook != nil {
+		self.allocHook(kind, size)
+	}
+	return nil
+}
+
+func (self *luaState) newTable(nArr, nRec int) *luaTable {
+	self.alloc(ALLOC_TABLE, tableSize+(nArr+2*nRec)*valueSize)
+	if arena, ok := self.allocator.(*Arena); ok {
+		t := arena.table()
+		if nArr > 0 {
+			t.arr = make([]luaValue, 0, nArr)
+		}
+		if nRec > 0 {
+			t._map = make(map[luaValue]luaValue, nRec)
+		}
+		t.g = self.globalState
+		return t
+	}
+	t := newLuaTable(nArr, nRec)
+	if _, ok := self.allocator.(defaultAllocator); !ok {
+		t.g = self.globalState /* growth is accounted too */
+	}
+	return t
+}
+
+func (self *luaState) newStack(size int) *luaStack {
+	self.alloc(ALLOC_STACK, stackSize+size*valueSize)
+	if arena, ok := self.allocator.(*Arena); ok {
+		return &luaStack{slots: arena.stackSlots(size), state: self}
+	}
+	return newLuaStack(size, self)
+}
+
+func (self *luaState) newClosure(proto *binchunk.Prototype) *closure {
+	self.alloc(ALLOC_CLOSURE, closureSize+len(proto.Upvalues)*upvalSize)
+	return newLuaClosure(proto)
+}
+
+func (self *luaState) newGoFunc(f GoFunction, nUpvals int) *closure {
+	self.alloc(ALLOC_CLOSURE, closureSize+nUpvals*upvalSize)
+	return newGoClosure(f, nUpvals)
+}
+
+func (self *luaState) newUserData(v interface{}, nUValue int) *userdata {
+	self.alloc(ALLOC_USERDATA, udataSize+nUValue*valueSize)
+	u := &userdata{value: v}
+	if nUValue > 0 {
+		u.uvalues = make([]luaValue, nUValue)
+	}
+	return u
+}
+
+func (self *luaState) newString(s string) string {
+	self.alloc(ALLOC_STRING, len(s))
+	return s
+}
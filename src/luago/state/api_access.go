@@ -1,7 +1,8 @@
 package state
 
-import "fmt"
+import "luago/number"
 import . "luago/api"
+import "unsafe"
 
 // [-0, +0, –]
 // http://www.lua.org/manual/5.3/manual.html#lua_rawlen
@@ -116,6 +117,23 @@ func (self *luaState) IsInteger(idx int) bool {
 	return ok
 }
 
+// [-0, +0, –]
+// http://www.lua.org/manual/5.3/manual.html#lua_isuserdata
+func (self *luaState) IsUserData(idx int) bool {
+	switch self.stack.get(idx).(type) {
+	case *userdata, lightUserData:
+		return true
+	}
+	return false
+}
+
+// [-0, +0, –]
+// http://www.lua.org/manual/5.3/manual.html#lua_islightuserdata
+func (self *luaState) IsLightUserData(idx int) bool {
+	_, ok := self.stack.get(idx).(lightUserData)
+	return ok
+}
+
 // [-0, +0, –]
 // http://www.lua.org/manual/5.3/manual.html#lua_iscfunction
 func (self *luaState) IsGoFunction(idx int) bool {
@@ -174,8 +192,12 @@ func (self *luaState) ToStringX(idx int) (string, bool) {
 	switch x := val.(type) {
 	case string:
 		return x, true
-	case int64, float64:
-		s := fmt.Sprintf("%v", x) // todo
+	case int64:
+		s := number.IntegerToString(x)
+		self.stack.set(idx, s)
+		return s, true
+	case float64:
+		s := number.FloatToString(x)
 		self.stack.set(idx, s)
 		return s, true
 	default:
@@ -183,6 +205,41 @@ func (self *luaState) ToStringX(idx int) (string, bool) {
 	}
 }
 
+// [-0, +0, –]
+// ToPointer returns the address of a table, function, thread or userdata, which
+// only serves to tell values apart; it returns 0 for other values, and
+// for light userdata that are not pointers.
+// http://www.lua.org/manual/5.3/manual.html#lua_topointer
+func (self *luaState) ToPointer(idx int) uintptr {
+	switch x := self.stack.get(idx).(type) {
+	case *luaTable:
+		return uintptr(unsafe.Pointer(x))
+	case *closure:
+		return uintptr(unsafe.Pointer(x))
+	case *luaState:
+		return uintptr(unsafe.Pointer(x))
+	case *userdata:
+		return uintptr(unsafe.Pointer(x))
+	case lightUserData:
+		return x.pointer()
+	}
+	return 0
+}
+
+// [-0, +0, –]
+// ToUserData returns the Go value of a full or light userdata, nil
+// for other values.
+// http://www.lua.org/manual/5.3/manual.html#lua_touserdata
+func (self *luaState) ToUserData(idx int) interface{} {
+	switch x := self.stack.get(idx).(type) {
+	case *userdata:
+		return x.value
+	case lightUserData:
+		return x.p
+	}
+	return nil
+}
+
 // [-0, +0, –]
 // http://www.lua.org/manual/5.3/manual.html#lua_tocfunction
 func (self *luaState) ToGoFunction(idx int) GoFunction {
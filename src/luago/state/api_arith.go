@@ -62,6 +62,9 @@ func (self *luaState) Arith(op ArithOp) {
 	}
 
 	operator := operators[op]
+	if op == LUA_OPIDIV || op == LUA_OPMOD {
+		self.checkDivByZero(a, b, op)
+	}
 	if result := _arith(a, b, operator); result != nil {
 		self.stack.push(result)
 		return
@@ -73,7 +76,49 @@ func (self *luaState) Arith(op ArithOp) {
 		return
 	}
 
-	panic("arithmetic error!")
+	self.arithError(a, b, operator.floatFunc == nil)
+}
+
+// integer division and modulo by zero are errors, like luaV_idiv
+// and luaV_mod; the float ones give inf or nan
+func (self *luaState) checkDivByZero(a, b luaValue, op ArithOp) {
+	if s, ok := b.(string); ok {
+		b, _ = stringToNumber(s)
+	}
+	if y, ok := b.(int64); !ok || y != 0 {
+		return
+	}
+	if s, ok := a.(string); ok {
+		a, _ = stringToNumber(s)
+	}
+	if _, ok := a.(int64); ok {
+		if op == LUA_OPIDIV {
+			self.runError("attempt to perform 'n//0'")
+		}
+		self.runError("attempt to perform 'n%%0'")
+	}
+}
+
+// reports the operand that cannot take part in the operation, like
+// luaT_trybinTM: the first one that is not a number
+func (self *luaState) arithError(a, b luaValue, bitwise bool) {
+	_, aIsNum := convertToFloat(a)
+	_, bIsNum := convertToFloat(b)
+	if bitwise && aIsNum && bIsNum { /* both numbers, one is not integral */
+		reg := operandReg(self.stack, 2)
+		if _, ok := convertToInteger(a); !ok {
+			reg = operandReg(self.stack, 1)
+		}
+		self.runError("number%s has no integer representation", varInfo(self.stack, reg))
+	}
+	msg := "perform arithmetic on"
+	if bitwise {
+		msg = "perform bitwise operation on"
+	}
+	if !aIsNum { /* first operand is wrong? */
+		self.typeError(a, msg, operandReg(self.stack, 1))
+	}
+	self.typeError(b, msg, operandReg(self.stack, 2))
 }
 
 func _arith(a, b luaValue, op operator) luaValue {
@@ -84,6 +129,16 @@ func _arith(a, b luaValue, op operator) luaValue {
 			}
 		}
 	} else { // arith
+		if s, ok := a.(string); ok {
+			if n, ok := stringToNumber(s); ok {
+				a = n
+			}
+		}
+		if s, ok := b.(string); ok {
+			if n, ok := stringToNumber(s); ok {
+				b = n
+			}
+		}
 		if op.integerFunc != nil { // add,sub,mul,mod,idiv,unm
 			if x, ok := a.(int64); ok {
 				if y, ok := b.(int64); ok {
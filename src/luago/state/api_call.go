@@ -4,18 +4,40 @@ import . "luago/api"
 import "luago/binchunk"
 import "luago/compiler"
 import "luago/vm"
+import "fmt"
+import "runtime"
+import "strings"
 
 // [-0, +1, –]
 // http://www.lua.org/manual/5.3/manual.html#lua_load
 func (self *luaState) Load(chunk []byte, chunkName, mode string) int {
 	var proto *binchunk.Prototype
 	if binchunk.IsBinaryChunk(chunk) {
-		proto = binchunk.Undump(chunk)
+		if mode != "" && !strings.Contains(mode, "b") {
+			self.PushString("attempt to load a binary chunk (mode is '" + mode + "')")
+			return LUA_ERRSYNTAX
+		}
+		var err error
+		if proto, err = binchunk.Load(chunk, chunkName); err != nil {
+			self.PushString(err.Error())
+			return LUA_ERRSYNTAX
+		}
 	} else {
-		proto = compiler.Compile(string(chunk), chunkName)
+		if mode != "" && !strings.Contains(mode, "t") {
+			self.PushString("attempt to load a text chunk (mode is '" + mode + "')")
+			return LUA_ERRSYNTAX
+		}
+		if self.backend == ASTEval {
+			return self.loadAST(chunk, chunkName)
+		}
+		var err error
+		if proto, err = compiler.Compile(string(chunk), chunkName); err != nil {
+			self.PushString(err.Error())
+			return LUA_ERRSYNTAX
+		}
 	}
 
-	c := newLuaClosure(proto)
+	c := self.newClosure(proto)
 	self.stack.push(c)
 	if len(proto.Upvalues) > 0 {
 		env := self.registry.get(LUA_RIDX_GLOBALS)
@@ -27,88 +49,253 @@ func (self *luaState) Load(chunk []byte, chunkName, mode string) int {
 // [-(nargs+1), +nresults, e]
 // http://www.lua.org/manual/5.3/manual.html#lua_call
 func (self *luaState) Call(nArgs, nResults int) {
+	if !self.errCaught && self.panicf != nil {
+		self.callUnprotected(nArgs, nResults)
+		return
+	}
 	val := self.stack.get(-(nArgs + 1))
 
 	c, ok := val.(*closure)
-	if !ok {
-		if mf := getMetafield(val, "__call", self); mf != nil {
-			if c, ok = mf.(*closure); ok {
-				self.stack.push(val)
-				self.Insert(-(nArgs + 2))
-				nArgs += 1
-			}
+	if !ok { /* not a function: try the '__call' metamethod */
+		if c, ok = getMetafield(val, "__call", self).(*closure); !ok {
+			self.typeError(val, "call", calledReg(self.stack))
 		}
+		self.stack.push(val) /* the object is the first argument */
+		self.Insert(-(nArgs + 2))
+		nArgs += 1
 	}
 
-	if ok {
-		if c.proto != nil {
-			self.callLuaClosure(nArgs, nResults, c)
-		} else {
-			self.callGoClosure(nArgs, nResults, c)
-		}
+	if c.proto != nil {
+		self.callLuaClosure(nArgs, nResults, c)
 	} else {
-		panic("not function!")
+		self.callGoClosure(nArgs, nResults, c)
 	}
 }
 
+// the outermost Call outside PCall: an error it lets through goes to
+// the panic function, with the error object on the stack
+func (self *luaState) callUnprotected(nArgs, nResults int) {
+	self.errCaught = true
+	defer func() {
+		self.errCaught = false
+		if err := recover(); err != nil {
+			self.stack.check(1)
+			self.stack.push(errorObject(err))
+			self.panicf(self)
+			panic(err) /* the panic function returned */
+		}
+	}()
+	self.Call(nArgs, nResults)
+}
+
+/*
+panic 函数：在 PCall 之外出错时（Go 代码直接 Call，脚本出错没人接），
+先调用 AtPanic 设置的函数，错误对象在栈顶，出错的调用帧还在栈上，
+可以用 Traceback 之类的函数看。panic 函数返回以后错误照常作为 Go 的
+panic 抛出，宿主程序可以 recover，也可以让 panic 函数自己退出进程：
+
+	ls.AtPanic(func(ls LuaState) int {
+		fmt.Fprintf(os.Stderr, "PANIC: unprotected error in call to Lua API (%s)\n", ls.ToString(-1))
+		os.Exit(1)
+		return 0
+	})
+
+Go 函数里的 panic（空指针、数组越界、panic(err) 等）在函数返回处变成
+Lua 错误，信息是 panic 的值，pcall 可以接住。
+*/
+
+// [-0, +0, –]
+// AtPanic installs f as the panic function and returns the previous
+// one; nil removes it.
+// http://www.lua.org/manual/5.3/manual.html#lua_atpanic
+func (self *luaState) AtPanic(f GoFunction) GoFunction {
+	old := self.panicf
+	self.panicf = f
+	return old
+}
+
 func (self *luaState) callGoClosure(nArgs, nResults int, c *closure) {
 	// create new lua stack
-	newStack := newLuaStack(nArgs+LUA_MINSTACK, self)
+	newStack := self.newStack(nArgs + LUA_MINSTACK)
 	newStack.closure = c
 
 	// pass args, pop func
-	if nArgs > 0 {
-		args := self.stack.popN(nArgs)
-		newStack.pushN(args, nArgs)
-	}
+	self.stack.moveN(newStack, nArgs, nArgs)
 	self.stack.pop()
 
 	// run closure
 	self.pushLuaStack(newStack)
-	r := c.goFunc(self)
+	if self.hookMask&LUA_MASKCALL != 0 {
+		self.callHook(LUA_HOOKCALL, -1)
+	}
+	r := self.runGoFunction(c, newStack)
+	if len(newStack.tbc) > 0 {
+		self.closeSlots(0, nil)
+	}
+	if self.hookMask&LUA_MASKRET != 0 {
+		self.callHook(LUA_HOOKRET, -1)
+	}
 	self.popLuaStack()
 
 	// return results
 	if nResults != 0 {
-		results := newStack.popN(r)
-		self.stack.check(len(results))
-		self.stack.pushN(results, nResults)
+		newStack.moveN(self.stack, r, nResults)
+	}
+}
+
+// the function can be finished by the continuation of CallK or
+// PCallK, which then gives the number of results. A panic of its Go
+// code, like a nil dereference or panic(err), becomes a Lua error
+// with the message of the panic value.
+func (self *luaState) runGoFunction(c *closure, stack *luaStack) (r int) {
+	defer func() {
+		if stack.kDone { /* the panic of finishK */
+			recover()
+			r = stack.kResults
+		} else if err := recover(); err != nil {
+			if isErrorObject(err) {
+				panic(err)
+			}
+			panic(goPanicMessage(err))
+		}
+	}()
+	return c.goFunc(self)
+}
+
+// whether a recovered panic was raised by Lua: an error object, or
+// the panic of finishK passing by
+func isErrorObject(err interface{}) bool {
+	switch err.(type) {
+	case nilError, bool, int64, float64, string, *luaTable, *closure,
+		*luaState, *userdata, lightUserData, *luaStack:
+		return true
 	}
+	return false
+}
+
+func goPanicMessage(err interface{}) string {
+	switch x := err.(type) {
+	case error:
+		return x.Error()
+	case fmt.Stringer:
+		return x.String()
+	}
+	return fmt.Sprint(err)
 }
 
 func (self *luaState) callLuaClosure(nArgs, nResults int, c *closure) {
+	newStack := self.newLuaFrame(nArgs, c)
+
+	// run closure
+	self.pushLuaStack(newStack)
+	if self.hookMask&LUA_MASKCALL != 0 {
+		self.callHook(LUA_HOOKCALL, -1)
+	}
+	self.runLuaClosure()
+	// the frame of the last tail call
+	newStack = self.stack
+	if len(newStack.tbc) > 0 { /* the results stay on top */
+		self.closeSlots(0, nil)
+	}
+	if self.hookMask&LUA_MASKRET != 0 {
+		self.callHook(LUA_HOOKRET, -1)
+	}
+	self.popLuaStack()
+
+	// return results
+	if nResults != 0 {
+		nRegs := int(newStack.closure.proto.MaxStackSize)
+		newStack.moveN(self.stack, newStack.top-nRegs, nResults)
+	}
+}
+
+// makes the frame of a call to the Lua function c, and moves the
+// nArgs arguments there from the top of the stack, popping c
+func (self *luaState) newLuaFrame(nArgs int, c *closure) *luaStack {
 	nRegs := int(c.proto.MaxStackSize)
 	nParams := int(c.proto.NumParams)
 	isVararg := c.proto.IsVararg == 1
 
 	// create new lua stack
-	newStack := newLuaStack(nRegs+LUA_MINSTACK, self)
+	newStack := self.newStack(nRegs + LUA_MINSTACK)
 	newStack.closure = c
 
 	// pass args, pop func
-	funcAndArgs := self.stack.popN(nArgs + 1)
-	newStack.pushN(funcAndArgs[1:], nParams)
-	newStack.top = nRegs
 	if nArgs > nParams && isVararg {
-		newStack.varargs = funcAndArgs[nParams+1:]
+		extra := self.stack.slots[self.stack.top-nArgs+nParams : self.stack.top]
+		newStack.varargs = append([]luaValue(nil), extra...)
 	}
+	self.stack.moveN(newStack, nArgs, nParams)
+	self.stack.pop()
+	newStack.top = nRegs
+	return newStack
+}
 
-	// run closure
-	self.pushLuaStack(newStack)
-	self.runLuaClosure()
-	self.popLuaStack()
+// replaces the running frame with the call of OP_TAILCALL, so that
+// tail calls run in constant space. Calls to Go functions, and calls
+// in the scope of to-be-closed variables, which are closed after the
+// call returns, are left to OP_TAILCALL as plain calls.
+func (self *luaState) tailCall(inst vm.Instruction) bool {
+	stack := self.stack
+	a, b, _ := inst.ABC()
+	fn := stack.slots[a]
+	c, isFunc := fn.(*closure)
+	if !isFunc { /* try the '__call' metamethod */
+		c, _ = getMetafield(fn, "__call", self).(*closure)
+	}
+	if c == nil || c.proto == nil || len(stack.tbc) > 0 {
+		return false
+	}
 
-	// return results
-	if nResults != 0 {
-		results := newStack.popN(newStack.top - nRegs)
-		self.stack.check(len(results))
-		self.stack.pushN(results, nResults)
+	var args []luaValue
+	if !isFunc { /* the object is the first argument */
+		args = append(args, fn)
+	}
+	if b != 0 {
+		args = append(args, stack.slots[a+1:a+b]...)
+	} else { /* up to the results of a call or vararg, left on top */
+		nRegs := int(stack.closure.proto.MaxStackSize)
+		x := int(stack.pop().(int64))
+		args = append(args, stack.slots[a+1:x-1]...)
+		args = append(args, stack.slots[nRegs:stack.top]...)
+	}
+
+	self.popLuaStack()
+	self.stack.check(len(args) + 1)
+	self.stack.push(c)
+	self.stack.pushN(args, -1)
+	newStack := self.newLuaFrame(len(args), c)
+	newStack.isTailCall = true
+	self.pushLuaStack(newStack)
+	if self.hookMask&LUA_MASKCALL != 0 {
+		self.callHook(LUA_HOOKTAILCALL, -1)
 	}
+	return true
 }
 
+// the code is fetched from the frame's own prototype, a hot swap of
+// the running closure takes effect on its next call
 func (self *luaState) runLuaClosure() {
+	stack := self.stack
+	code := stack.closure.proto.Code
 	for {
-		inst := vm.Instruction(self.Fetch())
+		self.checkInterrupt()
+		if self.hasWeakTables || self.hasFinalizers {
+			self.checkGC()
+		}
+		inst := vm.Instruction(code[stack.pc])
+		stack.pc++
+		if self.hookMask&(LUA_MASKLINE|LUA_MASKCOUNT) != 0 {
+			self.traceExec(stack)
+		}
+		if self.fastExecute(stack, inst) {
+			continue
+		}
+		if inst.Opcode() == vm.OP_TAILCALL && self.tailCall(inst) {
+			stack = self.stack
+			code = stack.closure.proto.Code
+			continue
+		}
 		inst.Execute(self)
 		if inst.Opcode() == vm.OP_RETURN {
 			break
@@ -121,14 +308,28 @@ func (self *luaState) runLuaClosure() {
 func (self *luaState) PCall(nArgs, nResults, msgh int) (status int) {
 	caller := self.stack
 	status = LUA_ERRRUN
+	errCaught := self.errCaught
+	self.errCaught = true
+	defer func() { self.errCaught = errCaught }()
+	var handler luaValue
+	if msgh != 0 {
+		handler = self.stack.get(msgh)
+	}
 
 	// catch error
 	defer func() {
 		if err := recover(); err != nil {
-			if msgh != 0 {
-				panic(err)
+			err = errorObject(err)
+			self.saveErrFrames()
+			if handler != nil {
+				// the stack is not unwound yet, the handler sees
+				// the frames where the error was raised
+				err = self.callMsgHandler(handler, err)
 			}
 			for self.stack != caller {
+				for len(self.stack.tbc) > 0 {
+					err = self.closeOnError(err)
+				}
 				self.popLuaStack()
 			}
 			self.stack.push(err)
@@ -139,3 +340,47 @@ func (self *luaState) PCall(nArgs, nResults, msgh int) (status int) {
 	status = LUA_OK
 	return
 }
+
+// the Lua value of a recovered panic
+func errorObject(err interface{}) interface{} {
+	if e, ok := err.(runtime.Error); ok {
+		return e.Error()
+	} else if _, ok := err.(nilError); ok {
+		return nil
+	}
+	return err
+}
+
+// closes the last to-be-closed variable of a frame unwound by an
+// error; as in Lua 5.4 an error raised by its __close metamethod
+// replaces the error object
+func (self *luaState) closeOnError(err interface{}) (result interface{}) {
+	stack := self.stack
+	defer func() {
+		if e := recover(); e != nil {
+			for self.stack != stack {
+				self.popLuaStack()
+			}
+			result = errorObject(e)
+		}
+	}()
+
+	self.closeSlots(stack.tbc[len(stack.tbc)-1], err)
+	return err
+}
+
+// runs the message handler of PCall on the error object, an error
+// raised by the handler itself becomes the error object (LUA_ERRERR)
+func (self *luaState) callMsgHandler(handler luaValue, err interface{}) (result interface{}) {
+	defer func() {
+		if recover() != nil {
+			result = "error in error handling"
+		}
+	}()
+
+	self.stack.check(2)
+	self.stack.push(handler)
+	self.stack.push(err)
+	self.Call(1, 1)
+	return self.stack.pop()
+}
@@ -1,6 +1,7 @@
 package state
 
 import . "luago/api"
+import "luago/number"
 
 // [-0, +0, –]
 // http://www.lua.org/manual/5.3/manual.html#lua_rawequal
@@ -50,7 +51,7 @@ func _eq(a, b luaValue, ls *luaState) bool {
 		case int64:
 			return x == y
 		case float64:
-			return float64(x) == y
+			return number.IntEqFloat(x, y)
 		default:
 			return false
 		}
@@ -59,7 +60,7 @@ func _eq(a, b luaValue, ls *luaState) bool {
 		case float64:
 			return x == y
 		case int64:
-			return x == float64(y)
+			return number.IntEqFloat(y, x)
 		default:
 			return false
 		}
@@ -70,6 +71,13 @@ func _eq(a, b luaValue, ls *luaState) bool {
 			}
 		}
 		return a == b
+	case *userdata:
+		if y, ok := b.(*userdata); ok && x != y && ls != nil {
+			if result, ok := callMetamethod(x, y, "__eq", ls); ok {
+				return convertToBoolean(result)
+			}
+		}
+		return a == b
 	default:
 		return a == b
 	}
@@ -86,22 +94,22 @@ func _lt(a, b luaValue, ls *luaState) bool {
 		case int64:
 			return x < y
 		case float64:
-			return float64(x) < y
+			return number.IntLtFloat(x, y)
 		}
 	case float64:
 		switch y := b.(type) {
 		case float64:
 			return x < y
 		case int64:
-			return x < float64(y)
+			return number.FloatLtInt(x, y)
 		}
 	}
 
 	if result, ok := callMetamethod(a, b, "__lt", ls); ok {
 		return convertToBoolean(result)
-	} else {
-		panic("comparison error!")
 	}
+	ls.orderError(a, b)
+	return false
 }
 
 func _le(a, b luaValue, ls *luaState) bool {
@@ -115,22 +123,31 @@ func _le(a, b luaValue, ls *luaState) bool {
 		case int64:
 			return x <= y
 		case float64:
-			return float64(x) <= y
+			return number.IntLeFloat(x, y)
 		}
 	case float64:
 		switch y := b.(type) {
 		case float64:
 			return x <= y
 		case int64:
-			return x <= float64(y)
+			return number.FloatLeInt(x, y)
 		}
 	}
 
+	// as in Lua 5.4, __le is not emulated with not (b < a): that is
+	// wrong for partial orders
 	if result, ok := callMetamethod(a, b, "__le", ls); ok {
 		return convertToBoolean(result)
-	} else if result, ok := callMetamethod(b, a, "__lt", ls); ok {
-		return !convertToBoolean(result)
-	} else {
-		panic("comparison error!")
 	}
+	ls.orderError(a, b)
+	return false
+}
+
+// like luaG_ordererror
+func (self *luaState) orderError(a, b luaValue) {
+	t1, t2 := self.objTypeName(a), self.objTypeName(b)
+	if t1 == t2 {
+		self.runError("attempt to compare two %s values", t1)
+	}
+	self.runError("attempt to compare %s with %s", t1, t2)
 }
@@ -0,0 +1,239 @@
+package state
+
+import (
+	. "luago/api"
+	"runtime"
+)
+
+/*
+协程：每个协程是一个 luaState，和主线程共享 globalState（注册表、分配器等），
+有自己的调用栈。协程的代码在自己的 goroutine 里运行，Resume 和 Yield 通过
+channel 交接控制权，任何时刻只有一个 goroutine 在运行 Lua 代码，所以 yield
+可以穿过解释器循环、pcall 和 Go 函数。
+
+挂起的协程的 goroutine 一直阻塞在 Yield 里，直到再次 Resume、用
+CloseThread（coroutine.close）结束，或者回收时发现协程已经不可达
+（见 collect）。Go 代码自己保存的线程对 collect 是不可见的，要放到
+注册表里才不会被结束，和 lua_newthread 的要求一样。
+
+这些 goroutine 引用着整个状态，所以没有 Close 的状态永远不会被 Go 的
+GC 回收：不再使用的状态一定要 Close，它会结束所有挂起的协程。
+
+	co := ls.NewThread()
+	ls.PushValue(f)
+	ls.XMove(co, 1)
+	status := co.Resume(ls, 0)
+*/
+
+// [-0, +1, m]
+// http://www.lua.org/manual/5.3/manual.html#lua_newthread
+func (self *luaState) NewThread() LuaState {
+	t := &luaState{globalState: self.globalState}
+	t.SetHook(self.hook, self.hookMask, self.baseHookCount) /* inherit hooks */
+	t.pushLuaStack(self.newStack(LUA_MINSTACK))
+	self.stack.push(t)
+	return t
+}
+
+// [-?, +?, –]
+// http://www.lua.org/manual/5.3/manual.html#lua_resume
+func (self *luaState) Resume(from LuaState, nArgs int) int {
+	lsFrom := from.(*luaState)
+	if lsFrom.coChan == nil {
+		lsFrom.coChan = make(chan int)
+	}
+	switch {
+	case self.coStatus == LUA_OK && self.stack.prev == nil: /* starting a coroutine */
+		self.coCaller = lsFrom
+		self.start(nArgs)
+	case self.coStatus == LUA_YIELD: /* resuming from previous yield */
+		self.coStatus = LUA_OK /* mark that it is running (again) */
+		self.coCaller = lsFrom
+		self.coChan <- 1
+	case self.coStatus == LUA_OK: /* not in base level */
+		return self.resumeError("cannot resume non-suspended coroutine", nArgs)
+	default: /* error status */
+		return self.resumeError("cannot resume dead coroutine", nArgs)
+	}
+	<-lsFrom.coChan /* wait for the coroutine to finish or yield */
+	return self.coStatus
+}
+
+// runs the function below the nArgs arguments in a new goroutine
+func (self *luaState) start(nArgs int) {
+	if self.coChan == nil {
+		self.coChan = make(chan int)
+	}
+	self.coroutines[self] = true
+	go func() {
+		defer func() { /* also run when CloseThread stops the goroutine */
+			delete(self.coroutines, self)
+			self.coCaller.coChan <- 1
+		}()
+		self.coStatus = self.PCall(nArgs, LUA_MULTRET, 0)
+		if self.coStatus != LUA_OK {
+			self.coErr = self.stack.get(-1)
+		}
+	}()
+}
+
+// replaces the arguments of Resume with an error message
+func (self *luaState) resumeError(msg string, nArgs int) int {
+	self.stack.top -= nArgs /* remove args from the stack */
+	self.stack.push(msg)    /* push error message */
+	return LUA_ERRRUN
+}
+
+// [-?, +?, e]
+// Yield suspends the coroutine with the top nResults values as the
+// results of Resume, and returns the number of values passed to the
+// next Resume, which are then on the top of the stack.
+// http://www.lua.org/manual/5.3/manual.html#lua_yield
+func (self *luaState) Yield(nResults int) int {
+	return self.YieldK(nResults, 0, nil)
+}
+
+/*
+延续（continuation）：C 函数 yield 之后 C 栈就没有了，Lua 5.3 用延续函数
+代替它继续执行。这里协程有自己的 goroutine，Go 函数的栈在 yield 之后还在，
+但是为了和 5.3 的写法一致：
+
+	func f(ls LuaState) int {
+		ls.CallK(0, 1, 0, k) // 被调用的函数 yield 过时，结束后调用
+		return k(ls, LUA_OK, 0) // k(ls, LUA_YIELD, 0) 并以它的结果返回，不再回到 f
+	}
+
+YieldK 在恢复之后调用 k，它的结果就是 Go 函数的结果。
+*/
+
+// [-?, +?, e]
+// http://www.lua.org/manual/5.3/manual.html#lua_yieldk
+func (self *luaState) YieldK(nResults int, ctx KContext, k KFunction) int {
+	if !self.IsYieldable() {
+		panic("attempt to yield from outside a coroutine")
+	}
+	if n := self.stack.top - nResults; n > 0 { /* keep only the results */
+		copy(self.stack.slots[:nResults], self.stack.slots[n:self.stack.top])
+		self.SetTop(nResults)
+	}
+	self.coStatus = LUA_YIELD
+	self.nYields++
+	self.coCaller.coChan <- 1
+	if _, ok := <-self.coChan; !ok { /* closed instead of resumed? */
+		runtime.Goexit()
+	}
+	if k != nil {
+		return k(self, LUA_YIELD, ctx)
+	}
+	return self.GetTop()
+}
+
+// [-0, +?, –]
+// CloseThread kills a suspended or dead coroutine and empties its
+// stack, it can then be reused to run another function. The result is
+// the status of the coroutine; if it died from an error, the status is
+// that error and the error object is pushed.
+// http://www.lua.org/manual/5.4/manual.html#lua_closethread
+func (self *luaState) CloseThread(from LuaState) int {
+	status := self.coStatus
+	if status == LUA_YIELD {
+		self.stop(from.(*luaState))
+		status = LUA_OK
+	}
+	for self.stack.prev != nil {
+		for len(self.stack.tbc) > 0 { /* suspended in their scope */
+			if err := self.closeOnError(nil); err != nil {
+				status = LUA_ERRRUN
+				self.coErr = err
+			}
+		}
+		self.popLuaStack()
+	}
+	self.SetTop(0)
+	self.coStatus = LUA_OK
+	if status != LUA_OK {
+		self.stack.push(self.coErr) /* error object */
+		self.coErr = nil
+	}
+	return status
+}
+
+// stop ends the goroutine of a suspended coroutine, from is the
+// running thread
+func (self *luaState) stop(from *luaState) {
+	if from.coChan == nil {
+		from.coChan = make(chan int)
+	}
+	self.coCaller = from
+	close(self.coChan)
+	<-from.coChan
+	self.coChan = nil
+}
+
+// [-(nargs+1), +nresults, e]
+// http://www.lua.org/manual/5.3/manual.html#lua_callk
+func (self *luaState) CallK(nArgs, nResults int, ctx KContext, k KFunction) {
+	nYields := self.nYields
+	self.Call(nArgs, nResults)
+	if k != nil && self.nYields != nYields { /* interrupted by a yield? */
+		self.finishK(k(self, LUA_YIELD, ctx))
+	}
+}
+
+// [-(nargs + 1), +(nresults|1), –]
+// http://www.lua.org/manual/5.3/manual.html#lua_pcallk
+func (self *luaState) PCallK(nArgs, nResults, msgh int, ctx KContext, k KFunction) int {
+	nYields := self.nYields
+	status := self.PCall(nArgs, nResults, msgh)
+	if k != nil && self.nYields != nYields { /* interrupted by a yield? */
+		if status == LUA_OK {
+			status = LUA_YIELD
+		}
+		self.finishK(k(self, status, ctx))
+	}
+	return status
+}
+
+// ends the running Go function with the n results of its continuation
+func (self *luaState) finishK(n int) {
+	self.stack.kDone = true
+	self.stack.kResults = n
+	panic(self.stack) /* recovered by runGoFunction */
+}
+
+// [-0, +0, –]
+// http://www.lua.org/manual/5.3/manual.html#lua_isyieldable
+func (self *luaState) IsYieldable() bool {
+	return self != self.mainThread
+}
+
+// [-0, +0, –]
+// http://www.lua.org/manual/5.3/manual.html#lua_status
+func (self *luaState) Status() int {
+	return self.coStatus
+}
+
+// [-0, +0, –]
+// http://www.lua.org/manual/5.3/manual.html#lua_tothread
+func (self *luaState) ToThread(idx int) LuaState {
+	if t, ok := self.stack.get(idx).(*luaState); ok {
+		return t
+	}
+	return nil
+}
+
+// [-0, +1, –]
+// http://www.lua.org/manual/5.3/manual.html#lua_pushthread
+func (self *luaState) PushThread() bool {
+	self.stack.push(self)
+	return self == self.mainThread
+}
+
+// [-?, +?, –]
+// http://www.lua.org/manual/5.3/manual.html#lua_xmove
+func (self *luaState) XMove(to LuaState, n int) {
+	if to == LuaState(self) {
+		return
+	}
+	self.stack.moveN(to.(*luaState).stack, n, n)
+}
@@ -0,0 +1,207 @@
+package state
+
+import (
+	"fmt"
+	. "luago/api"
+	"luago/number"
+	"strings"
+)
+
+// Traceback returns msg followed by a traceback of the call stack,
+// starting level frames below the running function (level 0). Go
+// functions are shown as [C] frames, like C functions in lua.c.
+// The result goes through the error formatter, if any.
+// http://www.lua.org/manual/5.3/manual.html#luaL_traceback
+func (self *luaState) Traceback(msg string, level int) string {
+	info := ErrInfo{Value: msg, Message: msg}
+	var buf strings.Builder
+	buf.WriteString("stack traceback:")
+	for stack := self.stack; stack != nil; stack = stack.prev {
+		if stack.closure == nil { /* the base frame */
+			continue
+		}
+		if level > 0 {
+			level--
+			continue
+		}
+		if proto := stack.closure.proto; proto != nil && info.Source == "" {
+			info.Source = chunkID(proto.Source)
+			_, info.Line, _ = proto.SourcePosition(stack.pc - 1)
+		}
+		buf.WriteString("\n\t")
+		buf.WriteString(frameInfo(stack.closure, stack.pc))
+		if stack.isTailCall {
+			buf.WriteString("\n\t(...tail calls...)")
+		}
+	}
+	info.Traceback = buf.String()
+	return self.formatError(info)
+}
+
+// a frame of the call stack when an error was raised
+type errFrame struct {
+	closure    *closure
+	pc         int
+	isTailCall bool
+}
+
+// remembers the frames of the running stack, called by PCall before
+// it unwinds them
+func (self *luaState) saveErrFrames() {
+	self.errFrames = self.errFrames[:0]
+	for stack := self.stack; stack != nil; stack = stack.prev {
+		if stack.closure != nil {
+			self.errFrames = append(self.errFrames, errFrame{stack.closure, stack.pc, stack.isTailCall})
+		}
+	}
+}
+
+// ErrorTraceback returns the traceback of the call stack where the
+// last error caught by PCall on this thread was raised, in the format
+// of Traceback, or "" if no error was caught. For a coroutine killed
+// by an error, ask the coroutine.
+func (self *luaState) ErrorTraceback() string {
+	if len(self.errFrames) == 0 {
+		return ""
+	}
+	var buf strings.Builder
+	buf.WriteString("stack traceback:")
+	for _, f := range self.errFrames {
+		buf.WriteString("\n\t")
+		buf.WriteString(frameInfo(f.closure, f.pc))
+		if f.isTailCall {
+			buf.WriteString("\n\t(...tail calls...)")
+		}
+	}
+	return buf.String()
+}
+
+// [-0, +1, m]
+// Where pushes "chunkname:currentline: " for the function at level
+// (0 is the running function, 1 its caller), or "" if that is not a
+// Lua function.
+// http://www.lua.org/manual/5.3/manual.html#luaL_where
+func (self *luaState) Where(level int) {
+	stack := self.stack
+	for ; level > 0 && stack != nil; level-- {
+		stack = stack.prev
+	}
+	if stack != nil && stack.closure != nil && stack.closure.proto != nil {
+		proto := stack.closure.proto
+		if _, line, _ := proto.SourcePosition(stack.pc - 1); line > 0 {
+			self.PushString(fmt.Sprintf("%s:%d: ", chunkID(proto.Source), line))
+			return
+		}
+	}
+	self.PushString("") /* else, no information available... */
+}
+
+// runError raises a runtime error, with the position of the running
+// function if it is a Lua function, like luaG_runerror
+func (self *luaState) runError(format string, a ...interface{}) {
+	msg := fmt.Sprintf(format, a...)
+	if stack := self.stack; stack.closure != nil && stack.closure.proto != nil {
+		proto := stack.closure.proto
+		if _, line, _ := proto.SourcePosition(stack.pc - 1); line > 0 {
+			msg = fmt.Sprintf("%s:%d: %s", chunkID(proto.Source), line, msg)
+		}
+	}
+	panic(msg)
+}
+
+// typeError raises "attempt to <op> a <type> value", naming the
+// variable if val comes from register reg of the running instruction,
+// like luaG_typeerror
+func (self *luaState) typeError(val luaValue, op string, reg int) {
+	self.runError("attempt to %s a %s value%s",
+		op, self.objTypeName(val), varInfo(self.stack, reg))
+}
+
+// the type name of val for error messages: the __name of its
+// metatable if that is a string, like luaT_objtypename
+func (self *luaState) objTypeName(val luaValue) string {
+	if mt := getMetatable(val, self); mt != nil {
+		if name, ok := mt.get("__name").(string); ok {
+			return name
+		}
+	}
+	return self.TypeName(typeOf(val))
+}
+
+// ErrorMessage returns the message of the error object at idx, for
+// hosts reporting errors caught by PCall. Objects other than strings
+// and numbers are described by their type, like lua.c does.
+func (self *luaState) ErrorMessage(idx int) string {
+	val := self.stack.get(idx)
+	info := ErrInfo{Value: val}
+	switch x := val.(type) {
+	case string:
+		info.Message = x
+	case int64:
+		info.Message = number.IntegerToString(x)
+	case float64:
+		info.Message = number.FloatToString(x)
+	default:
+		info.Message = fmt.Sprintf("(error object is a %s value)",
+			self.TypeName(typeOf(val)))
+	}
+	return self.formatError(info)
+}
+
+/*
+错误格式化：Traceback、ErrorMessage（以及用它们输出错误的命令行、
+actor、pool 等）生成错误信息时调用，可以翻译信息、加上错误码或者
+文档链接，不用再解析默认的格式。
+
+	ls.SetErrorFormatter(func(info ErrInfo) string {
+		msg := "[E42] " + info.Message
+		if info.Traceback != "" {
+			msg += "\n" + info.Traceback
+		}
+		return msg
+	})
+*/
+
+// SetErrorFormatter installs f (nil restores the default format) and
+// returns the previous one.
+func (self *luaState) SetErrorFormatter(f ErrorFormatter) ErrorFormatter {
+	old := self.errFormat
+	self.errFormat = f
+	return old
+}
+
+func (self *luaState) formatError(info ErrInfo) string {
+	if self.errFormat != nil {
+		return self.errFormat(info)
+	}
+	switch {
+	case info.Traceback == "":
+		return info.Message
+	case info.Message == "":
+		return info.Traceback
+	}
+	return info.Message + "\n" + info.Traceback
+}
+
+// "file:line: in function <file:linedefined>"
+func frameInfo(c *closure, pc int) string {
+	proto := c.proto
+	if proto == nil {
+		return "[C]: in ?"
+	}
+	source := chunkID(proto.Source)
+	_, line, _ := proto.SourcePosition(pc - 1)
+	if proto.LineDefined == 0 {
+		return fmt.Sprintf("%s:%d: in main chunk", source, line)
+	}
+	return fmt.Sprintf("%s:%d: in function <%s:%d>",
+		source, line, source, proto.LineDefined)
+}
+
+// the chunk name without its '@' or '=' prefix
+func chunkID(source string) string {
+	if strings.HasPrefix(source, "@") || strings.HasPrefix(source, "=") {
+		return source[1:]
+	}
+	return source
+}
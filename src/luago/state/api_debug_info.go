@@ -0,0 +1,266 @@
+package state
+
+import (
+	. "luago/api"
+	"strings"
+	"unsafe"
+)
+
+/*
+调试接口：GetStack 找到某一层的调用帧，GetInfo 取出它（或者栈顶函数）的
+信息，GetLocal、SetLocal 读写帧里的局部变量，GetUpvalue 等读写闭包的
+upvalue。debug 库就建立在这些函数之上。
+
+	var ar LuaDebug
+	if ls.GetStack(1, &ar) && ls.GetInfo("Sl", &ar) {
+		fmt.Println(ar.ShortSrc, ar.CurrentLine)
+	}
+*/
+
+// [-0, +0, –]
+// GetStack fills the private part of ar with the frame at level (0
+// is the running function), it returns false if there is no such
+// level.
+// http://www.lua.org/manual/5.3/manual.html#lua_getstack
+func (self *luaState) GetStack(level int, ar *LuaDebug) bool {
+	if level < 0 {
+		return false /* invalid (negative) level */
+	}
+	for stack := self.stack; stack.closure != nil; stack = stack.prev {
+		if level == 0 { /* level found? */
+			ar.CallInfo = stack
+			return true
+		}
+		level--
+	}
+	return false /* no such level */
+}
+
+// [-(0|1), +(0|1|2), e]
+// GetInfo fills the fields of ar selected by what, for the frame of
+// GetStack or, if what starts with '>', for the function popped from
+// the stack. Options 'f' and 'L' push the function and the table of
+// its lines. It returns false for an invalid option.
+// http://www.lua.org/manual/5.3/manual.html#lua_getinfo
+func (self *luaState) GetInfo(what string, ar *LuaDebug) bool {
+	var stack *luaStack
+	var c *closure
+	if strings.HasPrefix(what, ">") {
+		c = self.stack.pop().(*closure)
+		what = what[1:] /* skip the '>' */
+	} else {
+		stack = ar.CallInfo.(*luaStack)
+		c = stack.closure
+	}
+	status := true
+	for _, option := range what {
+		switch option {
+		case 'S':
+			funcInfo(ar, c)
+		case 'l':
+			ar.CurrentLine = currentLine(stack)
+		case 'u':
+			ar.NUps = len(c.upvals)
+			if c.proto == nil {
+				ar.IsVararg = true
+				ar.NParams = 0
+			} else {
+				ar.IsVararg = c.proto.IsVararg == 1
+				ar.NParams = int(c.proto.NumParams)
+			}
+		case 't':
+			ar.IsTailCall = stack != nil && stack.isTailCall
+		case 'n':
+			if stack != nil {
+				ar.NameWhat, ar.Name = getFuncName(stack)
+			} else {
+				ar.NameWhat, ar.Name = "", ""
+			}
+		case 'L', 'f': /* handled below */
+		default:
+			status = false /* invalid option */
+		}
+	}
+	if strings.ContainsRune(what, 'f') {
+		self.stack.push(c)
+	}
+	if strings.ContainsRune(what, 'L') {
+		self.collectValidLines(c)
+	}
+	return status
+}
+
+func funcInfo(ar *LuaDebug, c *closure) {
+	if c.proto == nil {
+		ar.Source = "=[C]"
+		ar.LineDefined = -1
+		ar.LastLineDefined = -1
+		ar.What = "C"
+	} else {
+		ar.Source = c.proto.Source
+		if ar.Source == "" {
+			ar.Source = "=?"
+		}
+		ar.LineDefined = int(c.proto.LineDefined)
+		ar.LastLineDefined = int(c.proto.LastLineDefined)
+		if ar.LineDefined == 0 {
+			ar.What = "main"
+		} else {
+			ar.What = "Lua"
+		}
+	}
+	ar.ShortSrc = chunkID(ar.Source)
+}
+
+// the line of the current instruction of a Lua frame, -1 otherwise
+func currentLine(stack *luaStack) int {
+	if stack == nil || stack.closure.proto == nil {
+		return -1
+	}
+	if _, line, _ := stack.closure.proto.SourcePosition(stack.pc - 1); line > 0 {
+		return line
+	}
+	return -1
+}
+
+// pushes a table whose keys are the lines with code of c, or nil for
+// Go functions
+func (self *luaState) collectValidLines(c *closure) {
+	if c.proto == nil {
+		self.stack.push(nil)
+		return
+	}
+	t := self.newTable(0, len(c.proto.LineInfo))
+	for _, line := range c.proto.LineInfo {
+		t.put(int64(line), true)
+	}
+	self.stack.push(t)
+}
+
+// [-0, +(0|1), –]
+// GetLocal pushes the value of the n-th local variable of the frame
+// of ar and returns its name; negative n are the varargs. With a nil
+// ar it returns the name of the n-th parameter of the function on the
+// top of the stack, and pushes nothing. ok is false if there is no
+// such variable.
+// http://www.lua.org/manual/5.3/manual.html#lua_getlocal
+func (self *luaState) GetLocal(ar *LuaDebug, n int) (name string, ok bool) {
+	if ar == nil { /* information about non-active function? */
+		c, _ := self.stack.get(-1).(*closure)
+		if c == nil || c.proto == nil { /* not a Lua function? */
+			return "", false
+		}
+		return localName(c.proto, n, 0) /* only parameters */
+	}
+	name, pos := findLocal(ar.CallInfo.(*luaStack), n)
+	if pos == nil {
+		return "", false
+	}
+	self.stack.push(*pos)
+	return name, true
+}
+
+// [-(0|1), +0, –]
+// SetLocal pops a value into the n-th local variable of the frame of
+// ar and returns its name; nothing is popped if there is no such
+// variable.
+// http://www.lua.org/manual/5.3/manual.html#lua_setlocal
+func (self *luaState) SetLocal(ar *LuaDebug, n int) (name string, ok bool) {
+	name, pos := findLocal(ar.CallInfo.(*luaStack), n)
+	if pos == nil {
+		return "", false
+	}
+	*pos = self.stack.pop()
+	return name, true
+}
+
+// the name and the slot of the n-th local variable of a frame, like
+// luaG_findlocal
+func findLocal(stack *luaStack, n int) (string, *luaValue) {
+	name := ""
+	if proto := stack.closure.proto; proto != nil {
+		if n < 0 { /* access to vararg values? */
+			if -n > len(stack.varargs) {
+				return "", nil /* no such vararg */
+			}
+			return "(*vararg)", &stack.varargs[-n-1]
+		}
+		name, _ = localName(proto, n, stack.pc-1)
+	}
+	if name == "" { /* no 'standard' name? */
+		if n <= 0 || n > stack.top { /* is 'n' outside the frame? */
+			return "", nil /* no name */
+		}
+		if stack.closure.proto != nil {
+			name = "(*temporary)"
+		} else {
+			name = "(C temporary)"
+		}
+	}
+	return name, &stack.slots[n-1]
+}
+
+// [-0, +(0|1), –]
+// GetUpvalue pushes the n-th upvalue of the closure at funcIdx and
+// returns its name, "" for Go functions.
+// http://www.lua.org/manual/5.3/manual.html#lua_getupvalue
+func (self *luaState) GetUpvalue(funcIdx, n int) (string, bool) {
+	name, uv := auxUpvalue(self.stack.get(funcIdx), n)
+	if uv == nil {
+		return "", false
+	}
+	self.stack.push(*uv.val)
+	return name, true
+}
+
+// [-(0|1), +0, –]
+// SetUpvalue pops a value into the n-th upvalue of the closure at
+// funcIdx and returns its name; nothing is popped if there is no such
+// upvalue.
+// http://www.lua.org/manual/5.3/manual.html#lua_setupvalue
+func (self *luaState) SetUpvalue(funcIdx, n int) (string, bool) {
+	name, uv := auxUpvalue(self.stack.get(funcIdx), n)
+	if uv == nil {
+		return "", false
+	}
+	*uv.val = self.stack.pop()
+	return name, true
+}
+
+func auxUpvalue(val luaValue, n int) (string, *upvalue) {
+	c, ok := val.(*closure)
+	if !ok || n < 1 || n > len(c.upvals) {
+		return "", nil
+	}
+	if c.upvals[n-1] == nil { /* not initialized by Load */
+		c.upvals[n-1] = &upvalue{new(luaValue)}
+	}
+	uv := c.upvals[n-1]
+	if c.proto == nil { /* Go closure */
+		return "", uv
+	}
+	if n-1 < len(c.proto.UpvalueNames) && c.proto.UpvalueNames[n-1] != "" {
+		return c.proto.UpvalueNames[n-1], uv
+	}
+	return "(*no name)", uv
+}
+
+// [-0, +0, –]
+// UpvalueId returns a unique identifier of the n-th upvalue of the
+// closure at funcIdx: closures sharing an upvalue get the same one.
+// http://www.lua.org/manual/5.3/manual.html#lua_upvalueid
+func (self *luaState) UpvalueId(funcIdx, n int) uintptr {
+	_, uv := auxUpvalue(self.stack.get(funcIdx), n)
+	return uintptr(unsafe.Pointer(uv))
+}
+
+// [-0, +0, –]
+// UpvalueJoin makes the n1-th upvalue of the Lua closure at funcIdx1
+// refer to the n2-th upvalue of the Lua closure at funcIdx2.
+// http://www.lua.org/manual/5.3/manual.html#lua_upvaluejoin
+func (self *luaState) UpvalueJoin(funcIdx1, n1, funcIdx2, n2 int) {
+	_, uv2 := auxUpvalue(self.stack.get(funcIdx2), n2)
+	if _, uv1 := auxUpvalue(self.stack.get(funcIdx1), n1); uv1 != nil && uv2 != nil {
+		self.stack.get(funcIdx1).(*closure).upvals[n1-1] = uv2
+	}
+}
@@ -0,0 +1,378 @@
+package state
+
+import (
+	. "luago/api"
+	"runtime"
+	"sort"
+	"strings"
+)
+
+/*
+垃圾回收：内存由 Go 的 GC 管理，这里只能近似 Lua 的 lua_gc。状态统计
+自己分配的字节数；LUA_GCCOLLECT 和 LUA_GCSTEP 让 Go 做一次完整的回收，
+再从注册表和主线程出发重新量出存活对象的大小，并调用不可达对象的
+__gc（见下面的终结器）。
+量的时候到不了的挂起协程会被结束掉（不运行它的 to-be-closed 变量，
+和 Lua 回收线程一样），它的 goroutine 随之退出。
+LUA_GCCOUNT 是上次量出的大小加上之后新分配的字节数，和 Lua 一样在
+两次回收之间只增不减。Go 的 GC 不能按状态停下来，LUA_GCSTOP 只是停掉
+为弱表和终结器做的自动回收（见 checkGC）；stepmul 只是记下来的数字。
+
+	ls.GC(LUA_GCCOLLECT, 0)
+	kb, b := ls.GC(LUA_GCCOUNT, 0), ls.GC(LUA_GCCOUNTB, 0)
+*/
+
+// [-0, +0, m]
+// http://www.lua.org/manual/5.3/manual.html#lua_gc
+func (self *luaState) GC(what, data int) int {
+	switch what {
+	case LUA_GCSTOP:
+		self.gcStopped = true
+	case LUA_GCRESTART:
+		self.gcStopped = false
+	case LUA_GCCOLLECT:
+		self.fullGC()
+	case LUA_GCCOUNT:
+		return (self.gcLive + self.gcDebt) >> 10 /* GC values are expressed in Kbytes */
+	case LUA_GCCOUNTB:
+		return (self.gcLive + self.gcDebt) & 0x3ff
+	case LUA_GCSTEP:
+		self.fullGC()
+		return 1 /* every step ends a cycle */
+	case LUA_GCSETPAUSE:
+		old := self.gcPause
+		self.gcPause = data
+		return old
+	case LUA_GCSETSTEPMUL:
+		old := self.gcStepMul
+		self.gcStepMul = data
+		return old
+	case LUA_GCISRUNNING:
+		if self.gcStopped {
+			return 0
+		}
+		return 1
+	default:
+		return -1 /* invalid option */
+	}
+	return 0
+}
+
+func (self *luaState) fullGC() {
+	runtime.GC()
+	self.collect()
+	self.callPendingFinalizers()
+}
+
+// checkGC runs a cycle when enough was allocated since the last one,
+// like luaC_checkGC. Only weak tables and finalizers need it, so the VM
+// calls it between instructions once one of them was created.
+func (self *luaState) checkGC() {
+	if !self.gcStopped && self.gcDebt > self.gcThreshold() {
+		self.collect()
+		self.callPendingFinalizers()
+	}
+}
+
+// the bytes to allocate before the next automatic cycle: the heap
+// grows to gcPause percent of its live size
+func (self *luaState) gcThreshold() int {
+	debt := self.gcLive/100*self.gcPause - self.gcLive
+	if debt < GC_MINDEBT {
+		debt = GC_MINDEBT
+	}
+	return debt
+}
+
+const GC_MINDEBT = 64 << 10
+
+// a cycle of the collector: marks what is reachable from the registry
+// and the running threads, clears the entries of weak tables that were
+// not reached, queues the finalizers of the objects that were not
+// reached, stops the goroutines of suspended coroutines that were not
+// reached and measures the live objects. The syntax tree evaluator
+// keeps locals in Go closures the walk cannot see, so its weak tables,
+// finalizers and coroutines are left alone.
+func (self *luaState) collect() {
+	g := &gcState{marked: map[luaValue]bool{}}
+	g.mark(self.registry)
+	g.mark(self.mainThread)
+	g.mark(self)
+	for co := range self.coroutines {
+		if co.coStatus != LUA_YIELD { /* running or resuming another one */
+			g.mark(co)
+		}
+	}
+	for _, obj := range self.tobefnz {
+		g.mark(obj)
+	}
+	g.convergeEphemerons()
+	if self.backend != ASTEval {
+		for _, t := range g.weak {
+			g.clearWeak(t)
+		}
+		self.separateFinalizers(g)
+		var dead []*luaState
+		for co := range self.coroutines {
+			if !g.marked[co] {
+				dead = append(dead, co)
+			}
+		}
+		for _, co := range dead {
+			co.stop(self)
+		}
+	}
+	self.gcLive = g.size
+	self.gcDebt = 0
+}
+
+/*
+弱表：标记时不经过弱引用，标记完以后把弱表里键或值没有被标记到的
+项删掉（只有表、函数、线程、userdata 这些对象会被回收，字符串和数字不算）。
+弱键表按 ephemeron 处理：键被标记到了，值才算可达。
+
+	setmetatable(cache, {__mode = "k"})
+	collectgarbage()
+*/
+
+type gcState struct {
+	marked     map[luaValue]bool
+	size       int
+	weak       []*luaTable /* tables to clear */
+	ephemerons []*luaTable /* weak keys and strong values */
+}
+
+// the weakness of the keys and values of t, from its __mode
+func weakMode(t *luaTable) (weakKeys, weakValues bool) {
+	if t.metatable == nil {
+		return false, false
+	}
+	mode, _ := t.metatable.get("__mode").(string)
+	return strings.IndexByte(mode, 'k') >= 0, strings.IndexByte(mode, 'v') >= 0
+}
+
+// whether val can be collected, so that it is removed from weak tables
+func isCollectable(val luaValue) bool {
+	switch val.(type) {
+	case *luaTable, *closure, *luaState, *userdata:
+		return true
+	}
+	return false
+}
+
+// whether val is still alive after the marking
+func (self *gcState) alive(val luaValue) bool {
+	return !isCollectable(val) || self.marked[val]
+}
+
+func (self *gcState) mark(val luaValue) {
+	if val == nil || self.marked[val] {
+		return
+	}
+	switch x := val.(type) {
+	case string: /* equal strings are counted once, as if interned */
+		self.marked[x] = true
+		self.size += len(x)
+	case *luaTable:
+		self.marked[x] = true
+		self.size += tableSize + (cap(x.arr)+2*len(x._map))*valueSize
+		if x.metatable != nil {
+			self.mark(x.metatable)
+		}
+		weakKeys, weakValues := weakMode(x)
+		if weakKeys || weakValues {
+			self.weak = append(self.weak, x)
+		}
+		if weakValues {
+			if !weakKeys {
+				for k := range x._map {
+					self.mark(k)
+				}
+			}
+			return
+		}
+		for _, v := range x.arr {
+			self.mark(v)
+		}
+		if weakKeys {
+			self.ephemerons = append(self.ephemerons, x)
+			return /* values are marked with their keys */
+		}
+		for k, v := range x._map {
+			self.mark(k)
+			self.mark(v)
+		}
+	case *closure:
+		self.marked[x] = true
+		self.size += closureSize + len(x.upvals)*upvalSize
+		for _, uv := range x.upvals {
+			if uv != nil && uv.val != nil {
+				self.mark(*uv.val)
+			}
+		}
+	case *userdata: /* the Go value is not measured */
+		self.marked[x] = true
+		self.size += udataSize + len(x.uvalues)*valueSize
+		if x.metatable != nil {
+			self.mark(x.metatable)
+		}
+		for _, v := range x.uvalues {
+			self.mark(v)
+		}
+	case *luaState:
+		self.marked[x] = true
+		self.mark(x.coErr)
+		for stack := x.stack; stack != nil; stack = stack.prev {
+			self.size += stackSize + len(stack.slots)*valueSize
+			for _, v := range stack.slots { /* dead slots are kept too */
+				self.mark(v)
+			}
+			for _, v := range stack.varargs {
+				self.mark(v)
+			}
+			if stack.closure != nil {
+				self.mark(stack.closure)
+			}
+		}
+	}
+}
+
+// marks the values of the ephemeron tables whose keys are reachable,
+// until that reaches no more keys
+func (self *gcState) convergeEphemerons() {
+	for changed := true; changed; {
+		changed = false
+		for i := 0; i < len(self.ephemerons); i++ { /* marking may add tables */
+			for k, v := range self.ephemerons[i]._map {
+				if self.alive(k) && !self.alive(v) {
+					self.mark(v)
+					changed = true
+				}
+			}
+		}
+	}
+}
+
+// removes the entries of t whose key or value was collected
+func (self *gcState) clearWeak(t *luaTable) {
+	for i := len(t.arr); i > 0; i-- {
+		if !self.alive(t.arr[i-1]) {
+			t.putInt(int64(i), nil)
+		}
+	}
+	var dead []luaValue
+	for k, v := range t._map {
+		if !self.alive(k) || !self.alive(v) {
+			dead = append(dead, k)
+		}
+	}
+	for _, k := range dead {
+		t.putMap(k, nil)
+	}
+	if len(dead) > 0 {
+		t.changed = true
+	}
+}
+
+/*
+终结器：设置元表时元表里已经有 __gc 的表和 userdata 会被登记下来
+（之后才加上的 __gc 不算，和 Lua 一样）。回收时不可达的登记对象从
+登记里去掉、放进待终结的队列，并且和它引用的东西一起重新标记为可达，
+直到 __gc 运行完。回收结束后按登记的相反顺序以保护模式调用
+__gc(obj)，出错时发出 "error in __gc (...)" 警告。弱表在这之前清理，
+指向待终结对象的项已经删掉了。Close 会终结所有还登记着的对象。
+
+	local obj = setmetatable({}, {__gc = function(o) print("bye") end})
+	obj = nil
+	collectgarbage() --> bye
+*/
+
+// checkFinalizer registers obj if its new metatable has a __gc field,
+// like luaC_checkfinalizer
+func (self *luaState) checkFinalizer(obj luaValue, mt *luaTable) {
+	if mt == nil || mt.get("__gc") == nil {
+		return
+	}
+	if _, found := self.finobj[obj]; found {
+		return
+	}
+	if self.finobj == nil {
+		self.finobj = map[luaValue]int{}
+	}
+	self.finSeq++
+	self.finobj[obj] = self.finSeq
+	self.hasFinalizers = true
+}
+
+// separateFinalizers moves the registered objects that were not
+// reached to the queue of pending finalizers and marks them, so that
+// they and what they refer to live until their __gc ran
+func (self *luaState) separateFinalizers(g *gcState) {
+	var dead []luaValue
+	for obj := range self.finobj {
+		if !g.marked[obj] {
+			dead = append(dead, obj)
+		}
+	}
+	self.queueFinalizers(dead)
+	for _, obj := range dead {
+		g.mark(obj)
+	}
+	g.convergeEphemerons()
+}
+
+// queueFinalizers unregisters objs and queues their finalizers, the
+// first registered is called last
+func (self *luaState) queueFinalizers(objs []luaValue) {
+	sort.Slice(objs, func(i, j int) bool {
+		return self.finobj[objs[i]] < self.finobj[objs[j]]
+	})
+	for _, obj := range objs {
+		delete(self.finobj, obj)
+		self.tobefnz = append(self.tobefnz, obj)
+	}
+}
+
+// callPendingFinalizers calls the queued finalizers; a finalizer that
+// triggers a collection does not run the others itself
+func (self *luaState) callPendingFinalizers() {
+	if self.inFinalizer {
+		return
+	}
+	self.inFinalizer = true
+	defer func() { self.inFinalizer = false }()
+	for len(self.tobefnz) > 0 {
+		n := len(self.tobefnz) - 1
+		obj := self.tobefnz[n]
+		self.tobefnz = self.tobefnz[:n]
+		self.callFinalizer(obj)
+	}
+}
+
+// calls __gc(obj) in protected mode, like GCTM; errors become warnings
+func (self *luaState) callFinalizer(obj luaValue) {
+	tm := getMetafield(obj, "__gc", self)
+	if tm == nil { /* removed since it was registered */
+		return
+	}
+	self.stack.check(2)
+	self.stack.push(tm)
+	self.stack.push(obj)
+	if self.PCall(1, 0, 0) != LUA_OK {
+		msg, ok := self.stack.pop().(string)
+		if !ok {
+			msg = "error object is not a string"
+		}
+		self.Warning("error in __gc ("+msg+")", false)
+	}
+}
+
+// finalizeAll calls the finalizers of all registered objects, for Close
+func (self *luaState) finalizeAll() {
+	var objs []luaValue
+	for obj := range self.finobj {
+		objs = append(objs, obj)
+	}
+	self.queueFinalizers(objs)
+	self.callPendingFinalizers()
+}
@@ -11,10 +11,41 @@ func (self *luaState) NewTable() {
 // [-0, +1, m]
 // http://www.lua.org/manual/5.3/manual.html#lua_createtable
 func (self *luaState) CreateTable(nArr, nRec int) {
-	t := newLuaTable(nArr, nRec)
+	t := self.newTable(nArr, nRec)
 	self.stack.push(t)
 }
 
+// [-0, +1, m]
+// NewUserData pushes a new userdata holding the Go value v, without
+// a metatable and with one user value, like the macro of Lua 5.4.
+// http://www.lua.org/manual/5.3/manual.html#lua_newuserdata
+func (self *luaState) NewUserData(v interface{}) {
+	self.NewUserDataUV(v, 1)
+}
+
+// [-0, +1, m]
+// NewUserDataUV is NewUserData with nUValue user values, all nil.
+// http://www.lua.org/manual/5.4/manual.html#lua_newuserdatauv
+func (self *luaState) NewUserDataUV(v interface{}, nUValue int) {
+	u := self.newUserData(v, nUValue)
+	self.stack.push(u)
+}
+
+// [-0, +1, –]
+// GetIUserValue pushes the n-th user value of the userdata at idx; if
+// there is no such value, it pushes nil and returns LUA_TNONE.
+// http://www.lua.org/manual/5.4/manual.html#lua_getiuservalue
+func (self *luaState) GetIUserValue(idx, n int) LuaType {
+	u, ok := self.stack.get(idx).(*userdata)
+	if !ok || n <= 0 || n > len(u.uvalues) {
+		self.stack.push(nil)
+		return LUA_TNONE
+	}
+	v := u.uvalues[n-1]
+	self.stack.push(v)
+	return typeOf(v)
+}
+
 // [-1, +1, e]
 // http://www.lua.org/manual/5.3/manual.html#lua_gettable
 func (self *luaState) GetTable(idx int) LuaType {
@@ -34,6 +65,12 @@ func (self *luaState) GetField(idx int, k string) LuaType {
 // http://www.lua.org/manual/5.3/manual.html#lua_geti
 func (self *luaState) GetI(idx int, i int64) LuaType {
 	t := self.stack.get(idx)
+	if tbl, ok := t.(*luaTable); ok {
+		if v := tbl.getInt(i); v != nil || !tbl.hasMetafield("__index") {
+			self.stack.push(v)
+			return typeOf(v)
+		}
+	}
 	return self.getTable(t, i, false)
 }
 
@@ -49,6 +86,11 @@ func (self *luaState) RawGet(idx int) LuaType {
 // http://www.lua.org/manual/5.3/manual.html#lua_rawgeti
 func (self *luaState) RawGetI(idx int, i int64) LuaType {
 	t := self.stack.get(idx)
+	if tbl, ok := t.(*luaTable); ok {
+		v := tbl.getInt(i)
+		self.stack.push(v)
+		return typeOf(v)
+	}
 	return self.getTable(t, i, true)
 }
 
@@ -72,31 +114,45 @@ func (self *luaState) GetMetatable(idx int) bool {
 	}
 }
 
-// push(t[k])
+// push(t[k]), following the __index chain like luaV_finishget
 func (self *luaState) getTable(t, k luaValue, raw bool) LuaType {
-	if tbl, ok := t.(*luaTable); ok {
-		v := tbl.get(k)
-		if raw || v != nil || !tbl.hasMetafield("__index") {
-			self.stack.push(v)
-			return typeOf(v)
-		}
-	}
-
-	if !raw {
-		if mf := getMetafield(t, "__index", self); mf != nil {
-			switch x := mf.(type) {
-			case *luaTable:
-				return self.getTable(x, k, false)
-			case *closure:
-				self.stack.push(mf)
-				self.stack.push(t)
-				self.stack.push(k)
-				self.Call(2, 1)
-				v := self.stack.get(-1)
+	for loop := 0; loop < MAXTAGLOOP; loop++ {
+		var mf luaValue
+		if tbl, ok := t.(*luaTable); ok {
+			v := tbl.get(k)
+			if raw || v != nil || tbl.metatable == nil {
+				self.stack.push(v)
 				return typeOf(v)
 			}
+			if mf = tbl.metatable.get("__index"); mf == nil { /* no metamethod? */
+				self.stack.push(nil)
+				return LUA_TNIL
+			}
+		} else if mf = getMetafield(t, "__index", self); mf == nil || raw {
+			self.indexError(t, loop)
+		}
+		if _, ok := mf.(*closure); ok { /* is metamethod a function? */
+			self.stack.push(mf)
+			self.stack.push(t)
+			self.stack.push(k)
+			self.Call(2, 1)
+			return typeOf(self.stack.get(-1))
 		}
+		t = mf /* else try to access 'mf[k]' */
 	}
+	self.runError("'__index' chain too long; possible loop")
+	return LUA_TNIL
+}
+
+// limit for the chains of __index and __newindex, like in lvm.c
+const MAXTAGLOOP = 2000
 
-	panic("index error!")
+// "attempt to index a nil value (local 't')": only the value indexed
+// by the running instruction, not one met along a chain, has a name
+func (self *luaState) indexError(t luaValue, loop int) {
+	info := ""
+	if loop == 0 {
+		info = indexedVarInfo(self.stack)
+	}
+	self.runError("attempt to index a %s value%s", self.objTypeName(t), info)
 }
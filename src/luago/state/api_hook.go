@@ -0,0 +1,87 @@
+package state
+
+import . "luago/api"
+
+/*
+钩子：VM 在函数调用、返回、执行新的一行或者每执行 count 条指令时调用
+宿主设置的钩子函数，调试器和抢占都建立在它上面。钩子属于线程，新建的
+协程继承创建者的钩子；钩子运行期间不会再触发钩子。
+
+	ls.SetHook(func(ls LuaState, ar *LuaDebug) {
+		ls.GetInfo("Sl", ar)
+		fmt.Println(ar.ShortSrc, ar.CurrentLine)
+	}, LUA_MASKLINE, 0)
+*/
+
+// [-0, +0, –]
+// http://www.lua.org/manual/5.3/manual.html#lua_sethook
+func (self *luaState) SetHook(f LuaHook, mask, count int) {
+	if f == nil || mask == 0 { /* turn off hooks? */
+		f, mask = nil, 0
+	}
+	self.hook = f
+	self.baseHookCount = count
+	self.hookCount = count
+	self.hookMask = mask
+}
+
+// [-0, +0, –]
+// http://www.lua.org/manual/5.3/manual.html#lua_gethook
+func (self *luaState) GetHook() LuaHook {
+	return self.hook
+}
+
+// [-0, +0, –]
+// http://www.lua.org/manual/5.3/manual.html#lua_gethookmask
+func (self *luaState) GetHookMask() int {
+	return self.hookMask
+}
+
+// [-0, +0, –]
+// http://www.lua.org/manual/5.3/manual.html#lua_gethookcount
+func (self *luaState) GetHookCount() int {
+	return self.baseHookCount
+}
+
+// calls the hook for event on the running frame, line is the current
+// line of line events and -1 otherwise
+func (self *luaState) callHook(event, line int) {
+	if self.inHook { /* hooks are not reentrant */
+		return
+	}
+	stack := self.stack
+	top := stack.top
+	stack.check(LUA_MINSTACK) /* ensure minimum stack size */
+	self.inHook = true        /* cannot call hooks inside a hook */
+	defer func() {
+		self.inHook = false
+		for stack.top > top { /* restore the stack */
+			stack.pop()
+		}
+	}()
+	self.hook(self, &LuaDebug{Event: event, CurrentLine: line, CallInfo: stack})
+}
+
+// runs the count and line hooks before the instruction at stack.pc-1
+// is executed, like luaG_traceexec
+func (self *luaState) traceExec(stack *luaStack) {
+	npc := stack.pc - 1
+	if self.hookMask&LUA_MASKCOUNT != 0 {
+		self.hookCount--
+		if self.hookCount == 0 {
+			self.hookCount = self.baseHookCount /* reset count */
+			self.callHook(LUA_HOOKCOUNT, -1)
+		}
+	}
+	if self.hookMask&LUA_MASKLINE != 0 {
+		p := stack.closure.proto
+		_, newLine, _ := p.SourcePosition(npc)
+		/* entered a new function, jumped back (loop) or a new line? */
+		if npc == 0 || npc <= stack.oldPC {
+			self.callHook(LUA_HOOKLINE, newLine)
+		} else if _, line, _ := p.SourcePosition(stack.oldPC); line != newLine {
+			self.callHook(LUA_HOOKLINE, newLine)
+		}
+	}
+	stack.oldPC = npc
+}
@@ -1,5 +1,7 @@
 package state
 
+import "luago/vm"
+
 // [-0, +1, e]
 // http://www.lua.org/manual/5.3/manual.html#lua_len
 func (self *luaState) Len(idx int) {
@@ -12,7 +14,7 @@ func (self *luaState) Len(idx int) {
 	} else if t, ok := val.(*luaTable); ok {
 		self.stack.push(int64(t.len()))
 	} else {
-		panic("length error!")
+		self.typeError(val, "get length of", operandReg(self.stack, 1))
 	}
 }
 
@@ -28,7 +30,7 @@ func (self *luaState) Concat(n int) {
 				s1 := self.ToString(-2)
 				self.stack.pop()
 				self.stack.pop()
-				self.stack.push(s1 + s2)
+				self.stack.push(self.newString(s1 + s2))
 				continue
 			}
 
@@ -39,12 +41,31 @@ func (self *luaState) Concat(n int) {
 				continue
 			}
 
-			panic("concatenation error!")
+			self.concatError(a, b, n-i)
 		}
 	}
 	// n == 1, do nothing
 }
 
+// reports the operand of the k-th pair from the left that is neither
+// a string nor a number, like luaG_concaterror. As luaV_concat works
+// in place, the pair of OP_CONCAT A B C is in registers B+k-1, B+k.
+func (self *luaState) concatError(a, b luaValue, k int) {
+	reg := -1
+	if i, ok := runningInst(self.stack); ok && i.Opcode() == vm.OP_CONCAT {
+		_, first, _ := i.ABC()
+		reg = first + k - 1
+	}
+	switch a.(type) {
+	case string, int64, float64:
+		if reg >= 0 {
+			reg++
+		}
+		self.typeError(b, "concatenate", reg)
+	}
+	self.typeError(a, "concatenate", reg)
+}
+
 // [-1, +(2|0), e]
 // http://www.lua.org/manual/5.3/manual.html#lua_next
 func (self *luaState) Next(idx int) bool {
@@ -61,9 +82,85 @@ func (self *luaState) Next(idx int) bool {
 	panic("table expected!")
 }
 
+// [-0, +1, –]
+// StringToNumber pushes the number denoted by s and returns true, or
+// pushes nothing and returns false if s is not a numeral.
+// http://www.lua.org/manual/5.3/manual.html#lua_stringtonumber
+func (self *luaState) StringToNumber(s string) bool {
+	if n, ok := stringToNumber(s); ok {
+		self.stack.push(n)
+		return true
+	}
+	return false
+}
+
 // [-1, +0, v]
 // http://www.lua.org/manual/5.3/manual.html#lua_error
 func (self *luaState) Error() int {
 	err := self.stack.pop()
+	if err == nil {
+		panic(nilError{}) /* panic(nil) may not be told from no panic */
+	}
 	panic(err)
 }
+
+// stands for a nil error object while it is raised
+type nilError struct{}
+
+// [-0, +0, m]
+// http://www.lua.org/manual/5.4/manual.html#lua_toclose
+func (self *luaState) ToClose(idx int) {
+	slot := self.stack.absIndex(idx) - 1
+	val := self.stack.slots[slot]
+	self.checkClosable(val, self.slotName(slot))
+	if val != nil && val != false { /* false and nil need no closing */
+		self.stack.tbc = append(self.stack.tbc, slot)
+	}
+}
+
+// [-0, +0, e]
+// http://www.lua.org/manual/5.4/manual.html#lua_closeslot
+func (self *luaState) CloseSlot(idx int) {
+	slot := self.stack.absIndex(idx) - 1
+	self.closeSlots(slot, nil)
+	self.stack.slots[slot] = nil
+}
+
+// "variable 'x' got a non-closable value", like luaF_newtbcupval
+func (self *luaState) checkClosable(val luaValue, name string) {
+	if val != nil && val != false && getMetafield(val, "__close", self) == nil {
+		self.runError("variable '%s' got a non-closable value", name)
+	}
+}
+
+// the name of the local variable of the running Lua function in slot,
+// "?" if it has none
+func (self *luaState) slotName(slot int) string {
+	if c := self.stack.closure; c != nil && c.proto != nil {
+		if name, ok := localName(c.proto, slot+1, self.stack.pc-1); ok {
+			return name
+		}
+	}
+	return "?"
+}
+
+// closes the to-be-closed variables of the running function from slot
+// level on, the last marked first; err is the error object that ends
+// their scope, nil when they go out of scope normally
+func (self *luaState) closeSlots(level int, err luaValue) {
+	stack := self.stack
+	for n := len(stack.tbc); n > 0 && stack.tbc[n-1] >= level; n = len(stack.tbc) {
+		val := stack.slots[stack.tbc[n-1]]
+		stack.tbc = stack.tbc[:n-1]
+		self.callClose(val, err)
+	}
+}
+
+// calls the __close metamethod of a to-be-closed value
+func (self *luaState) callClose(val, err luaValue) {
+	self.stack.check(3)
+	self.stack.push(getMetafield(val, "__close", self))
+	self.stack.push(val)
+	self.stack.push(err)
+	self.Call(2, 0)
+}
@@ -1,6 +1,10 @@
 package state
 
-import . "luago/api"
+import (
+	"fmt"
+	. "luago/api"
+	"reflect"
+)
 
 // [-0, +1, –]
 // http://www.lua.org/manual/5.3/manual.html#lua_pushnil
@@ -29,19 +33,19 @@ func (self *luaState) PushNumber(n float64) {
 // [-0, +1, m]
 // http://www.lua.org/manual/5.3/manual.html#lua_pushstring
 func (self *luaState) PushString(s string) {
-	self.stack.push(s)
+	self.stack.push(self.newString(s))
 }
 
 // [-0, +1, –]
 // http://www.lua.org/manual/5.3/manual.html#lua_pushcfunction
 func (self *luaState) PushGoFunction(f GoFunction) {
-	self.stack.push(newGoClosure(f, 0))
+	self.stack.push(self.newGoFunc(f, 0))
 }
 
 // [-n, +1, m]
 // http://www.lua.org/manual/5.3/manual.html#lua_pushcclosure
 func (self *luaState) PushGoClosure(f GoFunction, n int) {
-	closure := newGoClosure(f, n)
+	closure := self.newGoFunc(f, n)
 	for i := n; i > 0; i-- {
 		val := self.stack.pop()
 		closure.upvals[i-1] = &upvalue{&val}
@@ -55,3 +59,14 @@ func (self *luaState) PushGlobalTable() {
 	global := self.registry.get(LUA_RIDX_GLOBALS)
 	self.stack.push(global)
 }
+
+// [-0, +1, –]
+// PushLightUserData pushes p as a light userdata. p must be comparable:
+// light userdata are equal when their values are, and can be keys.
+// http://www.lua.org/manual/5.3/manual.html#lua_pushlightuserdata
+func (self *luaState) PushLightUserData(p interface{}) {
+	if p != nil && !reflect.TypeOf(p).Comparable() {
+		panic(fmt.Sprintf("light userdata of uncomparable type %T", p))
+	}
+	self.stack.push(lightUserData{p})
+}
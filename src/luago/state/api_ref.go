@@ -0,0 +1,63 @@
+package state
+
+import . "luago/api"
+
+/*
+引用：Go 代码要在多次调用之间留住一个 Lua 值（回调、配置表）时，
+不能让它一直占着栈，而是用 Ref 把它存进一个表（通常是注册表），
+拿到一个整数键，以后用 RawGetI 取回，不再需要时用 Unref 释放，
+释放掉的键会被再次使用。和 lauxlib 一样，空闲的键串成链表，表头
+放在 freelist 这个键下。
+
+	ls.PushValue(1)
+	cb := ls.Ref(LUA_REGISTRYINDEX)
+	...
+	ls.RawGetI(LUA_REGISTRYINDEX, int64(cb))
+	ls.Call(0, 0)
+	ls.Unref(LUA_REGISTRYINDEX, cb)
+*/
+
+/* key of the free list, after the predefined values of the registry */
+const freelist = LUA_RIDX_GLOBALS + 1
+
+// [-1, +0, m]
+// Ref pops a value and stores it in the table at idx under a new
+// integer key, which it returns; nil is not stored and gets LUA_REFNIL.
+// http://www.lua.org/manual/5.3/manual.html#luaL_ref
+func (self *luaState) Ref(idx int) int {
+	if self.IsNil(-1) {
+		self.Pop(1)
+		return LUA_REFNIL /* 'nil' has a unique fixed reference */
+	}
+	idx = self.AbsIndex(idx)
+	ref := 0
+	if self.RawGetI(idx, freelist) == LUA_TNIL { /* first access? */
+		self.PushInteger(0) /* initialize as an empty list */
+		self.RawSetI(idx, freelist)
+	} else {
+		ref = int(self.ToInteger(-1))
+	}
+	self.Pop(1)
+	if ref != 0 { /* any free element? */
+		self.RawGetI(idx, int64(ref)) /* remove it from list */
+		self.RawSetI(idx, freelist)
+	} else { /* no free elements */
+		ref = int(self.RawLen(idx)) + 1
+	}
+	self.RawSetI(idx, int64(ref))
+	return ref
+}
+
+// [-0, +0, –]
+// Unref releases ref from the table at idx, so that the value can be
+// collected and the key reused; LUA_REFNIL and LUA_NOREF are ignored.
+// http://www.lua.org/manual/5.3/manual.html#luaL_unref
+func (self *luaState) Unref(idx, ref int) {
+	if ref >= 0 {
+		idx = self.AbsIndex(idx)
+		self.RawGetI(idx, freelist)
+		self.RawSetI(idx, int64(ref)) /* t[ref] = t[freelist] */
+		self.PushInteger(int64(ref))
+		self.RawSetI(idx, freelist) /* t[freelist] = ref */
+	}
+}
@@ -24,6 +24,10 @@ func (self *luaState) SetField(idx int, k string) {
 func (self *luaState) SetI(idx int, i int64) {
 	t := self.stack.get(idx)
 	v := self.stack.pop()
+	if tbl, ok := t.(*luaTable); ok && tbl.metatable == nil {
+		tbl.putInt(i, v)
+		return
+	}
 	self.setTable(t, i, v, false)
 }
 
@@ -41,6 +45,10 @@ func (self *luaState) RawSet(idx int) {
 func (self *luaState) RawSetI(idx int, i int64) {
 	t := self.stack.get(idx)
 	v := self.stack.pop()
+	if tbl, ok := t.(*luaTable); ok {
+		tbl.putInt(i, v)
+		return
+	}
 	self.setTable(t, i, v, true)
 }
 
@@ -59,6 +67,37 @@ func (self *luaState) Register(name string, f GoFunction) {
 	self.SetGlobal(name)
 }
 
+// [-0, +0, e]
+// PreloadModule makes require(name) call loader, so that a module
+// implemented in Go is found without searching the file system. The
+// loader gets the module name and returns the module, like the
+// functions in package.preload.
+func (self *luaState) PreloadModule(name string, loader GoFunction) {
+	if self.GetField(LUA_REGISTRYINDEX, LUA_PRELOAD_TABLE) != LUA_TTABLE {
+		self.Pop(1)
+		self.NewTable()
+		self.PushValue(-1)
+		self.SetField(LUA_REGISTRYINDEX, LUA_PRELOAD_TABLE)
+	}
+	self.PushGoFunction(loader)
+	self.SetField(-2, name) /* PRELOAD[name] = loader */
+	self.Pop(1)
+}
+
+// [-1, +0, –]
+// SetIUserValue pops a value into the n-th user value of the userdata
+// at idx; it returns false if the userdata has no such value.
+// http://www.lua.org/manual/5.4/manual.html#lua_setiuservalue
+func (self *luaState) SetIUserValue(idx, n int) bool {
+	u, ok := self.stack.get(idx).(*userdata)
+	v := self.stack.pop()
+	if !ok || n <= 0 || n > len(u.uvalues) {
+		return false
+	}
+	u.uvalues[n-1] = v
+	return true
+}
+
 // [-1, +0, –]
 // http://www.lua.org/manual/5.3/manual.html#lua_setmetatable
 func (self *luaState) SetMetatable(idx int) {
@@ -74,31 +113,31 @@ func (self *luaState) SetMetatable(idx int) {
 	}
 }
 
-// t[k]=v
+// t[k]=v, following the __newindex chain like luaV_finishset
 func (self *luaState) setTable(t, k, v luaValue, raw bool) {
-	if tbl, ok := t.(*luaTable); ok {
-		if raw || tbl.get(k) != nil || !tbl.hasMetafield("__newindex") {
-			tbl.put(k, v)
-			return
-		}
-	}
-
-	if !raw {
-		if mf := getMetafield(t, "__newindex", self); mf != nil {
-			switch x := mf.(type) {
-			case *luaTable:
-				self.setTable(x, k, v, false)
+	for loop := 0; loop < MAXTAGLOOP; loop++ {
+		var mf luaValue
+		if tbl, ok := t.(*luaTable); ok {
+			if raw || tbl.metatable == nil || tbl.get(k) != nil {
+				tbl.put(k, v)
 				return
-			case *closure:
-				self.stack.push(mf)
-				self.stack.push(t)
-				self.stack.push(k)
-				self.stack.push(v)
-				self.Call(3, 0)
+			}
+			if mf = tbl.metatable.get("__newindex"); mf == nil { /* no metamethod? */
+				tbl.put(k, v)
 				return
 			}
+		} else if mf = getMetafield(t, "__newindex", self); mf == nil || raw {
+			self.indexError(t, loop)
 		}
+		if _, ok := mf.(*closure); ok { /* is metamethod a function? */
+			self.stack.push(mf)
+			self.stack.push(t)
+			self.stack.push(k)
+			self.stack.push(v)
+			self.Call(3, 0)
+			return
+		}
+		t = mf /* else repeat assignment over 'mf' */
 	}
-
-	panic("index error!")
+	self.runError("'__newindex' chain too long; possible loop")
 }
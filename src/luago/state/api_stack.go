@@ -1,5 +1,7 @@
 package state
 
+import . "luago/api"
+
 // [-0, +0, –]
 // http://www.lua.org/manual/5.3/manual.html#lua_gettop
 func (self *luaState) GetTop() int {
@@ -15,8 +17,11 @@ func (self *luaState) AbsIndex(idx int) int {
 // [-0, +0, –]
 // http://www.lua.org/manual/5.3/manual.html#lua_checkstack
 func (self *luaState) CheckStack(n int) bool {
+	if n < 0 || self.stack.top > LUAI_MAXSTACK-n {
+		return false /* would grow past the limit */
+	}
 	self.stack.check(n)
-	return true // never fails
+	return true
 }
 
 // [-n, +0, –]
@@ -43,7 +43,7 @@ func (self *luaState) LoadVararg(n int) {
 func (self *luaState) LoadProto(idx int) {
 	stack := self.stack
 	subProto := stack.closure.proto.Protos[idx]
-	closure := newLuaClosure(subProto)
+	closure := self.newClosure(subProto)
 	stack.push(closure)
 
 	for i, uvInfo := range subProto.Upvalues {
@@ -73,4 +73,7 @@ func (self *luaState) CloseUpvalues(a int) {
 			delete(self.stack.openuvs, i)
 		}
 	}
+	if len(self.stack.tbc) > 0 {
+		self.closeSlots(a-1, nil)
+	}
 }
@@ -0,0 +1,31 @@
+package state
+
+import . "luago/api"
+
+/*
+警告：Lua 5.4 的 warn 把消息交给宿主设置的警告函数，状态本身不输出
+任何东西，没有设置警告函数时警告被忽略。"@on"、"@off" 这样的控制消息
+也交给警告函数处理；auxlib.NewWarnF 是和 lua 独立解释器一样的默认实现。
+
+	ls.SetWarnF(func(msg string, tocont bool) {
+		logger.Print(msg) // 多段消息要自己拼起来
+	})
+*/
+
+// [-0, +0, –]
+// SetWarnF installs f as the warning function (nil ignores warnings)
+// and returns the previous one.
+// http://www.lua.org/manual/5.4/manual.html#lua_setwarnf
+func (self *luaState) SetWarnF(f WarnFunction) WarnFunction {
+	old := self.warnf
+	self.warnf = f
+	return old
+}
+
+// [-0, +0, –]
+// http://www.lua.org/manual/5.4/manual.html#lua_warning
+func (self *luaState) Warning(msg string, tocont bool) {
+	if self.warnf != nil {
+		self.warnf(msg, tocont)
+	}
+}
@@ -0,0 +1,447 @@
+package state
+
+import (
+	"fmt"
+	. "luago/api"
+	"luago/compiler"
+	. "luago/compiler/ast"
+	"luago/number"
+)
+
+/*
+语法树解释器（实验性的）：WithBackend(ASTEval) 时，Load 不生成字节码，
+而是直接在语法树上求值。可以用来对比两个后端的结果、排查代码生成
+的问题，也可以加快小脚本的启动，或者在不想生成字节码的环境里运行。
+
+	ls := state.New(state.WithBackend(state.ASTEval))
+	ls.Load(chunk, "test.lua", "t")
+	ls.Call(0, 0)
+
+函数是 Go 闭包，可以和其他函数一样传给 Go 代码、被字节码调用。
+运算都经过指令所用的 API（Arith、Len、Concat、Call ...），
+所以元方法的行为和字节码后端一致。
+
+它还不能代替字节码后端：
+  - 代码生成器在加载时报告的错误（比如非变长参数函数里的 ...、
+    找不到标签的 goto）要到执行相应的代码时才报告；
+  - 运行时错误前面没有 chunk:line；
+  - 尾调用和递归都占用 Go 的栈，尾调用不是常数空间的，递归太深时
+    进程因为 Go 的栈溢出直接崩溃，而不是抛出可以捕获的 "stack overflow"；
+  - 局部变量在 Go 闭包里，回收时遍历不到，所以不清理弱表（见 collect）。
+*/
+
+// the locals visible at a point of the program; a local statement
+// extends the list, so closures created earlier do not see the new
+// variable
+type evalScope struct {
+	parent  *evalScope
+	name    string
+	cell    *luaValue
+	isConst bool // declared <const>
+}
+
+func (self *evalScope) declare(name string, val luaValue) *evalScope {
+	return &evalScope{parent: self, name: name, cell: &val}
+}
+
+func (self *evalScope) lookup(name string) *luaValue {
+	if s := self.find(name); s != nil {
+		return s.cell
+	}
+	return nil
+}
+
+func (self *evalScope) find(name string) *evalScope {
+	for s := self; s != nil; s = s.parent {
+		if s.name == name {
+			return s
+		}
+	}
+	return nil
+}
+
+// an activation of a function
+type evalFrame struct {
+	fn      *FuncDefExp
+	varargs []luaValue
+	results []luaValue // of the return statement
+	loops   int        // enclosing loops, for break
+	jump    *GotoStat  // the goto being taken
+}
+
+// how a statement completed
+type evalCtl int
+
+const (
+	ctlNext evalCtl = iota
+	ctlBreak
+	ctlReturn
+	ctlGoto // looking for the label of frame.jump
+)
+
+func (self *luaState) loadAST(chunk []byte, chunkName string) int {
+	block, err := compiler.Parse(string(chunk), chunkName)
+	if err != nil {
+		self.PushString(err.Error())
+		return LUA_ERRSYNTAX
+	}
+
+	env := self.registry.get(LUA_RIDX_GLOBALS)
+	scope := &evalScope{name: "_ENV", cell: &env}
+	main := &FuncDefExp{LastLine: block.LastLine, IsVararg: true, Block: block}
+	c := self.newEvalClosure(main, scope, 1)
+	c.upvals[0] = &upvalue{scope.cell} /* _ENV, which SetUpvalue can replace */
+	self.stack.push(c)
+	return LUA_OK
+}
+
+func (self *luaState) newEvalClosure(fn *FuncDefExp, scope *evalScope, nUpvals int) *closure {
+	return self.newGoFunc(func(ls LuaState) int {
+		return ls.(*luaState).evalCall(fn, scope)
+	}, nUpvals)
+}
+
+// runs on the stack of the Go closure, which holds the arguments
+func (self *luaState) evalCall(fn *FuncDefExp, scope *evalScope) int {
+	self.checkInterrupt()
+	args := self.stack.popN(self.stack.top)
+	for i, param := range fn.ParList {
+		var arg luaValue
+		if i < len(args) {
+			arg = args[i]
+		}
+		scope = scope.declare(param, arg)
+	}
+
+	frame := &evalFrame{fn: fn}
+	if fn.IsVararg && len(args) > len(fn.ParList) {
+		frame.varargs = args[len(fn.ParList):]
+	}
+	if self.execBlock(frame, fn.Block, scope) == ctlGoto {
+		panic(fmt.Sprintf("no visible label '%s' for <goto> at line %d",
+			frame.jump.Name, frame.jump.Line))
+	}
+
+	self.stack.check(len(frame.results))
+	self.stack.pushN(frame.results, -1)
+	return len(frame.results)
+}
+
+func (self *luaState) execBlock(frame *evalFrame, block *Block, scope *evalScope) evalCtl {
+	ctl, _ := self.execStats(frame, block, scope)
+	return ctl
+}
+
+// also returns the scope at the end of the block, the condition of
+// repeat-until sees the locals of its body
+func (self *luaState) execStats(frame *evalFrame, block *Block, scope *evalScope) (evalCtl, *evalScope) {
+	var labelScopes map[string]*evalScope // of the labels passed
+	for i := 0; i < len(block.Stats); i++ {
+		var ctl evalCtl
+		if label, ok := block.Stats[i].(*LabelStat); ok {
+			if labelScopes == nil {
+				labelScopes = map[string]*evalScope{}
+			}
+			labelScopes[label.Name] = scope
+		} else if ctl, scope = self.execStat(frame, block.Stats[i], scope); ctl == ctlGoto {
+			if j := findLabel(block, frame.jump.Name); j >= 0 {
+				if s, passed := labelScopes[frame.jump.Name]; passed {
+					scope = s /* back to the locals of the label */
+				} else {
+					checkGotoScope(block, i, j, frame.jump)
+				}
+				i = j - 1 /* go on at the label */
+				continue
+			}
+		}
+		if ctl != ctlNext {
+			return ctl, scope
+		}
+	}
+	if block.RetExps != nil {
+		frame.results = self.evalExpList(frame, block.RetExps, scope, -1)
+		return ctlReturn, scope
+	}
+	return ctlNext, scope
+}
+
+func findLabel(block *Block, name string) int {
+	for i, stat := range block.Stats {
+		if label, ok := stat.(*LabelStat); ok && label.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// like the code generator: a goto can jump forward over local
+// declarations only to a label at the end of the block
+func checkGotoScope(block *Block, from, to int, jump *GotoStat) {
+	atEnd := block.RetExps == nil
+	for _, stat := range block.Stats[to+1:] {
+		if _, ok := stat.(*LabelStat); !ok {
+			atEnd = false
+		}
+	}
+	if atEnd {
+		return
+	}
+	for _, stat := range block.Stats[from+1 : to] {
+		name := ""
+		switch stat := stat.(type) {
+		case *LocalVarDeclStat:
+			name = stat.NameList[0]
+		case *LocalFuncDefStat:
+			name = stat.Name
+		}
+		if name != "" {
+			panic(fmt.Sprintf("<goto %s> at line %d jumps into the scope of local '%s'",
+				jump.Name, jump.Line, name))
+		}
+	}
+}
+
+func (self *luaState) execStat(frame *evalFrame, node Stat, scope *evalScope) (evalCtl, *evalScope) {
+	switch stat := node.(type) {
+	case *EmptyStat:
+	case *BreakStat:
+		if frame.loops == 0 {
+			panic(fmt.Sprintf("<break> at line %d not inside a loop", stat.Line))
+		}
+		return ctlBreak, scope
+	case *GotoStat:
+		frame.jump = stat
+		return ctlGoto, scope
+	case *DoStat:
+		return self.execBlock(frame, stat.Block, scope), scope
+	case *FuncCallStat:
+		self.evalFuncCall(frame, stat, scope, 0)
+	case *WhileStat:
+		return self.execWhile(frame, stat, scope), scope
+	case *RepeatStat:
+		return self.execRepeat(frame, stat, scope), scope
+	case *IfStat:
+		return self.execIf(frame, stat, scope), scope
+	case *ForNumStat:
+		return self.execForNum(frame, stat, scope), scope
+	case *ForInStat:
+		return self.execForIn(frame, stat, scope), scope
+	case *AssignStat:
+		self.execAssign(frame, stat, scope)
+	case *LocalVarDeclStat:
+		vals := self.evalExpList(frame, stat.ExpList, scope, len(stat.NameList))
+		for i, name := range stat.NameList {
+			scope = scope.declare(name, vals[i])
+			scope.isConst = stat.AttribList != nil && stat.AttribList[i] == "const"
+		}
+	case *LocalFuncDefStat:
+		scope = scope.declare(stat.Name, nil)
+		*scope.cell = self.newEvalClosure(stat.Exp, scope, 0)
+	}
+	return ctlNext, scope
+}
+
+// the result of a loop body: whether to leave the loop and how
+func loopCtl(ctl evalCtl) (bool, evalCtl) {
+	switch ctl {
+	case ctlBreak:
+		return true, ctlNext
+	case ctlReturn, ctlGoto:
+		return true, ctl
+	}
+	return false, ctlNext
+}
+
+func (self *luaState) execWhile(frame *evalFrame, node *WhileStat, scope *evalScope) evalCtl {
+	frame.loops++
+	defer func() { frame.loops-- }()
+
+	for convertToBoolean(self.evalExp(frame, node.Exp, scope)) {
+		self.checkInterrupt()
+		if leave, ctl := loopCtl(self.execBlock(frame, node.Block, scope)); leave {
+			return ctl
+		}
+	}
+	return ctlNext
+}
+
+func (self *luaState) execRepeat(frame *evalFrame, node *RepeatStat, scope *evalScope) evalCtl {
+	frame.loops++
+	defer func() { frame.loops-- }()
+
+	for {
+		self.checkInterrupt()
+		ctl, bodyScope := self.execStats(frame, node.Block, scope)
+		if leave, ctl := loopCtl(ctl); leave {
+			return ctl
+		}
+		if convertToBoolean(self.evalExp(frame, node.Exp, bodyScope)) {
+			return ctlNext
+		}
+	}
+}
+
+func (self *luaState) execIf(frame *evalFrame, node *IfStat, scope *evalScope) evalCtl {
+	for i, exp := range node.Exps {
+		if convertToBoolean(self.evalExp(frame, exp, scope)) {
+			return self.execBlock(frame, node.Blocks[i], scope)
+		}
+	}
+	return ctlNext
+}
+
+// same steps as FORPREP and FORLOOP
+func (self *luaState) execForNum(frame *evalFrame, node *ForNumStat, scope *evalScope) evalCtl {
+	frame.loops++
+	defer func() { frame.loops-- }()
+
+	init := self.evalExp(frame, node.InitExp, scope)
+	limit := self.evalExp(frame, node.LimitExp, scope)
+	var step luaValue = int64(1)
+	if node.StepExp != nil {
+		step = self.evalExp(frame, node.StepExp, scope)
+	}
+
+	i, ok1 := init.(int64)
+	s, ok2 := step.(int64)
+	if !ok1 || !ok2 {
+		return self.execForFloat(frame, node, scope, init, limit, step)
+	}
+	if s == 0 {
+		self.runError("'for' step is zero")
+	}
+	lim, ok := convertToInteger(limit)
+	if !ok {
+		f, ok := convertToFloat(limit)
+		if !ok {
+			self.forTypeError(limit, "limit")
+		}
+		var skip bool
+		if lim, skip = number.ForLimit(f, s); skip {
+			return ctlNext
+		}
+	}
+	count, skip := number.ForCount(i, lim, s)
+	if skip {
+		return ctlNext
+	}
+	for {
+		self.checkInterrupt()
+		body := scope.declare(node.VarName, i)
+		if leave, ctl := loopCtl(self.execBlock(frame, node.Block, body)); leave {
+			return ctl
+		}
+		if count == 0 {
+			return ctlNext
+		}
+		count--
+		i += s
+	}
+}
+
+// the loop control values are converted to floats, strings included
+func (self *luaState) execForFloat(frame *evalFrame, node *ForNumStat, scope *evalScope,
+	init, limit, step luaValue) evalCtl {
+
+	fLimit := self.forNumber(limit, "limit")
+	fStep := self.forNumber(step, "step")
+	idx := self.forNumber(init, "initial value")
+	if fStep == 0 {
+		self.runError("'for' step is zero")
+	}
+	if 0 < fStep && fLimit < idx || !(0 < fStep) && idx < fLimit {
+		return ctlNext
+	}
+	for {
+		self.checkInterrupt()
+		body := scope.declare(node.VarName, idx)
+		if leave, ctl := loopCtl(self.execBlock(frame, node.Block, body)); leave {
+			return ctl
+		}
+		if idx += fStep; !(0 < fStep && idx <= fLimit || !(0 < fStep) && fLimit <= idx) {
+			return ctlNext
+		}
+	}
+}
+
+func (self *luaState) forNumber(val luaValue, what string) float64 {
+	f, ok := convertToFloat(val)
+	if !ok {
+		self.forTypeError(val, what)
+	}
+	return f
+}
+
+func (self *luaState) forTypeError(val luaValue, what string) {
+	self.runError("bad 'for' %s (number expected, got %s)", what, self.TypeName(typeOf(val)))
+}
+
+func (self *luaState) execForIn(frame *evalFrame, node *ForInStat, scope *evalScope) evalCtl {
+	frame.loops++
+	defer func() { frame.loops-- }()
+
+	vals := self.evalExpList(frame, node.ExpList, scope, 4)
+	f, s, control, closing := vals[0], vals[1], vals[2], vals[3]
+	self.checkClosable(closing, "(for state)")
+	if closing != nil && closing != false {
+		defer self.closeEvalValue(closing)
+	}
+	for {
+		self.checkInterrupt()
+		results := self.callValue(f, []luaValue{s, control}, len(node.NameList))
+		if results[0] == nil {
+			return ctlNext
+		}
+		control = results[0]
+		body := scope
+		for i, name := range node.NameList {
+			body = body.declare(name, results[i])
+		}
+		if leave, ctl := loopCtl(self.execBlock(frame, node.Block, body)); leave {
+			return ctl
+		}
+	}
+}
+
+// closes the fourth value of a generic for when the loop is left,
+// normally or by an error, which goes on after the __close metamethod
+func (self *luaState) closeEvalValue(val luaValue) {
+	if err := recover(); err != nil {
+		if _, ok := err.(*luaStack); !ok { /* not an error, see finishK */
+			self.callClose(val, errorObject(err))
+		}
+		panic(err)
+	}
+	self.callClose(val, nil)
+}
+
+// like the code generator: the tables and keys of the targets are
+// evaluated first, then the values, then the targets are assigned
+// from left to right
+func (self *luaState) execAssign(frame *evalFrame, node *AssignStat, scope *evalScope) {
+	tables := make([]luaValue, len(node.VarList))
+	keys := make([]luaValue, len(node.VarList))
+	for i, exp := range node.VarList {
+		if nameExp, ok := exp.(*NameExp); ok {
+			if s := scope.find(nameExp.Name); s != nil && s.isConst {
+				panic(fmt.Sprintf("attempt to assign to const variable '%s'", nameExp.Name))
+			}
+		} else if taExp, ok := exp.(*TableAccessExp); ok {
+			tables[i] = self.evalExp(frame, taExp.PrefixExp, scope)
+			keys[i] = self.evalExp(frame, taExp.KeyExp, scope)
+		}
+	}
+
+	vals := self.evalExpList(frame, node.ExpList, scope, len(node.VarList))
+	for i, exp := range node.VarList {
+		if nameExp, ok := exp.(*NameExp); ok {
+			if cell := scope.lookup(nameExp.Name); cell != nil {
+				*cell = vals[i]
+			} else {
+				self.setTable(*scope.lookup("_ENV"), nameExp.Name, vals[i], false)
+			}
+		} else {
+			self.setTable(tables[i], keys[i], vals[i], false)
+		}
+	}
+}
@@ -0,0 +1,248 @@
+package state
+
+import (
+	"fmt"
+	. "luago/api"
+	. "luago/compiler/ast"
+	. "luago/compiler/lexer"
+)
+
+var evalArithOps = map[int]ArithOp{
+	TOKEN_OP_ADD:  LUA_OPADD,
+	TOKEN_OP_SUB:  LUA_OPSUB,
+	TOKEN_OP_MUL:  LUA_OPMUL,
+	TOKEN_OP_MOD:  LUA_OPMOD,
+	TOKEN_OP_POW:  LUA_OPPOW,
+	TOKEN_OP_DIV:  LUA_OPDIV,
+	TOKEN_OP_IDIV: LUA_OPIDIV,
+	TOKEN_OP_BAND: LUA_OPBAND,
+	TOKEN_OP_BOR:  LUA_OPBOR,
+	TOKEN_OP_BXOR: LUA_OPBXOR,
+	TOKEN_OP_SHL:  LUA_OPSHL,
+	TOKEN_OP_SHR:  LUA_OPSHR,
+}
+
+// evaluates an expression to exactly one value
+func (self *luaState) evalExp(frame *evalFrame, node Exp, scope *evalScope) luaValue {
+	switch exp := node.(type) {
+	case *NilExp:
+		return nil
+	case *FalseExp:
+		return false
+	case *TrueExp:
+		return true
+	case *IntegerExp:
+		return exp.Val
+	case *FloatExp:
+		return exp.Val
+	case *StringExp:
+		return exp.Str
+	case *ParensExp:
+		return self.evalExp(frame, exp.Exp, scope)
+	case *VarargExp:
+		if vals := self.evalVararg(frame); len(vals) > 0 {
+			return vals[0]
+		}
+		return nil
+	case *FuncDefExp:
+		return self.newEvalClosure(exp, scope, 0)
+	case *TableConstructorExp:
+		return self.evalTableConstructor(frame, exp, scope)
+	case *UnopExp:
+		return self.evalUnop(frame, exp, scope)
+	case *BinopExp:
+		return self.evalBinop(frame, exp, scope)
+	case *ConcatExp:
+		return self.evalConcat(frame, exp, scope)
+	case *NameExp:
+		if cell := scope.lookup(exp.Name); cell != nil {
+			return *cell
+		}
+		return self.evalIndex(*scope.lookup("_ENV"), exp.Name)
+	case *TableAccessExp:
+		t := self.evalExp(frame, exp.PrefixExp, scope)
+		k := self.evalExp(frame, exp.KeyExp, scope)
+		return self.evalIndex(t, k)
+	case *FuncCallExp:
+		return self.evalFuncCall(frame, exp, scope, 1)[0]
+	}
+	panic(fmt.Sprintf("unknown expression %T", node))
+}
+
+// evaluates a list of expressions, the last one may produce several
+// values; the result is adjusted to want values (-1: all of them)
+func (self *luaState) evalExpList(frame *evalFrame, exps []Exp, scope *evalScope, want int) []luaValue {
+	vals := make([]luaValue, 0, len(exps))
+	for i, exp := range exps {
+		if i < len(exps)-1 {
+			vals = append(vals, self.evalExp(frame, exp, scope))
+			continue
+		}
+		switch exp := exp.(type) {
+		case *FuncCallExp:
+			vals = append(vals, self.evalFuncCall(frame, exp, scope, -1)...)
+		case *VarargExp:
+			vals = append(vals, self.evalVararg(frame)...)
+		default:
+			vals = append(vals, self.evalExp(frame, exp, scope))
+		}
+	}
+
+	if want >= 0 {
+		for len(vals) < want {
+			vals = append(vals, nil)
+		}
+		vals = vals[:want]
+	}
+	return vals
+}
+
+func (self *luaState) evalVararg(frame *evalFrame) []luaValue {
+	if !frame.fn.IsVararg {
+		panic("cannot use '...' outside a vararg function")
+	}
+	return frame.varargs
+}
+
+func (self *luaState) evalTableConstructor(frame *evalFrame, node *TableConstructorExp, scope *evalScope) luaValue {
+	nArr := 0
+	for _, keyExp := range node.KeyExps {
+		if keyExp == nil {
+			nArr++
+		}
+	}
+	t := self.newTable(nArr, len(node.KeyExps)-nArr)
+
+	// like SETLIST, the positional fields are stored in batches, after
+	// the keyed fields evaluated before them
+	var pending []luaValue
+	idx, arrIdx := int64(0), 0
+	for i, keyExp := range node.KeyExps {
+		if keyExp != nil {
+			k := self.evalExp(frame, keyExp, scope)
+			v := self.evalExp(frame, node.ValExps[i], scope)
+			self.setTable(t, k, v, false)
+			continue
+		}
+		if i == len(node.KeyExps)-1 {
+			pending = append(pending, self.evalExpList(frame, node.ValExps[i:], scope, -1)...)
+		} else {
+			pending = append(pending, self.evalExp(frame, node.ValExps[i], scope))
+		}
+		if arrIdx++; arrIdx%50 == 0 || arrIdx == nArr { // LFIELDS_PER_FLUSH
+			for _, v := range pending {
+				idx++
+				self.setTable(t, idx, v, false)
+			}
+			pending = pending[:0]
+		}
+	}
+	return t
+}
+
+func (self *luaState) evalUnop(frame *evalFrame, node *UnopExp, scope *evalScope) luaValue {
+	val := self.evalExp(frame, node.Exp, scope)
+	switch node.Op {
+	case TOKEN_OP_NOT:
+		return !convertToBoolean(val)
+	case TOKEN_OP_UNM:
+		return self.evalArith(val, nil, LUA_OPUNM)
+	case TOKEN_OP_BNOT:
+		return self.evalArith(val, nil, LUA_OPBNOT)
+	case TOKEN_OP_LEN:
+		self.stack.check(2)
+		self.stack.push(val)
+		self.Len(-1)
+		result := self.stack.pop()
+		self.stack.pop()
+		return result
+	}
+	panic(fmt.Sprintf("unknown unary operator %d", node.Op))
+}
+
+func (self *luaState) evalBinop(frame *evalFrame, node *BinopExp, scope *evalScope) luaValue {
+	a := self.evalExp(frame, node.Exp1, scope)
+	switch node.Op {
+	case TOKEN_OP_AND:
+		if !convertToBoolean(a) {
+			return a
+		}
+		return self.evalExp(frame, node.Exp2, scope)
+	case TOKEN_OP_OR:
+		if convertToBoolean(a) {
+			return a
+		}
+		return self.evalExp(frame, node.Exp2, scope)
+	}
+
+	b := self.evalExp(frame, node.Exp2, scope)
+	if op, found := evalArithOps[node.Op]; found {
+		return self.evalArith(a, b, op)
+	}
+	switch node.Op {
+	case TOKEN_OP_EQ:
+		return _eq(a, b, self)
+	case TOKEN_OP_NE:
+		return !_eq(a, b, self)
+	case TOKEN_OP_LT:
+		return _lt(a, b, self)
+	case TOKEN_OP_GT:
+		return _lt(b, a, self)
+	case TOKEN_OP_LE:
+		return _le(a, b, self)
+	case TOKEN_OP_GE:
+		return _le(b, a, self)
+	}
+	panic(fmt.Sprintf("unknown binary operator %d", node.Op))
+}
+
+// b is ignored by the unary operators
+func (self *luaState) evalArith(a, b luaValue, op ArithOp) luaValue {
+	self.stack.check(2)
+	self.stack.push(a)
+	if op != LUA_OPUNM && op != LUA_OPBNOT {
+		self.stack.push(b)
+	}
+	self.Arith(op)
+	return self.stack.pop()
+}
+
+func (self *luaState) evalConcat(frame *evalFrame, node *ConcatExp, scope *evalScope) luaValue {
+	vals := make([]luaValue, len(node.Exps))
+	for i, exp := range node.Exps {
+		vals[i] = self.evalExp(frame, exp, scope)
+	}
+	self.stack.check(len(vals))
+	self.stack.pushN(vals, -1)
+	self.Concat(len(vals))
+	return self.stack.pop()
+}
+
+func (self *luaState) evalIndex(t, k luaValue) luaValue {
+	self.stack.check(1)
+	self.getTable(t, k, false)
+	return self.stack.pop()
+}
+
+// nResults is the number of results wanted, -1 for all of them
+func (self *luaState) evalFuncCall(frame *evalFrame, node *FuncCallExp, scope *evalScope, nResults int) []luaValue {
+	f := self.evalExp(frame, node.PrefixExp, scope)
+	var args []luaValue
+	if node.NameExp != nil {
+		args = append(args, f)
+		f = self.evalIndex(f, node.NameExp.Str)
+	}
+	args = append(args, self.evalExpList(frame, node.Args, scope, -1)...)
+	return self.callValue(f, args, nResults)
+}
+
+// calls f on the current stack, like the CALL instruction
+func (self *luaState) callValue(f luaValue, args []luaValue, nResults int) []luaValue {
+	stack := self.stack
+	base := stack.top
+	stack.check(len(args) + 1)
+	stack.push(f)
+	stack.pushN(args, -1)
+	self.Call(len(args), nResults)
+	return stack.popN(stack.top - base)
+}
@@ -0,0 +1,29 @@
+package state
+
+// Backend selects how Load runs text chunks, binary chunks always run
+// on the VM.
+type Backend int
+
+const (
+	Bytecode Backend = iota // compile to bytecode, the default
+	ASTEval                 // experimental: walk the syntax tree, see ast_eval.go
+)
+
+// Option configures a state created by New or NewWithAllocator.
+type Option func(ls *luaState)
+
+// WithBackend selects the backend of Load:
+//
+//	ls := state.New(state.WithBackend(state.ASTEval))
+//
+// ASTEval is experimental and not a drop-in replacement for Bytecode:
+// runtime errors carry no chunk:line prefix, errors the code generator
+// reports at load time (such as a goto with no visible label) are only
+// raised when the code runs, tail calls and recursion use Go stack, so
+// deep recursion kills the process instead of raising "stack
+// overflow", and the collector leaves its weak tables alone.
+func WithBackend(backend Backend) Option {
+	return func(ls *luaState) {
+		ls.backend = backend
+	}
+}
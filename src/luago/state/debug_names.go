@@ -0,0 +1,263 @@
+package state
+
+import (
+	"fmt"
+	"luago/binchunk"
+	"luago/vm"
+)
+
+/*
+给函数找一个名字：看调用它的那条指令，用符号执行找出被调用的寄存器是从
+哪里来的（局部变量、全局变量、字段、方法、upvalue）。移植自 ldebug.c，
+debug.getinfo 的 'n' 选项用到。
+*/
+
+/* the metamethods called by the instructions that are not calls */
+var opMetamethods = map[int]string{
+	vm.OP_SELF: "__index", vm.OP_GETTABUP: "__index", vm.OP_GETTABLE: "__index",
+	vm.OP_SETTABUP: "__newindex", vm.OP_SETTABLE: "__newindex",
+	vm.OP_ADD: "__add", vm.OP_SUB: "__sub", vm.OP_MUL: "__mul",
+	vm.OP_MOD: "__mod", vm.OP_POW: "__pow", vm.OP_DIV: "__div",
+	vm.OP_IDIV: "__idiv", vm.OP_BAND: "__band", vm.OP_BOR: "__bor",
+	vm.OP_BXOR: "__bxor", vm.OP_SHL: "__shl", vm.OP_SHR: "__shr",
+	vm.OP_UNM: "__unm", vm.OP_BNOT: "__bnot", vm.OP_LEN: "__len",
+	vm.OP_CONCAT: "__concat", vm.OP_EQ: "__eq", vm.OP_LT: "__lt", vm.OP_LE: "__le",
+}
+
+// the kind of name and the name of the function running on stack,
+// found from the instruction of its caller that called it
+func getFuncName(stack *luaStack) (what, name string) {
+	caller := stack.prev
+	if caller == nil || caller.closure == nil || caller.closure.proto == nil {
+		return "", "" /* not called from Lua code */
+	}
+	if stack.isTailCall { /* no information about the caller */
+		return "", ""
+	}
+	return funcNameFromCode(caller.closure.proto, caller.pc-1)
+}
+
+func funcNameFromCode(p *binchunk.Prototype, pc int) (what, name string) {
+	if pc < 0 || pc >= len(p.Code) {
+		return "", ""
+	}
+	i := vm.Instruction(p.Code[pc])
+	switch op := i.Opcode(); op {
+	case vm.OP_CALL, vm.OP_TAILCALL:
+		a, _, _ := i.ABC()
+		return getObjName(p, pc, a) /* get function name */
+	case vm.OP_TFORCALL: /* for iterator */
+		return "for iterator", "for iterator"
+	default: /* other instructions can do calls through metamethods */
+		if name, ok := opMetamethods[op]; ok {
+			return "metamethod", name
+		}
+		return "", ""
+	}
+}
+
+// the instruction stack is running, false if it does not run Lua code
+func runningInst(stack *luaStack) (vm.Instruction, bool) {
+	if stack.closure == nil || stack.closure.proto == nil {
+		return 0, false
+	}
+	code := stack.closure.proto.Code
+	if pc := stack.pc - 1; pc >= 0 && pc < len(code) {
+		return vm.Instruction(code[pc]), true
+	}
+	return 0, false
+}
+
+// " (kind 'name')" for the value of register reg of the running
+// instruction of stack, like varinfo in ldebug.c; constants (reg >
+// 0xFF) have no name
+func varInfo(stack *luaStack, reg int) string {
+	if _, ok := runningInst(stack); !ok || reg < 0 || reg > 0xFF {
+		return ""
+	}
+	p := stack.closure.proto
+	if kind, name := getObjName(p, stack.pc-1, reg); kind != "" {
+		return fmt.Sprintf(" (%s '%s')", kind, name)
+	}
+	return ""
+}
+
+// varInfo of the table indexed by the running instruction of stack
+func indexedVarInfo(stack *luaStack) string {
+	i, ok := runningInst(stack)
+	if !ok {
+		return ""
+	}
+	a, b, _ := i.ABC()
+	switch i.Opcode() {
+	case vm.OP_GETTABLE, vm.OP_SELF:
+		return varInfo(stack, b)
+	case vm.OP_SETTABLE:
+		return varInfo(stack, a)
+	case vm.OP_GETTABUP:
+		return fmt.Sprintf(" (upvalue '%s')", upvalName(stack.closure.proto, b))
+	case vm.OP_SETTABUP:
+		return fmt.Sprintf(" (upvalue '%s')", upvalName(stack.closure.proto, a))
+	}
+	return ""
+}
+
+// the register of the function called by the running instruction,
+// -1 if it is not a call (the call comes from a metamethod or the API)
+func calledReg(stack *luaStack) int {
+	if i, ok := runningInst(stack); ok {
+		if op := i.Opcode(); op == vm.OP_CALL || op == vm.OP_TAILCALL {
+			a, _, _ := i.ABC()
+			return a
+		}
+	}
+	return -1
+}
+
+// the register or constant index of the n-th operand (1 or 2) of the
+// running operator instruction, -1 if stack does not run one
+func operandReg(stack *luaStack, n int) int {
+	i, ok := runningInst(stack)
+	if !ok {
+		return -1
+	}
+	_, b, c := i.ABC()
+	switch op := i.Opcode(); {
+	case op == vm.OP_UNM || op == vm.OP_BNOT || op == vm.OP_LEN:
+		return b
+	case op >= vm.OP_ADD && op <= vm.OP_SHR:
+		if n == 2 {
+			return c
+		}
+		return b
+	}
+	return -1
+}
+
+// the kind of name and the name of the value in register reg at lastpc
+func getObjName(p *binchunk.Prototype, lastpc, reg int) (what, name string) {
+	if name, ok := localName(p, reg+1, lastpc); ok { /* is a local? */
+		return "local", name
+	}
+	/* else try symbolic execution */
+	pc := findSetReg(p, lastpc, reg)
+	if pc == -1 { /* could not find instruction? */
+		return "", ""
+	}
+	i := vm.Instruction(p.Code[pc])
+	switch op := i.Opcode(); op {
+	case vm.OP_MOVE:
+		a, b, _ := i.ABC() /* move from 'b' to 'a' */
+		if b < a {
+			return getObjName(p, pc, b) /* get name for 'b' */
+		}
+	case vm.OP_GETTABUP, vm.OP_GETTABLE:
+		_, t, k := i.ABC() /* table and key index */
+		var vn string      /* name of indexed variable */
+		if op == vm.OP_GETTABLE {
+			/* globals are read through a register holding _ENV */
+			_, vn = getObjName(p, pc, t)
+		} else {
+			vn = upvalName(p, t)
+		}
+		name = kName(p, pc, k)
+		if vn == "_ENV" {
+			return "global", name
+		}
+		return "field", name
+	case vm.OP_GETUPVAL:
+		_, b, _ := i.ABC()
+		return "upvalue", upvalName(p, b)
+	case vm.OP_LOADK, vm.OP_LOADKX:
+		_, b := i.ABx()
+		if op == vm.OP_LOADKX {
+			b = vm.Instruction(p.Code[pc+1]).Ax()
+		}
+		if s, ok := p.Constants[b].(string); ok {
+			return "constant", s
+		}
+	case vm.OP_SELF:
+		_, _, k := i.ABC() /* key index */
+		return "method", kName(p, pc, k)
+	}
+	return "", "" /* could not find reasonable name */
+}
+
+// the name of the key RK(c), "?" if it is not a literal string
+func kName(p *binchunk.Prototype, pc, c int) string {
+	if c > 0xFF { /* is 'c' a constant? */
+		if s, ok := p.Constants[c&0xFF].(string); ok { /* literal constant? */
+			return s /* it is its own name */
+		}
+	} else if what, name := getObjName(p, pc, c); what == "constant" { /* 'c' is a register */
+		return name /* found a constant name */
+	}
+	return "?" /* no reasonable name found */
+}
+
+func upvalName(p *binchunk.Prototype, uv int) string {
+	if uv < len(p.UpvalueNames) && p.UpvalueNames[uv] != "" {
+		return p.UpvalueNames[uv]
+	}
+	return "?"
+}
+
+// the last instruction before lastpc that changed register reg, -1
+// if that depends on a jump
+func findSetReg(p *binchunk.Prototype, lastpc, reg int) int {
+	setreg := -1   /* keep last instruction that changed 'reg' */
+	jmptarget := 0 /* any code before this address is conditional */
+	filterpc := func(pc int) int {
+		if pc < jmptarget { /* is code conditional (inside a jump)? */
+			return -1 /* cannot know who sets that register */
+		}
+		return pc /* current position sets that register */
+	}
+	for pc := 0; pc < lastpc; pc++ {
+		i := vm.Instruction(p.Code[pc])
+		a, b, _ := i.ABC()
+		switch i.Opcode() {
+		case vm.OP_LOADNIL:
+			if a <= reg && reg <= a+b { /* set registers from 'a' to 'a+b' */
+				setreg = filterpc(pc)
+			}
+		case vm.OP_TFORCALL:
+			if reg >= a+2 { /* affect all regs above its base */
+				setreg = filterpc(pc)
+			}
+		case vm.OP_CALL, vm.OP_TAILCALL:
+			if reg >= a { /* affect all registers above base */
+				setreg = filterpc(pc)
+			}
+		case vm.OP_JMP:
+			_, sbx := i.AsBx()
+			dest := pc + 1 + sbx
+			/* jump is forward and do not skip 'lastpc'? */
+			if pc < dest && dest <= lastpc && dest > jmptarget {
+				jmptarget = dest /* update 'jmptarget' */
+			}
+		default:
+			if i.TestAMode() && reg == a { /* any instruction that set A */
+				setreg = filterpc(pc)
+			}
+		}
+	}
+	return setreg
+}
+
+// the name of the n-th local variable active at pc, like
+// luaF_getlocalname
+func localName(p *binchunk.Prototype, n, pc int) (string, bool) {
+	for _, locVar := range p.LocVars {
+		if int(locVar.StartPC) > pc {
+			break
+		}
+		if pc < int(locVar.EndPC) { /* is variable active? */
+			n--
+			if n == 0 {
+				return locVar.VarName, true
+			}
+		}
+	}
+	return "", false /* not found */
+}
@@ -0,0 +1,109 @@
+package state
+
+import "luago/vm"
+
+/*
+常见指令的快速路径：直接读写寄存器，避免经由 LuaVM 接口的压栈、出栈。
+只处理最常见的情况（整数操作数等），其余情况返回 false，
+由 vm.Execute 按一般路径执行。
+*/
+func (self *luaState) fastExecute(stack *luaStack, inst vm.Instruction) bool {
+	switch inst.Opcode() {
+	case vm.OP_MOVE:
+		a, b, _ := inst.ABC()
+		stack.slots[a] = stack.slots[b]
+		return true
+	case vm.OP_ADD, vm.OP_SUB:
+		a, b, c := inst.ABC()
+		x, ok1 := stack.rk(b).(int64)
+		y, ok2 := stack.rk(c).(int64)
+		if !ok1 || !ok2 {
+			return false
+		}
+		if inst.Opcode() == vm.OP_ADD {
+			stack.slots[a] = x + y
+		} else {
+			stack.slots[a] = x - y
+		}
+		return true
+	case vm.OP_LOADK:
+		a, bx := inst.ABx()
+		stack.slots[a] = stack.closure.proto.Constants[bx]
+		return true
+	case vm.OP_JMP:
+		a, sBx := inst.AsBx()
+		if a != 0 {
+			return false /* closes upvalues */
+		}
+		stack.pc += sBx
+		return true
+	case vm.OP_EQ, vm.OP_LT, vm.OP_LE:
+		a, b, c := inst.ABC()
+		x, ok1 := stack.rk(b).(int64)
+		y, ok2 := stack.rk(c).(int64)
+		if !ok1 || !ok2 {
+			return false
+		}
+		var result bool
+		switch inst.Opcode() {
+		case vm.OP_EQ:
+			result = x == y
+		case vm.OP_LT:
+			result = x < y
+		default:
+			result = x <= y
+		}
+		if result != (a != 0) {
+			stack.pc++
+		}
+		return true
+	case vm.OP_GETTABLE:
+		a, b, c := inst.ABC()
+		t, ok1 := stack.slots[b].(*luaTable)
+		k, ok2 := stack.rk(c).(int64)
+		if !ok1 || !ok2 {
+			return false
+		}
+		v := t.getInt(k)
+		if v == nil && t.metatable != nil {
+			return false /* may have __index */
+		}
+		stack.slots[a] = v
+		return true
+	case vm.OP_SETTABLE:
+		a, b, c := inst.ABC()
+		t, ok1 := stack.slots[a].(*luaTable)
+		k, ok2 := stack.rk(b).(int64)
+		if !ok1 || !ok2 || t.metatable != nil {
+			return false
+		}
+		t.putInt(k, stack.rk(c))
+		return true
+	case vm.OP_FORLOOP:
+		a, sBx := inst.AsBx()
+		slots := stack.slots
+		i, ok1 := slots[a].(int64)
+		count, ok2 := slots[a+1].(int64)
+		step, ok3 := slots[a+2].(int64)
+		if !ok1 || !ok2 || !ok3 {
+			return false
+		}
+		if count != 0 { /* integer loops count the iterations left */
+			var idx luaValue = i + step /* boxed once for both slots */
+			slots[a+1] = count - 1
+			slots[a] = idx
+			stack.pc += sBx
+			slots[a+3] = idx
+		}
+		return true
+	}
+	return false
+}
+
+// rk returns a register or a constant without pushing it
+func (self *luaStack) rk(rk int) luaValue {
+	if rk > 0xFF {
+		return self.closure.proto.Constants[rk&0xFF]
+	}
+	return self.slots[rk]
+}
@@ -0,0 +1,203 @@
+package state
+
+import (
+	"errors"
+	"fmt"
+	. "luago/api"
+	"luago/binchunk"
+	"luago/compiler"
+	"luago/vfs"
+)
+
+/*
+热更新：重新编译代码，并把新函数的原型“嫁接”到已有的闭包上，
+这样宿主或脚本持有的旧函数引用也会执行新代码。
+	- 旧表中已有的函数被原地修补，新增的键被加入，其他值保持不变；
+	- 新闭包的上值按名字匹配旧闭包的上值，匹配成功则沿用旧上值（保留状态），
+	  上值本身是函数时递归修补；
+	- Go 函数不会被修补。
+*/
+
+// [-0, +0, –]
+// ReloadModule finds the source of an already required module on
+// package.path and hot swaps it.
+func (self *luaState) ReloadModule(name string) error {
+	top := self.GetTop()
+	defer self.SetTop(top)
+
+	if self.GetGlobal("package") != LUA_TTABLE ||
+		self.GetField(-1, "searchpath") != LUA_TFUNCTION {
+		return errors.New("package library is not open")
+	}
+	self.PushString(name)
+	self.GetField(-3, "path")
+	self.Call(2, 2)
+	if self.IsNil(-2) {
+		return fmt.Errorf("module '%s' not found:%s", name, self.ToString(-1))
+	}
+	filename := self.ToString(-2)
+
+	chunk, err := vfs.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+	return self.HotSwap(chunk, filename, name)
+}
+
+// [-0, +0, –]
+// HotSwap runs chunk and patches the module modName with the value it
+// returns. With an empty modName, the chunk runs in a separate global
+// environment and the global table is patched with what it defines.
+func (self *luaState) HotSwap(chunk []byte, chunkName, modName string) (err error) {
+	top := self.GetTop()
+	defer self.SetTop(top)
+
+	proto, err := compileChunk(chunk, chunkName)
+	if err != nil {
+		return err
+	}
+	globals := self.registry.get(LUA_RIDX_GLOBALS).(*luaTable)
+
+	var old luaValue = globals
+	var env luaValue = globals
+	if modName != "" {
+		loaded, _ := self.registry.get(LUA_LOADED_TABLE).(*luaTable)
+		if loaded == nil || loaded.get(modName) == nil {
+			return fmt.Errorf("module '%s' is not loaded", modName)
+		}
+		old = loaded.get(modName)
+	} else {
+		newEnv := newLuaTable(0, 0) /* reads fall through to the old globals */
+		newEnv.metatable = newLuaTable(0, 1)
+		newEnv.metatable.put("__index", globals)
+		env = newEnv
+	}
+
+	c := self.newClosure(proto)
+	if len(proto.Upvalues) > 0 {
+		c.upvals[0] = &upvalue{&env}
+	}
+	self.stack.push(c)
+	self.PushString(modName)
+	self.PushString(chunkName)
+	if self.PCall(2, 1, 0) != LUA_OK {
+		return fmt.Errorf("%v", self.stack.get(-1))
+	}
+
+	p := &patcher{
+		subst:   map[*luaTable]*luaTable{},
+		visited: map[interface{}]bool{},
+	}
+	if modName != "" {
+		p.patch(old, self.stack.get(-1))
+	} else {
+		p.subst[env.(*luaTable)] = globals
+		p.patch(globals, env)
+	}
+	return nil
+}
+
+func compileChunk(chunk []byte, chunkName string) (*binchunk.Prototype, error) {
+	if binchunk.IsBinaryChunk(chunk) {
+		return binchunk.Load(chunk, chunkName)
+	}
+	return compiler.Compile(string(chunk), chunkName)
+}
+
+type patcher struct {
+	subst   map[*luaTable]*luaTable /* new tables standing for old ones */
+	visited map[interface{}]bool
+}
+
+// patch merges the new value into the old one, returns false if the
+// values are not patchable (different types, Go functions)
+func (self *patcher) patch(old, new luaValue) bool {
+	switch o := old.(type) {
+	case *luaTable:
+		if n, ok := new.(*luaTable); ok {
+			self.patchTable(o, n)
+			return true
+		}
+	case *closure:
+		if n, ok := new.(*closure); ok && o.proto != nil && n.proto != nil {
+			self.patchClosure(o, n)
+			return true
+		}
+	}
+	return false
+}
+
+func (self *patcher) patchTable(old, new *luaTable) {
+	if old == new || self.visited[old] {
+		return
+	}
+	self.visited[old] = true
+
+	merge := func(k, nv luaValue) {
+		if ov := old.get(k); ov == nil {
+			old.put(k, self.substitute(nv))
+		} else {
+			switch ov.(type) {
+			case *closure, *luaTable:
+				self.patch(ov, nv)
+			}
+		}
+	}
+	for i, nv := range new.arr {
+		merge(int64(i+1), nv)
+	}
+	for k, nv := range new._map {
+		merge(keyValue(k), nv)
+	}
+}
+
+func (self *patcher) patchClosure(old, new *closure) {
+	if old == new || self.visited[old] {
+		return
+	}
+	self.visited[old] = true
+
+	upvals := make([]*upvalue, len(new.upvals))
+	for i, uv := range new.upvals {
+		upvals[i] = self.substituteUpvalue(uv)
+		if i >= len(new.proto.UpvalueNames) {
+			continue
+		}
+		if j := indexOf(old.proto.UpvalueNames, new.proto.UpvalueNames[i]); j >= 0 &&
+			j < len(old.upvals) && old.upvals[j] != nil {
+			/* keep the state of the old upvalue, but update functions it holds */
+			if uv != nil && uv.val != nil && old.upvals[j].val != nil {
+				self.patch(*old.upvals[j].val, *uv.val)
+			}
+			upvals[i] = old.upvals[j]
+		}
+	}
+	old.proto = new.proto
+	old.upvals = upvals
+}
+
+func (self *patcher) substitute(val luaValue) luaValue {
+	if t, ok := val.(*luaTable); ok && self.subst[t] != nil {
+		return self.subst[t]
+	}
+	return val
+}
+
+func (self *patcher) substituteUpvalue(uv *upvalue) *upvalue {
+	if uv != nil && uv.val != nil {
+		if t, ok := (*uv.val).(*luaTable); ok && self.subst[t] != nil {
+			var val luaValue = self.subst[t]
+			return &upvalue{&val}
+		}
+	}
+	return uv
+}
+
+func indexOf(names []string, name string) int {
+	for i, n := range names {
+		if n == name {
+			return i
+		}
+	}
+	return -1
+}
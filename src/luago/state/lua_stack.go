@@ -11,7 +11,14 @@ type luaStack struct {
 	closure *closure
 	varargs []luaValue
 	openuvs map[int]*upvalue
+	tbc     []int /* slots of the to-be-closed variables, see ToClose */
 	pc      int
+	oldPC   int /* last pc traced by the line hook */
+	/* entered by a tail call, the frame of the caller is gone */
+	isTailCall bool
+	/* results of the continuation that finished a Go function */
+	kDone    bool
+	kResults int
 	/* linked list */
 	prev *luaStack
 }
@@ -26,8 +33,16 @@ func newLuaStack(size int, state *luaState) *luaStack {
 
 func (self *luaStack) check(n int) {
 	free := len(self.slots) - self.top
-	for i := free; i < n; i++ {
-		self.slots = append(self.slots, nil)
+	if free >= n {
+		return
+	}
+	self.state.alloc(ALLOC_STACK, (n-free)*valueSize)
+	slots := make([]luaValue, self.top+n)
+	copy(slots, self.slots)
+	self.slots = slots
+	/* open upvalues alias the slots, move them to the new array */
+	for i, openuv := range self.openuvs {
+		openuv.val = &slots[i]
 	}
 }
 
@@ -72,6 +87,25 @@ func (self *luaStack) popN(n int) []luaValue {
 	return vals
 }
 
+// moveN moves the top n values onto stack to, adjusted to want values
+// (-1: all of them), without a temporary slice
+func (self *luaStack) moveN(to *luaStack, n, want int) {
+	if want < 0 {
+		want = n
+	}
+	to.check(want)
+	from := self.top - n
+	m := copy(to.slots[to.top:to.top+want], self.slots[from:self.top])
+	for i := to.top + m; i < to.top+want; i++ {
+		to.slots[i] = nil
+	}
+	to.top += want
+	for i := from; i < self.top; i++ {
+		self.slots[i] = nil
+	}
+	self.top = from
+}
+
 func (self *luaStack) absIndex(idx int) int {
 	if idx >= 0 || idx <= LUA_REGISTRYINDEX {
 		return idx
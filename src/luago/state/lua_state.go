@@ -1,21 +1,101 @@
 package state
 
-import . "luago/api"
+import (
+	. "luago/api"
+	"sync/atomic"
+)
 
+/* the data shared by the main thread and its coroutines */
+type globalState struct {
+	registry   *luaTable
+	mainThread *luaState
+	coroutines map[*luaState]bool /* the ones with a goroutine */
+	allocator  Allocator
+	allocHook  AllocHook
+	errFormat  ErrorFormatter
+	panicf     GoFunction /* see AtPanic */
+	warnf      WarnFunction
+	/* interruption, may be requested from other goroutines */
+	interrupted  int32
+	interruptMsg string
+	backend      Backend
+	/* garbage collection, see api_gc.go */
+	gcLive        int /* bytes reachable at the last collection */
+	gcDebt        int /* bytes allocated since then */
+	gcStopped     bool
+	gcPause       int
+	gcStepMul     int
+	hasWeakTables bool             /* a metatable with __mode was set */
+	hasFinalizers bool             /* a metatable with __gc was set */
+	finobj        map[luaValue]int /* objects with a finalizer -> registration order */
+	finSeq        int
+	tobefnz       []luaValue /* unreachable, their finalizers are pending */
+	inFinalizer   bool
+}
+
+// a thread: the main one or a coroutine
 type luaState struct {
-	registry *luaTable
-	stack    *luaStack
+	*globalState
+	stack *luaStack
+	/* coroutine */
+	coStatus int
+	coCaller *luaState
+	coChan   chan int /* closed to stop the goroutine */
+	coErr    luaValue /* the error that killed the coroutine */
+	nYields  int      /* number of yields, to detect them in CallK */
+	/* hooks */
+	hook          LuaHook
+	hookMask      int
+	baseHookCount int
+	hookCount     int
+	inHook        bool /* running a hook */
+	/* where the last error caught by PCall was raised */
+	errFrames []errFrame
+	/* an error raised now is caught by PCall or by the panic function */
+	errCaught bool
 }
 
-func New() *luaState {
-	registry := newLuaTable(0, 0)
-	registry.put(LUA_RIDX_GLOBALS, newLuaTable(0, 0))
+func New(opts ...Option) *luaState {
+	return NewWithAllocator(defaultAllocator{}, opts...)
+}
 
-	ls := &luaState{registry: registry}
-	ls.pushLuaStack(newLuaStack(LUA_MINSTACK, ls))
+// NewWithAllocator creates a state whose tables, strings and stacks
+// are accounted to the given allocator.
+func NewWithAllocator(allocator Allocator, opts ...Option) *luaState {
+	ls := &luaState{globalState: &globalState{
+		allocator: allocator,
+		gcPause:   LUAI_GCPAUSE,
+		gcStepMul: LUAI_GCMUL,
+	}}
+	ls.mainThread = ls
+	ls.coroutines = map[*luaState]bool{}
+	for _, opt := range opts {
+		opt(ls)
+	}
+	ls.registry = ls.newTable(0, 0)
+	ls.registry.put(LUA_RIDX_MAINTHREAD, ls)
+	ls.registry.put(LUA_RIDX_GLOBALS, ls.newTable(0, 0))
+	ls.pushLuaStack(ls.newStack(LUA_MINSTACK))
 	return ls
 }
 
+// [-0, +0, –]
+// Close releases the state and its allocator, the state cannot be
+// used afterwards. The finalizers of all objects that have one are
+// called first. The goroutines of suspended coroutines are stopped;
+// they keep the state alive, so a state with suspended coroutines that
+// is dropped without Close is never garbage collected.
+// http://www.lua.org/manual/5.3/manual.html#lua_close
+func (self *luaState) Close() {
+	self.finalizeAll()
+	for co := range self.coroutines {
+		co.CloseThread(self)
+	}
+	self.registry = nil
+	self.stack = nil
+	self.allocator.Close()
+}
+
 func (self *luaState) pushLuaStack(stack *luaStack) {
 	stack.prev = self.stack
 	self.stack = stack
@@ -26,3 +106,23 @@ func (self *luaState) popLuaStack() {
 	self.stack = stack.prev
 	stack.prev = nil
 }
+
+// Interrupt asks the running Lua code to stop: an error with the given
+// message is raised before the next instruction. Safe to call from any
+// goroutine.
+func (self *luaState) Interrupt(msg string) {
+	self.interruptMsg = msg
+	atomic.StoreInt32(&self.interrupted, 1)
+}
+
+// ClearInterrupt withdraws a pending interruption.
+func (self *luaState) ClearInterrupt() {
+	atomic.StoreInt32(&self.interrupted, 0)
+}
+
+func (self *luaState) checkInterrupt() {
+	if atomic.LoadInt32(&self.interrupted) != 0 {
+		atomic.StoreInt32(&self.interrupted, 0)
+		panic(self.interruptMsg)
+	}
+}
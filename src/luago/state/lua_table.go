@@ -1,6 +1,7 @@
 package state
 
 import (
+	. "luago/api"
 	"luago/number"
 	"math"
 )
@@ -12,6 +13,9 @@ type luaTable struct {
 	keys      map[luaValue]luaValue // used by next()
 	lastKey   luaValue              // used by next()
 	changed   bool                  // used by next()
+	longKeys  map[uint32][]*longKey // long string keys by sampled hash
+	deadKeys  int                   // long keys removed from _map but not from longKeys
+	g         *globalState          // charged for growth, nil: not accounted
 }
 
 func newLuaTable(nArr, nRec int) *luaTable {
@@ -35,62 +39,118 @@ func (self *luaTable) len() int {
 }
 
 func (self *luaTable) get(key luaValue) luaValue {
-	key = _floatToInteger(key)
-	if idx, ok := key.(int64); ok {
-		if idx >= 1 && idx <= int64(len(self.arr)) {
-			return self.arr[idx-1]
+	switch k := key.(type) {
+	case int64:
+		return self.getInt(k)
+	case float64:
+		if i, ok := number.FloatToInteger(k); ok {
+			return self.getInt(i)
+		}
+	case string:
+		if lk, ok := self.longKey(k, false); ok {
+			if lk == nil {
+				return nil
+			}
+			return self._map[lk]
 		}
 	}
 	return self._map[key]
 }
 
-func _floatToInteger(key luaValue) luaValue {
-	if f, ok := key.(float64); ok {
-		if i, ok := number.FloatToInteger(f); ok {
-			return i
-		}
+// getInt is get for integer keys, it skips the key normalization
+func (self *luaTable) getInt(idx int64) luaValue {
+	if uint64(idx-1) < uint64(len(self.arr)) {
+		return self.arr[idx-1]
 	}
-	return key
+	if self._map == nil {
+		return nil
+	}
+	return self._map[idx]
 }
 
 func (self *luaTable) put(key, val luaValue) {
-	if key == nil {
+	switch k := key.(type) {
+	case nil:
 		panic("table index is nil!")
-	}
-	if f, ok := key.(float64); ok && math.IsNaN(f) {
-		panic("table index is NaN!")
+	case int64:
+		self.putInt(k, val)
+		return
+	case float64:
+		if i, ok := number.FloatToInteger(k); ok {
+			self.putInt(i, val)
+			return
+		}
+		if math.IsNaN(k) {
+			panic("table index is NaN!")
+		}
+	case string:
+		if lk, ok := self.longKey(k, val != nil); ok {
+			if lk == nil {
+				return
+			}
+			key = lk
+			if val == nil && self._map[lk] != nil {
+				self.deadKeys++ /* kept until the next prune, next() may still need it */
+			}
+		}
 	}
 
 	self.changed = true
-	key = _floatToInteger(key)
-	if idx, ok := key.(int64); ok && idx >= 1 {
-		arrLen := int64(len(self.arr))
-		if idx <= arrLen {
-			self.arr[idx-1] = val
-			if idx == arrLen && val == nil {
-				self._shrinkArray()
-			}
-			return
+	self.putMap(key, val)
+}
+
+// putInt is put for integer keys, it skips the key normalization
+func (self *luaTable) putInt(idx int64, val luaValue) {
+	self.changed = true
+	arrLen := int64(len(self.arr))
+	if uint64(idx-1) < uint64(arrLen) {
+		self.arr[idx-1] = val
+		if idx == arrLen && val == nil {
+			self._shrinkArray()
 		}
-		if idx == arrLen+1 {
-			delete(self._map, key)
-			if val != nil {
-				self.arr = append(self.arr, val)
-				self._expandArray()
-			}
-			return
+		return
+	}
+	if idx == arrLen+1 {
+		if self._map != nil {
+			delete(self._map, idx)
+		}
+		if val != nil {
+			oldCap := cap(self.arr)
+			self.arr = append(self.arr, val)
+			self._expandArray()
+			self.grow(cap(self.arr) - oldCap)
 		}
+		return
 	}
+	self.putMap(idx, val)
+}
+
+func (self *luaTable) putMap(key, val luaValue) {
 	if val != nil {
 		if self._map == nil {
 			self._map = make(map[luaValue]luaValue, 8)
 		}
+		n := len(self._map)
 		self._map[key] = val
+		if len(self._map) > n && self.g != nil { /* new key */
+			if err := self.g.tryAlloc(ALLOC_TABLE, 2*valueSize); err != nil {
+				delete(self._map, key)
+				panic(err.Error())
+			}
+		}
 	} else {
 		delete(self._map, key)
 	}
 }
 
+// grow charges n more slots of the array part to the allocator; the
+// slots are already there, a refusal only raises the error
+func (self *luaTable) grow(n int) {
+	if n > 0 && self.g != nil {
+		self.g.alloc(ALLOC_TABLE, n*valueSize)
+	}
+}
+
 func (self *luaTable) _shrinkArray() {
 	for i := len(self.arr) - 1; i >= 0; i-- {
 		if self.arr[i] == nil {
@@ -100,6 +160,9 @@ func (self *luaTable) _shrinkArray() {
 }
 
 func (self *luaTable) _expandArray() {
+	if len(self._map) == 0 {
+		return
+	}
 	for idx := int64(len(self.arr)) + 1; true; idx++ {
 		if val, found := self._map[idx]; found {
 			delete(self._map, idx)
@@ -116,15 +179,21 @@ func (self *luaTable) nextKey(key luaValue) luaValue {
 		self.changed = false
 	}
 
+	if lk, ok := self.longKey(key, false); ok && lk != nil {
+		key = lk
+	}
 	nextKey := self.keys[key]
 	if nextKey == nil && key != nil && key != self.lastKey {
 		panic("invalid key to 'next'")
 	}
 
-	return nextKey
+	return keyValue(nextKey)
 }
 
 func (self *luaTable) initKeys() {
+	if self.deadKeys > 0 {
+		self.pruneLongKeys()
+	}
 	self.keys = make(map[luaValue]luaValue)
 	var key luaValue = nil
 	for i, v := range self.arr {
@@ -141,3 +210,81 @@ func (self *luaTable) initKeys() {
 	}
 	self.lastKey = key
 }
+
+/*
+长字符串键：Go 的 map 每次查找都要对整个字符串求哈希，
+超过 LUAI_MAXSHORTLEN 的字符串作为键时改用 *longKey：
+哈希只在第一次作为键时按采样计算（同 luaS_hashlongstr），并保存在 longKey 上，
+之后 _map 里按指针查找。相同的字符串先比较指针，所以通常也不需要逐字节比较。
+*/
+const LUAI_MAXSHORTLEN = 40
+const LUAI_HASHLIMIT = 5 // at most 2^5 characters are hashed
+
+type longKey struct {
+	s    string
+	hash uint32
+}
+
+func hashLongString(s string) uint32 {
+	l := len(s)
+	h := uint32(l)
+	step := (l >> LUAI_HASHLIMIT) + 1
+	for ; l >= step; l -= step {
+		h ^= (h << 5) + (h >> 2) + uint32(s[l-1])
+	}
+	return h
+}
+
+// longKey finds the key object of a long string key, creating it if
+// create is set. ok is false for keys that are not long strings.
+func (self *luaTable) longKey(key luaValue, create bool) (lk *longKey, ok bool) {
+	s, isStr := key.(string)
+	if !isStr || len(s) <= LUAI_MAXSHORTLEN {
+		return nil, false
+	}
+
+	h := hashLongString(s)
+	for _, lk := range self.longKeys[h] {
+		if lk.s == s {
+			return lk, true
+		}
+	}
+	if !create {
+		return nil, true
+	}
+	if self.longKeys == nil {
+		self.longKeys = map[uint32][]*longKey{}
+	}
+	if self.deadKeys > len(self._map) { /* adding keys during next() is undefined anyway */
+		self.pruneLongKeys()
+	}
+	lk = &longKey{s, h}
+	self.longKeys[h] = append(self.longKeys[h], lk)
+	return lk, true
+}
+
+// pruneLongKeys forgets the long keys no longer in the table
+func (self *luaTable) pruneLongKeys() {
+	for h, bucket := range self.longKeys {
+		live := bucket[:0]
+		for _, lk := range bucket {
+			if self._map[lk] != nil {
+				live = append(live, lk)
+			}
+		}
+		if len(live) == 0 {
+			delete(self.longKeys, h)
+		} else {
+			self.longKeys[h] = live
+		}
+	}
+	self.deadKeys = 0
+}
+
+// keyValue turns a key of _map back into the Lua value
+func keyValue(key luaValue) luaValue {
+	if lk, ok := key.(*longKey); ok {
+		return lk.s
+	}
+	return key
+}
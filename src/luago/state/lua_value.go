@@ -20,6 +20,12 @@ func typeOf(val luaValue) LuaType {
 		return LUA_TTABLE
 	case *closure:
 		return LUA_TFUNCTION
+	case *luaState:
+		return LUA_TTHREAD
+	case *userdata:
+		return LUA_TUSERDATA
+	case lightUserData:
+		return LUA_TLIGHTUSERDATA
 	default:
 		panic("todo!")
 	}
@@ -65,22 +71,44 @@ func convertToInteger(val luaValue) (int64, bool) {
 }
 
 func _stringToInteger(s string) (int64, bool) {
-	if i, ok := number.ParseInteger(s); ok {
-		return i, true
-	}
-	if f, ok := number.ParseFloat(s); ok {
+	i, f, isFloat, ok := number.ParseNumeral(s)
+	if ok && isFloat {
 		return number.FloatToInteger(f)
 	}
-	return 0, false
+	return i, ok
+}
+
+// stringToNumber converts a string operand of an arithmetic operation
+// to an integer or a float, following the syntax of Lua numerals
+func stringToNumber(s string) (luaValue, bool) {
+	i, f, isFloat, ok := number.ParseNumeral(s)
+	if !ok {
+		return nil, false
+	} else if isFloat {
+		return f, true
+	}
+	return i, true
 }
 
 /* metatable */
 
+// registry keys of the metatables shared by all values of a type
+var mtKeys = map[LuaType]string{}
+
+func init() {
+	for tp := LUA_TNONE; tp <= LUA_TTHREAD; tp++ {
+		mtKeys[tp] = fmt.Sprintf("_MT%d", tp)
+	}
+}
+
 func getMetatable(val luaValue, ls *luaState) *luaTable {
-	if t, ok := val.(*luaTable); ok {
-		return t.metatable
+	switch x := val.(type) {
+	case *luaTable:
+		return x.metatable
+	case *userdata:
+		return x.metatable
 	}
-	key := fmt.Sprintf("_MT%d", typeOf(val))
+	key := mtKeys[typeOf(val)]
 	if mt := ls.registry.get(key); mt != nil {
 		return mt.(*luaTable)
 	}
@@ -90,9 +118,18 @@ func getMetatable(val luaValue, ls *luaState) *luaTable {
 func setMetatable(val luaValue, mt *luaTable, ls *luaState) {
 	if t, ok := val.(*luaTable); ok {
 		t.metatable = mt
+		if mt != nil && mt.get("__mode") != nil {
+			ls.hasWeakTables = true
+		}
+		ls.checkFinalizer(val, mt)
+		return
+	}
+	if u, ok := val.(*userdata); ok {
+		u.metatable = mt
+		ls.checkFinalizer(val, mt)
 		return
 	}
-	key := fmt.Sprintf("_MT%d", typeOf(val))
+	key := mtKeys[typeOf(val)]
 	ls.registry.put(key, mt)
 }
 
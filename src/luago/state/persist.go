@@ -0,0 +1,411 @@
+package state
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"luago/api"
+	"luago/binchunk"
+	"math"
+)
+
+/*
+持久化（eris 风格）：把值及其可达的整个对象图编码为字节串，
+包括闭包（原型 + 上值）、共享引用和环。
+不可持久化的值（Go 函数、注册表等）可以放进 permanents 表：
+Persist 时 perms[value] = key，Unpersist 时 perms[key] = value。
+打开的上值被保存为其当前值，还原后成为关闭的上值。
+*/
+const PERSIST_SIGNATURE = "\x1bLPS"
+const PERSIST_VERSION = 1
+
+const (
+	PTAG_NIL = iota
+	PTAG_FALSE
+	PTAG_TRUE
+	PTAG_INTEGER
+	PTAG_NUMBER
+	PTAG_STRING
+	PTAG_TABLE
+	PTAG_CLOSURE
+	PTAG_REF  // already persisted table or closure
+	PTAG_PERM // permanent value, followed by its key
+)
+
+const (
+	PTAG_UPVAL = iota
+	PTAG_UPVAL_REF
+)
+
+type persister struct {
+	buf    bytes.Buffer
+	perms  *luaTable
+	refs   map[interface{}]int64 // tables, closures, upvalues and protos
+	nextId int64
+}
+
+type unpersister struct {
+	ls    *luaState
+	data  []byte
+	perms *luaTable
+	refs  []interface{}
+}
+
+// [-0, +0, e]
+// Persist serializes the value at idx. permsIdx is the index of the
+// permanents table, or 0 for none.
+func (self *luaState) Persist(idx, permsIdx int) (data []byte, err error) {
+	p := &persister{refs: map[interface{}]int64{}}
+	if permsIdx != 0 {
+		if t, ok := self.stack.get(permsIdx).(*luaTable); ok {
+			p.perms = t
+		} else {
+			return nil, errors.New("permanents must be a table")
+		}
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			if e, ok := r.(persistError); ok {
+				data, err = nil, e
+			} else {
+				panic(r)
+			}
+		}
+	}()
+
+	p.buf.WriteString(PERSIST_SIGNATURE)
+	p.buf.WriteByte(PERSIST_VERSION)
+	p.writeValue(self.stack.get(idx))
+	return p.buf.Bytes(), nil
+}
+
+// [-0, +1, e]
+// Unpersist decodes data produced by Persist and pushes the value.
+// permsIdx is the index of the permanents table, or 0 for none.
+func (self *luaState) Unpersist(data []byte, permsIdx int) (err error) {
+	u := &unpersister{ls: self, data: data}
+	if permsIdx != 0 {
+		if t, ok := self.stack.get(permsIdx).(*luaTable); ok {
+			u.perms = t
+		} else {
+			return errors.New("permanents must be a table")
+		}
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			switch e := r.(type) {
+			case persistError:
+				err = e
+			case string: /* from Undump or table.put */
+				err = persistError("malformed data: " + e)
+			case error: /* index out of range on truncated data */
+				err = persistError("malformed data: " + e.Error())
+			default:
+				panic(r)
+			}
+		}
+	}()
+
+	if len(data) < len(PERSIST_SIGNATURE)+1 ||
+		string(data[:len(PERSIST_SIGNATURE)]) != PERSIST_SIGNATURE {
+		return errors.New("not persisted data")
+	}
+	if data[len(PERSIST_SIGNATURE)] != PERSIST_VERSION {
+		return errors.New("persisted data version mismatch")
+	}
+	u.data = data[len(PERSIST_SIGNATURE)+1:]
+	val := u.readValue()
+	if len(u.data) != 0 {
+		return errors.New("malformed data: trailing bytes")
+	}
+	self.stack.check(1)
+	self.stack.push(val)
+	return nil
+}
+
+type persistError string
+
+func (self persistError) Error() string {
+	return string(self)
+}
+
+/* persist */
+
+func (self *persister) error(f string, a ...interface{}) {
+	panic(persistError(fmt.Sprintf(f, a...)))
+}
+
+func (self *persister) writeUvarint(n uint64) {
+	var tmp [binary.MaxVarintLen64]byte
+	self.buf.Write(tmp[:binary.PutUvarint(tmp[:], n)])
+}
+
+func (self *persister) writeString(s string) {
+	self.writeUvarint(uint64(len(s)))
+	self.buf.WriteString(s)
+}
+
+// registers a reference type, returns false if it was seen before
+func (self *persister) register(obj interface{}) bool {
+	if id, found := self.refs[obj]; found {
+		self.buf.WriteByte(PTAG_REF)
+		self.writeUvarint(uint64(id))
+		return false
+	}
+	self.refs[obj] = self.nextId
+	self.nextId++
+	return true
+}
+
+func (self *persister) writeValue(val luaValue) {
+	if val != nil && self.perms != nil {
+		if key := self.perms.get(val); key != nil {
+			self.buf.WriteByte(PTAG_PERM)
+			self.writeValue(key)
+			return
+		}
+	}
+
+	switch x := val.(type) {
+	case nil:
+		self.buf.WriteByte(PTAG_NIL)
+	case bool:
+		if x {
+			self.buf.WriteByte(PTAG_TRUE)
+		} else {
+			self.buf.WriteByte(PTAG_FALSE)
+		}
+	case int64:
+		self.buf.WriteByte(PTAG_INTEGER)
+		self.writeUvarint(uint64(x))
+	case float64:
+		self.buf.WriteByte(PTAG_NUMBER)
+		self.writeUvarint(math.Float64bits(x))
+	case string:
+		self.buf.WriteByte(PTAG_STRING)
+		self.writeString(x)
+	case *luaTable:
+		if self.register(x) {
+			self.buf.WriteByte(PTAG_TABLE)
+			self.writeTable(x)
+		}
+	case *closure:
+		if x.proto == nil {
+			self.error("attempt to persist a Go function")
+		}
+		if self.register(x) {
+			self.buf.WriteByte(PTAG_CLOSURE)
+			self.writeClosure(x)
+		}
+	case *userdata, lightUserData: /* their Go values cannot be written */
+		self.error("attempt to persist a userdata")
+	default:
+		self.error("attempt to persist a %T value", val)
+	}
+}
+
+// metatable, array part, then hash part terminated by a nil key
+func (self *persister) writeTable(t *luaTable) {
+	if t.metatable != nil {
+		self.writeValue(t.metatable)
+	} else {
+		self.writeValue(nil)
+	}
+	self.writeUvarint(uint64(len(t.arr)))
+	for _, v := range t.arr {
+		self.writeValue(v)
+	}
+	for k, v := range t._map {
+		self.writeValue(keyValue(k))
+		self.writeValue(v)
+	}
+	self.writeValue(nil)
+}
+
+func (self *persister) writeClosure(c *closure) {
+	if _, found := self.refs[c.proto]; found {
+		self.writeUvarint(uint64(self.refs[c.proto]) + 1)
+	} else {
+		self.writeUvarint(0) /* new prototype */
+		self.refs[c.proto] = self.nextId
+		self.nextId++
+		chunk, err := binchunk.DumpBytes(c.proto)
+		if err != nil {
+			self.error("cannot dump function: %s", err.Error())
+		}
+		self.writeString(string(chunk))
+	}
+
+	self.writeUvarint(uint64(len(c.upvals)))
+	for _, uv := range c.upvals {
+		if uv == nil || uv.val == nil {
+			self.nextId++ /* Unpersist allocates it anyway */
+			self.buf.WriteByte(PTAG_UPVAL)
+			self.writeValue(nil)
+			continue
+		}
+		/* upvalues are shared through the value they point to */
+		if id, found := self.refs[uv.val]; found {
+			self.buf.WriteByte(PTAG_UPVAL_REF)
+			self.writeUvarint(uint64(id))
+			continue
+		}
+		self.refs[uv.val] = self.nextId
+		self.nextId++
+		self.buf.WriteByte(PTAG_UPVAL)
+		self.writeValue(*uv.val)
+	}
+}
+
+/* unpersist */
+
+func (self *unpersister) error(f string, a ...interface{}) {
+	panic(persistError(fmt.Sprintf(f, a...)))
+}
+
+func (self *unpersister) readByte() byte {
+	if len(self.data) == 0 {
+		self.error("malformed data: truncated")
+	}
+	b := self.data[0]
+	self.data = self.data[1:]
+	return b
+}
+
+func (self *unpersister) readUvarint() uint64 {
+	n, size := binary.Uvarint(self.data)
+	if size <= 0 {
+		self.error("malformed data: bad varint")
+	}
+	self.data = self.data[size:]
+	return n
+}
+
+func (self *unpersister) readString() string {
+	n := self.readUvarint()
+	if n > uint64(len(self.data)) {
+		self.error("malformed data: truncated")
+	}
+	s := string(self.data[:n])
+	self.data = self.data[n:]
+	return s
+}
+
+func (self *unpersister) ref(id uint64) interface{} {
+	if id >= uint64(len(self.refs)) {
+		self.error("malformed data: bad reference %d", id)
+	}
+	return self.refs[id]
+}
+
+func (self *unpersister) readValue() luaValue {
+	switch tag := self.readByte(); tag {
+	case PTAG_NIL:
+		return nil
+	case PTAG_FALSE:
+		return false
+	case PTAG_TRUE:
+		return true
+	case PTAG_INTEGER:
+		return int64(self.readUvarint())
+	case PTAG_NUMBER:
+		return math.Float64frombits(self.readUvarint())
+	case PTAG_STRING:
+		return self.readString()
+	case PTAG_TABLE:
+		return self.readTable()
+	case PTAG_CLOSURE:
+		return self.readClosure()
+	case PTAG_REF:
+		return self.ref(self.readUvarint())
+	case PTAG_PERM:
+		key := self.readValue()
+		if self.perms == nil || key == nil {
+			self.error("permanent value missing")
+		}
+		val := self.perms.get(key)
+		if val == nil {
+			self.error("permanent value missing for key %v", key)
+		}
+		return val
+	default:
+		self.error("malformed data: bad tag %d", tag)
+		return nil
+	}
+}
+
+func (self *unpersister) readTable() *luaTable {
+	t := self.ls.newTable(0, 0)
+	self.refs = append(self.refs, t)
+
+	if mt := self.readValue(); mt != nil {
+		if mt, ok := mt.(*luaTable); ok {
+			t.metatable = mt
+		} else {
+			self.error("malformed data: bad metatable")
+		}
+	}
+	n := self.readUvarint()
+	for i := uint64(1); i <= n; i++ {
+		t.put(int64(i), self.readValue())
+	}
+	for {
+		k := self.readValue()
+		if k == nil {
+			return t
+		}
+		t.put(k, self.readValue())
+	}
+}
+
+func (self *unpersister) readClosure() *closure {
+	c := &closure{}
+	self.refs = append(self.refs, c)
+
+	if protoRef := self.readUvarint(); protoRef == 0 {
+		self.refs = append(self.refs, nil) /* reserve the id */
+		id := len(self.refs) - 1
+		chunk := []byte(self.readString())
+		if !binchunk.IsBinaryChunk(chunk) {
+			self.error("malformed data: bad function")
+		}
+		proto, err := binchunk.Load(chunk, "=persist")
+		if err != nil {
+			self.error("malformed data: %v", err)
+		}
+		c.proto = proto
+		self.refs[id] = c.proto
+	} else if proto, ok := self.ref(protoRef - 1).(*binchunk.Prototype); ok {
+		c.proto = proto
+	} else {
+		self.error("malformed data: bad function reference")
+	}
+
+	n := self.readUvarint()
+	if n != uint64(len(c.proto.Upvalues)) {
+		self.error("malformed data: upvalue count mismatch")
+	}
+	self.ls.alloc(api.ALLOC_CLOSURE, closureSize+int(n)*upvalSize)
+	c.upvals = make([]*upvalue, n)
+	for i := range c.upvals {
+		switch tag := self.readByte(); tag {
+		case PTAG_UPVAL:
+			val := new(luaValue)
+			self.refs = append(self.refs, val)
+			*val = self.readValue()
+			c.upvals[i] = &upvalue{val}
+		case PTAG_UPVAL_REF:
+			val, ok := self.ref(self.readUvarint()).(*luaValue)
+			if !ok {
+				self.error("malformed data: bad upvalue reference")
+			}
+			c.upvals[i] = &upvalue{val}
+		default:
+			self.error("malformed data: bad upvalue tag %d", tag)
+		}
+	}
+	return c
+}
@@ -0,0 +1,58 @@
+package state
+
+import (
+	"reflect"
+	"unsafe"
+)
+
+/*
+userdata：宿主程序把 Go 对象交给 Lua 的方式。Lua 代码看不到里面的
+Go 值，只能通过它的元表使用它；和表一样，每个 userdata 有自己的元表。
+宿主用 ToUserData 取回 Go 值。
+
+	ls.NewUserData(conn)
+	ls.GetField(LUA_REGISTRYINDEX, "Conn") // 方法都在这个元表的 __index 里
+	ls.SetMetatable(-2)
+
+和 Lua 5.4 一样，userdata 还可以带几个 user value，用来挂上和 Go 对象
+相关的 Lua 值（比如回调函数），它们和 userdata 一起被 GC 标记。
+NewUserData 创建的 userdata 有一个 user value。
+
+	ls.NewUserDataUV(btn, 2)
+	ls.PushValue(onClick)
+	ls.SetIUserValue(-2, 1)
+*/
+type userdata struct {
+	metatable *luaTable
+	value     interface{} /* the Go object */
+	uvalues   []luaValue
+}
+
+/*
+light userdata：一个不归 Lua 管的 Go 值（通常是指针或 uintptr），按值
+比较，常用作注册表里不会和别的键冲突的键。它没有自己的元表，所有
+light userdata 共用一个。Go 值必须是可比较的。
+
+	var key byte
+	ls.PushLightUserData(&key)
+	ls.NewTable()
+	ls.RawSet(LUA_REGISTRYINDEX)
+*/
+type lightUserData struct {
+	p interface{}
+}
+
+// the address of p for ToPointer, 0 if it is not pointer-like
+func (self lightUserData) pointer() uintptr {
+	switch p := self.p.(type) {
+	case uintptr:
+		return p
+	case unsafe.Pointer:
+		return uintptr(p)
+	}
+	switch v := reflect.ValueOf(self.p); v.Kind() {
+	case reflect.Ptr, reflect.Chan, reflect.Func, reflect.Map, reflect.Slice:
+		return v.Pointer()
+	}
+	return 0
+}
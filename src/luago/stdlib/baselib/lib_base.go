@@ -0,0 +1,437 @@
+package baselib
+
+import (
+	"bytes"
+	"fmt"
+	. "luago/api"
+	"luago/auxlib"
+	"luago/number"
+	"strings"
+)
+
+var baseFuncs = map[string]GoFunction{
+	"print":          basePrint,
+	"warn":           baseWarn,
+	"tostring":       baseToString,
+	"tonumber":       baseToNumber,
+	"collectgarbage": baseCollectGarbage,
+	"getmetatable":   baseGetMetatable,
+	"setmetatable":   baseSetMetatable,
+	"next":           baseNext,
+	"pairs":          basePairs,
+	"ipairs":         baseIPairs,
+	"error":          baseError,
+	"assert":         baseAssert,
+	"pcall":          basePCall,
+	"xpcall":         baseXPCall,
+	"load":           baseLoad,
+	"loadstring":     baseLoad, /* Lua 5.1 name of load */
+	"loadfile":       baseLoadFile,
+	"dofile":         baseDoFile,
+	"select":         baseSelect,
+	"rawequal":       baseRawEqual,
+	"rawlen":         baseRawLen,
+	"rawget":         baseRawGet,
+	"rawset":         baseRawSet,
+}
+
+// OpenBaseLib sets the basic functions, _G and _VERSION into the
+// global table and returns it.
+// http://www.lua.org/manual/5.3/manual.html#6.1
+func OpenBaseLib(ls LuaState) int {
+	ls.PushGlobalTable()
+	auxlib.SetFuncs(ls, baseFuncs, 0)
+	ls.PushValue(-1)
+	ls.SetField(-2, "_G") /* _G = the global table */
+	ls.PushString(LUA_VERSION)
+	ls.SetField(-2, "_VERSION")
+	return 1
+}
+
+// print (···)
+// http://www.lua.org/manual/5.3/manual.html#pdf-print
+func basePrint(ls LuaState) int {
+	nArgs := ls.GetTop()
+	ls.GetGlobal("tostring")
+	for i := 1; i <= nArgs; i++ {
+		ls.PushValue(-1) /* function to be called */
+		ls.PushValue(i)  /* value to print */
+		ls.Call(1, 1)
+		s, ok := ls.ToStringX(-1) /* get result */
+		if !ok {
+			return auxlib.Error(ls, "'tostring' must return a string to 'print'")
+		}
+		if i > 1 {
+			fmt.Print("\t")
+		}
+		fmt.Print(s)
+		ls.Pop(1) /* pop result */
+	}
+	fmt.Println()
+	return 0
+}
+
+// tostring (v)
+// http://www.lua.org/manual/5.3/manual.html#pdf-tostring
+func baseToString(ls LuaState) int {
+	auxlib.CheckAny(ls, 1)
+	auxlib.ToLString(ls, 1)
+	return 1
+}
+
+func baseGetMetatable(ls LuaState) int {
+	if !ls.GetMetatable(1) {
+		ls.PushNil()
+	}
+	return 1
+}
+
+// only tables: the metatables of userdata are set by the host
+func baseSetMetatable(ls LuaState) int {
+	auxlib.CheckType(ls, 1, LUA_TTABLE)
+	t := ls.Type(2)
+	auxlib.ArgCheck(ls, t == LUA_TNIL || t == LUA_TTABLE, 2, "nil or table expected")
+	ls.SetTop(2)
+	ls.SetMetatable(1)
+	return 1
+}
+
+func baseNext(ls LuaState) int {
+	ls.SetTop(2) /* create a 2nd argument if there isn't one */
+	if ls.Next(1) {
+		return 2
+	} else {
+		ls.PushNil()
+		return 1
+	}
+}
+
+// pairs (t)
+// http://www.lua.org/manual/5.3/manual.html#pdf-pairs
+func basePairs(ls LuaState) int {
+	auxlib.CheckAny(ls, 1)
+	if auxlib.GetMetafield(ls, 1, "__pairs") == LUA_TNIL { /* no metamethod? */
+		ls.PushGoFunction(baseNext) /* will return generator, */
+		ls.PushValue(1)             /* state, */
+		ls.PushNil()                /* and initial value */
+	} else {
+		ls.PushValue(1) /* argument 'self' to metamethod */
+		ls.Call(1, 3)   /* get 3 values from metamethod */
+	}
+	return 3
+}
+
+func baseIPairs(ls LuaState) int {
+	ls.PushGoFunction(iPairsAux) /* iteration function */
+	ls.PushValue(1)              /* state */
+	ls.PushInteger(0)            /* initial value */
+	return 3
+}
+
+func iPairsAux(ls LuaState) int {
+	i := ls.ToInteger(2) + 1
+	ls.PushInteger(i)
+	if ls.GetI(1, i) == LUA_TNIL {
+		return 1
+	} else {
+		return 2
+	}
+}
+
+// error (message [, level])
+// http://www.lua.org/manual/5.3/manual.html#pdf-error
+func baseError(ls LuaState) int {
+	level := int(auxlib.OptInteger(ls, 2, 1))
+	ls.SetTop(1)
+	if ls.Type(1) == LUA_TSTRING && level > 0 {
+		ls.Where(level) /* add extra information */
+		ls.PushValue(1)
+		ls.Concat(2)
+	}
+	return ls.Error()
+}
+
+// assert (v [, message])
+// http://www.lua.org/manual/5.3/manual.html#pdf-assert
+func baseAssert(ls LuaState) int {
+	if ls.ToBoolean(1) { /* condition is true? */
+		return ls.GetTop() /* return all arguments */
+	}
+	auxlib.CheckAny(ls, 1)             /* there must be a condition */
+	ls.Remove(1)                       /* remove it */
+	ls.PushString("assertion failed!") /* default message */
+	ls.SetTop(1)                       /* leave only message (default if no other one) */
+	return ls.Error()                  /* raise it unchanged, any value */
+}
+
+func basePCall(ls LuaState) int {
+	ls.PushBoolean(true) /* first result if no errors */
+	ls.Insert(1)         /* put it in place */
+	status := ls.PCallK(ls.GetTop()-2, LUA_MULTRET, 0, 0, finishPCall)
+	return finishPCall(ls, status, 0)
+}
+
+// xpcall (f, msgh [, arg1, ···])
+// http://www.lua.org/manual/5.3/manual.html#pdf-xpcall
+func baseXPCall(ls LuaState) int {
+	n := ls.GetTop()
+	auxlib.CheckType(ls, 2, LUA_TFUNCTION) /* check error function */
+	ls.PushBoolean(true)                   /* first result */
+	ls.PushValue(1)                        /* function */
+	ls.Rotate(3, 2)                        /* move them below function's arguments */
+	status := ls.PCallK(n-2, LUA_MULTRET, 2, 2, finishPCall)
+	return finishPCall(ls, status, 2)
+}
+
+// continuation of pcall and xpcall, also called when the function
+// yielded
+func finishPCall(ls LuaState, status int, extra KContext) int {
+	if status != LUA_OK && status != LUA_YIELD { /* error? */
+		ls.PushBoolean(false) /* first result (false) */
+		ls.PushValue(-2)      /* error message */
+		return 2              /* return false, msg */
+	}
+	return ls.GetTop() - extra /* return all results */
+}
+
+// load (chunk [, chunkname [, mode [, env]]])
+// http://www.lua.org/manual/5.3/manual.html#pdf-load
+func baseLoad(ls LuaState) int {
+	var chunk []byte
+	mode := auxlib.OptString(ls, 3, "bt")
+	env := 0 /* 'env' index or 0 if no 'env' */
+	if !ls.IsNone(4) {
+		env = 4
+	}
+	chunkName := ""
+	if s, ok := ls.ToStringX(1); ok { /* loading a string? */
+		chunk = []byte(s)
+		chunkName = auxlib.OptString(ls, 2, stringChunkName(s))
+	} else { /* loading from a reader function */
+		chunkName = auxlib.OptString(ls, 2, "=(load)")
+		auxlib.CheckType(ls, 1, LUA_TFUNCTION)
+		var err string
+		if chunk, err = readChunk(ls); err != "" {
+			ls.PushNil()
+			ls.PushString(err)
+			return 2 /* return nil plus error message */
+		}
+	}
+	return loadAux(ls, ls.Load(chunk, chunkName, mode), env)
+}
+
+// calls the reader function at index 1 until it returns nil or an
+// empty string, and concatenates the pieces
+func readChunk(ls LuaState) ([]byte, string) {
+	var buf bytes.Buffer
+	for {
+		ls.PushValue(1) /* get function */
+		if ls.PCall(0, 1, 0) != LUA_OK {
+			defer ls.Pop(1)
+			return nil, ls.ToString(-1)
+		}
+		if ls.IsNil(-1) {
+			ls.Pop(1) /* pop result */
+			return buf.Bytes(), ""
+		} else if !ls.IsString(-1) {
+			ls.Pop(1)
+			return nil, "reader function must return a string"
+		}
+		piece := ls.ToString(-1)
+		ls.Pop(1)
+		if piece == "" {
+			return buf.Bytes(), ""
+		}
+		buf.WriteString(piece)
+	}
+}
+
+// returns the loaded function, with env as its first upvalue, or nil
+// and the error message
+func loadAux(ls LuaState, status, env int) int {
+	if status != LUA_OK {
+		ls.PushNil()
+		ls.Insert(-2) /* put before error message */
+		return 2      /* return nil plus error message */
+	}
+	if env != 0 { /* 'env' parameter? */
+		ls.PushValue(env)                       /* environment for loaded function */
+		if _, ok := ls.SetUpvalue(-2, 1); !ok { /* set it as 1st upvalue */
+			ls.Pop(1) /* remove 'env' if not used by previous call */
+		}
+	}
+	return 1
+}
+
+// the name of a chunk loaded from s, like luaO_chunkid: the first
+// line of s, shortened to fit in LUA_IDSIZE
+func stringChunkName(s string) string {
+	const LUA_IDSIZE = 60
+	const PRE, RETS, POS = "[string \"", "...", "\"]"
+	bufflen := LUA_IDSIZE - len(PRE+RETS+POS) - 1 /* save space for prefix+suffix+'\0' */
+	nl := strings.IndexByte(s, '\n')
+	if len(s) < bufflen && nl < 0 { /* small one-line source? */
+		return PRE + s + POS /* keep it */
+	}
+	if nl >= 0 {
+		s = s[:nl] /* stop at first newline */
+	}
+	if len(s) > bufflen {
+		s = s[:bufflen]
+	}
+	return PRE + s + RETS + POS
+}
+
+// loadfile ([filename [, mode [, env]]])
+// http://www.lua.org/manual/5.3/manual.html#pdf-loadfile
+func baseLoadFile(ls LuaState) int {
+	fname := auxlib.OptString(ls, 1, "")
+	mode := auxlib.OptString(ls, 2, "bt")
+	env := 0 /* 'env' index or 0 if no 'env' */
+	if !ls.IsNone(3) {
+		env = 3
+	}
+	return loadAux(ls, auxlib.LoadFileX(ls, fname, mode), env)
+}
+
+// dofile ([filename])
+// http://www.lua.org/manual/5.3/manual.html#pdf-dofile
+func baseDoFile(ls LuaState) int {
+	fname := auxlib.OptString(ls, 1, "")
+	ls.SetTop(1)
+	if auxlib.LoadFile(ls, fname) != LUA_OK {
+		return ls.Error()
+	}
+	ls.CallK(0, LUA_MULTRET, 0, finishDoFile)
+	return finishDoFile(ls, LUA_OK, 0)
+}
+
+// continuation of dofile, also called when the chunk yielded
+func finishDoFile(ls LuaState, status int, extra KContext) int {
+	return ls.GetTop() - 1
+}
+
+// tonumber (e [, base])
+// http://www.lua.org/manual/5.3/manual.html#pdf-tonumber
+func baseToNumber(ls LuaState) int {
+	if ls.IsNoneOrNil(2) { /* standard conversion? */
+		if ls.Type(1) == LUA_TNUMBER { /* already a number? */
+			ls.SetTop(1) /* yes; return it */
+			return 1
+		}
+		if s, ok := ls.ToStringX(1); ok && ls.StringToNumber(s) {
+			return 1 /* successful conversion to number */
+		}
+		/* else not a number */
+		auxlib.CheckAny(ls, 1) /* (but there must be some parameter) */
+	} else {
+		base := auxlib.CheckInteger(ls, 2)
+		auxlib.CheckType(ls, 1, LUA_TSTRING) /* no numbers as strings */
+		s := ls.ToString(1)
+		auxlib.ArgCheck(ls, 2 <= base && base <= 36, 2, "base out of range")
+		if n, ok := number.ParseIntegerBase(s, int(base)); ok {
+			ls.PushInteger(n)
+			return 1
+		}
+	}
+	ls.PushNil() /* not a number */
+	return 1
+}
+
+// collectgarbage ([opt [, arg]])
+// http://www.lua.org/manual/5.3/manual.html#pdf-collectgarbage
+func baseCollectGarbage(ls LuaState) int {
+	opts := []string{"stop", "restart", "collect", "count", "step",
+		"setpause", "setstepmul", "isrunning", "incremental", "generational"}
+	optsNum := []int{LUA_GCSTOP, LUA_GCRESTART, LUA_GCCOLLECT, LUA_GCCOUNT,
+		LUA_GCSTEP, LUA_GCSETPAUSE, LUA_GCSETSTEPMUL, LUA_GCISRUNNING}
+	o := auxlib.CheckOption(ls, 1, "collect", opts)
+	if o >= len(optsNum) { /* there is only one mode, the incremental one */
+		ls.PushString("incremental") /* previous mode */
+		return 1
+	}
+	ex := int(auxlib.OptInteger(ls, 2, 0))
+	res := ls.GC(optsNum[o], ex)
+	switch optsNum[o] {
+	case LUA_GCCOUNT:
+		b := ls.GC(LUA_GCCOUNTB, 0)
+		ls.PushNumber(float64(res) + float64(b)/1024)
+	case LUA_GCSTEP, LUA_GCISRUNNING:
+		ls.PushBoolean(res != 0)
+	default:
+		ls.PushInteger(int64(res))
+	}
+	return 1
+}
+
+// warn (msg1, ···)
+// http://www.lua.org/manual/5.4/manual.html#pdf-warn
+func baseWarn(ls LuaState) int {
+	n := ls.GetTop()
+	auxlib.CheckString(ls, 1) /* at least one argument */
+	for i := 2; i <= n; i++ {
+		auxlib.CheckString(ls, i) /* make sure all arguments are strings */
+	}
+	for i := 1; i < n; i++ { /* compose warning */
+		ls.Warning(ls.ToString(i), true)
+	}
+	ls.Warning(ls.ToString(n), false) /* close warning */
+	return 0
+}
+
+// select (index, ···)
+// http://www.lua.org/manual/5.3/manual.html#pdf-select
+func baseSelect(ls LuaState) int {
+	n := int64(ls.GetTop())
+	if ls.Type(1) == LUA_TSTRING && strings.HasPrefix(ls.ToString(1), "#") {
+		ls.PushInteger(n - 1)
+		return 1
+	}
+	i := auxlib.CheckInteger(ls, 1)
+	if i < 0 {
+		i = n + i
+	} else if i > n {
+		i = n
+	}
+	auxlib.ArgCheck(ls, 1 <= i, 1, "index out of range")
+	return int(n - i)
+}
+
+// rawequal (v1, v2)
+// http://www.lua.org/manual/5.3/manual.html#pdf-rawequal
+func baseRawEqual(ls LuaState) int {
+	auxlib.CheckAny(ls, 1)
+	auxlib.CheckAny(ls, 2)
+	ls.PushBoolean(ls.RawEqual(1, 2))
+	return 1
+}
+
+// rawlen (v)
+// http://www.lua.org/manual/5.3/manual.html#pdf-rawlen
+func baseRawLen(ls LuaState) int {
+	t := ls.Type(1)
+	auxlib.ArgCheck(ls, t == LUA_TTABLE || t == LUA_TSTRING, 1, "table or string expected")
+	ls.PushInteger(int64(ls.RawLen(1)))
+	return 1
+}
+
+// rawget (table, index)
+// http://www.lua.org/manual/5.3/manual.html#pdf-rawget
+func baseRawGet(ls LuaState) int {
+	auxlib.CheckType(ls, 1, LUA_TTABLE)
+	auxlib.CheckAny(ls, 2)
+	ls.SetTop(2)
+	ls.RawGet(1)
+	return 1
+}
+
+// rawset (table, index, value)
+// http://www.lua.org/manual/5.3/manual.html#pdf-rawset
+func baseRawSet(ls LuaState) int {
+	auxlib.CheckType(ls, 1, LUA_TTABLE)
+	auxlib.CheckAny(ls, 2)
+	auxlib.CheckAny(ls, 3)
+	ls.SetTop(3)
+	ls.RawSet(1)
+	return 1
+}
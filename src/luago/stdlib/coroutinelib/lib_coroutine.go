@@ -0,0 +1,190 @@
+package coroutinelib
+
+import (
+	. "luago/api"
+	"luago/auxlib"
+)
+
+/*
+	local co = coroutine.create(function(a, b)
+		local c = coroutine.yield(a + b)
+		return c * 2
+	end)
+	print(coroutine.resume(co, 1, 2))      --> true    3
+	print(coroutine.resume(co, 10))        --> true    20
+	print(coroutine.status(co))            --> dead
+
+协程的实现见 state/api_coroutine.go。每个挂起的协程占着一个 goroutine，
+不再恢复的协程可以用 coroutine.close 结束（Lua 5.4 的函数）。
+*/
+
+var coFuncs = map[string]GoFunction{
+	"close":       coClose,
+	"create":      coCreate,
+	"resume":      coResume,
+	"running":     coRunning,
+	"status":      coStatus,
+	"wrap":        coWrap,
+	"yield":       coYield,
+	"isyieldable": coYieldable,
+}
+
+// OpenCoroutineLib returns the coroutine table.
+// http://www.lua.org/manual/5.3/manual.html#6.2
+func OpenCoroutineLib(ls LuaState) int {
+	ls.CreateTable(0, len(coFuncs))
+	for name, f := range coFuncs {
+		ls.PushGoFunction(f)
+		ls.SetField(-2, name)
+	}
+	return 1
+}
+
+// coroutine.create (f)
+// http://www.lua.org/manual/5.3/manual.html#pdf-coroutine.create
+func coCreate(ls LuaState) int {
+	auxlib.CheckType(ls, 1, LUA_TFUNCTION)
+	co := ls.NewThread()
+	ls.PushValue(1) /* move function to top */
+	ls.XMove(co, 1) /* move function from ls to co */
+	return 1
+}
+
+// coroutine.resume (co [, val1, ···])
+// http://www.lua.org/manual/5.3/manual.html#pdf-coroutine.resume
+func coResume(ls LuaState) int {
+	co := getCo(ls)
+	r := auxResume(ls, co, ls.GetTop()-1)
+	if r < 0 {
+		ls.PushBoolean(false)
+		ls.Insert(-2)
+		return 2 /* return false + error message */
+	}
+	ls.PushBoolean(true)
+	ls.Insert(-(r + 1))
+	return r + 1 /* return true + 'resume' returns */
+}
+
+// resumes co with the top narg values, leaves its results or its
+// error message on the stack; returns the number of results or -1
+func auxResume(ls, co LuaState, narg int) int {
+	if co.Status() == LUA_OK && co.GetTop() == 0 {
+		ls.PushString("cannot resume dead coroutine")
+		return -1 /* error flag */
+	}
+	ls.XMove(co, narg)
+	status := co.Resume(ls, narg)
+	if status == LUA_OK || status == LUA_YIELD {
+		nres := co.GetTop()
+		ls.CheckStack(nres + 1)
+		co.XMove(ls, nres) /* move yielded values */
+		return nres
+	}
+	co.XMove(ls, 1) /* move error message */
+	return -1       /* error flag */
+}
+
+// coroutine.wrap (f)
+// Errors in the coroutine are raised again in the caller, with its
+// position, and the coroutine is closed.
+// http://www.lua.org/manual/5.4/manual.html#pdf-coroutine.wrap
+func coWrap(ls LuaState) int {
+	coCreate(ls)
+	ls.PushGoClosure(auxWrap, 1)
+	return 1
+}
+
+func auxWrap(ls LuaState) int {
+	co := ls.ToThread(LuaUpvalueIndex(1))
+	r := auxResume(ls, co, ls.GetTop())
+	if r < 0 { /* error? */
+		if stat := co.Status(); stat != LUA_OK && stat != LUA_YIELD { /* error in the coroutine? */
+			co.CloseThread(ls) /* the coroutine is dead, release it */
+			co.XMove(ls, 1)    /* move error message to the caller */
+		}
+		if ls.Type(-1) == LUA_TSTRING { /* error object is a string? */
+			ls.Where(1) /* get extra info, if available */
+			ls.Insert(-2)
+			ls.Concat(2)
+		}
+		return ls.Error() /* propagate error */
+	}
+	return r
+}
+
+// coroutine.yield (···)
+// http://www.lua.org/manual/5.3/manual.html#pdf-coroutine.yield
+func coYield(ls LuaState) int {
+	return ls.Yield(ls.GetTop())
+}
+
+// coroutine.status (co)
+// http://www.lua.org/manual/5.3/manual.html#pdf-coroutine.status
+func coStatus(ls LuaState) int {
+	co := getCo(ls)
+	ls.PushString(auxStatus(ls, co))
+	return 1
+}
+
+func auxStatus(ls, co LuaState) string {
+	if ls == co {
+		return "running"
+	}
+	switch co.Status() {
+	case LUA_YIELD:
+		return "suspended"
+	case LUA_OK:
+		var ar LuaDebug
+		if co.GetStack(0, &ar) { /* does it have frames? */
+			return "normal" /* it is running */
+		} else if co.GetTop() == 0 {
+			return "dead"
+		}
+		return "suspended" /* initial state */
+	default: /* some error occurred */
+		return "dead"
+	}
+}
+
+// coroutine.close (co)
+// http://www.lua.org/manual/5.4/manual.html#pdf-coroutine.close
+func coClose(ls LuaState) int {
+	co := getCo(ls)
+	switch status := auxStatus(ls, co); status {
+	case "dead", "suspended":
+		if co.CloseThread(ls) == LUA_OK {
+			ls.PushBoolean(true)
+			return 1
+		}
+		ls.PushBoolean(false)
+		co.XMove(ls, 1) /* move error message */
+		return 2
+	default: /* normal or running coroutine */
+		return auxlib.Error(ls, "cannot close a %s coroutine", status)
+	}
+}
+
+// coroutine.isyieldable ()
+// http://www.lua.org/manual/5.3/manual.html#pdf-coroutine.isyieldable
+func coYieldable(ls LuaState) int {
+	ls.PushBoolean(ls.IsYieldable())
+	return 1
+}
+
+// coroutine.running ()
+// http://www.lua.org/manual/5.3/manual.html#pdf-coroutine.running
+func coRunning(ls LuaState) int {
+	isMain := ls.PushThread()
+	ls.PushBoolean(isMain)
+	return 2
+}
+
+/* helpers */
+
+func getCo(ls LuaState) LuaState {
+	co := ls.ToThread(1)
+	if co == nil {
+		auxlib.TypeError(ls, 1, "coroutine")
+	}
+	return co
+}
@@ -0,0 +1,357 @@
+package csvlib
+
+import (
+	"bytes"
+	"encoding/csv"
+	"io"
+	. "luago/api"
+	"luago/auxlib"
+	"luago/vfs"
+	"strings"
+	"unicode/utf8"
+)
+
+/*
+	local r = csv.open("data.csv", {header = true, delimiter = ";"})
+	for row in r:rows() do print(row.name) end
+	r:close()
+
+	local w = csv.writer("out.csv", {delimiter = "\t"})
+	w:write({"a", "b c", 'say "hi"'})
+	w:close()
+
+选项：delimiter（默认 ","）、comment、header（首行作为键名）、
+trim（去掉字段前导空白）、lazyquotes（宽松的引号处理）、crlf（写入 \r\n）。
+csv.parse(s) 和 csv.writer() 分别从字符串读取、写入内存，
+后者用 w:contents() 取得结果。读写对象都是带方法的表。
+*/
+var csvFuncs = map[string]GoFunction{
+	"open":   csvOpen,
+	"parse":  csvParse,
+	"writer": csvWriter,
+}
+
+func OpenCsvLib(ls LuaState) int {
+	ls.CreateTable(0, len(csvFuncs))
+	for name, f := range csvFuncs {
+		ls.PushGoFunction(f)
+		ls.SetField(-2, name)
+	}
+	return 1
+}
+
+type options struct {
+	delimiter  rune
+	comment    rune
+	header     bool
+	trim       bool
+	lazyQuotes bool
+	crlf       bool
+}
+
+// reads the options table at idx
+func checkOptions(ls LuaState, idx int) options {
+	opts := options{delimiter: ','}
+	if !ls.IsTable(idx) {
+		return opts
+	}
+	opts.delimiter = runeField(ls, idx, "delimiter", ',')
+	opts.comment = runeField(ls, idx, "comment", 0)
+	opts.header = boolField(ls, idx, "header")
+	opts.trim = boolField(ls, idx, "trim")
+	opts.lazyQuotes = boolField(ls, idx, "lazyquotes")
+	opts.crlf = boolField(ls, idx, "crlf")
+	return opts
+}
+
+func runeField(ls LuaState, idx int, name string, def rune) rune {
+	defer ls.Pop(1)
+	if ls.GetField(idx, name) == LUA_TNIL {
+		return def
+	}
+	s := ls.ToString(-1)
+	if r, size := utf8.DecodeRuneInString(s); size > 0 && size == len(s) {
+		return r
+	}
+	auxlib.Error(ls, "csv: option '%s' must be a single character", name)
+	return def
+}
+
+func boolField(ls LuaState, idx int, name string) bool {
+	ls.GetField(idx, name)
+	defer ls.Pop(1)
+	return ls.ToBoolean(-1)
+}
+
+/* reader */
+
+// csv.open (filename [, options])
+func csvOpen(ls LuaState) int {
+	opts := checkOptions(ls, 2)
+	file, err := vfs.Open(ls.ToString(1))
+	if err != nil {
+		return pushError(ls, err)
+	}
+	pushReader(ls, file, opts)
+	return 1
+}
+
+// csv.parse (s [, options])
+func csvParse(ls LuaState) int {
+	opts := checkOptions(ls, 2)
+	pushReader(ls, strings.NewReader(ls.ToString(1)), opts)
+	return 1
+}
+
+type reader struct {
+	src    io.Reader
+	r      *csv.Reader
+	opts   options
+	header []string
+	closed bool
+}
+
+func pushReader(ls LuaState, src io.Reader, opts options) {
+	r := csv.NewReader(src)
+	r.Comma = opts.delimiter
+	r.Comment = opts.comment
+	r.TrimLeadingSpace = opts.trim
+	r.LazyQuotes = opts.lazyQuotes
+	r.FieldsPerRecord = -1
+	r.ReuseRecord = true
+	self := &reader{src: src, r: r, opts: opts}
+
+	pushObject(ls, map[string]GoFunction{
+		"read":   self.read,
+		"rows":   self.rows,
+		"header": self.pushHeader,
+		"close":  self.close,
+	})
+}
+
+// r:read (), returns the next record, nil at end of input
+func (self *reader) read(ls LuaState) int {
+	return self.next(ls)
+}
+
+// r:rows (), iterator over the remaining records
+func (self *reader) rows(ls LuaState) int {
+	ls.PushGoFunction(self.next)
+	return 1
+}
+
+// r:header (), the header record when the header option is set
+func (self *reader) pushHeader(ls LuaState) int {
+	if self.opts.header && self.header == nil && !self.closed {
+		self.readHeader(ls)
+	}
+	if self.header == nil {
+		ls.PushNil()
+		return 1
+	}
+	pushRecord(ls, self.header)
+	return 1
+}
+
+// r:close ()
+func (self *reader) close(ls LuaState) int {
+	if !self.closed {
+		self.closed = true
+		if c, ok := self.src.(io.Closer); ok {
+			if err := c.Close(); err != nil {
+				return pushError(ls, err)
+			}
+		}
+	}
+	ls.PushBoolean(true)
+	return 1
+}
+
+func (self *reader) readHeader(ls LuaState) {
+	record, err := self.r.Read()
+	if err == io.EOF {
+		self.header = []string{}
+		return
+	} else if err != nil {
+		raiseError(ls, err)
+	}
+	self.header = append([]string(nil), record...)
+}
+
+func (self *reader) next(ls LuaState) int {
+	if self.closed {
+		return auxlib.Error(ls, "csv: attempt to use a closed reader")
+	}
+	if self.opts.header && self.header == nil {
+		self.readHeader(ls)
+	}
+
+	record, err := self.r.Read()
+	if err == io.EOF {
+		ls.PushNil()
+		return 1
+	} else if err != nil {
+		return raiseError(ls, err)
+	}
+
+	if !self.opts.header {
+		pushRecord(ls, record)
+		return 1
+	}
+	ls.CreateTable(0, len(self.header))
+	for i, field := range record {
+		ls.PushString(field)
+		if i < len(self.header) {
+			ls.SetField(-2, self.header[i])
+		} else {
+			ls.RawSetI(-2, int64(i+1)) /* extra fields keep their position */
+		}
+	}
+	return 1
+}
+
+func pushRecord(ls LuaState, record []string) {
+	ls.CreateTable(len(record), 0)
+	for i, field := range record {
+		ls.PushString(field)
+		ls.RawSetI(-2, int64(i+1))
+	}
+}
+
+/* writer */
+
+// csv.writer ([filename [, options]])
+func csvWriter(ls LuaState) int {
+	opts := checkOptions(ls, 2)
+	var dst io.Writer
+	var buf *bytes.Buffer
+	if ls.IsNoneOrNil(1) {
+		buf = &bytes.Buffer{}
+		dst = buf
+	} else {
+		file, err := vfs.Create(ls.ToString(1))
+		if err != nil {
+			return pushError(ls, err)
+		}
+		dst = file
+	}
+
+	w := csv.NewWriter(dst)
+	w.Comma = opts.delimiter
+	w.UseCRLF = opts.crlf
+	self := &writer{dst: dst, w: w, buf: buf}
+
+	pushObject(ls, map[string]GoFunction{
+		"write":    self.write,
+		"flush":    self.flush,
+		"close":    self.close,
+		"contents": self.contents,
+	})
+	return 1
+}
+
+type writer struct {
+	dst    io.Writer
+	w      *csv.Writer
+	buf    *bytes.Buffer /* nil when writing to a file */
+	closed bool
+}
+
+// w:write (record), the fields are converted with tostring rules
+func (self *writer) write(ls LuaState) int {
+	if self.closed {
+		return auxlib.Error(ls, "csv: attempt to use a closed writer")
+	}
+	auxlib.CheckType(ls, 2, LUA_TTABLE)
+	n := int64(ls.RawLen(2))
+	record := make([]string, n)
+	for i := int64(1); i <= n; i++ {
+		ls.RawGetI(2, i)
+		record[i-1] = fieldToString(ls, -1)
+		ls.Pop(1)
+	}
+	if err := self.w.Write(record); err != nil {
+		return raiseError(ls, err)
+	}
+	return 0
+}
+
+// w:flush ()
+func (self *writer) flush(ls LuaState) int {
+	self.w.Flush()
+	if err := self.w.Error(); err != nil {
+		return pushError(ls, err)
+	}
+	ls.PushBoolean(true)
+	return 1
+}
+
+// w:close ()
+func (self *writer) close(ls LuaState) int {
+	if self.closed {
+		ls.PushBoolean(true)
+		return 1
+	}
+	self.closed = true
+	self.w.Flush()
+	err := self.w.Error()
+	if c, ok := self.dst.(io.Closer); ok {
+		if cerr := c.Close(); err == nil {
+			err = cerr
+		}
+	}
+	if err != nil {
+		return pushError(ls, err)
+	}
+	ls.PushBoolean(true)
+	return 1
+}
+
+// w:contents (), the output of an in-memory writer
+func (self *writer) contents(ls LuaState) int {
+	if self.buf == nil {
+		ls.PushNil()
+		return 1
+	}
+	self.w.Flush()
+	ls.PushString(self.buf.String())
+	return 1
+}
+
+/* helpers */
+
+func fieldToString(ls LuaState, idx int) string {
+	switch ls.Type(idx) {
+	case LUA_TNIL:
+		return ""
+	case LUA_TBOOLEAN:
+		if ls.ToBoolean(idx) {
+			return "true"
+		}
+		return "false"
+	default:
+		if s, ok := ls.ToStringX(idx); ok {
+			return s
+		}
+		auxlib.Error(ls, "csv: cannot write a %s field", auxlib.TypeName(ls, idx))
+		return ""
+	}
+}
+
+func pushObject(ls LuaState, methods map[string]GoFunction) {
+	ls.CreateTable(0, len(methods))
+	for name, f := range methods {
+		ls.PushGoFunction(f)
+		ls.SetField(-2, name)
+	}
+}
+
+func pushError(ls LuaState, err error) int {
+	ls.PushNil()
+	ls.PushString(err.Error())
+	return 2
+}
+
+func raiseError(ls LuaState, err error) int {
+	return auxlib.Error(ls, "csv: %s", err.Error())
+}
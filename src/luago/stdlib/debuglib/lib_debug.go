@@ -0,0 +1,456 @@
+package debuglib
+
+import (
+	. "luago/api"
+	"luago/auxlib"
+	"reflect"
+)
+
+/* key, in the registry, for table of hooks */
+const HOOKKEY = "_HKEY"
+
+/*
+	local info = debug.getinfo(1, "Sl")
+	print(info.short_src, info.currentline)
+	local name, value = debug.getlocal(1, 1)   -- 当前函数的第一个局部变量
+	print(debug.getupvalue(f, 1))              -- f 的第一个 upvalue
+	print(debug.traceback("message"))
+	debug.sethook(function(event, line) print(event, line) end, "crl", 100)
+
+和 ldblib.c 一样，接受层次的函数可以在前面加一个协程参数，查看这个协程的栈。
+*/
+
+var dbFuncs = map[string]GoFunction{
+	"gethook":      dbGetHook,
+	"getinfo":      dbGetInfo,
+	"getlocal":     dbGetLocal,
+	"getmetatable": dbGetMetatable,
+	"getregistry":  dbGetRegistry,
+	"getupvalue":   dbGetUpvalue,
+	"getuservalue": dbGetUserValue,
+	"sethook":      dbSetHook,
+	"setlocal":     dbSetLocal,
+	"setmetatable": dbSetMetatable,
+	"setupvalue":   dbSetUpvalue,
+	"setuservalue": dbSetUserValue,
+	"traceback":    dbTraceback,
+	"upvalueid":    dbUpvalueId,
+	"upvaluejoin":  dbUpvalueJoin,
+}
+
+// OpenDebugLib returns the debug table.
+// http://www.lua.org/manual/5.3/manual.html#6.10
+func OpenDebugLib(ls LuaState) int {
+	ls.CreateTable(0, len(dbFuncs))
+	for name, f := range dbFuncs {
+		ls.PushGoFunction(f)
+		ls.SetField(-2, name)
+	}
+	return 1
+}
+
+// debug.getregistry ()
+// http://www.lua.org/manual/5.3/manual.html#pdf-debug.getregistry
+func dbGetRegistry(ls LuaState) int {
+	ls.PushValue(LUA_REGISTRYINDEX)
+	return 1
+}
+
+// debug.getmetatable (value)
+// http://www.lua.org/manual/5.3/manual.html#pdf-debug.getmetatable
+func dbGetMetatable(ls LuaState) int {
+	auxlib.CheckAny(ls, 1)
+	if !ls.GetMetatable(1) {
+		ls.PushNil() /* no metatable */
+	}
+	return 1
+}
+
+// debug.setmetatable (value, table)
+// http://www.lua.org/manual/5.3/manual.html#pdf-debug.setmetatable
+func dbSetMetatable(ls LuaState) int {
+	if t := ls.Type(2); t != LUA_TNIL && t != LUA_TTABLE {
+		auxlib.TypeError(ls, 2, "nil or table")
+	}
+	ls.SetTop(2)
+	ls.SetMetatable(1)
+	return 1 /* return 1st argument */
+}
+
+// debug.getuservalue (u [, n])
+// http://www.lua.org/manual/5.4/manual.html#pdf-debug.getuservalue
+func dbGetUserValue(ls LuaState) int {
+	n := int(auxlib.OptInteger(ls, 2, 1))
+	if ls.Type(1) != LUA_TUSERDATA {
+		ls.PushNil()
+	} else if ls.GetIUserValue(1, n) != LUA_TNONE {
+		ls.PushBoolean(true)
+		return 2
+	}
+	return 1
+}
+
+// debug.setuservalue (udata, value [, n])
+// http://www.lua.org/manual/5.4/manual.html#pdf-debug.setuservalue
+func dbSetUserValue(ls LuaState) int {
+	n := int(auxlib.OptInteger(ls, 3, 1))
+	auxlib.CheckType(ls, 1, LUA_TUSERDATA)
+	auxlib.CheckAny(ls, 2)
+	ls.SetTop(2)
+	if !ls.SetIUserValue(1, n) {
+		ls.PushNil()
+	}
+	return 1
+}
+
+// debug.getupvalue (f, up)
+// http://www.lua.org/manual/5.3/manual.html#pdf-debug.getupvalue
+func dbGetUpvalue(ls LuaState) int {
+	n := int(auxlib.CheckInteger(ls, 2))   /* upvalue index */
+	auxlib.CheckType(ls, 1, LUA_TFUNCTION) /* closure */
+	name, ok := ls.GetUpvalue(1, n)
+	if !ok {
+		return 0
+	}
+	ls.PushString(name)
+	ls.Insert(-2)
+	return 2
+}
+
+// debug.setupvalue (f, up, value)
+// http://www.lua.org/manual/5.3/manual.html#pdf-debug.setupvalue
+func dbSetUpvalue(ls LuaState) int {
+	auxlib.CheckAny(ls, 3)
+	n := int(auxlib.CheckInteger(ls, 2))
+	auxlib.CheckType(ls, 1, LUA_TFUNCTION)
+	name, ok := ls.SetUpvalue(1, n)
+	if !ok {
+		return 0
+	}
+	ls.PushString(name)
+	return 1
+}
+
+// checks whether a given upvalue from a given closure exists and
+// returns its index
+func checkUpval(ls LuaState, argf, argnup int) int {
+	var ar LuaDebug
+	nup := int(auxlib.CheckInteger(ls, argnup)) /* upvalue index */
+	auxlib.CheckType(ls, argf, LUA_TFUNCTION)   /* closure */
+	ls.PushValue(argf)                          /* get function to stack top */
+	ls.GetInfo(">u", &ar)                       /* get its number of upvalues */
+	if nup < 1 || nup > ar.NUps {
+		auxlib.ArgError(ls, argnup, "invalid upvalue index")
+	}
+	return nup
+}
+
+// debug.upvalueid (f, n)
+// http://www.lua.org/manual/5.3/manual.html#pdf-debug.upvalueid
+func dbUpvalueId(ls LuaState) int {
+	n := checkUpval(ls, 1, 2)
+	ls.PushLightUserData(ls.UpvalueId(1, n))
+	return 1
+}
+
+// debug.upvaluejoin (f1, n1, f2, n2)
+// http://www.lua.org/manual/5.3/manual.html#pdf-debug.upvaluejoin
+func dbUpvalueJoin(ls LuaState) int {
+	n1 := checkUpval(ls, 1, 2)
+	n2 := checkUpval(ls, 3, 4)
+	if ls.IsGoFunction(1) {
+		auxlib.ArgError(ls, 1, "Lua function expected")
+	}
+	if ls.IsGoFunction(3) {
+		auxlib.ArgError(ls, 3, "Lua function expected")
+	}
+	ls.UpvalueJoin(1, n1, 3, n2)
+	return 0
+}
+
+// the thread of the optional first argument, arg is the number of
+// arguments before the others
+func getThread(ls LuaState) (LuaState, int) {
+	if ls.IsThread(1) {
+		return ls.ToThread(1), 1
+	}
+	return ls, 0 /* function will operate over current thread */
+}
+
+// debug.getinfo ([thread,] f [, what])
+// http://www.lua.org/manual/5.3/manual.html#pdf-debug.getinfo
+func dbGetInfo(ls LuaState) int {
+	var ar LuaDebug
+	ls1, arg := getThread(ls)
+	options := "flnStu"
+	if !ls.IsNoneOrNil(arg + 2) {
+		options = auxlib.CheckString(ls, arg+2)
+	}
+	if ls.IsFunction(arg + 1) { /* info about a function? */
+		options = ">" + options /* add '>' to 'options' */
+		ls.PushValue(arg + 1)   /* move function to 'ls1' stack */
+		ls.XMove(ls1, 1)
+	} else { /* stack level */
+		level := int(auxlib.CheckInteger(ls, arg+1))
+		if !ls1.GetStack(level, &ar) {
+			ls.PushNil() /* level out of range */
+			return 1
+		}
+	}
+	if !ls1.GetInfo(options, &ar) {
+		return auxlib.ArgError(ls, arg+2, "invalid option")
+	}
+	ls.CreateTable(0, 2) /* table to collect results */
+	if containsRune(options, 'S') {
+		setTabS(ls, "source", ar.Source)
+		setTabS(ls, "short_src", ar.ShortSrc)
+		setTabI(ls, "linedefined", ar.LineDefined)
+		setTabI(ls, "lastlinedefined", ar.LastLineDefined)
+		setTabS(ls, "what", ar.What)
+	}
+	if containsRune(options, 'l') {
+		setTabI(ls, "currentline", ar.CurrentLine)
+	}
+	if containsRune(options, 'u') {
+		setTabI(ls, "nups", ar.NUps)
+		setTabI(ls, "nparams", ar.NParams)
+		setTabB(ls, "isvararg", ar.IsVararg)
+	}
+	if containsRune(options, 'n') {
+		if ar.Name != "" {
+			setTabS(ls, "name", ar.Name)
+		}
+		setTabS(ls, "namewhat", ar.NameWhat)
+	}
+	if containsRune(options, 't') {
+		setTabB(ls, "istailcall", ar.IsTailCall)
+	}
+	if containsRune(options, 'L') {
+		treatStackOption(ls, ls1, "activelines")
+	}
+	if containsRune(options, 'f') {
+		treatStackOption(ls, ls1, "func")
+	}
+	return 1 /* return table */
+}
+
+// moves the value on the top of ls1 into field fname of the table on
+// the top of ls
+func treatStackOption(ls, ls1 LuaState, fname string) {
+	if ls == ls1 {
+		ls.Rotate(-2, 1) /* exchange object and table */
+	} else {
+		ls1.XMove(ls, 1) /* move object to the "main" stack */
+	}
+	ls.SetField(-2, fname) /* put object into table */
+}
+
+// debug.getlocal ([thread,] f, local)
+// http://www.lua.org/manual/5.3/manual.html#pdf-debug.getlocal
+func dbGetLocal(ls LuaState) int {
+	var ar LuaDebug
+	ls1, arg := getThread(ls)
+	nvar := int(auxlib.CheckInteger(ls, arg+2)) /* local-variable index */
+	if ls.IsFunction(arg + 1) {                 /* function argument? */
+		ls.PushValue(arg + 1) /* push function */
+		if name, ok := ls.GetLocal(nil, nvar); ok {
+			ls.PushString(name) /* push local name */
+		} else {
+			ls.PushNil()
+		}
+		return 1 /* return only name (there is no value) */
+	}
+	/* stack-level argument */
+	level := int(auxlib.CheckInteger(ls, arg+1))
+	if !ls1.GetStack(level, &ar) { /* out of range? */
+		return auxlib.ArgError(ls, arg+1, "level out of range")
+	}
+	name, ok := ls1.GetLocal(&ar, nvar)
+	if !ok {
+		ls.PushNil() /* no name (nor value) */
+		return 1
+	}
+	ls1.XMove(ls, 1)    /* move local value */
+	ls.PushString(name) /* push name */
+	ls.Rotate(-2, 1)    /* re-order */
+	return 2
+}
+
+// debug.setlocal ([thread,] level, local, value)
+// http://www.lua.org/manual/5.3/manual.html#pdf-debug.setlocal
+func dbSetLocal(ls LuaState) int {
+	var ar LuaDebug
+	ls1, arg := getThread(ls)
+	level := int(auxlib.CheckInteger(ls, arg+1))
+	nvar := int(auxlib.CheckInteger(ls, arg+2))
+	if !ls1.GetStack(level, &ar) { /* out of range? */
+		return auxlib.ArgError(ls, arg+1, "level out of range")
+	}
+	auxlib.CheckAny(ls, arg+3)
+	ls.SetTop(arg + 3)
+	ls.XMove(ls1, 1)
+	name, ok := ls1.SetLocal(&ar, nvar)
+	if !ok {
+		ls1.Pop(1) /* pop value (if not popped by 'SetLocal') */
+		ls.PushNil()
+	} else {
+		ls.PushString(name)
+	}
+	return 1
+}
+
+var hookNames = []string{"call", "return", "line", "count", "tail call"}
+
+// calls the Lua hook function of the thread with the name of the
+// event and the current line
+func hookF(ls LuaState, ar *LuaDebug) {
+	ls.GetField(LUA_REGISTRYINDEX, HOOKKEY)
+	ls.PushThread()
+	if ls.RawGet(-2) == LUA_TFUNCTION { /* is there a hook function? */
+		ls.PushString(hookNames[ar.Event]) /* push event name */
+		if ar.CurrentLine >= 0 {
+			ls.PushInteger(int64(ar.CurrentLine)) /* push current line */
+		} else {
+			ls.PushNil()
+		}
+		ls.Call(2, 0) /* call hook function */
+	}
+}
+
+// converts a string mask (for 'sethook') into a bit mask
+func makeMask(smask string, count int) int {
+	mask := 0
+	if containsRune(smask, 'c') {
+		mask |= LUA_MASKCALL
+	}
+	if containsRune(smask, 'r') {
+		mask |= LUA_MASKRET
+	}
+	if containsRune(smask, 'l') {
+		mask |= LUA_MASKLINE
+	}
+	if count > 0 {
+		mask |= LUA_MASKCOUNT
+	}
+	return mask
+}
+
+// converts a bit mask (for 'gethook') into a string mask
+func unmakeMask(mask int) string {
+	smask := ""
+	if mask&LUA_MASKCALL != 0 {
+		smask += "c"
+	}
+	if mask&LUA_MASKRET != 0 {
+		smask += "r"
+	}
+	if mask&LUA_MASKLINE != 0 {
+		smask += "l"
+	}
+	return smask
+}
+
+// debug.sethook ([thread,] hook, mask [, count])
+// http://www.lua.org/manual/5.3/manual.html#pdf-debug.sethook
+func dbSetHook(ls LuaState) int {
+	var mask, count int
+	var f LuaHook
+	ls1, arg := getThread(ls)
+	if ls.IsNoneOrNil(arg + 1) { /* no hook? */
+		ls.SetTop(arg + 1) /* turn off hooks */
+	} else {
+		smask := auxlib.CheckString(ls, arg+2)
+		auxlib.CheckType(ls, arg+1, LUA_TFUNCTION)
+		if !ls.IsNoneOrNil(arg + 3) {
+			count = int(auxlib.CheckInteger(ls, arg+3))
+		}
+		f, mask = hookF, makeMask(smask, count)
+	}
+	if ls.GetField(LUA_REGISTRYINDEX, HOOKKEY) == LUA_TNIL {
+		ls.Pop(1)
+		ls.CreateTable(0, 2) /* create a hook table */
+		ls.PushValue(-1)
+		ls.SetField(LUA_REGISTRYINDEX, HOOKKEY) /* set it in position */
+		ls.PushString("k")
+		ls.SetField(-2, "__mode") /* hooktable.__mode = "k" */
+		ls.PushValue(-1)
+		ls.SetMetatable(-2) /* setmetatable(hooktable) = hooktable */
+	}
+	ls1.PushThread() /* key (thread) */
+	ls1.XMove(ls, 1)
+	ls.PushValue(arg + 1) /* value (hook function) */
+	ls.RawSet(-3)         /* hooktable[ls1] = new Lua hook */
+	ls1.SetHook(f, mask, count)
+	return 0
+}
+
+// debug.gethook ([thread])
+// http://www.lua.org/manual/5.3/manual.html#pdf-debug.gethook
+func dbGetHook(ls LuaState) int {
+	ls1, _ := getThread(ls)
+	hook := ls1.GetHook()
+	mask := ls1.GetHookMask()
+	if hook == nil { /* no hook? */
+		ls.PushNil()
+	} else if reflect.ValueOf(hook).Pointer() != reflect.ValueOf(hookF).Pointer() {
+		ls.PushString("external hook") /* external hook */
+	} else { /* hook table must exist */
+		ls.GetField(LUA_REGISTRYINDEX, HOOKKEY)
+		ls1.PushThread()
+		ls1.XMove(ls, 1)
+		ls.RawGet(-2) /* 1st result = hooktable[ls1] */
+		ls.Remove(-2) /* remove hook table */
+	}
+	ls.PushString(unmakeMask(mask))           /* 2nd result = mask */
+	ls.PushInteger(int64(ls1.GetHookCount())) /* 3rd result = count */
+	return 3
+}
+
+// debug.traceback ([thread,] [message [, level]])
+// http://www.lua.org/manual/5.3/manual.html#pdf-debug.traceback
+func dbTraceback(ls LuaState) int {
+	ls1, arg := getThread(ls)
+	msg, ok := "", true
+	if !ls.IsNoneOrNil(arg + 1) {
+		msg, ok = ls.ToStringX(arg + 1)
+	}
+	if !ok { /* non-string 'msg'? */
+		ls.PushValue(arg + 1) /* return it untouched */
+		return 1
+	}
+	level := int64(0)
+	if ls1 == ls {
+		level = 1 /* skip traceback itself */
+	}
+	if !ls.IsNoneOrNil(arg + 2) {
+		level = auxlib.CheckInteger(ls, arg+2)
+	}
+	ls.PushString(ls1.Traceback(msg, int(level)))
+	return 1
+}
+
+/* helpers */
+
+func setTabS(ls LuaState, k, v string) {
+	ls.PushString(v)
+	ls.SetField(-2, k)
+}
+
+func setTabI(ls LuaState, k string, v int) {
+	ls.PushInteger(int64(v))
+	ls.SetField(-2, k)
+}
+
+func setTabB(ls LuaState, k string, v bool) {
+	ls.PushBoolean(v)
+	ls.SetField(-2, k)
+}
+
+func containsRune(s string, r rune) bool {
+	for _, c := range s {
+		if c == r {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,44 @@
+package hotswaplib
+
+import (
+	. "luago/api"
+	"luago/auxlib"
+)
+
+var hotswapFuncs = map[string]GoFunction{
+	"update": hotswapUpdate,
+	"reload": hotswapReload,
+}
+
+func OpenHotswapLib(ls LuaState) int {
+	ls.CreateTable(0, len(hotswapFuncs))
+	for name, f := range hotswapFuncs {
+		ls.PushGoFunction(f)
+		ls.SetField(-2, name)
+	}
+	return 1
+}
+
+// hotswap.update (chunk [, modname [, chunkname]])
+// patches package.loaded[modname], or the globals without modname
+func hotswapUpdate(ls LuaState) int {
+	chunk := auxlib.CheckString(ls, 1)
+	modName := auxlib.OptString(ls, 2, "")
+	chunkName := auxlib.OptString(ls, 3, "=hotswap")
+	return pushResult(ls, ls.HotSwap([]byte(chunk), chunkName, modName))
+}
+
+// hotswap.reload (modname), reloads the module from package.path
+func hotswapReload(ls LuaState) int {
+	return pushResult(ls, ls.ReloadModule(auxlib.CheckString(ls, 1)))
+}
+
+func pushResult(ls LuaState, err error) int {
+	if err != nil {
+		ls.PushNil()
+		ls.PushString(err.Error())
+		return 2
+	}
+	ls.PushBoolean(true)
+	return 1
+}
@@ -0,0 +1,368 @@
+package inspectlib
+
+import (
+	"fmt"
+	. "luago/api"
+	"luago/number"
+	"sort"
+	"strings"
+)
+
+/*
+	local inspect = require "inspect"
+	print(inspect({1, 2, a = {b = true}}))
+	--> { 1, 2,
+	-->   a = {
+	-->     b = true
+	-->   }
+	--> }
+	print(inspect(t, {depth = 2, newline = " ", indent = ""}))
+
+和 kikito 的 inspect.lua 一样：序列部分写在第一行，其余的键排好序
+（数字、字符串、布尔值，再是其他类型）每个占一行；元表写成
+<metatable> = {...}；出现不止一次的表第一次写成 <1>{...}，以后写成
+<table 1>，所以环也能打印；函数等写成 <function 1>。超过 depth 层的
+表写成 {...}。
+
+选项：depth（默认不限）、newline（默认 "\n"）、indent（默认两个空格）。
+控制台的 ":inspect expr" 用同样的格式打印表达式的值。
+*/
+func OpenInspectLib(ls LuaState) int {
+	ls.NewTable()
+	ls.PushGoFunction(inspect)
+	ls.SetField(-2, "inspect")
+	ls.NewTable() /* inspect(t) calls inspect.inspect */
+	ls.PushGoFunction(func(ls LuaState) int {
+		ls.Remove(1)
+		return inspect(ls)
+	})
+	ls.SetField(-2, "__call")
+	ls.SetMetatable(-2)
+	return 1
+}
+
+// Options control the layout of Inspect.
+type Options struct {
+	Depth   int /* tables nested deeper are shown as {...}, 0: no limit */
+	Newline string
+	Indent  string
+}
+
+var DefaultOptions = Options{Newline: "\n", Indent: "  "}
+
+// inspect.inspect (value [, options])
+func inspect(ls LuaState) int {
+	opts := DefaultOptions
+	if ls.IsTable(2) {
+		if ls.GetField(2, "depth") != LUA_TNIL {
+			opts.Depth = int(ls.ToInteger(-1))
+		}
+		if ls.GetField(2, "newline") != LUA_TNIL {
+			opts.Newline = ls.ToString(-1)
+		}
+		if ls.GetField(2, "indent") != LUA_TNIL {
+			opts.Indent = ls.ToString(-1)
+		}
+		ls.Pop(3)
+	}
+	ls.PushString(Inspect(ls, 1, opts))
+	return 1
+}
+
+// Inspect renders the value at idx.
+func Inspect(ls LuaState, idx int, opts Options) string {
+	idx = ls.AbsIndex(idx)
+	top := ls.GetTop()
+	defer ls.SetTop(top)
+
+	ls.NewTable() /* table -> number of references */
+	ls.NewTable() /* table, function ... -> id */
+	self := &inspector{
+		ls:     ls,
+		opts:   opts,
+		counts: top + 1,
+		ids:    top + 2,
+		nextId: map[LuaType]int{},
+	}
+	self.count(idx, 0)
+	self.put(idx, 0)
+	return self.buf.String()
+}
+
+type inspector struct {
+	ls     LuaState
+	opts   Options
+	buf    strings.Builder
+	counts int /* stack indices of the scratch tables */
+	ids    int
+	nextId map[LuaType]int
+}
+
+func (self *inspector) tooDeep(level int) bool {
+	return self.opts.Depth > 0 && level >= self.opts.Depth
+}
+
+// counts the references to the tables reachable from idx
+func (self *inspector) count(idx, level int) {
+	ls := self.ls
+	if !ls.IsTable(idx) || self.tooDeep(level) {
+		return
+	}
+	ls.CheckStack(3)
+	ls.PushValue(idx)
+	ls.RawGet(self.counts)
+	n := ls.ToInteger(-1)
+	ls.Pop(1)
+	ls.PushValue(idx)
+	ls.PushInteger(n + 1)
+	ls.RawSet(self.counts)
+	if n > 0 {
+		return
+	}
+
+	ls.PushNil()
+	for ls.Next(idx) {
+		top := ls.GetTop()
+		self.count(top-1, level+1)
+		self.count(top, level+1)
+		ls.Pop(1)
+	}
+	if ls.GetMetatable(idx) {
+		self.count(ls.GetTop(), level+1)
+		ls.Pop(1)
+	}
+}
+
+// the id of the value at idx, 0 if it has none yet
+func (self *inspector) id(idx int) int64 {
+	self.ls.CheckStack(1)
+	self.ls.PushValue(idx)
+	self.ls.RawGet(self.ids)
+	defer self.ls.Pop(1)
+	return self.ls.ToInteger(-1)
+}
+
+func (self *inspector) newId(idx int) int {
+	tp := self.ls.Type(idx)
+	self.nextId[tp]++
+	self.ls.CheckStack(2)
+	self.ls.PushValue(idx)
+	self.ls.PushInteger(int64(self.nextId[tp]))
+	self.ls.RawSet(self.ids)
+	return self.nextId[tp]
+}
+
+func (self *inspector) put(idx, level int) {
+	ls := self.ls
+	switch tp := ls.Type(idx); tp {
+	case LUA_TNIL:
+		self.buf.WriteString("nil")
+	case LUA_TBOOLEAN:
+		fmt.Fprintf(&self.buf, "%t", ls.ToBoolean(idx))
+	case LUA_TNUMBER:
+		if ls.IsInteger(idx) {
+			self.buf.WriteString(number.IntegerToString(ls.ToInteger(idx)))
+		} else {
+			self.buf.WriteString(number.FloatToString(ls.ToNumber(idx)))
+		}
+	case LUA_TSTRING:
+		s, _ := ls.ToStringX(idx)
+		self.buf.WriteString(quote(s))
+	case LUA_TTABLE:
+		self.putTable(idx, level)
+	default:
+		id := self.id(idx)
+		if id == 0 {
+			id = int64(self.newId(idx))
+		}
+		fmt.Fprintf(&self.buf, "<%s %d>", ls.TypeName(tp), id)
+	}
+}
+
+func (self *inspector) putTable(idx, level int) {
+	ls := self.ls
+	ls.CheckStack(2)
+	if id := self.id(idx); id != 0 {
+		fmt.Fprintf(&self.buf, "<table %d>", id)
+		return
+	}
+	if self.tooDeep(level) {
+		self.buf.WriteString("{...}")
+		return
+	}
+	ls.PushValue(idx)
+	ls.RawGet(self.counts)
+	if ls.ToInteger(-1) > 1 {
+		fmt.Fprintf(&self.buf, "<%d>", self.newId(idx))
+	}
+	ls.Pop(1)
+
+	top := ls.GetTop()
+	defer ls.SetTop(top)
+	n := int64(ls.RawLen(idx))
+	keys := self.keys(idx, n)
+	ls.CheckStack(2) /* the metatable and the value being put */
+	hasMeta := ls.GetMetatable(idx)
+
+	self.buf.WriteString("{")
+	for i := int64(1); i <= n; i++ {
+		if i > 1 {
+			self.buf.WriteString(",")
+		}
+		self.buf.WriteString(" ")
+		ls.RawGetI(idx, i)
+		self.put(ls.GetTop(), level+1)
+		ls.Pop(1)
+	}
+	for i, key := range keys {
+		if i > 0 || n > 0 {
+			self.buf.WriteString(",")
+		}
+		self.newline(level + 1)
+		self.putKey(key, level+1)
+		self.buf.WriteString(" = ")
+		ls.PushValue(key)
+		ls.RawGet(idx)
+		self.put(ls.GetTop(), level+1)
+		ls.Pop(1)
+	}
+	if hasMeta {
+		if len(keys) > 0 || n > 0 {
+			self.buf.WriteString(",")
+		}
+		self.newline(level + 1)
+		self.buf.WriteString("<metatable> = ")
+		self.put(top+len(keys)+1, level+1)
+	}
+
+	switch {
+	case len(keys) > 0 || hasMeta:
+		self.newline(level)
+	case n > 0:
+		self.buf.WriteString(" ")
+	}
+	self.buf.WriteString("}")
+}
+
+func (self *inspector) newline(level int) {
+	self.buf.WriteString(self.opts.Newline)
+	self.buf.WriteString(strings.Repeat(self.opts.Indent, level))
+}
+
+func (self *inspector) putKey(idx, level int) {
+	if s, ok := identifier(self.ls, idx); ok {
+		self.buf.WriteString(s)
+		return
+	}
+	self.buf.WriteString("[")
+	self.put(idx, level)
+	self.buf.WriteString("]")
+}
+
+// pushes the keys of the table at idx that are not in its sequence
+// part 1..n, returns their stack indices in sorted order
+func (self *inspector) keys(idx int, n int64) []int {
+	ls := self.ls
+	var keys []int
+	ls.PushNil()
+	for ls.Next(idx) {
+		ls.Pop(1)
+		if i, ok := ls.ToIntegerX(-1); ok && ls.IsInteger(-1) && i >= 1 && i <= n {
+			continue
+		}
+		ls.CheckStack(2)
+		ls.PushValue(-1)
+		ls.Insert(-2) /* keep a copy below the iteration key */
+		keys = append(keys, ls.GetTop()-1)
+	}
+	sort.SliceStable(keys, func(i, j int) bool {
+		return self.less(keys[i], keys[j])
+	})
+	return keys
+}
+
+// numbers, then strings, then booleans, then the other types
+var keyOrder = map[LuaType]int{
+	LUA_TNUMBER:  1,
+	LUA_TSTRING:  2,
+	LUA_TBOOLEAN: 3,
+}
+
+func (self *inspector) less(a, b int) bool {
+	ls := self.ls
+	ta, tb := ls.Type(a), ls.Type(b)
+	oa, ob := keyOrder[ta], keyOrder[tb]
+	if oa == 0 {
+		oa = 4
+	}
+	if ob == 0 {
+		ob = 4
+	}
+	switch {
+	case oa != ob:
+		return oa < ob
+	case ta == LUA_TNUMBER:
+		return ls.ToNumber(a) < ls.ToNumber(b)
+	case ta == LUA_TSTRING:
+		sa, _ := ls.ToStringX(a)
+		sb, _ := ls.ToStringX(b)
+		return sa < sb
+	case ta == LUA_TBOOLEAN:
+		return !ls.ToBoolean(a) && ls.ToBoolean(b)
+	}
+	return false
+}
+
+var keywords = map[string]bool{
+	"and": true, "break": true, "do": true, "else": true, "elseif": true,
+	"end": true, "false": true, "for": true, "function": true, "goto": true,
+	"if": true, "in": true, "local": true, "nil": true, "not": true,
+	"or": true, "repeat": true, "return": true, "then": true, "true": true,
+	"until": true, "while": true,
+}
+
+// the string key at idx if it can be written as name = value
+func identifier(ls LuaState, idx int) (string, bool) {
+	if ls.Type(idx) != LUA_TSTRING {
+		return "", false
+	}
+	s, _ := ls.ToStringX(idx)
+	if s == "" || keywords[s] {
+		return "", false
+	}
+	for i, c := range s {
+		if !(c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' ||
+			i > 0 && c >= '0' && c <= '9') {
+			return "", false
+		}
+	}
+	return s, true
+}
+
+// a Lua string literal for s
+func quote(s string) string {
+	var buf strings.Builder
+	buf.WriteByte('"')
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '"':
+			buf.WriteString(`\"`)
+		case '\\':
+			buf.WriteString(`\\`)
+		case '\n':
+			buf.WriteString(`\n`)
+		case '\r':
+			buf.WriteString(`\r`)
+		case '\t':
+			buf.WriteString(`\t`)
+		default:
+			if c < ' ' || c == 0x7f {
+				fmt.Fprintf(&buf, "\\%03d", c)
+			} else {
+				buf.WriteByte(c)
+			}
+		}
+	}
+	buf.WriteByte('"')
+	return buf.String()
+}
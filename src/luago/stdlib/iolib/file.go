@@ -0,0 +1,333 @@
+package iolib
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	. "luago/api"
+	"luago/auxlib"
+	"strings"
+	"syscall"
+)
+
+const LUA_FILEHANDLE = "FILE*" /* registry key of the metatable of files */
+
+const LUAL_BUFFERSIZE = 4096 /* default size of the buffer of setvbuf */
+
+/*
+文件是带 FILE* 元表的 userdata，值就是 *stream；closef 为 nil 的是已关闭的文件。
+没有关闭的文件由 __gc（以及 __close）关闭，LuaState.Close 时也会关闭。
+注册表的 IO_FILES 是一个弱键表，记录打开的文件，Flush 用它找到要刷新的缓冲。
+*/
+
+// an open file, like luaL_Stream
+type stream struct {
+	f      io.Closer
+	rd     io.Reader /* f as a reader, writer and seeker */
+	wr     io.Writer
+	seeker io.Seeker /* nil if it cannot seek */
+	r      *bufio.Reader
+	w      *bufio.Writer /* nil: unbuffered */
+	line   bool          /* w is flushed at each newline */
+	closef func(ls LuaState, p *stream) int
+}
+
+func newStream(f io.Closer, closef func(ls LuaState, p *stream) int) *stream {
+	p := &stream{f: f, closef: closef}
+	p.rd, _ = f.(io.Reader)
+	p.wr, _ = f.(io.Writer)
+	p.seeker, _ = f.(io.Seeker)
+	if p.rd == nil {
+		p.rd = badFile{}
+	}
+	if p.wr == nil {
+		p.wr = badFile{}
+	}
+	return p
+}
+
+// the reads and writes a file was not opened for
+type badFile struct{}
+
+func (badFile) Read(p []byte) (int, error)  { return 0, errBadFile }
+func (badFile) Write(p []byte) (int, error) { return 0, errBadFile }
+
+var errBadFile = errors.New("bad file descriptor")
+
+// pushes a new file for p
+func pushStream(ls LuaState, p *stream) {
+	ls.NewUserData(p)
+	auxlib.SetMetatable(ls, LUA_FILEHANDLE)
+	ls.GetField(LUA_REGISTRYINDEX, IO_FILES)
+	ls.PushValue(-2)
+	ls.PushBoolean(true)
+	ls.RawSet(-3) /* IO_FILES[file] = true */
+	ls.Pop(1)
+}
+
+// the stream of the file at idx, nil if the file is closed; ok is
+// false if the value is not a file
+func toStream(ls LuaState, idx int) (p *stream, ok bool) {
+	ud := auxlib.TestUData(ls, idx, LUA_FILEHANDLE)
+	if ud == nil {
+		return nil, false
+	}
+	if p = ud.(*stream); p.closef == nil {
+		return nil, true
+	}
+	return p, true
+}
+
+// the stream of the file argument arg, which must be open
+func toFile(ls LuaState, arg int) *stream {
+	p := auxlib.CheckUData(ls, arg, LUA_FILEHANDLE).(*stream)
+	if p.closef == nil {
+		auxlib.Error(ls, "attempt to use a closed file")
+	}
+	return p
+}
+
+// closes the file at idx, its close function leaves the results
+func auxClose(ls LuaState, idx int) int {
+	idx = ls.AbsIndex(idx)
+	p, _ := toStream(ls, idx)
+	cf := p.closef
+	p.closef = nil       /* mark stream as closed */
+	n := cf(ls, p)       /* close it */
+	if p.closef == nil { /* not kept open by ioNoClose? */
+		ls.GetField(LUA_REGISTRYINDEX, IO_FILES)
+		ls.PushValue(idx)
+		ls.PushNil()
+		ls.RawSet(-3) /* IO_FILES[file] = nil */
+		ls.Pop(1)
+	}
+	return n
+}
+
+// makes the stream ready to read, after writes
+func (self *stream) reader() *bufio.Reader {
+	if self.w != nil {
+		self.w.Flush()
+	}
+	if self.r == nil {
+		self.r = bufio.NewReader(self.rd)
+	}
+	return self.r
+}
+
+// makes the stream ready to write, after reads: the read-ahead is
+// given back to the file
+func (self *stream) writer() io.Writer {
+	if self.r != nil && self.r.Buffered() > 0 && self.seeker != nil {
+		self.seeker.Seek(-int64(self.r.Buffered()), io.SeekCurrent)
+		self.r.Reset(self.rd)
+	}
+	if self.w != nil {
+		return self.w
+	}
+	return self.wr
+}
+
+func (self *stream) write(s string) error {
+	if _, err := io.WriteString(self.writer(), s); err != nil {
+		return err
+	}
+	if self.line && strings.IndexByte(s, '\n') >= 0 {
+		return self.w.Flush()
+	}
+	return nil
+}
+
+// moves to offset from whence and returns the new position; the
+// buffers are emptied first
+func (self *stream) seek(offset int64, whence int) (int64, error) {
+	if self.seeker == nil {
+		return 0, syscall.ESPIPE
+	}
+	if err := self.flush(); err != nil {
+		return 0, err
+	}
+	if self.r != nil {
+		if whence == io.SeekCurrent { /* the file is ahead of the reader */
+			offset -= int64(self.r.Buffered())
+		}
+		self.r.Reset(self.rd)
+	}
+	return self.seeker.Seek(offset, whence)
+}
+
+func (self *stream) flush() error {
+	if self.w != nil {
+		return self.w.Flush()
+	}
+	return nil
+}
+
+// Flush writes out the buffers of the open files of ls, like C's exit.
+func Flush(ls LuaState) {
+	if ls.GetField(LUA_REGISTRYINDEX, IO_FILES) == LUA_TTABLE {
+		ls.PushNil()
+		for ls.Next(-2) {
+			ls.Pop(1) /* keep the file, the key */
+			if p, _ := toStream(ls, -1); p != nil {
+				p.flush()
+			}
+		}
+	}
+	ls.Pop(1)
+}
+
+/* file methods */
+
+// file:close ()
+// http://www.lua.org/manual/5.3/manual.html#pdf-file:close
+func fClose(ls LuaState) int {
+	toFile(ls, 1) /* make sure argument is an open stream */
+	return auxClose(ls, 1)
+}
+
+// file:flush ()
+// http://www.lua.org/manual/5.3/manual.html#pdf-file:flush
+func fFlush(ls LuaState) int {
+	return fileResult(ls, toFile(ls, 1).flush(), "")
+}
+
+// file:lines (···)
+// http://www.lua.org/manual/5.3/manual.html#pdf-file:lines
+func fLines(ls LuaState) int {
+	toFile(ls, 1) /* check that it's a valid file handle */
+	auxLines(ls, false)
+	return 1
+}
+
+// file:read (···)
+// http://www.lua.org/manual/5.3/manual.html#pdf-file:read
+func fRead(ls LuaState) int {
+	return gRead(ls, toFile(ls, 1), 2)
+}
+
+// file:seek ([whence [, offset]])
+// http://www.lua.org/manual/5.3/manual.html#pdf-file:seek
+func fSeek(ls LuaState) int {
+	p := toFile(ls, 1)
+	whence := auxlib.CheckOption(ls, 2, "cur", []string{"set", "cur", "end"})
+	offset := auxlib.OptInteger(ls, 3, 0)
+	pos, err := p.seek(offset, []int{io.SeekStart, io.SeekCurrent, io.SeekEnd}[whence])
+	if err != nil {
+		return fileResult(ls, err, "") /* error */
+	}
+	ls.PushInteger(pos)
+	return 1
+}
+
+// file:setvbuf (mode [, size])
+// http://www.lua.org/manual/5.3/manual.html#pdf-file:setvbuf
+func fSetvbuf(ls LuaState) int {
+	p := toFile(ls, 1)
+	mode := auxlib.CheckOption(ls, 2, "", []string{"no", "full", "line"})
+	size := auxlib.OptInteger(ls, 3, LUAL_BUFFERSIZE)
+	err := p.flush()
+	switch mode {
+	case 0: /* no */
+		p.w, p.line = nil, false
+	default: /* full or line */
+		if size <= 0 {
+			size = LUAL_BUFFERSIZE
+		}
+		p.w = bufio.NewWriterSize(p.wr, int(size))
+		p.line = mode == 2
+	}
+	return fileResult(ls, err, "")
+}
+
+// file:write (···)
+// http://www.lua.org/manual/5.3/manual.html#pdf-file:write
+func fWrite(ls LuaState) int {
+	p := toFile(ls, 1)
+	ls.PushValue(1) /* push file at the stack top (to be returned) */
+	return gWrite(ls, p, 2)
+}
+
+// __gc and __close: closes the file if it is still open
+func fGc(ls LuaState) int {
+	if p, _ := toStream(ls, 1); p != nil {
+		p.flush() /* the standard files stay open */
+		auxClose(ls, 1)
+	}
+	return 0
+}
+
+func fToString(ls LuaState) int {
+	if p, _ := toStream(ls, 1); p == nil {
+		ls.PushString("file (closed)")
+	} else {
+		ls.PushString(fmt.Sprintf("file (%p)", p))
+	}
+	return 1
+}
+
+/* reading and writing */
+
+func gWrite(ls LuaState, p *stream, arg int) int {
+	nargs := ls.GetTop() - arg
+	var err error
+	for ; nargs > 0 && err == nil; nargs-- {
+		if ls.Type(arg) == LUA_TNUMBER {
+			/* optimization: could be done exactly as for strings */
+			if ls.IsInteger(arg) {
+				err = p.write(fmt.Sprintf("%d", ls.ToInteger(arg)))
+			} else {
+				err = p.write(fmt.Sprintf("%.14g", ls.ToNumber(arg)))
+			}
+		} else {
+			err = p.write(auxlib.CheckString(ls, arg))
+		}
+		arg++
+	}
+	if err != nil {
+		return fileResult(ls, err, "")
+	}
+	return 1 /* file handle already on stack top */
+}
+
+// pushes the iterator of file:lines and io.lines, the file is at
+// index 1 and the formats follow it
+func auxLines(ls LuaState, toClose bool) {
+	n := ls.GetTop() - 1 /* number of arguments to read */
+	if n > 250 {
+		auxlib.ArgError(ls, 252, "too many arguments")
+	}
+	ls.PushInteger(int64(n)) /* number of arguments to read */
+	ls.PushBoolean(toClose)  /* close/not close file when finished */
+	ls.Rotate(2, 2)          /* move 'n' and 'toClose' to their positions */
+	ls.PushGoClosure(ioReadLine, 3+n)
+}
+
+func ioReadLine(ls LuaState) int {
+	p, _ := toStream(ls, LuaUpvalueIndex(1))
+	if p == nil { /* file is already closed? */
+		return auxlib.Error(ls, "file is already closed")
+	}
+	n := int(ls.ToInteger(LuaUpvalueIndex(2)))
+	ls.SetTop(1)
+	ls.CheckStack(n)
+	for i := 1; i <= n; i++ { /* push arguments to 'g_read' */
+		ls.PushValue(LuaUpvalueIndex(3 + i))
+	}
+	n = gRead(ls, p, 2)   /* 'n' is number of results */
+	if ls.ToBoolean(-n) { /* read at least one value? */
+		return n /* return them */
+	}
+	/* first result is nil: EOF or error */
+	if n > 1 { /* is there error information? */
+		/* 2nd result is error message */
+		return auxlib.Error(ls, "%s", ls.ToString(-n+1))
+	}
+	if ls.ToBoolean(LuaUpvalueIndex(3)) { /* generate error on close? */
+		ls.SetTop(0)
+		ls.PushValue(LuaUpvalueIndex(1))
+		auxClose(ls, 1) /* close it */
+	}
+	return 0
+}
@@ -0,0 +1,344 @@
+package iolib
+
+import (
+	"bufio"
+	"io"
+	"io/ioutil"
+	. "luago/api"
+	"luago/auxlib"
+	"luago/vfs"
+	"os"
+	"strings"
+	"syscall"
+)
+
+/* registry keys of the default input and output files */
+const (
+	IO_PREFIX = "_IO_"
+	IO_INPUT  = IO_PREFIX + "input"
+	IO_OUTPUT = IO_PREFIX + "output"
+	IO_FILES  = IO_PREFIX + "files" /* weak set of the open files */
+)
+
+var ioFuncs = map[string]GoFunction{
+	"close":   ioClose,
+	"input":   ioInput,
+	"lines":   ioLines,
+	"open":    ioOpen,
+	"popen":   ioPopen,
+	"output":  ioOutput,
+	"read":    ioRead,
+	"tmpfile": ioTmpFile,
+	"type":    ioType,
+	"write":   ioWrite,
+}
+
+/* methods for file handles */
+var fileMethods = map[string]GoFunction{
+	"close":   fClose,
+	"flush":   fFlush,
+	"lines":   fLines,
+	"read":    fRead,
+	"seek":    fSeek,
+	"setvbuf": fSetvbuf,
+	"write":   fWrite,
+}
+
+// OpenIoLib returns the io table.
+// http://www.lua.org/manual/5.3/manual.html#6.8
+func OpenIoLib(ls LuaState) int {
+	ls.CreateTable(0, len(ioFuncs)+3)
+	for name, f := range ioFuncs {
+		ls.PushGoFunction(f)
+		ls.SetField(-2, name)
+	}
+	createMeta(ls)
+	createFileSet(ls)
+	/* create (and set) default files */
+	createStdFile(ls, os.Stdin, IO_INPUT, "stdin")
+	createStdFile(ls, os.Stdout, IO_OUTPUT, "stdout")
+	createStdFile(ls, os.Stderr, "", "stderr")
+	return 1
+}
+
+// creates the metatable of files in the registry
+func createMeta(ls LuaState) {
+	auxlib.NewMetatable(ls, LUA_FILEHANDLE) /* metatable for file handles */
+	ls.PushGoFunction(fGc)
+	ls.SetField(-2, "__gc")
+	ls.PushGoFunction(fGc)
+	ls.SetField(-2, "__close")
+	ls.PushGoFunction(fToString)
+	ls.SetField(-2, "__tostring")
+	ls.CreateTable(0, len(fileMethods)) /* create method table */
+	for name, f := range fileMethods {
+		ls.PushGoFunction(f)
+		ls.SetField(-2, name)
+	}
+	ls.SetField(-2, "__index") /* metatable.__index = method table */
+	ls.Pop(1)                  /* pop metatable */
+}
+
+// creates IO_FILES, whose keys are weak so it does not keep files alive
+func createFileSet(ls LuaState) {
+	ls.NewTable()
+	ls.CreateTable(0, 1)
+	ls.PushString("k")
+	ls.SetField(-2, "__mode")
+	ls.SetMetatable(-2)
+	ls.SetField(LUA_REGISTRYINDEX, IO_FILES)
+}
+
+// the standard files cannot be closed; their writes are not buffered,
+// so they mix with print
+func createStdFile(ls LuaState, f *os.File, k, fname string) {
+	pushStream(ls, newStream(f, ioNoClose))
+	if k != "" {
+		ls.PushValue(-1)
+		ls.SetField(LUA_REGISTRYINDEX, k) /* add file to registry */
+	}
+	ls.SetField(-2, fname) /* add file to module */
+}
+
+func ioNoClose(ls LuaState, p *stream) int {
+	p.closef = ioNoClose /* keep file opened */
+	ls.PushNil()
+	ls.PushString("cannot close standard file")
+	return 2
+}
+
+// closes an opened file
+func ioFClose(ls LuaState, p *stream) int {
+	err := p.flush()
+	if cerr := p.f.Close(); err == nil {
+		err = cerr
+	}
+	return fileResult(ls, err, "")
+}
+
+// io.close ([file])
+// http://www.lua.org/manual/5.3/manual.html#pdf-io.close
+func ioClose(ls LuaState) int {
+	if ls.IsNone(1) { /* no argument? */
+		ls.GetField(LUA_REGISTRYINDEX, IO_OUTPUT) /* use standard output */
+	}
+	return fClose(ls)
+}
+
+// io.open (filename [, mode])
+// http://www.lua.org/manual/5.3/manual.html#pdf-io.open
+func ioOpen(ls LuaState) int {
+	filename := auxlib.CheckString(ls, 1)
+	mode := auxlib.OptString(ls, 2, "r")
+	flag, ok := checkMode(mode)
+	if !ok {
+		auxlib.ArgError(ls, 2, "invalid mode")
+	}
+	f, err := vfs.OpenFile(filename, flag, 0666)
+	if err != nil {
+		return fileResult(ls, err, filename)
+	}
+	pushStream(ls, newFileStream(f, flag))
+	return 1
+}
+
+// the os.OpenFile flags of a mode of fopen: [rwa]%+?b*
+func checkMode(mode string) (int, bool) {
+	if mode == "" {
+		return 0, false
+	}
+	var flag int
+	plus := len(mode) > 1 && mode[1] == '+'
+	switch mode[0] {
+	case 'r':
+		flag = os.O_RDONLY
+		if plus {
+			flag = os.O_RDWR
+		}
+	case 'w':
+		flag = os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+		if plus {
+			flag = os.O_RDWR | os.O_CREATE | os.O_TRUNC
+		}
+	case 'a':
+		flag = os.O_WRONLY | os.O_CREATE | os.O_APPEND
+		if plus {
+			flag = os.O_RDWR | os.O_CREATE | os.O_APPEND
+		}
+	default:
+		return 0, false
+	}
+	mode = mode[1:]
+	if plus {
+		mode = mode[1:]
+	}
+	return flag, strings.Trim(mode, "b") == ""
+}
+
+// a stream for a file opened with flag, buffered if it is written
+func newFileStream(f io.Closer, flag int) *stream {
+	p := newStream(f, ioFClose)
+	if flag&(os.O_WRONLY|os.O_RDWR) != 0 {
+		p.w = bufio.NewWriter(p.wr)
+	}
+	return p
+}
+
+// io.tmpfile ()
+// http://www.lua.org/manual/5.3/manual.html#pdf-io.tmpfile
+func ioTmpFile(ls LuaState) int {
+	f, err := ioutil.TempFile("", "lua_")
+	if err != nil {
+		return fileResult(ls, err, "")
+	}
+	p := newFileStream(f, os.O_RDWR)
+	p.closef = func(ls LuaState, p *stream) int {
+		defer os.Remove(f.Name()) /* removed when closed, like C's tmpfile */
+		return ioFClose(ls, p)
+	}
+	pushStream(ls, p)
+	return 1
+}
+
+// io.type (obj)
+// http://www.lua.org/manual/5.3/manual.html#pdf-io.type
+func ioType(ls LuaState) int {
+	auxlib.CheckAny(ls, 1)
+	p, ok := toStream(ls, 1)
+	if !ok {
+		ls.PushNil() /* not a file */
+	} else if p == nil {
+		ls.PushString("closed file")
+	} else {
+		ls.PushString("file")
+	}
+	return 1
+}
+
+// io.input ([file])
+// http://www.lua.org/manual/5.3/manual.html#pdf-io.input
+func ioInput(ls LuaState) int {
+	return gIoFile(ls, IO_INPUT, "r")
+}
+
+// io.output ([file])
+// http://www.lua.org/manual/5.3/manual.html#pdf-io.output
+func ioOutput(ls LuaState) int {
+	return gIoFile(ls, IO_OUTPUT, "w")
+}
+
+// sets the default file f to the file or file name argument, if
+// there is one, and returns it
+func gIoFile(ls LuaState, f, mode string) int {
+	if !ls.IsNoneOrNil(1) {
+		if filename, ok := ls.ToStringX(1); ok {
+			openCheckFile(ls, filename, mode)
+		} else {
+			toFile(ls, 1) /* check that it's a valid file handle */
+			ls.PushValue(1)
+		}
+		ls.SetField(LUA_REGISTRYINDEX, f)
+	}
+	/* return current value */
+	ls.GetField(LUA_REGISTRYINDEX, f)
+	return 1
+}
+
+// pushes the file filename opened with mode, raises an error if it
+// cannot be opened
+func openCheckFile(ls LuaState, filename, mode string) {
+	flag, _ := checkMode(mode)
+	f, err := vfs.OpenFile(filename, flag, 0666)
+	if err != nil {
+		auxlib.Error(ls, "cannot open file '%s' (%s)", filename, errMessage(err))
+	}
+	pushStream(ls, newFileStream(f, flag))
+}
+
+// pushes the default file f and returns its stream
+func getIoFile(ls LuaState, f string) *stream {
+	ls.GetField(LUA_REGISTRYINDEX, f)
+	p, _ := toStream(ls, -1)
+	if p == nil {
+		auxlib.Error(ls, "standard %s file is closed", f[len(IO_PREFIX):])
+	}
+	return p
+}
+
+// io.lines ([filename, ···])
+// http://www.lua.org/manual/5.3/manual.html#pdf-io.lines
+func ioLines(ls LuaState) int {
+	if ls.IsNone(1) {
+		ls.PushNil() /* at least one argument */
+	}
+	toClose := false
+	if ls.IsNil(1) { /* no file name? */
+		ls.GetField(LUA_REGISTRYINDEX, IO_INPUT) /* get default input */
+		ls.Replace(1)                            /* put it at index 1 */
+		toFile(ls, 1)                            /* check that it's a valid file handle */
+	} else { /* open a new file */
+		openCheckFile(ls, auxlib.CheckString(ls, 1), "r")
+		ls.Replace(1) /* put file at index 1 */
+		toClose = true
+	}
+	auxLines(ls, toClose)
+	return 1
+}
+
+// io.read (···)
+// http://www.lua.org/manual/5.3/manual.html#pdf-io.read
+func ioRead(ls LuaState) int {
+	return gRead(ls, getIoFile(ls, IO_INPUT), 1)
+}
+
+// io.write (···)
+// http://www.lua.org/manual/5.3/manual.html#pdf-io.write
+func ioWrite(ls LuaState) int {
+	return gWrite(ls, getIoFile(ls, IO_OUTPUT), 1)
+}
+
+/* helpers */
+
+// pushes true on success, or nil, "filename: message" and the error
+// number, like luaL_fileresult
+func fileResult(ls LuaState, err error, filename string) int {
+	if err == nil {
+		ls.PushBoolean(true)
+		return 1
+	}
+	ls.PushNil()
+	if filename != "" {
+		ls.PushString(filename + ": " + errMessage(err))
+	} else {
+		ls.PushString(errMessage(err))
+	}
+	ls.PushInteger(int64(errno(err)))
+	return 3
+}
+
+// the message of err like C's strerror, without Go's "op path:"
+func errMessage(err error) string {
+	msg := cause(err).Error()
+	if msg != "" {
+		msg = strings.ToUpper(msg[:1]) + msg[1:]
+	}
+	return msg
+}
+
+func errno(err error) syscall.Errno {
+	if err == errBadFile {
+		return syscall.EBADF
+	}
+	n, _ := cause(err).(syscall.Errno)
+	return n
+}
+
+func cause(err error) error {
+	switch e := err.(type) {
+	case *os.PathError:
+		return e.Err
+	case *os.LinkError:
+		return e.Err
+	}
+	return err
+}
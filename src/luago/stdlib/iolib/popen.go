@@ -0,0 +1,99 @@
+package iolib
+
+import (
+	"io"
+	. "luago/api"
+	"luago/auxlib"
+	"luago/sandbox"
+	"os"
+	"os/exec"
+	"runtime"
+	"syscall"
+)
+
+/*
+	for line in io.popen("ls"):lines() do print(line) end
+	local p = io.popen("sort", "w")
+	p:write("b\na\n")
+	print(p:close())                       --> true    exit    0
+
+io.popen 通过 shell 启动命令，返回连到它标准输出（"r"）或标准输入（"w"）
+的文件；关闭这个文件时等待命令结束，结果和 os.execute 相同。
+sandbox.Exec 为 false 时不能启动命令。
+*/
+
+// io.popen (prog [, mode])
+// http://www.lua.org/manual/5.3/manual.html#pdf-io.popen
+func ioPopen(ls LuaState) int {
+	prog := auxlib.CheckString(ls, 1)
+	mode := "r"
+	if !ls.IsNoneOrNil(2) {
+		mode = auxlib.CheckString(ls, 2)
+	}
+	if mode != "r" && mode != "w" {
+		auxlib.ArgError(ls, 2, "invalid mode")
+	}
+	if !sandbox.Exec {
+		return auxlib.Error(ls, "command execution is disabled")
+	}
+	c := command(prog)
+	c.Stdin, c.Stdout, c.Stderr = os.Stdin, os.Stdout, os.Stderr
+	var pipe io.Closer
+	var err error
+	flag := os.O_RDONLY
+	if mode == "r" {
+		c.Stdout = nil
+		pipe, err = c.StdoutPipe()
+	} else {
+		c.Stdin = nil
+		pipe, err = c.StdinPipe()
+		flag = os.O_WRONLY
+	}
+	if err == nil {
+		Flush(ls) /* the command writes to the same output */
+		err = c.Start()
+	}
+	if err != nil {
+		return fileResult(ls, err, prog)
+	}
+	p := newFileStream(pipe, flag)
+	p.closef = func(ls LuaState, p *stream) int {
+		p.flush()
+		p.f.Close() /* the command sees the end of its input */
+		return execResult(ls, c.Wait())
+	}
+	pushStream(ls, p)
+	return 1
+}
+
+// a command that runs cmd through the shell, like C's popen
+func command(cmd string) *exec.Cmd {
+	if runtime.GOOS == "windows" {
+		return exec.Command("cmd", "/C", cmd)
+	}
+	return exec.Command("/bin/sh", "-c", cmd)
+}
+
+// pushes true or nil, "exit" or "signal" and the exit status or the
+// signal number of a finished command, like luaL_execresult
+func execResult(ls LuaState, err error) int {
+	what, stat := "exit", 0 /* type of termination and status */
+	if err != nil {
+		ee, ok := err.(*exec.ExitError)
+		if !ok {
+			return fileResult(ls, err, "")
+		}
+		stat = ee.ExitCode()
+		if ws, ok := ee.Sys().(syscall.WaitStatus); ok && ws.Signaled() {
+			what, stat = "signal", int(ws.Signal())
+		}
+	}
+	if what == "exit" && stat == 0 { /* successful termination? */
+		ls.PushBoolean(true)
+	} else {
+		ls.PushNil()
+	}
+	ls.PushString(what)
+	ls.PushInteger(int64(stat))
+	return 3 /* return true/nil,what,code */
+}
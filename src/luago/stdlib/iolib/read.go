@@ -0,0 +1,200 @@
+package iolib
+
+import (
+	"bufio"
+	"io"
+	. "luago/api"
+	"luago/auxlib"
+	"luago/number"
+	"math"
+	"strings"
+)
+
+/*
+	n, s = f:read("n", 4)      -- 一个数字，再读 4 个字节
+	for a, b in io.lines("data.txt", "n", "n") do ... end
+
+读取格式："n" 读一个数字，"l" 读一行（去掉换行符），"L" 读一行（保留换行符），
+"a" 读到文件末尾，整数 k 读至多 k 个字节（0 用来测试是否到了文件末尾）。
+io.read、file:read 以及 io.lines、file:lines 的迭代器都通过 gRead 读取；
+某个格式读不到内容时它的结果是 nil，后面的格式不再读取。
+*/
+
+// reads with the formats starting at first, pushes the results or
+// nil for the first one that fails
+func gRead(ls LuaState, p *stream, first int) int {
+	r := p.reader()
+	nargs := ls.GetTop() - 1
+	var n int
+	success := true
+	var err error
+	if nargs == 0 { /* no arguments? */
+		success, err = readLine(ls, r, true)
+		n = first + 1 /* to return 1 result */
+	} else {
+		ls.CheckStack(nargs + 20)
+		for n = first; nargs > 0 && success; n++ {
+			nargs--
+			if ls.Type(n) == LUA_TNUMBER {
+				success, err = readChars(ls, r, auxlib.CheckInteger(ls, n))
+				continue
+			}
+			format := auxlib.CheckString(ls, n)
+			format = strings.TrimPrefix(format, "*") /* skip optional '*' (for compatibility) */
+			if format == "" {
+				auxlib.ArgError(ls, n, "invalid format")
+			}
+			switch format[0] {
+			case 'n': /* number */
+				success, err = readNumber(ls, r)
+			case 'l': /* line */
+				success, err = readLine(ls, r, true)
+			case 'L': /* line with end-of-line */
+				success, err = readLine(ls, r, false)
+			case 'a': /* file */
+				err = readAll(ls, r)
+				success = true /* always success */
+			default:
+				auxlib.ArgError(ls, n, "invalid format")
+			}
+		}
+	}
+	if err != nil && err != io.EOF {
+		return fileResult(ls, err, "")
+	}
+	if !success {
+		ls.Pop(1)    /* remove last result */
+		ls.PushNil() /* push nil instead */
+	}
+	return n - first
+}
+
+func readLine(ls LuaState, r *bufio.Reader, chop bool) (bool, error) {
+	line, err := r.ReadString('\n')
+	if chop && strings.HasSuffix(line, "\n") {
+		line = line[:len(line)-1]
+	}
+	ls.PushString(line)
+	/* return ok if read something (either a newline or something else) */
+	return err == nil || line != "", err
+}
+
+func readAll(ls LuaState, r *bufio.Reader) error {
+	var b strings.Builder
+	_, err := io.Copy(&b, r)
+	ls.PushString(b.String())
+	return err
+}
+
+// reads at most n bytes, n == 0 tests for the end of file
+func readChars(ls LuaState, r *bufio.Reader, n int64) (bool, error) {
+	if n == 0 { /* test eof */
+		_, err := r.Peek(1)
+		ls.PushString("")
+		return err == nil, err
+	}
+	if n < 0 { /* a huge size_t in C */
+		n = math.MaxInt64
+	}
+	var b strings.Builder
+	nr, err := io.CopyN(&b, r, n)
+	ls.PushString(b.String())
+	return nr > 0, err /* true iff read something */
+}
+
+const L_MAXLENNUM = 200 /* maximum length of a numeral */
+
+// the state of readNumber
+type rn struct {
+	r    *bufio.Reader
+	c    int /* current character (look ahead), -1 at the end */
+	buff []byte
+	err  error
+}
+
+// adds the current char to the buffer (if not too long) and reads
+// the next one
+func (self *rn) nextc() bool {
+	if len(self.buff) >= L_MAXLENNUM { /* buffer overflow? */
+		self.buff = self.buff[:0] /* invalidate result */
+		return false              /* fail */
+	}
+	self.buff = append(self.buff, byte(self.c)) /* save current char */
+	self.getc()                                 /* read next one */
+	return true
+}
+
+func (self *rn) getc() {
+	if c, err := self.r.ReadByte(); err != nil {
+		self.c, self.err = -1, err
+	} else {
+		self.c = int(c)
+	}
+}
+
+// accepts the current char if it is in set (of size 2)
+func (self *rn) test2(set string) bool {
+	if self.c == int(set[0]) || self.c == int(set[1]) {
+		return self.nextc()
+	}
+	return false
+}
+
+// reads a sequence of (hex)digits
+func (self *rn) readDigits(hex bool) int {
+	count := 0
+	for self.c >= 0 && (isdigit(byte(self.c)) || hex && isxdigit(byte(self.c))) &&
+		self.nextc() {
+		count++
+	}
+	return count
+}
+
+// reads a numeral like the C reader: at most L_MAXLENNUM characters,
+// and the first character that cannot follow stays in the file
+func readNumber(ls LuaState, r *bufio.Reader) (bool, error) {
+	rn := &rn{r: r}
+	count := 0
+	hex := false
+	for rn.getc(); rn.c >= 0 && isspace(byte(rn.c)); rn.getc() {
+	} /* skip spaces */
+	rn.test2("-+") /* optional sign */
+	if rn.test2("00") {
+		if rn.test2("xX") {
+			hex = true /* numeral is hexadecimal */
+		} else {
+			count = 1 /* count initial '0' as a valid digit */
+		}
+	}
+	count += rn.readDigits(hex) /* integral part */
+	if rn.test2("..") {         /* decimal point? */
+		count += rn.readDigits(hex) /* fractional part */
+	}
+	exp := "eE"
+	if hex {
+		exp = "pP"
+	}
+	if count > 0 && rn.test2(exp) { /* exponent mark? */
+		rn.test2("-+")       /* exponent sign */
+		rn.readDigits(false) /* exponent digits */
+	}
+	if rn.c >= 0 {
+		r.UnreadByte() /* unread look-ahead char */
+	}
+	err := rn.err
+	i, f, isFloat, ok := number.ParseNumeral(string(rn.buff))
+	switch {
+	case !ok: /* invalid format */
+		ls.PushNil()      /* "result" to be removed */
+		return false, err /* read fails */
+	case isFloat:
+		ls.PushNumber(f)
+	default:
+		ls.PushInteger(i)
+	}
+	return true, err
+}
+
+func isdigit(c byte) bool  { return '0' <= c && c <= '9' }
+func isxdigit(c byte) bool { return isdigit(c) || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F' }
+func isspace(c byte) bool  { return c == ' ' || '\t' <= c && c <= '\r' }
@@ -0,0 +1,43 @@
+//go:build js && wasm
+// +build js,wasm
+
+package jslib
+
+import (
+	"fmt"
+	. "luago/api"
+	"luago/auxlib"
+	"syscall/js"
+)
+
+// newCallback pops a Lua function and wraps it as a JS function. The
+// Lua function is called in protected mode; errors go to console.error.
+// A once callback releases itself after its first call.
+func newCallback(ls LuaState, once bool) js.Func {
+	if !ls.IsFunction(-1) {
+		auxlib.Error(ls, "js: function expected, got %s", ls.TypeName(ls.Type(-1)))
+	}
+	ref := ls.Ref(LUA_REGISTRYINDEX)
+
+	var cb js.Func
+	cb = js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		top := ls.GetTop()
+		defer ls.SetTop(top)
+
+		ls.RawGetI(LUA_REGISTRYINDEX, int64(ref))
+		for _, arg := range args {
+			pushJS(ls, arg)
+		}
+		if ls.PCall(len(args), 1, 0) != LUA_OK {
+			js.Global().Get("console").Call("error", fmt.Sprint(ls.ToString(-1)))
+			return nil
+		}
+		result := toJS(ls, -1)
+		if once {
+			ls.Unref(LUA_REGISTRYINDEX, ref)
+			cb.Release()
+		}
+		return result
+	})
+	return cb
+}
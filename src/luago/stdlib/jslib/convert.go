@@ -0,0 +1,86 @@
+//go:build js && wasm
+// +build js,wasm
+
+package jslib
+
+import (
+	. "luago/api"
+	"syscall/js"
+)
+
+// pushJS converts a JS value to Lua. Objects become proxy tables
+// (see object.go), functions become callable Go functions.
+func pushJS(ls LuaState, v js.Value) {
+	switch v.Type() {
+	case js.TypeUndefined, js.TypeNull:
+		ls.PushNil()
+	case js.TypeBoolean:
+		ls.PushBoolean(v.Bool())
+	case js.TypeNumber:
+		f := v.Float()
+		if i := int64(f); float64(i) == f {
+			ls.PushInteger(i)
+		} else {
+			ls.PushNumber(f)
+		}
+	case js.TypeString:
+		ls.PushString(v.String())
+	case js.TypeFunction:
+		pushFunction(ls, v, js.Undefined())
+	default:
+		pushObject(ls, v)
+	}
+}
+
+// toJS converts the Lua value at idx to JS. Proxy tables are unwrapped,
+// other tables become plain objects (or arrays when they have a
+// sequence part only), Lua functions become JS callbacks.
+func toJS(ls LuaState, idx int) interface{} {
+	switch ls.Type(idx) {
+	case LUA_TNONE, LUA_TNIL:
+		return nil
+	case LUA_TBOOLEAN:
+		return ls.ToBoolean(idx)
+	case LUA_TNUMBER:
+		if ls.IsInteger(idx) {
+			return ls.ToInteger(idx)
+		}
+		return ls.ToNumber(idx)
+	case LUA_TSTRING:
+		return ls.ToString(idx)
+	case LUA_TTABLE:
+		if v, ok := unwrapObject(ls, idx); ok {
+			return v
+		}
+		return tableToJS(ls, idx)
+	case LUA_TFUNCTION:
+		ls.PushValue(idx)
+		return newCallback(ls, false)
+	default:
+		return ls.TypeName(ls.Type(idx))
+	}
+}
+
+func tableToJS(ls LuaState, idx int) interface{} {
+	idx = ls.AbsIndex(idx)
+	n := int64(ls.RawLen(idx))
+	if n > 0 {
+		arr := make([]interface{}, n)
+		for i := int64(1); i <= n; i++ {
+			ls.RawGetI(idx, i)
+			arr[i-1] = toJS(ls, -1)
+			ls.Pop(1)
+		}
+		return arr
+	}
+
+	obj := map[string]interface{}{}
+	ls.PushNil()
+	for ls.Next(idx) {
+		if ls.Type(-2) == LUA_TSTRING {
+			obj[ls.ToString(-2)] = toJS(ls, -1)
+		}
+		ls.Pop(1)
+	}
+	return obj
+}
@@ -0,0 +1,105 @@
+//go:build js && wasm
+// +build js,wasm
+
+package jslib
+
+import (
+	. "luago/api"
+	"strings"
+	"syscall/js"
+)
+
+// JS 对象在 Lua 中表示为带方法的表，真实的 js.Value 保存在 Go 闭包里
+var jsLib = map[string]GoFunction{
+	"log":      jsLog,
+	"eval":     jsEval,
+	"get":      jsGet,
+	"set":      jsSet,
+	"query":    jsQuery,
+	"create":   jsCreate,
+	"alert":    jsAlert,
+	"settimer": jsSetTimer,
+}
+
+func OpenJsLib(ls LuaState) int {
+	ls.CreateTable(0, len(jsLib))
+	for name, f := range jsLib {
+		ls.PushGoFunction(f)
+		ls.SetField(-2, name)
+	}
+	return 1
+}
+
+// js.log (···)
+func jsLog(ls LuaState) int {
+	nArgs := ls.GetTop()
+	args := make([]interface{}, nArgs)
+	for i := 1; i <= nArgs; i++ {
+		args[i-1] = toJS(ls, i)
+	}
+	js.Global().Get("console").Call("log", args...)
+	return 0
+}
+
+// js.alert (msg)
+func jsAlert(ls LuaState) int {
+	js.Global().Call("alert", ls.ToString(1))
+	return 0
+}
+
+// js.eval (code)
+func jsEval(ls LuaState) int {
+	pushJS(ls, js.Global().Call("eval", ls.ToString(1)))
+	return 1
+}
+
+// js.get ("a.b.c"), property lookup starting at the global object
+func jsGet(ls LuaState) int {
+	pushJS(ls, lookup(ls.ToString(1)))
+	return 1
+}
+
+// js.set ("a.b.c", v)
+func jsSet(ls LuaState) int {
+	path := ls.ToString(1)
+	obj := js.Global()
+	if i := strings.LastIndexByte(path, '.'); i >= 0 {
+		obj = lookup(path[:i])
+		path = path[i+1:]
+	}
+	obj.Set(path, toJS(ls, 2))
+	return 0
+}
+
+// js.query (selector), returns an element or nil
+func jsQuery(ls LuaState) int {
+	elem := js.Global().Get("document").Call("querySelector", ls.ToString(1))
+	pushJS(ls, elem)
+	return 1
+}
+
+// js.create (tagName), creates a detached element
+func jsCreate(ls LuaState) int {
+	elem := js.Global().Get("document").Call("createElement", ls.ToString(1))
+	pushJS(ls, elem)
+	return 1
+}
+
+// js.settimer (ms, f), calls f once after ms milliseconds
+func jsSetTimer(ls LuaState) int {
+	ls.PushValue(2)
+	cb := newCallback(ls, true)
+	js.Global().Call("setTimeout", cb, ls.ToInteger(1))
+	return 0
+}
+
+func lookup(path string) js.Value {
+	v := js.Global()
+	for _, name := range strings.Split(path, ".") {
+		if v.IsUndefined() || v.IsNull() {
+			break
+		}
+		v = v.Get(name)
+	}
+	return v
+}
@@ -0,0 +1,106 @@
+//go:build js && wasm
+// +build js,wasm
+
+package jslib
+
+import (
+	. "luago/api"
+	"luago/auxlib"
+	"syscall/js"
+)
+
+const JS_OBJECT_KEY = "__js" /* field holding the handle of the object */
+
+// 代理表只保存句柄；没有 userdata 和 __gc，对象在状态存活期间不会释放
+var objects []js.Value
+
+/*
+JS 对象的代理表：
+
+	obj:get(name)          读属性
+	obj:set(name, v)       写属性
+	obj:call(method, ···)  调用方法
+	obj:on(event, f)       addEventListener
+	obj:text([s])          读写 textContent
+	obj:html([s])          读写 innerHTML
+	obj:append(child)      appendChild
+*/
+func pushObject(ls LuaState, v js.Value) {
+	methods := map[string]GoFunction{
+		"get": func(ls LuaState) int {
+			pushJS(ls, v.Get(ls.ToString(2)))
+			return 1
+		},
+		"set": func(ls LuaState) int {
+			v.Set(ls.ToString(2), toJS(ls, 3))
+			return 0
+		},
+		"call": func(ls LuaState) int {
+			method := ls.ToString(2)
+			if v.Get(method).Type() != js.TypeFunction {
+				return auxlib.Error(ls, "js: '%s' is not a method", method)
+			}
+			pushJS(ls, v.Call(method, argsToJS(ls, 3)...))
+			return 1
+		},
+		"on": func(ls LuaState) int {
+			ls.PushValue(3)
+			v.Call("addEventListener", ls.ToString(2), newCallback(ls, false))
+			return 0
+		},
+		"text": func(ls LuaState) int {
+			return accessor(ls, v, "textContent")
+		},
+		"html": func(ls LuaState) int {
+			return accessor(ls, v, "innerHTML")
+		},
+		"append": func(ls LuaState) int {
+			v.Call("appendChild", toJS(ls, 2))
+			return 0
+		},
+	}
+
+	ls.CreateTable(0, len(methods)+1)
+	for name, f := range methods {
+		ls.PushGoFunction(f)
+		ls.SetField(-2, name)
+	}
+	objects = append(objects, v)
+	ls.PushInteger(int64(len(objects) - 1))
+	ls.SetField(-2, JS_OBJECT_KEY)
+}
+
+func unwrapObject(ls LuaState, idx int) (js.Value, bool) {
+	defer ls.Pop(1)
+	if ls.GetField(idx, JS_OBJECT_KEY) == LUA_TNUMBER {
+		if h, ok := ls.ToIntegerX(-1); ok && h >= 0 && h < int64(len(objects)) {
+			return objects[h], true
+		}
+	}
+	return js.Undefined(), false
+}
+
+// JS 函数作为 Go 函数推入，this 为调用时的接收者
+func pushFunction(ls LuaState, f, this js.Value) {
+	ls.PushGoFunction(func(ls LuaState) int {
+		pushJS(ls, f.Call("call", append([]interface{}{this}, argsToJS(ls, 1)...)...))
+		return 1
+	})
+}
+
+func accessor(ls LuaState, v js.Value, prop string) int {
+	if ls.GetTop() >= 2 {
+		v.Set(prop, ls.ToString(2))
+		return 0
+	}
+	ls.PushString(v.Get(prop).String())
+	return 1
+}
+
+func argsToJS(ls LuaState, from int) []interface{} {
+	var args []interface{}
+	for i := from; i <= ls.GetTop(); i++ {
+		args = append(args, toJS(ls, i))
+	}
+	return args
+}
@@ -0,0 +1,318 @@
+package mathlib
+
+import (
+	. "luago/api"
+	"luago/auxlib"
+	"math"
+)
+
+var mathFuncs = map[string]GoFunction{
+	"abs":       mathAbs,
+	"acos":      mathAcos,
+	"asin":      mathAsin,
+	"atan":      mathAtan,
+	"ceil":      mathCeil,
+	"cos":       mathCos,
+	"deg":       mathDeg,
+	"exp":       mathExp,
+	"floor":     mathFloor,
+	"fmod":      mathFmod,
+	"log":       mathLog,
+	"max":       mathMax,
+	"min":       mathMin,
+	"modf":      mathModf,
+	"rad":       mathRad,
+	"sin":       mathSin,
+	"sqrt":      mathSqrt,
+	"tan":       mathTan,
+	"tointeger": mathToInt,
+	"type":      mathType,
+	"ult":       mathUlt,
+}
+
+// OpenMathLib returns the math table.
+// http://www.lua.org/manual/5.3/manual.html#6.7
+func OpenMathLib(ls LuaState) int {
+	ls.CreateTable(0, len(mathFuncs)+6)
+	for name, f := range mathFuncs {
+		ls.PushGoFunction(f)
+		ls.SetField(-2, name)
+	}
+	setRandFuncs(ls)
+	ls.PushNumber(math.Pi)
+	ls.SetField(-2, "pi")
+	ls.PushNumber(math.Inf(1))
+	ls.SetField(-2, "huge")
+	ls.PushInteger(math.MaxInt64)
+	ls.SetField(-2, "maxinteger")
+	ls.PushInteger(math.MinInt64)
+	ls.SetField(-2, "mininteger")
+	return 1
+}
+
+// math.abs (x)
+// http://www.lua.org/manual/5.3/manual.html#pdf-math.abs
+func mathAbs(ls LuaState) int {
+	if ls.IsInteger(1) {
+		n := ls.ToInteger(1)
+		if n < 0 {
+			n = int64(0 - uint64(n)) /* wraps around for mininteger, like C */
+		}
+		ls.PushInteger(n)
+	} else {
+		ls.PushNumber(math.Abs(auxlib.CheckNumber(ls, 1)))
+	}
+	return 1
+}
+
+// math.floor (x)
+// http://www.lua.org/manual/5.3/manual.html#pdf-math.floor
+func mathFloor(ls LuaState) int {
+	if ls.IsInteger(1) {
+		ls.SetTop(1) /* integer is its own floor */
+	} else {
+		pushNumInt(ls, math.Floor(auxlib.CheckNumber(ls, 1)))
+	}
+	return 1
+}
+
+// math.ceil (x)
+// http://www.lua.org/manual/5.3/manual.html#pdf-math.ceil
+func mathCeil(ls LuaState) int {
+	if ls.IsInteger(1) {
+		ls.SetTop(1) /* integer is its own ceil */
+	} else {
+		pushNumInt(ls, math.Ceil(auxlib.CheckNumber(ls, 1)))
+	}
+	return 1
+}
+
+// math.fmod (x, y)
+// http://www.lua.org/manual/5.3/manual.html#pdf-math.fmod
+func mathFmod(ls LuaState) int {
+	if ls.IsInteger(1) && ls.IsInteger(2) {
+		d := ls.ToInteger(2)
+		switch d {
+		case 0:
+			auxlib.ArgError(ls, 2, "zero")
+		case -1:
+			ls.PushInteger(0) /* avoid overflow with 0x80000... / -1 */
+		default:
+			ls.PushInteger(ls.ToInteger(1) % d) /* truncates, like C */
+		}
+	} else {
+		ls.PushNumber(math.Mod(auxlib.CheckNumber(ls, 1),
+			auxlib.CheckNumber(ls, 2)))
+	}
+	return 1
+}
+
+// math.modf (x)
+// http://www.lua.org/manual/5.3/manual.html#pdf-math.modf
+func mathModf(ls LuaState) int {
+	if ls.IsInteger(1) {
+		ls.SetTop(1)     /* number is its own integer part */
+		ls.PushNumber(0) /* no fractional part */
+	} else {
+		n := auxlib.CheckNumber(ls, 1)
+		/* integer part (rounds toward zero) */
+		ip := math.Floor(n)
+		if n < 0 {
+			ip = math.Ceil(n)
+		}
+		ls.PushNumber(ip)
+		/* fractional part (test needed for inf/-inf) */
+		if n == ip {
+			ls.PushNumber(0)
+		} else {
+			ls.PushNumber(n - ip)
+		}
+	}
+	return 2
+}
+
+// math.sqrt (x)
+// http://www.lua.org/manual/5.3/manual.html#pdf-math.sqrt
+func mathSqrt(ls LuaState) int {
+	ls.PushNumber(math.Sqrt(auxlib.CheckNumber(ls, 1)))
+	return 1
+}
+
+// math.exp (x)
+// http://www.lua.org/manual/5.3/manual.html#pdf-math.exp
+func mathExp(ls LuaState) int {
+	ls.PushNumber(math.Exp(auxlib.CheckNumber(ls, 1)))
+	return 1
+}
+
+// math.log (x [, base])
+// http://www.lua.org/manual/5.3/manual.html#pdf-math.log
+func mathLog(ls LuaState) int {
+	x := auxlib.CheckNumber(ls, 1)
+	var res float64
+	if ls.IsNoneOrNil(2) {
+		res = math.Log(x)
+	} else {
+		switch base := auxlib.CheckNumber(ls, 2); base {
+		case 2:
+			res = math.Log2(x)
+		case 10:
+			res = math.Log10(x)
+		default:
+			res = math.Log(x) / math.Log(base)
+		}
+	}
+	ls.PushNumber(res)
+	return 1
+}
+
+// math.sin (x)
+// http://www.lua.org/manual/5.3/manual.html#pdf-math.sin
+func mathSin(ls LuaState) int {
+	ls.PushNumber(math.Sin(auxlib.CheckNumber(ls, 1)))
+	return 1
+}
+
+// math.cos (x)
+// http://www.lua.org/manual/5.3/manual.html#pdf-math.cos
+func mathCos(ls LuaState) int {
+	ls.PushNumber(math.Cos(auxlib.CheckNumber(ls, 1)))
+	return 1
+}
+
+// math.tan (x)
+// http://www.lua.org/manual/5.3/manual.html#pdf-math.tan
+func mathTan(ls LuaState) int {
+	ls.PushNumber(math.Tan(auxlib.CheckNumber(ls, 1)))
+	return 1
+}
+
+// math.asin (x)
+// http://www.lua.org/manual/5.3/manual.html#pdf-math.asin
+func mathAsin(ls LuaState) int {
+	ls.PushNumber(math.Asin(auxlib.CheckNumber(ls, 1)))
+	return 1
+}
+
+// math.acos (x)
+// http://www.lua.org/manual/5.3/manual.html#pdf-math.acos
+func mathAcos(ls LuaState) int {
+	ls.PushNumber(math.Acos(auxlib.CheckNumber(ls, 1)))
+	return 1
+}
+
+// math.atan (y [, x])
+// http://www.lua.org/manual/5.3/manual.html#pdf-math.atan
+func mathAtan(ls LuaState) int {
+	y := auxlib.CheckNumber(ls, 1)
+	x := auxlib.OptNumber(ls, 2, 1)
+	ls.PushNumber(math.Atan2(y, x))
+	return 1
+}
+
+// math.deg (x)
+// http://www.lua.org/manual/5.3/manual.html#pdf-math.deg
+func mathDeg(ls LuaState) int {
+	ls.PushNumber(auxlib.CheckNumber(ls, 1) * (180 / math.Pi))
+	return 1
+}
+
+// math.rad (x)
+// http://www.lua.org/manual/5.3/manual.html#pdf-math.rad
+func mathRad(ls LuaState) int {
+	ls.PushNumber(auxlib.CheckNumber(ls, 1) * (math.Pi / 180))
+	return 1
+}
+
+// math.min (x, ···)
+// http://www.lua.org/manual/5.3/manual.html#pdf-math.min
+func mathMin(ls LuaState) int {
+	n := ls.GetTop() /* number of arguments */
+	imin := 1        /* index of current minimum value */
+	if n < 1 {
+		auxlib.ArgError(ls, 1, "number expected, got no value")
+	}
+	for i := 1; i <= n; i++ {
+		auxlib.CheckNumber(ls, i)
+		if ls.Compare(i, imin, LUA_OPLT) {
+			imin = i
+		}
+	}
+	ls.PushValue(imin)
+	return 1
+}
+
+// math.max (x, ···)
+// http://www.lua.org/manual/5.3/manual.html#pdf-math.max
+func mathMax(ls LuaState) int {
+	n := ls.GetTop() /* number of arguments */
+	imax := 1        /* index of current maximum value */
+	if n < 1 {
+		auxlib.ArgError(ls, 1, "number expected, got no value")
+	}
+	for i := 1; i <= n; i++ {
+		auxlib.CheckNumber(ls, i)
+		if ls.Compare(imax, i, LUA_OPLT) {
+			imax = i
+		}
+	}
+	ls.PushValue(imax)
+	return 1
+}
+
+// math.tointeger (x)
+// http://www.lua.org/manual/5.3/manual.html#pdf-math.tointeger
+func mathToInt(ls LuaState) int {
+	if n, ok := ls.ToIntegerX(1); ok {
+		ls.PushInteger(n)
+	} else {
+		auxlib.CheckAny(ls, 1)
+		ls.PushNil() /* value is not convertible to integer */
+	}
+	return 1
+}
+
+// math.type (x)
+// http://www.lua.org/manual/5.3/manual.html#pdf-math.type
+func mathType(ls LuaState) int {
+	if ls.Type(1) == LUA_TNUMBER {
+		if ls.IsInteger(1) {
+			ls.PushString("integer")
+		} else {
+			ls.PushString("float")
+		}
+	} else {
+		auxlib.CheckAny(ls, 1)
+		ls.PushNil()
+	}
+	return 1
+}
+
+// math.ult (m, n)
+// http://www.lua.org/manual/5.3/manual.html#pdf-math.ult
+func mathUlt(ls LuaState) int {
+	a := auxlib.CheckInteger(ls, 1)
+	b := auxlib.CheckInteger(ls, 2)
+	ls.PushBoolean(uint64(a) < uint64(b))
+	return 1
+}
+
+/* helpers */
+
+// pushes f as an integer if it has an integer value that fits,
+// otherwise as a float
+func pushNumInt(ls LuaState, f float64) {
+	if i, ok := floatToInteger(f); ok {
+		ls.PushInteger(i)
+	} else {
+		ls.PushNumber(f)
+	}
+}
+
+// f as an integer, if it has an exact representation as one
+func floatToInteger(f float64) (int64, bool) {
+	if f >= -(1<<63) && f < (1<<63) && f == math.Floor(f) {
+		return int64(f), true
+	}
+	return 0, false
+}
@@ -0,0 +1,146 @@
+package mathlib
+
+import (
+	. "luago/api"
+	"luago/auxlib"
+	"sync/atomic"
+	"time"
+)
+
+/*
+	math.randomseed(42)
+	print(math.random())       --> 一个 [0,1) 之间的浮点数
+	print(math.random(6))      --> 1 到 6 之间的整数
+	print(math.random(-5, 5))  --> -5 到 5 之间的整数
+	print(math.random(0))      --> 任意一个整数
+
+和 Lua 5.4 一样使用 xoshiro256** 生成器，每个 LuaState 打开 math 库时
+得到自己的生成器状态，互不影响；同样的种子得到同样的序列。
+math.randomseed 返回实际使用的两个种子，不带参数时用时间随机播种。
+*/
+
+// the state of a xoshiro256** generator
+type ranState [4]uint64
+
+func rotl(x uint64, n uint) uint64 {
+	return (x << n) | (x >> (64 - n))
+}
+
+func (self *ranState) next() uint64 {
+	s := self
+	state0, state1 := s[0], s[1]
+	state2, state3 := s[2]^state0, s[3]^state1
+	res := rotl(state1*5, 7) * 9
+	s[0] = state0 ^ state3
+	s[1] = state1 ^ state2
+	s[2] = state2 ^ (state1 << 17)
+	s[3] = rotl(state3, 45)
+	return res
+}
+
+func (self *ranState) setSeed(n1, n2 uint64) {
+	self[0] = n1
+	self[1] = 0xff /* avoid a zero state */
+	self[2] = n2
+	self[3] = 0
+	for i := 0; i < 16; i++ {
+		self.next() /* discard initial values to "spread" seed */
+	}
+}
+
+// a float in [0, 1) from the 53 higher bits of ran
+func i2d(ran uint64) float64 {
+	return float64(ran>>11) * (0.5 / (1 << 52))
+}
+
+// projects ran into the interval [0, n], drawing again while the
+// masked value falls outside so the result has no bias
+func (self *ranState) project(ran, n uint64) uint64 {
+	if n&(n+1) == 0 { /* is 'n + 1' a power of 2? */
+		return ran & n /* no bias */
+	}
+	lim := n
+	/* compute the smallest (2^b - 1) not smaller than n */
+	lim |= lim >> 1
+	lim |= lim >> 2
+	lim |= lim >> 4
+	lim |= lim >> 8
+	lim |= lim >> 16
+	lim |= lim >> 32
+	for ran &= lim; ran > n; ran &= lim { /* project 'ran' into [0, lim] */
+		ran = self.next() /* not inside [0, n]? Try again */
+	}
+	return ran
+}
+
+// math.random ([m [, n]])
+// http://www.lua.org/manual/5.4/manual.html#pdf-math.random
+func (self *ranState) random(ls LuaState) int {
+	var low, up int64
+	rv := self.next()    /* next pseudo-random value */
+	switch ls.GetTop() { /* check number of arguments */
+	case 0: /* no arguments */
+		ls.PushNumber(i2d(rv)) /* float between 0 and 1 */
+		return 1
+	case 1: /* only upper limit */
+		low = 1
+		up = auxlib.CheckInteger(ls, 1)
+		if up == 0 { /* single 0 as argument? */
+			ls.PushInteger(int64(rv)) /* full random integer */
+			return 1
+		}
+	case 2: /* lower and upper limits */
+		low = auxlib.CheckInteger(ls, 1)
+		up = auxlib.CheckInteger(ls, 2)
+	default:
+		return auxlib.Error(ls, "wrong number of arguments")
+	}
+	/* random integer in the interval [low, up] */
+	if low > up {
+		auxlib.ArgError(ls, 1, "interval is empty")
+	}
+	/* project random integer into the interval [0, up - low] */
+	p := self.project(rv, uint64(up)-uint64(low))
+	ls.PushInteger(int64(p + uint64(low)))
+	return 1
+}
+
+// math.randomseed ([x [, y]])
+// http://www.lua.org/manual/5.4/manual.html#pdf-math.randomseed
+func (self *ranState) randomSeed(ls LuaState) int {
+	var n1, n2 int64
+	if ls.IsNone(1) {
+		n1, n2 = self.randSeed()
+	} else {
+		n1 = auxlib.CheckInteger(ls, 1)
+		if ls.IsNoneOrNil(2) {
+			n2 = 0
+		} else {
+			n2 = auxlib.CheckInteger(ls, 2)
+		}
+	}
+	self.setSeed(uint64(n1), uint64(n2))
+	ls.PushInteger(n1)
+	ls.PushInteger(n2)
+	return 2
+}
+
+var seeds uint64 /* counts the generators seeded by randSeed */
+
+// a seed from the clock and a counter, different for each state
+// even when they are created at the same time
+func (self *ranState) randSeed() (int64, int64) {
+	return time.Now().UnixNano(), int64(atomic.AddUint64(&seeds, 1))
+}
+
+// registers random and randomseed, sharing a new generator, in the
+// math table on the top of the stack
+func setRandFuncs(ls LuaState) {
+	g := &ranState{}
+	n1, n2 := g.randSeed()
+	g.setSeed(uint64(n1), uint64(n2))
+	ls.PushGoFunction(g.random)
+	ls.SetField(-2, "random")
+	ls.PushGoFunction(g.randomSeed)
+	ls.SetField(-2, "randomseed")
+}
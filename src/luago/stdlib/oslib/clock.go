@@ -0,0 +1,18 @@
+//go:build linux || darwin || freebsd
+// +build linux darwin freebsd
+
+package oslib
+
+import (
+	"syscall"
+	"time"
+)
+
+// the processor time used by the program, like C's clock
+func cpuTime() time.Duration {
+	var ru syscall.Rusage
+	if syscall.Getrusage(syscall.RUSAGE_SELF, &ru) != nil {
+		return time.Since(start)
+	}
+	return time.Duration(ru.Utime.Nano() + ru.Stime.Nano())
+}
@@ -0,0 +1,12 @@
+//go:build !linux && !darwin && !freebsd
+// +build !linux,!darwin,!freebsd
+
+package oslib
+
+import "time"
+
+// the processor time used by the program; where it cannot be asked
+// for, the time since the program started
+func cpuTime() time.Duration {
+	return time.Since(start)
+}
@@ -0,0 +1,173 @@
+package oslib
+
+import (
+	"fmt"
+	. "luago/api"
+	"luago/auxlib"
+	"strings"
+	"time"
+)
+
+/*
+	print(os.date("%Y-%m-%d %H:%M:%S"))    --> 2020-01-31 08:30:00
+	print(os.date("!%c", 0))               --> Thu Jan  1 00:00:00 1970
+	local t = os.date("*t", os.time())     --> {year=..., month=..., day=..., hour=...,
+	                                       -->  min=..., sec=..., yday=..., wday=..., isdst=...}
+
+格式和 C 的 strftime 相同（C locale），支持 C99 的全部转换符以及 %E、%O
+修饰符；格式以 ! 开头时按 UTC 格式化；"*t" 返回一个表。第二个参数是
+os.time 返回的时间，默认为当前时间。
+*/
+
+/* the valid conversions, by length, blocks separated by '|' */
+const L_STRFTIMEC99 = "aAbBcCdDeFgGhHIjmMnprRStTuUVwWxXyYzZ%" +
+	"||" + "EcECExEXEyEY" + "OdOeOHOIOmOMOSOuOUOVOwOWOy"
+
+// os.date ([format [, time]])
+// http://www.lua.org/manual/5.3/manual.html#pdf-os.date
+func osDate(ls LuaState) int {
+	format := "%c"
+	if !ls.IsNoneOrNil(1) {
+		format = auxlib.CheckString(ls, 1)
+	}
+	t := time.Now()
+	if !ls.IsNoneOrNil(2) {
+		t = time.Unix(auxlib.CheckInteger(ls, 2), 0)
+	}
+	if strings.HasPrefix(format, "!") { /* UTC? */
+		t = t.UTC()
+		format = format[1:] /* skip '!' */
+	}
+	if strings.HasPrefix(format, "*t") {
+		ls.CreateTable(0, 9) /* 9 = number of fields */
+		setAllFields(ls, t)
+	} else {
+		ls.PushString(strftime(ls, format, t))
+	}
+	return 1
+}
+
+// sets the fields of the date table on the top of the stack
+func setAllFields(ls LuaState, t time.Time) {
+	setField := func(key string, value int) {
+		ls.PushInteger(int64(value))
+		ls.SetField(-2, key)
+	}
+	setField("year", t.Year())
+	setField("month", int(t.Month()))
+	setField("day", t.Day())
+	setField("hour", t.Hour())
+	setField("min", t.Minute())
+	setField("sec", t.Second())
+	setField("yday", t.YearDay())
+	setField("wday", int(t.Weekday())+1)
+	ls.PushBoolean(t.IsDST())
+	ls.SetField(-2, "isdst")
+}
+
+// formats t like the C strftime in the C locale
+func strftime(ls LuaState, format string, t time.Time) string {
+	var b strings.Builder
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' {
+			b.WriteByte(format[i])
+			continue
+		}
+		i++
+		conv := checkOption(ls, format[i:])
+		i += len(conv) - 1
+		b.WriteString(convert(conv[len(conv)-1], t)) /* E and O change nothing in C */
+	}
+	return b.String()
+}
+
+// the valid conversion at the start of conv (after the '%')
+func checkOption(ls LuaState, conv string) string {
+	option := L_STRFTIMEC99
+	oplen := 1 /* length of options being checked */
+	for option != "" && oplen <= len(conv) {
+		if option[0] == '|' { /* next block? */
+			oplen++ /* will check options with next length (+1) */
+		} else if option[:oplen] == conv[:oplen] { /* match? */
+			return conv[:oplen]
+		}
+		option = option[oplen:]
+	}
+	auxlib.ArgError(ls, 1, fmt.Sprintf("invalid conversion specifier '%%%s'", conv))
+	return ""
+}
+
+func convert(c byte, t time.Time) string {
+	switch c {
+	case 'a':
+		return t.Format("Mon")
+	case 'A':
+		return t.Format("Monday")
+	case 'b', 'h':
+		return t.Format("Jan")
+	case 'B':
+		return t.Format("January")
+	case 'c':
+		return t.Format("Mon Jan _2 15:04:05 2006")
+	case 'C':
+		return fmt.Sprintf("%02d", t.Year()/100)
+	case 'd':
+		return fmt.Sprintf("%02d", t.Day())
+	case 'D', 'x':
+		return t.Format("01/02/06")
+	case 'e':
+		return fmt.Sprintf("%2d", t.Day())
+	case 'F':
+		return fmt.Sprintf("%d-%02d-%02d", t.Year(), t.Month(), t.Day())
+	case 'g':
+		year, _ := t.ISOWeek()
+		return fmt.Sprintf("%02d", year%100)
+	case 'G':
+		year, _ := t.ISOWeek()
+		return fmt.Sprintf("%d", year)
+	case 'H':
+		return fmt.Sprintf("%02d", t.Hour())
+	case 'I':
+		return t.Format("03")
+	case 'j':
+		return fmt.Sprintf("%03d", t.YearDay())
+	case 'm':
+		return fmt.Sprintf("%02d", int(t.Month()))
+	case 'M':
+		return fmt.Sprintf("%02d", t.Minute())
+	case 'n':
+		return "\n"
+	case 'p':
+		return t.Format("PM")
+	case 'r':
+		return t.Format("03:04:05 PM")
+	case 'R':
+		return t.Format("15:04")
+	case 'S':
+		return fmt.Sprintf("%02d", t.Second())
+	case 't':
+		return "\t"
+	case 'T', 'X':
+		return t.Format("15:04:05")
+	case 'u': /* Monday is 1 */
+		return fmt.Sprintf("%d", (int(t.Weekday())+6)%7+1)
+	case 'U': /* weeks starting on Sunday */
+		return fmt.Sprintf("%02d", (t.YearDay()+6-int(t.Weekday()))/7)
+	case 'V':
+		_, week := t.ISOWeek()
+		return fmt.Sprintf("%02d", week)
+	case 'w': /* Sunday is 0 */
+		return fmt.Sprintf("%d", int(t.Weekday()))
+	case 'W': /* weeks starting on Monday */
+		return fmt.Sprintf("%02d", (t.YearDay()+6-(int(t.Weekday())+6)%7)/7)
+	case 'y':
+		return fmt.Sprintf("%02d", t.Year()%100)
+	case 'Y':
+		return fmt.Sprintf("%d", t.Year())
+	case 'z':
+		return t.Format("-0700")
+	case 'Z':
+		return t.Format("MST")
+	}
+	return "%" /* %% */
+}
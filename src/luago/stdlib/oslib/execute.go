@@ -0,0 +1,73 @@
+package oslib
+
+import (
+	. "luago/api"
+	"luago/auxlib"
+	"luago/sandbox"
+	"os"
+	"os/exec"
+	"runtime"
+	"syscall"
+)
+
+// os.execute ([command])
+// http://www.lua.org/manual/5.3/manual.html#pdf-os.execute
+func osExecute(ls LuaState) int {
+	if ls.IsNoneOrNil(1) { /* is there a shell? */
+		ls.PushBoolean(sandbox.Exec && shell() != "")
+		return 1
+	}
+	cmd := auxlib.CheckString(ls, 1)
+	if !sandbox.Exec {
+		return auxlib.Error(ls, "command execution is disabled")
+	}
+	c := command(cmd)
+	c.Stdin, c.Stdout, c.Stderr = os.Stdin, os.Stdout, os.Stderr
+	return execResult(ls, c.Run())
+}
+
+// the shell that runs commands, "" if there is none
+func shell() string {
+	name := "/bin/sh"
+	if runtime.GOOS == "windows" {
+		name = "cmd"
+	}
+	path, err := exec.LookPath(name)
+	if err != nil {
+		return ""
+	}
+	return path
+}
+
+// a command that runs cmd through the shell, like C's system
+func command(cmd string) *exec.Cmd {
+	if runtime.GOOS == "windows" {
+		return exec.Command("cmd", "/C", cmd)
+	}
+	return exec.Command("/bin/sh", "-c", cmd)
+}
+
+// pushes true or nil, "exit" or "signal" and the exit status or the
+// signal number of a finished command, like luaL_execresult; err not
+// coming from the command itself is reported like luaL_fileresult
+func execResult(ls LuaState, err error) int {
+	what, stat := "exit", 0 /* type of termination and status */
+	if err != nil {
+		ee, ok := err.(*exec.ExitError)
+		if !ok { /* could not start the command */
+			return fileResult(ls, err, "")
+		}
+		stat = ee.ExitCode()
+		if ws, ok := ee.Sys().(syscall.WaitStatus); ok && ws.Signaled() {
+			what, stat = "signal", int(ws.Signal())
+		}
+	}
+	if what == "exit" && stat == 0 { /* successful termination? */
+		ls.PushBoolean(true)
+	} else {
+		ls.PushNil()
+	}
+	ls.PushString(what)
+	ls.PushInteger(int64(stat))
+	return 3 /* return true/nil,what,code */
+}
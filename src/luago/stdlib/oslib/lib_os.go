@@ -0,0 +1,184 @@
+package oslib
+
+import (
+	"io/ioutil"
+	. "luago/api"
+	"luago/auxlib"
+	"luago/stdlib/iolib"
+	"os"
+	"strings"
+	"syscall"
+	"time"
+)
+
+var osFuncs = map[string]GoFunction{
+	"clock":    osClock,
+	"date":     osDate,
+	"difftime": osDiffTime,
+	"execute":  osExecute,
+	"exit":     osExit,
+	"getenv":   osGetEnv,
+	"remove":   osRemove,
+	"rename":   osRename,
+	"time":     osTime,
+	"tmpname":  osTmpName,
+}
+
+var start = time.Now() /* for os.clock where there is no processor time */
+
+// OpenOsLib returns the os table.
+// http://www.lua.org/manual/5.3/manual.html#6.9
+func OpenOsLib(ls LuaState) int {
+	ls.CreateTable(0, len(osFuncs))
+	for name, f := range osFuncs {
+		ls.PushGoFunction(f)
+		ls.SetField(-2, name)
+	}
+	return 1
+}
+
+// os.clock ()
+// http://www.lua.org/manual/5.3/manual.html#pdf-os.clock
+func osClock(ls LuaState) int {
+	ls.PushNumber(cpuTime().Seconds())
+	return 1
+}
+
+// os.difftime (t2, t1)
+// http://www.lua.org/manual/5.3/manual.html#pdf-os.difftime
+func osDiffTime(ls LuaState) int {
+	t2 := auxlib.CheckInteger(ls, 1)
+	t1 := auxlib.OptInteger(ls, 2, 0)
+	ls.PushNumber(float64(t2 - t1))
+	return 1
+}
+
+// os.exit ([code [, close]])
+// http://www.lua.org/manual/5.3/manual.html#pdf-os.exit
+func osExit(ls LuaState) int {
+	var status int
+	if ls.IsBoolean(1) {
+		if !ls.ToBoolean(1) {
+			status = 1 /* EXIT_FAILURE */
+		}
+	} else {
+		status = int(auxlib.OptInteger(ls, 1, 0))
+	}
+	iolib.Flush(ls) /* like C's exit */
+	if ls.ToBoolean(2) {
+		ls.Close() /* close the state before exiting */
+	}
+	os.Exit(status)
+	return 0
+}
+
+// os.getenv (varname)
+// http://www.lua.org/manual/5.3/manual.html#pdf-os.getenv
+func osGetEnv(ls LuaState) int {
+	if v, ok := os.LookupEnv(auxlib.CheckString(ls, 1)); ok {
+		ls.PushString(v)
+	} else {
+		ls.PushNil()
+	}
+	return 1
+}
+
+// os.remove (filename)
+// http://www.lua.org/manual/5.3/manual.html#pdf-os.remove
+func osRemove(ls LuaState) int {
+	filename := auxlib.CheckString(ls, 1)
+	return fileResult(ls, os.Remove(filename), filename)
+}
+
+// os.rename (oldname, newname)
+// http://www.lua.org/manual/5.3/manual.html#pdf-os.rename
+func osRename(ls LuaState) int {
+	fromname := auxlib.CheckString(ls, 1)
+	toname := auxlib.CheckString(ls, 2)
+	return fileResult(ls, os.Rename(fromname, toname), fromname)
+}
+
+// os.tmpname ()
+// http://www.lua.org/manual/5.3/manual.html#pdf-os.tmpname
+func osTmpName(ls LuaState) int {
+	f, err := ioutil.TempFile("", "lua_")
+	if err != nil {
+		return auxlib.Error(ls, "unable to generate a unique filename")
+	}
+	f.Close()
+	ls.PushString(f.Name())
+	return 1
+}
+
+// os.time ([table])
+// http://www.lua.org/manual/5.3/manual.html#pdf-os.time
+func osTime(ls LuaState) int {
+	if ls.IsNoneOrNil(1) { /* called without args? */
+		ls.PushInteger(time.Now().Unix()) /* get current time */
+		return 1
+	}
+	auxlib.CheckType(ls, 1, LUA_TTABLE)
+	ls.SetTop(1) /* make sure table is at the top */
+	sec := getField(ls, "sec", 0)
+	min := getField(ls, "min", 0)
+	hour := getField(ls, "hour", 12)
+	day := getField(ls, "day", -1)
+	month := getField(ls, "month", -1)
+	year := getField(ls, "year", -1)
+	t := time.Date(year, time.Month(month), day, hour, min, sec, 0, time.Local)
+	setAllFields(ls, t) /* update fields with normalized values */
+	ls.PushInteger(t.Unix())
+	return 1
+}
+
+/* helpers */
+
+// the integer field key of the table on the top of the stack, d if it
+// is absent (d < 0: the field is required)
+func getField(ls LuaState, key string, d int) int {
+	t := ls.GetField(-1, key)
+	res, ok := ls.ToIntegerX(-1)
+	if !ok || !ls.IsNumber(-1) { /* field is not an integer? */
+		if t != LUA_TNIL { /* some other value? */
+			auxlib.Error(ls, "field '%s' is not an integer", key)
+		} else if d < 0 { /* absent field; no default? */
+			auxlib.Error(ls, "field '%s' missing in date table", key)
+		}
+		res = int64(d)
+	} else if res < -(1<<31) || res > 1<<31-1 {
+		auxlib.Error(ls, "field '%s' is out-of-bound", key)
+	}
+	ls.Pop(1)
+	return int(res)
+}
+
+// pushes true on success, or nil, "filename: message" and the error
+// number, like luaL_fileresult
+func fileResult(ls LuaState, err error, filename string) int {
+	if err == nil {
+		ls.PushBoolean(true)
+		return 1
+	}
+	switch e := err.(type) { /* the cause, without Go's "op path:" */
+	case *os.PathError:
+		err = e.Err
+	case *os.LinkError:
+		err = e.Err
+	}
+	msg := err.Error()
+	if msg != "" { /* C's strerror capitalizes */
+		msg = strings.ToUpper(msg[:1]) + msg[1:]
+	}
+	var errno int64
+	if n, ok := err.(syscall.Errno); ok {
+		errno = int64(n)
+	}
+	ls.PushNil()
+	if filename != "" {
+		ls.PushString(filename + ": " + msg)
+	} else {
+		ls.PushString(msg)
+	}
+	ls.PushInteger(errno)
+	return 3
+}
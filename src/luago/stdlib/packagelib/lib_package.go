@@ -0,0 +1,251 @@
+package packagelib
+
+import (
+	. "luago/api"
+	"luago/auxlib"
+	"luago/vfs"
+	"os"
+	"strings"
+)
+
+const (
+	LUA_DIRSEP    = string(os.PathSeparator)
+	LUA_PATH_SEP  = ";"
+	LUA_PATH_MARK = "?"
+	LUA_EXEC_DIR  = "!"
+	LUA_IGMARK    = "-"
+
+	LUA_PATH_DEFAULT  = "./?.lua;./?/init.lua"
+	LUA_CPATH_DEFAULT = "./?.so"
+)
+
+// OpenPackageLib creates the package table and the global require.
+// http://www.lua.org/manual/5.3/manual.html#6.3
+func OpenPackageLib(ls LuaState) int {
+	ls.NewTable() /* package */
+	createSearchersTable(ls)
+	setPath(ls, "path", "LUA_PATH", LUA_PATH_DEFAULT)
+	setPath(ls, "cpath", "LUA_CPATH", LUA_CPATH_DEFAULT)
+	ls.PushString(LUA_DIRSEP + "\n" + LUA_PATH_SEP + "\n" +
+		LUA_PATH_MARK + "\n" + LUA_EXEC_DIR + "\n" + LUA_IGMARK + "\n")
+	ls.SetField(-2, "config")
+	getSubTable(ls, LUA_REGISTRYINDEX, LUA_LOADED_TABLE)
+	ls.SetField(-2, "loaded")
+	getSubTable(ls, LUA_REGISTRYINDEX, LUA_PRELOAD_TABLE)
+	ls.SetField(-2, "preload")
+	ls.PushGoFunction(pkgSearchPath)
+	ls.SetField(-2, "searchpath")
+
+	ls.PushValue(-1)
+	ls.PushGoClosure(pkgRequire, 1) /* package as upvalue */
+	ls.SetGlobal("require")
+	ls.PushValue(-1)
+	ls.SetGlobal("package")
+
+	/* package.loaded.package = package */
+	getSubTable(ls, LUA_REGISTRYINDEX, LUA_LOADED_TABLE)
+	ls.PushValue(-2)
+	ls.SetField(-2, "package")
+	ls.Pop(1)
+	return 1
+}
+
+func createSearchersTable(ls LuaState) {
+	searchers := []GoFunction{
+		preloadSearcher,
+		luaSearcher,
+		pluginSearcher,
+	}
+	/* create 'searchers' table */
+	ls.CreateTable(len(searchers), 0)
+	/* fill it with predefined searchers */
+	for idx, searcher := range searchers {
+		ls.PushValue(-2) /* set 'package' as upvalue for all searchers */
+		ls.PushGoClosure(searcher, 1)
+		ls.RawSetI(-2, int64(idx+1))
+	}
+	ls.SetField(-2, "searchers") /* put it in field 'searchers' */
+}
+
+// the environment variable overrides the default, and ";;" in it
+// is replaced by the default path
+func setPath(ls LuaState, field, envName, def string) {
+	path := os.Getenv(envName + "_5_3")
+	if path == "" {
+		path = os.Getenv(envName)
+	}
+	if path == "" {
+		path = def
+	} else {
+		path = strings.Replace(path, LUA_PATH_SEP+LUA_PATH_SEP,
+			LUA_PATH_SEP+def+LUA_PATH_SEP, 1)
+	}
+	ls.PushString(path)
+	ls.SetField(-2, field)
+}
+
+// pushes t[fname] where t is the value at idx, creating it if absent
+func getSubTable(ls LuaState, idx int, fname string) bool {
+	if ls.GetField(idx, fname) == LUA_TTABLE {
+		return true /* table already there */
+	}
+	ls.Pop(1) /* remove previous result */
+	idx = ls.AbsIndex(idx)
+	ls.NewTable()
+	ls.PushValue(-1)        /* copy to be left at top */
+	ls.SetField(idx, fname) /* assign new table to field */
+	return false            /* false, because did not find table there */
+}
+
+// require (modname)
+// http://www.lua.org/manual/5.3/manual.html#pdf-require
+func pkgRequire(ls LuaState) int {
+	name := auxlib.CheckString(ls, 1)
+	ls.SetTop(1) /* LOADED table will be at index 2 */
+	getSubTable(ls, LUA_REGISTRYINDEX, LUA_LOADED_TABLE)
+	ls.GetField(2, name)  /* LOADED[name] */
+	if ls.ToBoolean(-1) { /* is it there? */
+		return 1 /* package is already loaded */
+	}
+	/* else must load package */
+	ls.Pop(1) /* remove 'getfield' result */
+	findLoader(ls, name)
+	ls.PushString(name) /* pass name as argument to module loader */
+	ls.Insert(-2)       /* name is 1st argument (before search data) */
+	ls.Call(2, 1)       /* run loader to load module */
+	if !ls.IsNil(-1) {  /* non-nil return? */
+		ls.SetField(2, name) /* LOADED[name] = returned value */
+	}
+	if ls.GetField(2, name) == LUA_TNIL { /* module set no value? */
+		ls.PushBoolean(true) /* use true as result */
+		ls.PushValue(-1)     /* extra copy to be returned */
+		ls.SetField(2, name) /* LOADED[name] = true */
+	}
+	return 1
+}
+
+func findLoader(ls LuaState, name string) {
+	/* push 'package.searchers' to index 3 in the stack */
+	if ls.GetField(LuaUpvalueIndex(1), "searchers") != LUA_TTABLE {
+		auxlib.Error(ls, "'package.searchers' must be a table")
+	}
+
+	/* to build error message */
+	errMsg := "module '" + name + "' not found:"
+
+	/*  iterate over available searchers to find a loader */
+	for i := int64(1); ; i++ {
+		if ls.RawGetI(3, i) == LUA_TNIL { /* no more searchers? */
+			ls.Pop(1)                      /* remove nil */
+			auxlib.Error(ls, "%s", errMsg) /* create error message */
+		}
+
+		ls.PushString(name)
+		ls.Call(1, 2)          /* call it */
+		if ls.IsFunction(-2) { /* did it find a loader? */
+			return /* module loader found */
+		} else if ls.IsString(-2) { /* searcher returned error message? */
+			ls.Pop(1)                 /* remove extra return */
+			errMsg += ls.ToString(-1) /* concatenate error message */
+		} else {
+			ls.Pop(2) /* remove both returns */
+		}
+		ls.Pop(1)
+	}
+}
+
+// package.searchpath (name, path [, sep [, rep]])
+// http://www.lua.org/manual/5.3/manual.html#pdf-package.searchpath
+func pkgSearchPath(ls LuaState) int {
+	name := auxlib.CheckString(ls, 1)
+	path := auxlib.CheckString(ls, 2)
+	sep := auxlib.OptString(ls, 3, ".")
+	rep := auxlib.OptString(ls, 4, LUA_DIRSEP)
+	if filename, errMsg := searchPath(name, path, sep, rep); errMsg == "" {
+		ls.PushString(filename)
+		return 1
+	} else {
+		ls.PushNil()
+		ls.PushString(errMsg)
+		return 2
+	}
+}
+
+func searchPath(name, path, sep, dirSep string) (filename, errMsg string) {
+	if sep != "" {
+		name = strings.Replace(name, sep, dirSep, -1)
+	}
+
+	for _, filename := range strings.Split(path, LUA_PATH_SEP) {
+		if filename == "" {
+			continue
+		}
+		filename = strings.Replace(filename, LUA_PATH_MARK, name, -1)
+		if vfs.Exists(filename) {
+			return filename, ""
+		}
+		errMsg += "\n\tno file '" + filename + "'"
+	}
+
+	return "", errMsg
+}
+
+// looks up package[pname] and searches name in it
+func findFile(ls LuaState, name, pname string) (filename, errMsg string) {
+	ls.GetField(LuaUpvalueIndex(1), pname)
+	path, ok := ls.ToStringX(-1)
+	ls.Pop(1)
+	if !ok {
+		auxlib.Error(ls, "'package.%s' must be a string", pname)
+	}
+	return searchPath(name, path, ".", LUA_DIRSEP)
+}
+
+func preloadSearcher(ls LuaState) int {
+	name := ls.ToString(1)
+	getSubTable(ls, LUA_REGISTRYINDEX, LUA_PRELOAD_TABLE)
+	if ls.GetField(-1, name) == LUA_TNIL { /* not found? */
+		ls.PushString("\n\tno field package.preload['" + name + "']")
+	}
+	return 1
+}
+
+func luaSearcher(ls LuaState) int {
+	name := ls.ToString(1)
+	filename, errMsg := findFile(ls, name, "path")
+	if errMsg != "" {
+		ls.PushString(errMsg)
+		return 1 /* module not found in this path */
+	}
+
+	data, err := vfs.ReadFile(filename)
+	if err != nil {
+		return auxlib.Error(ls, "error loading module '%s' from file '%s':\n\t%s",
+			name, filename, err.Error())
+	}
+	if ls.Load(data, filename, "bt") != LUA_OK {
+		return auxlib.Error(ls, "error loading module '%s' from file '%s':\n\t%s",
+			name, filename, ls.ToString(-1))
+	}
+	ls.PushString(filename) /* will be 2nd argument to module */
+	return 2                /* return open function and file name */
+}
+
+// looks for a Go plugin exporting `func Open(ls LuaState) int`
+func pluginSearcher(ls LuaState) int {
+	name := ls.ToString(1)
+	filename, errMsg := findFile(ls, name, "cpath")
+	if errMsg != "" {
+		ls.PushString(errMsg)
+		return 1 /* module not found in this path */
+	}
+
+	open, err := loadPlugin(filename)
+	if err != nil {
+		return auxlib.Error(ls, "error loading module '%s' from file '%s':\n\t%s",
+			name, filename, err.Error())
+	}
+	ls.PushGoFunction(open)
+	ls.PushString(filename) /* will be 2nd argument to module */
+	return 2
+}
@@ -0,0 +1,35 @@
+//go:build (linux && cgo) || (darwin && cgo) || (freebsd && cgo)
+// +build linux,cgo darwin,cgo freebsd,cgo
+
+package packagelib
+
+import (
+	"fmt"
+	. "luago/api"
+	"plugin"
+)
+
+const PLUGIN_OPEN_FUNC = "Open"
+
+func loadPlugin(filename string) (GoFunction, error) {
+	p, err := plugin.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	sym, err := p.Lookup(PLUGIN_OPEN_FUNC)
+	if err != nil {
+		return nil, err
+	}
+
+	switch open := sym.(type) {
+	case func(LuaState) int:
+		return open, nil
+	case *func(LuaState) int: /* exported as a variable */
+		return *open, nil
+	case *GoFunction:
+		return *open, nil
+	default:
+		return nil, fmt.Errorf("%s has type %T, want func(LuaState) int",
+			PLUGIN_OPEN_FUNC, sym)
+	}
+}
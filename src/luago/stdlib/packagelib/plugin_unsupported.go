@@ -0,0 +1,13 @@
+//go:build (!linux && !darwin && !freebsd) || !cgo
+// +build !linux,!darwin,!freebsd !cgo
+
+package packagelib
+
+import (
+	"errors"
+	. "luago/api"
+)
+
+func loadPlugin(filename string) (GoFunction, error) {
+	return nil, errors.New("Go plugins are not supported on this platform")
+}
@@ -0,0 +1,49 @@
+package persistlib
+
+import . "luago/api"
+
+var persistFuncs = map[string]GoFunction{
+	"dump": persistDump,
+	"load": persistLoad,
+}
+
+func OpenPersistLib(ls LuaState) int {
+	ls.CreateTable(0, len(persistFuncs))
+	for name, f := range persistFuncs {
+		ls.PushGoFunction(f)
+		ls.SetField(-2, name)
+	}
+	return 1
+}
+
+// persist.dump (v [, perms])
+// perms maps values that cannot be persisted to keys
+func persistDump(ls LuaState) int {
+	permsIdx := 0
+	if !ls.IsNoneOrNil(2) {
+		permsIdx = 2
+	}
+	data, err := ls.Persist(1, permsIdx)
+	if err != nil {
+		ls.PushNil()
+		ls.PushString(err.Error())
+		return 2
+	}
+	ls.PushString(string(data))
+	return 1
+}
+
+// persist.load (s [, perms])
+// perms maps the keys used by dump back to values
+func persistLoad(ls LuaState) int {
+	permsIdx := 0
+	if !ls.IsNoneOrNil(2) {
+		permsIdx = 2
+	}
+	if err := ls.Unpersist([]byte(ls.ToString(1)), permsIdx); err != nil {
+		ls.PushNil()
+		ls.PushString(err.Error())
+		return 2
+	}
+	return 1
+}
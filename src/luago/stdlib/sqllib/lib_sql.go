@@ -0,0 +1,310 @@
+package sqllib
+
+import (
+	"database/sql"
+	"fmt"
+	. "luago/api"
+	"luago/auxlib"
+	"luago/conv"
+	"time"
+)
+
+const SQL_HANDLES = "_SQLDB" /* registry table: name -> constructor of the db object */
+
+const (
+	DB_TYPE   = "sql.db"
+	TX_TYPE   = "sql.tx"
+	STMT_TYPE = "sql.stmt"
+)
+
+/*
+脚本只能访问宿主注册的数据库：
+
+	sqllib.Register(ls, "main", db)
+
+	local db = require("sql").open("main")
+	local rows, err = db:query("select id, name from t where id > ?", 1)
+	local n, id = db:exec("insert into t(name) values (?)", "x")
+	local stmt = db:prepare("select * from t where id = ?")
+	local rows = stmt:query(1)
+	local tx = db:begin() ... tx:commit()
+
+出错时返回 nil 和错误信息。每一行是以列名为键的表，NULL 列不出现在表中。
+数据库对象、语句和事务都是 userdata，元表的 __name 分别是 sql.db、sql.stmt、
+sql.tx，方法放在元表的 __index 里。语句被回收时自动 Close，事务被回收时
+自动 Rollback（已经提交或回滚的事务不受影响）；数据库归宿主所有，不会被关闭。
+*/
+func Register(ls LuaState, name string, db *sql.DB) {
+	getSubTable(ls, LUA_REGISTRYINDEX, SQL_HANDLES)
+	ls.PushGoFunction(func(ls LuaState) int {
+		pushObject(ls, db, DB_TYPE)
+		return 1
+	})
+	ls.SetField(-2, name)
+	ls.Pop(1)
+}
+
+/* the methods shared by sql.db and sql.tx */
+type conn interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Prepare(query string) (*sql.Stmt, error)
+}
+
+var dbMethods = connMethods(func(ls LuaState) conn { return checkDB(ls) },
+	map[string]GoFunction{
+		"begin": dbBegin,
+	})
+
+var txMethods = connMethods(func(ls LuaState) conn { return checkTx(ls) },
+	map[string]GoFunction{
+		"commit":   txCommit,
+		"rollback": txRollback,
+	})
+
+var stmtMethods = map[string]GoFunction{
+	"query": stmtQuery,
+	"exec":  stmtExec,
+	"close": stmtClose,
+}
+
+func OpenSqlLib(ls LuaState) int {
+	createMeta(ls, DB_TYPE, dbMethods, nil)
+	createMeta(ls, TX_TYPE, txMethods, txGc)
+	createMeta(ls, STMT_TYPE, stmtMethods, stmtGc)
+	auxlib.NewLib(ls, map[string]GoFunction{"open": sqlOpen})
+	return 1
+}
+
+// sql.open (name)
+func sqlOpen(ls LuaState) int {
+	name := auxlib.CheckString(ls, 1)
+	getSubTable(ls, LUA_REGISTRYINDEX, SQL_HANDLES)
+	if ls.GetField(-1, name) != LUA_TFUNCTION {
+		ls.PushNil()
+		ls.PushString(fmt.Sprintf("no database registered as '%s'", name))
+		return 2
+	}
+	ls.Call(0, 1)
+	return 1
+}
+
+/* objects */
+
+// the metatable of tname, with the methods as its __index and gc,
+// if any, as its __gc
+func createMeta(ls LuaState, tname string, methods map[string]GoFunction, gc GoFunction) {
+	auxlib.NewMetatable(ls, tname)
+	auxlib.NewLib(ls, methods)
+	ls.SetField(-2, "__index")
+	if gc != nil {
+		ls.PushGoFunction(gc)
+		ls.SetField(-2, "__gc")
+	}
+	ls.Pop(1)
+}
+
+func pushObject(ls LuaState, obj interface{}, tname string) {
+	ls.NewUserData(obj)
+	auxlib.SetMetatable(ls, tname)
+}
+
+func checkDB(ls LuaState) *sql.DB {
+	return auxlib.CheckUData(ls, 1, DB_TYPE).(*sql.DB)
+}
+
+func checkTx(ls LuaState) *sql.Tx {
+	return auxlib.CheckUData(ls, 1, TX_TYPE).(*sql.Tx)
+}
+
+func checkStmt(ls LuaState) *sql.Stmt {
+	return auxlib.CheckUData(ls, 1, STMT_TYPE).(*sql.Stmt)
+}
+
+/* methods, self is at index 1 */
+
+// adds query, exec and prepare on the conn checked by check to methods
+func connMethods(check func(LuaState) conn, methods map[string]GoFunction) map[string]GoFunction {
+	// obj:query (query, ···)
+	methods["query"] = func(ls LuaState) int {
+		c := check(ls)
+		rows, err := c.Query(auxlib.CheckString(ls, 2), args(ls, 3)...)
+		return pushQuery(ls, rows, err)
+	}
+	// obj:exec (query, ···), returns rows affected and last insert id
+	methods["exec"] = func(ls LuaState) int {
+		c := check(ls)
+		result, err := c.Exec(auxlib.CheckString(ls, 2), args(ls, 3)...)
+		return pushExec(ls, result, err)
+	}
+	// obj:prepare (query)
+	methods["prepare"] = func(ls LuaState) int {
+		c := check(ls)
+		stmt, err := c.Prepare(auxlib.CheckString(ls, 2))
+		if err != nil {
+			return pushError(ls, err)
+		}
+		pushObject(ls, stmt, STMT_TYPE)
+		return 1
+	}
+	return methods
+}
+
+// db:begin ()
+func dbBegin(ls LuaState) int {
+	tx, err := checkDB(ls).Begin()
+	if err != nil {
+		return pushError(ls, err)
+	}
+	pushObject(ls, tx, TX_TYPE)
+	return 1
+}
+
+// tx:commit ()
+func txCommit(ls LuaState) int {
+	return pushResult(ls, checkTx(ls).Commit())
+}
+
+// tx:rollback ()
+func txRollback(ls LuaState) int {
+	return pushResult(ls, checkTx(ls).Rollback())
+}
+
+// rolls back a transaction nobody committed; sql.ErrTxDone otherwise
+func txGc(ls LuaState) int {
+	checkTx(ls).Rollback()
+	return 0
+}
+
+// stmt:query (···)
+func stmtQuery(ls LuaState) int {
+	stmt := checkStmt(ls)
+	rows, err := stmt.Query(args(ls, 2)...)
+	return pushQuery(ls, rows, err)
+}
+
+// stmt:exec (···)
+func stmtExec(ls LuaState) int {
+	stmt := checkStmt(ls)
+	result, err := stmt.Exec(args(ls, 2)...)
+	return pushExec(ls, result, err)
+}
+
+// stmt:close ()
+func stmtClose(ls LuaState) int {
+	return pushResult(ls, checkStmt(ls).Close())
+}
+
+// closing a closed statement is a no-op
+func stmtGc(ls LuaState) int {
+	checkStmt(ls).Close()
+	return 0
+}
+
+func pushQuery(ls LuaState, rows *sql.Rows, err error) int {
+	if err != nil {
+		return pushError(ls, err)
+	}
+	defer rows.Close()
+	if err := pushRows(ls, rows); err != nil {
+		return pushError(ls, err)
+	}
+	return 1
+}
+
+func pushExec(ls LuaState, result sql.Result, err error) int {
+	if err != nil {
+		return pushError(ls, err)
+	}
+	if n, err := result.RowsAffected(); err == nil {
+		ls.PushInteger(n)
+	} else {
+		ls.PushNil()
+	}
+	if id, err := result.LastInsertId(); err == nil {
+		ls.PushInteger(id)
+	} else {
+		ls.PushNil()
+	}
+	return 2
+}
+
+/* conversion */
+
+func args(ls LuaState, from int) []interface{} {
+	var args []interface{}
+	for i := from; i <= ls.GetTop(); i++ {
+		switch ls.Type(i) {
+		case LUA_TTABLE, LUA_TFUNCTION:
+			auxlib.ArgError(ls, i, auxlib.TypeName(ls, i)+" cannot be a query parameter")
+		}
+		args = append(args, conv.ToGo(ls, i))
+	}
+	return args
+}
+
+func pushRows(ls LuaState, rows *sql.Rows) error {
+	columns, err := rows.Columns()
+	if err != nil {
+		return err
+	}
+
+	values := make([]interface{}, len(columns))
+	ptrs := make([]interface{}, len(columns))
+	for i := range values {
+		ptrs[i] = &values[i]
+	}
+
+	ls.NewTable()
+	for n := int64(1); rows.Next(); n++ {
+		if err := rows.Scan(ptrs...); err != nil {
+			ls.Pop(1)
+			return err
+		}
+		ls.CreateTable(0, len(columns))
+		for i, col := range columns {
+			pushValue(ls, values[i])
+			ls.SetField(-2, col)
+		}
+		ls.RawSetI(-2, n)
+	}
+	if err := rows.Err(); err != nil {
+		ls.Pop(1)
+		return err
+	}
+	return nil
+}
+
+// SQL values: int64, float64, bool, []byte, string, time.Time or nil
+func pushValue(ls LuaState, v interface{}) {
+	switch x := v.(type) {
+	case time.Time:
+		ls.PushString(x.Format(time.RFC3339Nano))
+	default:
+		conv.Push(ls, x)
+	}
+}
+
+func pushError(ls LuaState, err error) int {
+	ls.PushNil()
+	ls.PushString(err.Error())
+	return 2
+}
+
+func pushResult(ls LuaState, err error) int {
+	if err != nil {
+		return pushError(ls, err)
+	}
+	ls.PushBoolean(true)
+	return 1
+}
+
+func getSubTable(ls LuaState, idx int, fname string) {
+	if ls.GetField(idx, fname) != LUA_TTABLE {
+		ls.Pop(1)
+		idx = ls.AbsIndex(idx)
+		ls.NewTable()
+		ls.PushValue(-1)
+		ls.SetField(idx, fname)
+	}
+}
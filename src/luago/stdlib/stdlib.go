@@ -0,0 +1,98 @@
+package stdlib
+
+import (
+	. "luago/api"
+	"luago/stdlib/baselib"
+	"luago/stdlib/coroutinelib"
+	"luago/stdlib/csvlib"
+	"luago/stdlib/debuglib"
+	"luago/stdlib/hotswaplib"
+	"luago/stdlib/inspectlib"
+	"luago/stdlib/iolib"
+	"luago/stdlib/mathlib"
+	"luago/stdlib/oslib"
+	"luago/stdlib/packagelib"
+	"luago/stdlib/persistlib"
+	"luago/stdlib/sqllib"
+	"luago/stdlib/stringlib"
+	"luago/stdlib/synclib"
+	"luago/stdlib/tablelib"
+	"luago/stdlib/templatelib"
+	"luago/stdlib/tomllib"
+	"luago/stdlib/utf8lib"
+	"luago/stdlib/yamllib"
+)
+
+type lib struct {
+	name string
+	open GoFunction
+}
+
+// libraries are opened in this order and set as globals
+var libs = []lib{
+	{"_G", baselib.OpenBaseLib},
+	{"package", packagelib.OpenPackageLib},
+	{"coroutine", coroutinelib.OpenCoroutineLib},
+	{"string", stringlib.OpenStringLib},
+	{"table", tablelib.OpenTableLib},
+	{"math", mathlib.OpenMathLib},
+	{"io", iolib.OpenIoLib},
+	{"os", oslib.OpenOsLib},
+	{"utf8", utf8lib.OpenUtf8Lib},
+	{"debug", debuglib.OpenDebugLib},
+}
+
+// extension modules, loaded on demand by require
+var preloads = []lib{
+	{"template", templatelib.OpenTemplateLib},
+	{"sql", sqllib.OpenSqlLib},
+	{"toml", tomllib.OpenTomlLib},
+	{"yaml", yamllib.OpenYamlLib},
+	{"csv", csvlib.OpenCsvLib},
+	{"persist", persistlib.OpenPersistLib},
+	{"hotswap", hotswaplib.OpenHotswapLib},
+	{"sync", synclib.OpenSyncLib},
+	{"inspect", inspectlib.OpenInspectLib},
+}
+
+// OpenLibs opens all standard libraries into the given state and
+// makes the extension modules available to require.
+func OpenLibs(ls LuaState) {
+	for _, lib := range libs {
+		requireF(ls, lib.name, lib.open)
+		ls.Pop(1)
+	}
+
+	for _, lib := range preloads {
+		ls.PreloadModule(lib.name, lib.open)
+	}
+}
+
+// requireF calls open, stores the module in package.loaded and in the
+// global modname, and leaves a copy of it on the stack.
+// http://www.lua.org/manual/5.3/manual.html#luaL_requiref
+func requireF(ls LuaState, modname string, open GoFunction) {
+	getSubTable(ls, LUA_REGISTRYINDEX, LUA_LOADED_TABLE)
+	ls.GetField(-1, modname) /* LOADED[modname] */
+	if !ls.ToBoolean(-1) {   /* package not already loaded? */
+		ls.Pop(1) /* remove field */
+		ls.PushGoFunction(open)
+		ls.PushString(modname)   /* argument to open function */
+		ls.Call(1, 1)            /* call 'open' to open module */
+		ls.PushValue(-1)         /* make copy of module (call result) */
+		ls.SetField(-3, modname) /* LOADED[modname] = module */
+	}
+	ls.Remove(-2) /* remove LOADED table */
+	ls.PushValue(-1)
+	ls.SetGlobal(modname) /* _G[modname] = module */
+}
+
+func getSubTable(ls LuaState, idx int, fname string) {
+	if ls.GetField(idx, fname) != LUA_TTABLE {
+		ls.Pop(1)
+		idx = ls.AbsIndex(idx)
+		ls.NewTable()
+		ls.PushValue(-1)
+		ls.SetField(idx, fname)
+	}
+}
@@ -0,0 +1,10 @@
+//go:build js && wasm
+// +build js,wasm
+
+package stdlib
+
+import "luago/stdlib/jslib"
+
+func init() {
+	libs = append(libs, lib{"js", jslib.OpenJsLib})
+}
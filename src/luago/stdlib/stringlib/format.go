@@ -0,0 +1,254 @@
+package stringlib
+
+import (
+	"fmt"
+	. "luago/api"
+	"luago/auxlib"
+	"math"
+	"strconv"
+	"strings"
+)
+
+const L_FMTFLAGS = "-+ #0" /* valid flags in a format specification */
+
+// string.format (formatstring, ···)
+// http://www.lua.org/manual/5.3/manual.html#pdf-string.format
+func strFormat(ls LuaState) int {
+	top := ls.GetTop()
+	strfrmt := auxlib.CheckString(ls, 1)
+	arg := 1
+	var b auxlib.Buffer
+	b.Init(ls)
+	for i := 0; i < len(strfrmt); i++ {
+		if strfrmt[i] != L_ESC {
+			b.AddChar(strfrmt[i])
+			continue
+		}
+		if i++; i < len(strfrmt) && strfrmt[i] == L_ESC {
+			b.AddChar(L_ESC) /* %% */
+			continue
+		}
+		/* format item */
+		if arg++; arg > top {
+			auxlib.ArgError(ls, arg, "no value")
+		}
+		form, conv := scanFormat(ls, strfrmt[i:])
+		i += len(form) - 2 /* the conversion character */
+		switch conv {
+		case 'c':
+			b.AddString(pad(string([]byte{byte(auxlib.CheckInteger(ls, arg))}), form))
+		case 'd', 'i':
+			n := auxlib.CheckInteger(ls, arg)
+			b.AddString(fmt.Sprintf(form[:len(form)-1]+"d", n))
+		case 'u':
+			n := auxlib.CheckInteger(ls, arg)
+			b.AddString(fmt.Sprintf(form[:len(form)-1]+"d", uint64(n)))
+		case 'o', 'x', 'X':
+			n := auxlib.CheckInteger(ls, arg)
+			b.AddString(fmt.Sprintf(form[:len(form)-1]+string(conv), uint64(n)))
+		case 'a', 'A':
+			b.AddString(formatHexFloat(form, auxlib.CheckNumber(ls, arg)))
+		case 'e', 'E', 'f', 'F', 'g', 'G':
+			b.AddString(formatFloat(form, auxlib.CheckNumber(ls, arg)))
+		case 'q':
+			addLiteral(ls, &b, arg)
+		case 's':
+			s := toLString(ls, arg)
+			if !strings.Contains(form, ".") && len(s) >= 100 {
+				/* no precision and string is too long to be formatted */
+				b.AddString(s) /* keep entire string */
+			} else {
+				b.AddString(pad(truncate(s, form), form))
+			}
+		default: /* also treat cases 'pnLlh' */
+			auxlib.Error(ls, "invalid option '%s' to 'format'", form)
+		}
+	}
+	b.PushResult()
+	return 1
+}
+
+// the format item "%flags width.precision conv" starting after the
+// '%' at the start of s, and its conversion character
+func scanFormat(ls LuaState, s string) (string, byte) {
+	p := 0
+	for p < len(s) && strings.IndexByte(L_FMTFLAGS, s[p]) >= 0 {
+		p++ /* skip flags */
+	}
+	if p >= len(L_FMTFLAGS)+1 {
+		auxlib.Error(ls, "invalid format (repeated flags)")
+	}
+	digits := func() {
+		for n := 0; p < len(s) && isdigit(s[p]); n++ {
+			if n == 2 { /* (2 digits at most) */
+				auxlib.Error(ls, "invalid format (width or precision too long)")
+			}
+			p++
+		}
+	}
+	digits() /* skip width */
+	if p < len(s) && s[p] == '.' {
+		p++
+		digits() /* skip precision */
+	}
+	if p >= len(s) {
+		auxlib.Error(ls, "invalid option '%%%s' to 'format'", s)
+	}
+	return "%" + s[:p+1], s[p]
+}
+
+// the flags, width and precision of a format item
+func formatSpec(form string) (flags string, width, prec int) {
+	spec := form[1 : len(form)-1]
+	i := 0
+	for i < len(spec) && strings.IndexByte(L_FMTFLAGS, spec[i]) >= 0 {
+		i++
+	}
+	flags, spec = spec[:i], spec[i:]
+	prec = -1
+	if dot := strings.IndexByte(spec, '.'); dot >= 0 {
+		prec, _ = strconv.Atoi(spec[dot+1:]) /* "." alone means 0 */
+		spec = spec[:dot]
+	}
+	width, _ = strconv.Atoi(spec)
+	return
+}
+
+// pads s to the width of the item, C counts bytes, not runes
+func pad(s, form string) string {
+	flags, width, _ := formatSpec(form)
+	if len(s) >= width {
+		return s
+	}
+	fill := strings.Repeat(" ", width-len(s))
+	if strings.Contains(flags, "-") {
+		return s + fill
+	}
+	return fill + s
+}
+
+// cuts s to the precision of the item
+func truncate(s, form string) string {
+	if _, _, prec := formatSpec(form); prec >= 0 && prec < len(s) {
+		return s[:prec]
+	}
+	return s
+}
+
+func formatFloat(form string, f float64) string {
+	conv := form[len(form)-1]
+	if math.IsInf(f, 0) || math.IsNaN(f) { /* like C: inf, -inf, nan */
+		flags, _, _ := formatSpec(form)
+		s := "nan"
+		if math.IsInf(f, 0) {
+			s = "inf"
+		}
+		if 'A' <= conv && conv <= 'Z' {
+			s = strings.ToUpper(s)
+		}
+		if math.Signbit(f) && !math.IsNaN(f) {
+			s = "-" + s
+		} else if strings.Contains(flags, "+") {
+			s = "+" + s
+		} else if strings.Contains(flags, " ") {
+			s = " " + s
+		}
+		return pad(s, form)
+	}
+	if conv == 'F' {
+		form = form[:len(form)-1] + "f"
+	}
+	if (conv == 'g' || conv == 'G') && !strings.Contains(form, ".") {
+		form = form[:len(form)-1] + ".6" + string(conv) /* C's default precision */
+	}
+	return fmt.Sprintf(form, f)
+}
+
+// %a: Go writes at least two exponent digits, C as few as needed
+func formatHexFloat(form string, f float64) string {
+	if math.IsInf(f, 0) || math.IsNaN(f) {
+		return formatFloat(form, f)
+	}
+	verb := "x"
+	if form[len(form)-1] == 'A' {
+		verb = "X"
+	}
+	flags, width, prec := formatSpec(form)
+	spec := "%" + strings.Replace(flags, "0", "", -1)
+	if prec >= 0 {
+		spec += "." + strconv.Itoa(prec)
+	}
+	s := fmt.Sprintf(spec+verb, f)
+	if i := strings.LastIndexAny(s, "pP"); i >= 0 {
+		exp := strings.TrimLeft(s[i+2:], "0")
+		if exp == "" {
+			exp = "0"
+		}
+		s = s[:i+2] + exp
+	}
+	if len(s) < width {
+		if strings.Contains(flags, "-") {
+			s += strings.Repeat(" ", width-len(s))
+		} else if strings.Contains(flags, "0") { /* zeros after the 0x */
+			at := strings.Index(strings.ToLower(s), "0x") + 2
+			s = s[:at] + strings.Repeat("0", width-len(s)) + s[at:]
+		} else {
+			s = strings.Repeat(" ", width-len(s)) + s
+		}
+	}
+	return s
+}
+
+// %q: the value as a Lua literal
+func addLiteral(ls LuaState, b *auxlib.Buffer, arg int) {
+	switch ls.Type(arg) {
+	case LUA_TSTRING:
+		s, _ := ls.ToStringX(arg)
+		addQuoted(b, s)
+	case LUA_TNUMBER:
+		if !ls.IsInteger(arg) { /* float? */
+			n := ls.ToNumber(arg)
+			switch {
+			case math.IsInf(n, 1):
+				b.AddString("1e9999")
+			case math.IsInf(n, -1):
+				b.AddString("-1e9999")
+			case math.IsNaN(n):
+				b.AddString("(0/0)")
+			default: /* format number as hexadecimal, to keep all bits */
+				b.AddString(formatHexFloat("%a", n))
+			}
+		} else { /* integers */
+			n := ls.ToInteger(arg)
+			if n == math.MinInt64 { /* cannot be written as a decimal literal */
+				fmt.Fprintf(b, "0x%x", uint64(n))
+			} else {
+				fmt.Fprintf(b, "%d", n)
+			}
+		}
+	case LUA_TNIL, LUA_TBOOLEAN:
+		b.AddString(toLString(ls, arg))
+	default:
+		auxlib.ArgError(ls, arg, "value has no literal form")
+	}
+}
+
+func addQuoted(b *auxlib.Buffer, s string) {
+	b.AddChar('"')
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c == '"' || c == '\\' || c == '\n' {
+			b.AddChar('\\')
+			b.AddChar(c)
+		} else if iscntrl(c) {
+			if i+1 < len(s) && isdigit(s[i+1]) {
+				fmt.Fprintf(b, "\\%03d", c)
+			} else {
+				fmt.Fprintf(b, "\\%d", c)
+			}
+		} else {
+			b.AddChar(c)
+		}
+	}
+	b.AddChar('"')
+}
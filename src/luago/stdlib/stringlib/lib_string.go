@@ -0,0 +1,368 @@
+package stringlib
+
+import (
+	"fmt"
+	. "luago/api"
+	"luago/auxlib"
+	"math"
+	"strings"
+)
+
+var strFuncs = map[string]GoFunction{
+	"byte":     strByte,
+	"char":     strChar,
+	"find":     strFind,
+	"format":   strFormat,
+	"gsub":     strGsub,
+	"len":      strLen,
+	"lower":    strLower,
+	"match":    strMatch,
+	"pack":     strPack,
+	"packsize": strPackSize,
+	"rep":      strRep,
+	"reverse":  strReverse,
+	"sub":      strSub,
+	"unpack":   strUnpack,
+	"upper":    strUpper,
+}
+
+// OpenStringLib returns the string table, which is also the __index
+// of the metatable shared by all strings, so s:find(p) works.
+// http://www.lua.org/manual/5.3/manual.html#6.4
+func OpenStringLib(ls LuaState) int {
+	ls.CreateTable(0, len(strFuncs))
+	for name, f := range strFuncs {
+		ls.PushGoFunction(f)
+		ls.SetField(-2, name)
+	}
+	createMetatable(ls)
+	return 1
+}
+
+// sets the metatable of strings, the string table is on the top
+func createMetatable(ls LuaState) {
+	ls.CreateTable(0, 1)       /* table to be metatable for strings */
+	ls.PushString("")          /* dummy string */
+	ls.PushValue(-2)           /* copy table */
+	ls.SetMetatable(-2)        /* set table as metatable for strings */
+	ls.Pop(1)                  /* pop dummy string */
+	ls.PushValue(-2)           /* get string library */
+	ls.SetField(-2, "__index") /* metatable.__index = string */
+	ls.Pop(1)                  /* pop metatable */
+}
+
+// string.len (s)
+// http://www.lua.org/manual/5.3/manual.html#pdf-string.len
+func strLen(ls LuaState) int {
+	s := auxlib.CheckString(ls, 1)
+	ls.PushInteger(int64(len(s)))
+	return 1
+}
+
+// string.sub (s, i [, j])
+// http://www.lua.org/manual/5.3/manual.html#pdf-string.sub
+func strSub(ls LuaState) int {
+	s := auxlib.CheckString(ls, 1)
+	l := int64(len(s))
+	start := posRelat(auxlib.CheckInteger(ls, 2), len(s))
+	end := posRelat(auxlib.OptInteger(ls, 3, -1), len(s))
+	if start < 1 {
+		start = 1
+	}
+	if end > l {
+		end = l
+	}
+	if start <= end {
+		ls.PushString(s[start-1 : end])
+	} else {
+		ls.PushString("")
+	}
+	return 1
+}
+
+// string.reverse (s)
+// http://www.lua.org/manual/5.3/manual.html#pdf-string.reverse
+func strReverse(ls LuaState) int {
+	b := []byte(auxlib.CheckString(ls, 1))
+	reverse(b)
+	ls.PushString(string(b))
+	return 1
+}
+
+// string.lower (s)
+// http://www.lua.org/manual/5.3/manual.html#pdf-string.lower
+func strLower(ls LuaState) int {
+	b := []byte(auxlib.CheckString(ls, 1))
+	for i, c := range b {
+		if isupper(c) {
+			b[i] = c + ('a' - 'A')
+		}
+	}
+	ls.PushString(string(b))
+	return 1
+}
+
+// string.upper (s)
+// http://www.lua.org/manual/5.3/manual.html#pdf-string.upper
+func strUpper(ls LuaState) int {
+	b := []byte(auxlib.CheckString(ls, 1))
+	for i, c := range b {
+		if islower(c) {
+			b[i] = c - ('a' - 'A')
+		}
+	}
+	ls.PushString(string(b))
+	return 1
+}
+
+// string.rep (s, n [, sep])
+// http://www.lua.org/manual/5.3/manual.html#pdf-string.rep
+func strRep(ls LuaState) int {
+	s := auxlib.CheckString(ls, 1)
+	n := auxlib.CheckInteger(ls, 2)
+	sep := ""
+	if !ls.IsNoneOrNil(3) {
+		sep = auxlib.CheckString(ls, 3)
+	}
+	if n <= 0 {
+		ls.PushString("")
+	} else if l := int64(len(s) + len(sep)); l > 0 && l >= MAXSIZE/n {
+		auxlib.Error(ls, "resulting string too large")
+	} else if sep == "" {
+		ls.PushString(strings.Repeat(s, int(n)))
+	} else {
+		var b strings.Builder
+		b.Grow(int(n*l) - len(sep))
+		for ; n > 1; n-- { /* first n-1 copies (followed by separator) */
+			b.WriteString(s)
+			b.WriteString(sep)
+		}
+		b.WriteString(s) /* last copy (not followed by separator) */
+		ls.PushString(b.String())
+	}
+	return 1
+}
+
+// string.byte (s [, i [, j]])
+// http://www.lua.org/manual/5.3/manual.html#pdf-string.byte
+func strByte(ls LuaState) int {
+	s := auxlib.CheckString(ls, 1)
+	posi := posRelat(auxlib.OptInteger(ls, 2, 1), len(s))
+	pose := posRelat(auxlib.OptInteger(ls, 3, posi), len(s))
+	if posi < 1 {
+		posi = 1
+	}
+	if pose > int64(len(s)) {
+		pose = int64(len(s))
+	}
+	if posi > pose {
+		return 0 /* empty interval; return no values */
+	}
+	if pose-posi >= math.MaxInt32 { /* arithmetic overflow? */
+		auxlib.Error(ls, "string slice too long")
+	}
+	n := int(pose - posi + 1)
+	ls.CheckStack(n)
+	for i := 0; i < n; i++ {
+		ls.PushInteger(int64(s[int(posi)+i-1]))
+	}
+	return n
+}
+
+// string.char (···)
+// http://www.lua.org/manual/5.3/manual.html#pdf-string.char
+func strChar(ls LuaState) int {
+	n := ls.GetTop() /* number of arguments */
+	b := make([]byte, n)
+	for i := 1; i <= n; i++ {
+		c := auxlib.CheckInteger(ls, i)
+		if uint64(c) > math.MaxUint8 {
+			auxlib.ArgError(ls, i, "value out of range")
+		}
+		b[i-1] = byte(c)
+	}
+	ls.PushString(string(b))
+	return 1
+}
+
+// string.find (s, pattern [, init [, plain]])
+// http://www.lua.org/manual/5.3/manual.html#pdf-string.find
+func strFind(ls LuaState) int {
+	return strFindAux(ls, true)
+}
+
+// string.match (s, pattern [, init])
+// http://www.lua.org/manual/5.3/manual.html#pdf-string.match
+func strMatch(ls LuaState) int {
+	return strFindAux(ls, false)
+}
+
+func strFindAux(ls LuaState, find bool) int {
+	s := auxlib.CheckString(ls, 1)
+	pattern := auxlib.CheckString(ls, 2)
+	init := posRelat(auxlib.OptInteger(ls, 3, 1), len(s))
+	if init < 1 {
+		init = 1
+	} else if init > int64(len(s))+1 { /* start after string's end? */
+		ls.PushNil() /* cannot find anything */
+		return 1
+	}
+
+	/* explicit request or no special characters? */
+	if find && (ls.ToBoolean(4) || noSpecials(pattern)) {
+		/* do a plain search */
+		if i := strings.Index(s[init-1:], pattern); i >= 0 {
+			start := int(init) + i
+			ls.PushInteger(int64(start))
+			ls.PushInteger(int64(start + len(pattern) - 1))
+			return 2
+		}
+	} else {
+		anchor := strings.HasPrefix(pattern, "^")
+		if anchor {
+			pattern = pattern[1:] /* skip anchor character */
+		}
+		ms := newMatchState(s, pattern)
+		for s1 := int(init) - 1; ; s1++ {
+			ms.reprep()
+			if e := ms.match(s1, 0); e != -1 {
+				if find {
+					ls.PushInteger(int64(s1 + 1)) /* start */
+					ls.PushInteger(int64(e))      /* end */
+					return pushCaptures(ls, ms.captures(s1, e, false)) + 2
+				}
+				return pushCaptures(ls, ms.captures(s1, e, true))
+			}
+			if s1 >= len(s) || anchor {
+				break
+			}
+		}
+	}
+	ls.PushNil() /* not found */
+	return 1
+}
+
+// string.gsub (s, pattern, repl [, n])
+// http://www.lua.org/manual/5.3/manual.html#pdf-string.gsub
+func strGsub(ls LuaState) int {
+	src := auxlib.CheckString(ls, 1)
+	pattern := auxlib.CheckString(ls, 2)
+	switch tr := ls.Type(3); tr {
+	case LUA_TNUMBER, LUA_TSTRING, LUA_TTABLE, LUA_TFUNCTION:
+	default:
+		auxlib.TypeError(ls, 3, "string/function/table")
+	}
+	maxS := auxlib.OptInteger(ls, 4, int64(len(src))+1) /* max replacements */
+
+	anchor := strings.HasPrefix(pattern, "^")
+	if anchor {
+		pattern = pattern[1:] /* skip anchor character */
+	}
+	ms := newMatchState(src, pattern)
+	var b auxlib.Buffer
+	b.Init(ls)
+	s, lastMatch, n := 0, -1, int64(0)
+	for n < maxS {
+		ms.reprep()
+		if e := ms.match(s, 0); e != -1 && e != lastMatch { /* match? */
+			n++
+			addValue(ls, ms, &b, s, e) /* add replacement to buffer */
+			s, lastMatch = e, e
+		} else if s < len(src) { /* otherwise, skip one character */
+			b.AddChar(src[s])
+			s++
+		} else {
+			break /* end of subject */
+		}
+		if anchor {
+			break
+		}
+	}
+	b.AddString(src[s:])
+	b.PushResult()
+	ls.PushInteger(n) /* number of substitutions */
+	return 2
+}
+
+// adds the replacement of the match src[s:e] to b
+func addValue(ls LuaState, ms *matchState, b *auxlib.Buffer, s, e int) {
+	switch ls.Type(3) {
+	case LUA_TFUNCTION: /* call the function */
+		ls.PushValue(3)
+		n := pushCaptures(ls, ms.captures(s, e, true))
+		ls.Call(n, 1)
+	case LUA_TTABLE: /* index the table */
+		pushCaptures(ls, ms.captures(s, e, true)[:1])
+		ls.GetTable(3)
+	default: /* LUA_TNUMBER or LUA_TSTRING */
+		addS(ls, ms, b, s, e)
+		return
+	}
+	if !ls.ToBoolean(-1) { /* nil or false? */
+		ls.Pop(1)
+		b.AddString(ms.src[s:e]) /* keep original text */
+	} else if ls.IsString(-1) {
+		b.AddValue() /* add result to accumulator */
+	} else {
+		auxlib.Error(ls, "invalid replacement value (a %s)", auxlib.TypeName(ls, -1))
+	}
+}
+
+// the replacement string with its %0-%9 references expanded
+func addS(ls LuaState, ms *matchState, b *auxlib.Buffer, s, e int) {
+	news, _ := ls.ToStringX(3)
+	for i := 0; i < len(news); i++ {
+		if news[i] != L_ESC {
+			b.AddChar(news[i])
+			continue
+		}
+		i++ /* skip ESC */
+		switch {
+		case i < len(news) && news[i] == L_ESC:
+			b.AddChar(L_ESC)
+		case i < len(news) && news[i] == '0':
+			b.AddString(ms.src[s:e])
+		case i < len(news) && isdigit(news[i]):
+			switch c := ms.getCapture(int(news[i]-'1'), s, e).(type) {
+			case string:
+				b.AddString(c)
+			case int64:
+				fmt.Fprintf(b, "%d", c)
+			}
+		default:
+			auxlib.Error(ls, "invalid use of '%%' in replacement string")
+		}
+	}
+}
+
+func pushCaptures(ls LuaState, caps []interface{}) int {
+	ls.CheckStack(len(caps))
+	for _, c := range caps {
+		switch x := c.(type) {
+		case string:
+			ls.PushString(x)
+		case int64:
+			ls.PushInteger(x)
+		}
+	}
+	return len(caps)
+}
+
+/* helpers */
+
+// translate a relative string position: negative means back from end
+func posRelat(pos int64, _len int) int64 {
+	if pos >= 0 {
+		return pos
+	} else if -pos > int64(_len) {
+		return 0
+	}
+	return int64(_len) + pos + 1
+}
+
+// the value at arg as a string, like luaL_tolstring
+func toLString(ls LuaState, arg int) string {
+	s := auxlib.ToLString(ls, arg)
+	ls.Pop(1)
+	return s
+}
@@ -0,0 +1,401 @@
+package stringlib
+
+import (
+	"strconv"
+	"strings"
+)
+
+/*
+Lua 模式匹配，逐行移植自 lstrlib.c：字符类（%a %d %s ...，大写取反）、
+集合 [...]、重复 * + - ?、锚点 ^、捕获 (...) 和位置捕获 ()、
+%b 平衡匹配、%f 边界以及 %1-%9 反向引用。
+模式有误时 panic 一个错误信息，和 PUC-Lua 一样由调用者作为 Lua 错误抛出。
+*/
+
+const (
+	LUA_MAXCAPTURES = 32
+	MAXCCALLS       = 200 /* maximum recursion depth of 'match' */
+
+	CAP_UNFINISHED = -1
+	CAP_POSITION   = -2
+
+	L_ESC = '%'
+)
+
+const specials = "^$*+?.([%-"
+
+type capture struct {
+	init int /* start in src */
+	len  int /* or CAP_UNFINISHED, CAP_POSITION */
+}
+
+type matchState struct {
+	src        string
+	pattern    string
+	level      int /* total number of captures (finished or unfinished) */
+	matchdepth int
+	capture    [LUA_MAXCAPTURES]capture
+}
+
+func newMatchState(src, pattern string) *matchState {
+	return &matchState{src: src, pattern: pattern, matchdepth: MAXCCALLS}
+}
+
+func (self *matchState) reprep() {
+	self.level = 0
+	self.matchdepth = MAXCCALLS
+}
+
+func (self *matchState) checkCapture(l byte) int {
+	l -= '1'
+	if int(l) >= self.level || self.capture[l].len == CAP_UNFINISHED {
+		panic("invalid capture index %" + strconv.Itoa(int(l)+1))
+	}
+	return int(l)
+}
+
+func (self *matchState) captureToClose() int {
+	level := self.level - 1
+	for ; level >= 0; level-- {
+		if self.capture[level].len == CAP_UNFINISHED {
+			return level
+		}
+	}
+	panic("invalid pattern capture")
+}
+
+// the index in the pattern after the class starting at p
+func (self *matchState) classEnd(p int) int {
+	pat := self.pattern
+	c := pat[p]
+	p++
+	if c == L_ESC {
+		if p >= len(pat) {
+			panic("malformed pattern (ends with '%')")
+		}
+		return p + 1
+	}
+	if c == '[' {
+		if p < len(pat) && pat[p] == '^' {
+			p++
+		}
+		for { /* look for a ']' */
+			if p >= len(pat) {
+				panic("malformed pattern (missing ']')")
+			}
+			c := pat[p]
+			p++
+			if c == L_ESC && p < len(pat) {
+				p++ /* skip escapes (e.g. '%]') */
+			}
+			if p < len(pat) && pat[p] == ']' {
+				return p + 1
+			}
+			if p >= len(pat) {
+				panic("malformed pattern (missing ']')")
+			}
+		}
+	}
+	return p
+}
+
+func isalpha(c byte) bool  { return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' }
+func isdigit(c byte) bool  { return '0' <= c && c <= '9' }
+func islower(c byte) bool  { return 'a' <= c && c <= 'z' }
+func isupper(c byte) bool  { return 'A' <= c && c <= 'Z' }
+func isspace(c byte) bool  { return c == ' ' || '\t' <= c && c <= '\r' }
+func iscntrl(c byte) bool  { return c < ' ' || c == 0x7f }
+func isgraph(c byte) bool  { return '!' <= c && c <= '~' }
+func ispunct(c byte) bool  { return isgraph(c) && !isalpha(c) && !isdigit(c) }
+func isxdigit(c byte) bool { return isdigit(c) || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F' }
+
+func singleClass(c, cl byte) bool {
+	var res bool
+	switch cl | 0x20 { /* tolower */
+	case 'a':
+		res = isalpha(c)
+	case 'c':
+		res = iscntrl(c)
+	case 'd':
+		res = isdigit(c)
+	case 'g':
+		res = isgraph(c)
+	case 'l':
+		res = islower(c)
+	case 'p':
+		res = ispunct(c)
+	case 's':
+		res = isspace(c)
+	case 'u':
+		res = isupper(c)
+	case 'w':
+		res = isalpha(c) || isdigit(c)
+	case 'x':
+		res = isxdigit(c)
+	default:
+		return cl == c
+	}
+	if isupper(cl) {
+		return !res
+	}
+	return res
+}
+
+// matches c against the set [...] between p and ec (the ']')
+func (self *matchState) matchBracketClass(c byte, p, ec int) bool {
+	pat := self.pattern
+	sig := true
+	if pat[p+1] == '^' {
+		sig = false
+		p++ /* skip the '^' */
+	}
+	for p++; p < ec; p++ {
+		if pat[p] == L_ESC {
+			p++
+			if singleClass(c, pat[p]) {
+				return sig
+			}
+		} else if p+2 < ec && pat[p+1] == '-' {
+			if pat[p] <= c && c <= pat[p+2] {
+				return sig
+			}
+			p += 2
+		} else if pat[p] == c {
+			return sig
+		}
+	}
+	return !sig
+}
+
+func (self *matchState) singleMatch(s, p, ep int) bool {
+	if s >= len(self.src) {
+		return false
+	}
+	c := self.src[s]
+	switch self.pattern[p] {
+	case '.':
+		return true /* matches any char */
+	case L_ESC:
+		return singleClass(c, self.pattern[p+1])
+	case '[':
+		return self.matchBracketClass(c, p, ep-1)
+	default:
+		return self.pattern[p] == c
+	}
+}
+
+func (self *matchState) matchBalance(s, p int) int {
+	if p+1 >= len(self.pattern) {
+		panic("malformed pattern (missing arguments to '%b')")
+	}
+	if s >= len(self.src) || self.src[s] != self.pattern[p] {
+		return -1
+	}
+	b, e := self.pattern[p], self.pattern[p+1]
+	cont := 1
+	for s++; s < len(self.src); s++ {
+		if self.src[s] == e {
+			if cont--; cont == 0 {
+				return s + 1
+			}
+		} else if self.src[s] == b {
+			cont++
+		}
+	}
+	return -1 /* string ends out of balance */
+}
+
+func (self *matchState) maxExpand(s, p, ep int) int {
+	i := 0 /* counts maximum expand for item */
+	for self.singleMatch(s+i, p, ep) {
+		i++
+	}
+	/* keeps trying to match with the maximum repetitions */
+	for ; i >= 0; i-- {
+		if res := self.match(s+i, ep+1); res != -1 {
+			return res
+		}
+	}
+	return -1
+}
+
+func (self *matchState) minExpand(s, p, ep int) int {
+	for {
+		if res := self.match(s, ep+1); res != -1 {
+			return res
+		} else if self.singleMatch(s, p, ep) {
+			s++ /* try with one more repetition */
+		} else {
+			return -1
+		}
+	}
+}
+
+func (self *matchState) startCapture(s, p, what int) int {
+	if self.level >= LUA_MAXCAPTURES {
+		panic("too many captures")
+	}
+	self.capture[self.level] = capture{s, what}
+	self.level++
+	res := self.match(s, p)
+	if res == -1 { /* match failed? */
+		self.level-- /* undo capture */
+	}
+	return res
+}
+
+func (self *matchState) endCapture(s, p int) int {
+	l := self.captureToClose()
+	self.capture[l].len = s - self.capture[l].init /* close capture */
+	res := self.match(s, p)
+	if res == -1 { /* match failed? */
+		self.capture[l].len = CAP_UNFINISHED /* undo capture */
+	}
+	return res
+}
+
+func (self *matchState) matchCapture(s int, l byte) int {
+	idx := self.checkCapture(l)
+	c := self.capture[idx]
+	str := self.src[c.init : c.init+c.len]
+	if strings.HasPrefix(self.src[s:], str) {
+		return s + len(str)
+	}
+	return -1
+}
+
+// returns the end of the match of pattern[p:] at src[s:], -1 if none
+func (self *matchState) match(s, p int) int {
+	if self.matchdepth--; self.matchdepth == 0 {
+		panic("pattern too complex")
+	}
+	defer func() { self.matchdepth++ }()
+
+	pat := self.pattern
+	for p < len(pat) {
+		switch pat[p] {
+		case '(': /* start capture */
+			if p+1 < len(pat) && pat[p+1] == ')' { /* position capture? */
+				return self.startCapture(s, p+2, CAP_POSITION)
+			}
+			return self.startCapture(s, p+1, CAP_UNFINISHED)
+		case ')': /* end capture */
+			return self.endCapture(s, p+1)
+		case '$':
+			if p+1 == len(pat) { /* is the '$' the last char in pattern? */
+				if s == len(self.src) {
+					return s
+				}
+				return -1
+			}
+			/* else go to default */
+		case L_ESC: /* escaped sequences not in the format class[*+?-]? */
+			if p+1 < len(pat) {
+				switch pat[p+1] {
+				case 'b': /* balanced string? */
+					if s = self.matchBalance(s, p+2); s != -1 {
+						p += 4
+						continue
+					}
+					return -1
+				case 'f': /* frontier? */
+					p += 2
+					if p >= len(pat) || pat[p] != '[' {
+						panic("missing '[' after '%f' in pattern")
+					}
+					ep := self.classEnd(p) /* points to what is next */
+					var prev, cur byte
+					if s > 0 {
+						prev = self.src[s-1]
+					}
+					if s < len(self.src) {
+						cur = self.src[s]
+					}
+					if !self.matchBracketClass(prev, p, ep-1) &&
+						self.matchBracketClass(cur, p, ep-1) {
+						p = ep
+						continue
+					}
+					return -1 /* match failed */
+				case '0', '1', '2', '3', '4', '5', '6', '7', '8', '9':
+					/* capture results (%0-%9)? */
+					if s = self.matchCapture(s, pat[p+1]); s != -1 {
+						p += 2
+						continue
+					}
+					return -1
+				}
+			}
+			/* else go to default */
+		}
+
+		/* default: pattern class plus optional suffix */
+		ep := self.classEnd(p) /* points to optional suffix */
+		/* does not match at least once? */
+		if !self.singleMatch(s, p, ep) {
+			if ep < len(pat) && (pat[ep] == '*' || pat[ep] == '?' || pat[ep] == '-') {
+				p = ep + 1 /* accept empty */
+				continue
+			}
+			return -1 /* '+' or no suffix */
+		}
+		/* matched once */
+		if ep < len(pat) {
+			switch pat[ep] {
+			case '?': /* optional */
+				if res := self.match(s+1, ep+1); res != -1 {
+					return res
+				}
+				p = ep + 1
+				continue
+			case '+': /* 1 or more repetitions */
+				return self.maxExpand(s+1, p, ep)
+			case '*': /* 0 or more repetitions */
+				return self.maxExpand(s, p, ep)
+			case '-': /* 0 or more repetitions (minimum) */
+				return self.minExpand(s, p, ep)
+			}
+		}
+		s++ /* no suffix */
+		p = ep
+	}
+	return s /* end of pattern */
+}
+
+// the value of capture i of the match src[s:e]: a string, an int64
+// position (1-based) or, for i == 0 without captures, the whole match
+func (self *matchState) getCapture(i, s, e int) interface{} {
+	if i >= self.level {
+		if i != 0 {
+			panic("invalid capture index %" + strconv.Itoa(i+1))
+		}
+		return self.src[s:e] /* add whole match */
+	}
+	c := self.capture[i]
+	switch c.len {
+	case CAP_UNFINISHED:
+		panic("unfinished capture")
+	case CAP_POSITION:
+		return int64(c.init + 1)
+	}
+	return self.src[c.init : c.init+c.len]
+}
+
+// the captures of the match src[s:e], or the whole match if the
+// pattern has none
+func (self *matchState) captures(s, e int, wholeIfNone bool) []interface{} {
+	n := self.level
+	if n == 0 && wholeIfNone {
+		n = 1
+	}
+	caps := make([]interface{}, n)
+	for i := range caps {
+		caps[i] = self.getCapture(i, s, e)
+	}
+	return caps
+}
+
+// check whether pattern has no special characters
+func noSpecials(pattern string) bool {
+	return !strings.ContainsAny(pattern, specials)
+}
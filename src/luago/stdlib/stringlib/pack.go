@@ -0,0 +1,367 @@
+package stringlib
+
+import (
+	"encoding/binary"
+	. "luago/api"
+	"luago/auxlib"
+	"math"
+	"strings"
+)
+
+/* string.pack, string.unpack and string.packsize, ported from lstrlib.c */
+
+const (
+	MAXINTSIZE = 16                /* maximum size for the binary representation of an integer */
+	NB         = 8                 /* number of bits in a character */
+	MC         = (1 << NB) - 1     /* mask for one character */
+	SZINT      = 8                 /* size of a lua_Integer */
+	MAXALIGN   = 8                 /* the alignment of doubles, int64s and pointers */
+	MAXSIZE    = math.MaxInt32 - 1 /* limit of the sizes in a format */
+)
+
+/* options for pack/unpack */
+const (
+	Kint       = iota /* signed integers */
+	Kuint             /* unsigned integers */
+	Kfloat            /* floating-point numbers */
+	Kchar             /* fixed-length strings */
+	Kstring           /* strings with prefixed length */
+	Kzstr             /* zero-terminated strings */
+	Kpadding          /* padding */
+	Kpaddalign        /* padding for alignment */
+	Knop              /* no-op (configuration or spaces) */
+)
+
+// the state of a format being read
+type header struct {
+	ls       LuaState
+	fmt      string
+	isLittle bool
+	maxAlign int
+}
+
+func newHeader(ls LuaState, fmt string) *header {
+	return &header{ls: ls, fmt: fmt, isLittle: true, maxAlign: 1}
+}
+
+// reads an optional size, def if there is none
+func (self *header) getNum(def int) int {
+	if self.fmt == "" || !isdigit(self.fmt[0]) {
+		return def
+	}
+	a := 0
+	for self.fmt != "" && isdigit(self.fmt[0]) && a <= (MAXSIZE-9)/10 {
+		a = a*10 + int(self.fmt[0]-'0')
+		self.fmt = self.fmt[1:]
+	}
+	return a
+}
+
+// reads an integer size and checks its limits
+func (self *header) getNumLimit(def int) int {
+	sz := self.getNum(def)
+	if sz > MAXINTSIZE || sz <= 0 {
+		auxlib.Error(self.ls, "integral size (%d) out of limits [1,%d]", sz, MAXINTSIZE)
+	}
+	return sz
+}
+
+// reads the next option, returns its kind and size
+func (self *header) getOption() (int, int) {
+	opt := self.fmt[0]
+	self.fmt = self.fmt[1:]
+	switch opt {
+	case 'b':
+		return Kint, 1
+	case 'B':
+		return Kuint, 1
+	case 'h':
+		return Kint, 2
+	case 'H':
+		return Kuint, 2
+	case 'l', 'j':
+		return Kint, 8
+	case 'L', 'J', 'T':
+		return Kuint, 8
+	case 'f':
+		return Kfloat, 4
+	case 'd', 'n':
+		return Kfloat, 8
+	case 'i':
+		return Kint, self.getNumLimit(4)
+	case 'I':
+		return Kuint, self.getNumLimit(4)
+	case 's':
+		return Kstring, self.getNumLimit(8)
+	case 'c':
+		size := self.getNum(-1)
+		if size == -1 {
+			auxlib.Error(self.ls, "missing size for format option 'c'")
+		}
+		return Kchar, size
+	case 'z':
+		return Kzstr, 0
+	case 'x':
+		return Kpadding, 1
+	case 'X':
+		return Kpaddalign, 0
+	case ' ':
+	case '<':
+		self.isLittle = true
+	case '>':
+		self.isLittle = false
+	case '=':
+		self.isLittle = true /* native */
+	case '!':
+		self.maxAlign = self.getNumLimit(MAXALIGN)
+	default:
+		auxlib.Error(self.ls, "invalid format option '%c'", opt)
+	}
+	return Knop, 0
+}
+
+// reads the next option and the padding it needs to be aligned at
+// totalSize; returns its kind, its size and the padding
+func (self *header) getDetails(totalSize int) (int, int, int) {
+	opt, size := self.getOption()
+	align := size          /* usually, alignment follows size */
+	if opt == Kpaddalign { /* 'X' gets alignment from following option */
+		if self.fmt == "" {
+			auxlib.ArgError(self.ls, 1, "invalid next option for option 'X'")
+		}
+		var next int
+		if next, align = self.getOption(); next == Kchar || align == 0 {
+			auxlib.ArgError(self.ls, 1, "invalid next option for option 'X'")
+		}
+	}
+	ntoAlign := 0
+	if align > 1 && opt != Kchar { /* need no alignment otherwise */
+		if align > self.maxAlign { /* enforce maximum alignment */
+			align = self.maxAlign
+		}
+		if align&(align-1) != 0 { /* is 'align' not a power of 2? */
+			auxlib.ArgError(self.ls, 1, "format asks for alignment not power of 2")
+		}
+		ntoAlign = (align - totalSize&(align-1)) & (align - 1)
+	}
+	return opt, size, ntoAlign
+}
+
+func (self *header) packInt(b *strings.Builder, n uint64, size int, neg bool) {
+	buff := make([]byte, size)
+	for i := 0; i < size; i++ {
+		if i < SZINT {
+			buff[i] = byte(n & MC)
+			n >>= NB
+		} else if neg { /* sign extension */
+			buff[i] = MC
+		}
+	}
+	if !self.isLittle {
+		reverse(buff)
+	}
+	b.Write(buff)
+}
+
+func (self *header) packFloat(b *strings.Builder, f float64, size int) {
+	buff := make([]byte, size)
+	order := self.byteOrder()
+	if size == 4 {
+		order.PutUint32(buff, math.Float32bits(float32(f)))
+	} else {
+		order.PutUint64(buff, math.Float64bits(f))
+	}
+	b.Write(buff)
+}
+
+func (self *header) byteOrder() binary.ByteOrder {
+	if self.isLittle {
+		return binary.LittleEndian
+	}
+	return binary.BigEndian
+}
+
+func reverse(buff []byte) {
+	for i, j := 0, len(buff)-1; i < j; i, j = i+1, j-1 {
+		buff[i], buff[j] = buff[j], buff[i]
+	}
+}
+
+// string.pack (fmt, v1, v2, ···)
+// http://www.lua.org/manual/5.3/manual.html#pdf-string.pack
+func strPack(ls LuaState) int {
+	h := newHeader(ls, auxlib.CheckString(ls, 1))
+	var b strings.Builder
+	arg := 1       /* current argument to pack */
+	totalSize := 0 /* accumulate total size of result */
+	for h.fmt != "" {
+		opt, size, ntoAlign := h.getDetails(totalSize)
+		totalSize += ntoAlign + size
+		for ; ntoAlign > 0; ntoAlign-- {
+			b.WriteByte(0) /* fill alignment */
+		}
+		arg++
+		switch opt {
+		case Kint: /* signed integers */
+			n := auxlib.CheckInteger(ls, arg)
+			if size < SZINT { /* need overflow check? */
+				lim := int64(1) << uint(size*NB-1)
+				if -lim > n || n >= lim {
+					auxlib.ArgError(ls, arg, "integer overflow")
+				}
+			}
+			h.packInt(&b, uint64(n), size, n < 0)
+		case Kuint: /* unsigned integers */
+			n := auxlib.CheckInteger(ls, arg)
+			if size < SZINT && uint64(n) >= uint64(1)<<uint(size*NB) {
+				auxlib.ArgError(ls, arg, "unsigned overflow")
+			}
+			h.packInt(&b, uint64(n), size, false)
+		case Kfloat: /* floating-point options */
+			h.packFloat(&b, auxlib.CheckNumber(ls, arg), size)
+		case Kchar: /* fixed-size string */
+			s := auxlib.CheckString(ls, arg)
+			if len(s) > size {
+				auxlib.ArgError(ls, arg, "string longer than given size")
+			}
+			b.WriteString(s)
+			for i := len(s); i < size; i++ { /* pad extra space */
+				b.WriteByte(0)
+			}
+		case Kstring: /* strings with length count */
+			s := auxlib.CheckString(ls, arg)
+			if size < SZINT && uint64(len(s)) >= uint64(1)<<uint(size*NB) {
+				auxlib.ArgError(ls, arg, "string length does not fit in given size")
+			}
+			h.packInt(&b, uint64(len(s)), size, false) /* pack length */
+			b.WriteString(s)
+			totalSize += len(s)
+		case Kzstr: /* zero-terminated string */
+			s := auxlib.CheckString(ls, arg)
+			if strings.IndexByte(s, 0) >= 0 {
+				auxlib.ArgError(ls, arg, "string contains zeros")
+			}
+			b.WriteString(s)
+			b.WriteByte(0) /* add zero at the end */
+			totalSize += len(s) + 1
+		case Kpadding:
+			b.WriteByte(0)
+			arg--
+		case Kpaddalign, Knop:
+			arg-- /* undo increment */
+		}
+	}
+	ls.PushString(b.String())
+	return 1
+}
+
+// string.packsize (fmt)
+// http://www.lua.org/manual/5.3/manual.html#pdf-string.packsize
+func strPackSize(ls LuaState) int {
+	h := newHeader(ls, auxlib.CheckString(ls, 1))
+	totalSize := 0 /* accumulate total size of result */
+	for h.fmt != "" {
+		opt, size, ntoAlign := h.getDetails(totalSize)
+		size += ntoAlign /* total space used by option */
+		if totalSize > MAXSIZE-size {
+			auxlib.ArgError(ls, 1, "format result too large")
+		}
+		totalSize += size
+		if opt == Kstring || opt == Kzstr {
+			auxlib.ArgError(ls, 1, "variable-length format")
+		}
+	}
+	ls.PushInteger(int64(totalSize))
+	return 1
+}
+
+func (self *header) unpackInt(data string, size int, isSigned bool) int64 {
+	var res uint64
+	limit := size
+	if limit > SZINT {
+		limit = SZINT
+	}
+	for i := limit - 1; i >= 0; i-- {
+		res <<= NB
+		if self.isLittle {
+			res |= uint64(data[i])
+		} else {
+			res |= uint64(data[size-1-i])
+		}
+	}
+	if size < SZINT { /* real size smaller than lua_Integer? */
+		if isSigned { /* needs sign extension? */
+			mask := uint64(1) << uint(size*NB-1)
+			res = (res ^ mask) - mask /* do sign extension */
+		}
+	} else if size > SZINT { /* must check unread bytes */
+		var mask byte
+		if isSigned && int64(res) < 0 {
+			mask = MC
+		}
+		for i := limit; i < size; i++ {
+			c := data[i]
+			if !self.isLittle {
+				c = data[size-1-i]
+			}
+			if c != mask {
+				auxlib.Error(self.ls, "%d-byte integer does not fit into Lua Integer", size)
+			}
+		}
+	}
+	return int64(res)
+}
+
+// string.unpack (fmt, s [, pos])
+// http://www.lua.org/manual/5.3/manual.html#pdf-string.unpack
+func strUnpack(ls LuaState) int {
+	h := newHeader(ls, auxlib.CheckString(ls, 1))
+	data := auxlib.CheckString(ls, 2)
+	ld := len(data)
+	pos := int(posRelat(auxlib.OptInteger(ls, 3, 1), ld)) - 1
+	if pos > ld || pos < 0 {
+		auxlib.ArgError(ls, 3, "initial position out of string")
+	}
+	n := 0 /* number of results */
+	for h.fmt != "" {
+		opt, size, ntoAlign := h.getDetails(pos)
+		if ntoAlign+size > ld-pos {
+			auxlib.ArgError(ls, 2, "data string too short")
+		}
+		pos += ntoAlign /* skip alignment */
+		ls.CheckStack(2)
+		n++
+		switch opt {
+		case Kint, Kuint:
+			ls.PushInteger(h.unpackInt(data[pos:], size, opt == Kint))
+		case Kfloat:
+			order := h.byteOrder()
+			if size == 4 {
+				ls.PushNumber(float64(math.Float32frombits(order.Uint32([]byte(data[pos : pos+4])))))
+			} else {
+				ls.PushNumber(math.Float64frombits(order.Uint64([]byte(data[pos : pos+8]))))
+			}
+		case Kchar:
+			ls.PushString(data[pos : pos+size])
+		case Kstring:
+			l := h.unpackInt(data[pos:], size, false)
+			if uint64(l) > uint64(ld-pos-size) {
+				auxlib.ArgError(ls, 2, "data string too short")
+			}
+			ls.PushString(data[pos+size : pos+size+int(l)])
+			pos += int(l) /* skip string */
+		case Kzstr:
+			l := strings.IndexByte(data[pos:], 0)
+			if l < 0 {
+				auxlib.ArgError(ls, 2, "unfinished string for format 'z'")
+			}
+			ls.PushString(data[pos : pos+l])
+			pos += l + 1 /* skip string plus final '\0' */
+		case Kpaddalign, Kpadding, Knop:
+			n-- /* undo increment */
+		}
+		pos += size
+	}
+	ls.PushInteger(int64(pos) + 1) /* next position */
+	return n + 1
+}
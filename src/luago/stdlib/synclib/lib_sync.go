@@ -0,0 +1,290 @@
+package synclib
+
+import (
+	. "luago/api"
+	"luago/auxlib"
+	"luago/conv"
+)
+
+/*
+	local hits = sync.table("hits")        -- 按名字共享，省略名字则新建匿名表
+	hits:set("/", 0)
+	hits:incr("/")                         -- 原子加，默认加 1
+	hits:update("/", function(n) return n * 2 end)
+	print(hits:get("/"), hits:len(), hits:name())
+	for k, v in pairs(hits:snapshot()) do ... end
+
+	local n = sync.atomic("jobs", 0)       -- get / set / add / cas
+	local m = sync.mutex("log")            -- lock / unlock / trylock
+	m:with(function() ... end)             -- 加锁调用，出错也会解锁
+
+update 的函数在锁外执行，如果期间值被改写就用新值重试，所以它可能被调用多次。
+共享对象是 userdata，三种对象各有一个元表（__name 为 sync.table、sync.atomic、
+sync.mutex），方法放在元表的 __index 里。它们可以跨 LuaState、跨 goroutine 使用，
+宿主可用 SharedTable/SharedAtomic/SharedMutex 访问同一批对象。
+解锁一个没有锁住的 mutex 会抛出 "mutex not locked" 错误。
+*/
+var syncFuncs = map[string]GoFunction{
+	"table":  syncTable,
+	"atomic": syncAtomic,
+	"mutex":  syncMutex,
+}
+
+var tableMethods = map[string]GoFunction{
+	"name":     tableName,
+	"get":      tableGet,
+	"set":      tableSet,
+	"incr":     tableIncr,
+	"update":   tableUpdate,
+	"len":      tableLen,
+	"snapshot": tableSnapshot,
+	"clear":    tableClear,
+}
+
+var atomicMethods = map[string]GoFunction{
+	"name": atomicName,
+	"get":  atomicGet,
+	"set":  atomicSet,
+	"add":  atomicAdd,
+	"cas":  atomicCas,
+}
+
+var mutexMethods = map[string]GoFunction{
+	"name":    mutexName,
+	"lock":    mutexLock,
+	"unlock":  mutexUnlock,
+	"trylock": mutexTryLock,
+	"with":    mutexWith,
+}
+
+const (
+	TABLE_TYPE  = "sync.table"
+	ATOMIC_TYPE = "sync.atomic"
+	MUTEX_TYPE  = "sync.mutex"
+)
+
+func OpenSyncLib(ls LuaState) int {
+	createMeta(ls, TABLE_TYPE, tableMethods)
+	createMeta(ls, ATOMIC_TYPE, atomicMethods)
+	createMeta(ls, MUTEX_TYPE, mutexMethods)
+	auxlib.NewLib(ls, syncFuncs)
+	return 1
+}
+
+// the metatable of tname, with the methods as its __index
+func createMeta(ls LuaState, tname string, methods map[string]GoFunction) {
+	auxlib.NewMetatable(ls, tname)
+	auxlib.NewLib(ls, methods)
+	ls.SetField(-2, "__index")
+	ls.Pop(1)
+}
+
+func pushObject(ls LuaState, obj interface{}, tname string) {
+	ls.NewUserData(obj)
+	auxlib.SetMetatable(ls, tname)
+}
+
+/* table */
+
+// sync.table ([name])
+func syncTable(ls LuaState) int {
+	pushObject(ls, SharedTable(auxlib.OptString(ls, 1, "")), TABLE_TYPE)
+	return 1
+}
+
+func checkTable(ls LuaState) *Table {
+	return auxlib.CheckUData(ls, 1, TABLE_TYPE).(*Table)
+}
+
+func tableName(ls LuaState) int {
+	ls.PushString(checkTable(ls).Name())
+	return 1
+}
+
+func tableGet(ls LuaState) int {
+	t := checkTable(ls)
+	conv.Push(ls, t.Get(checkKey(ls, 2)))
+	return 1
+}
+
+func tableSet(ls LuaState) int {
+	t := checkTable(ls)
+	t.Set(checkKey(ls, 2), checkValue(ls, 3))
+	return 0
+}
+
+func tableIncr(ls LuaState) int {
+	t := checkTable(ls)
+	key := checkKey(ls, 2)
+	var delta interface{} = int64(1)
+	if !ls.IsNoneOrNil(3) {
+		if ls.IsInteger(3) {
+			delta = ls.ToInteger(3)
+		} else {
+			delta = auxlib.CheckNumber(ls, 3)
+		}
+	}
+	sum, err := t.Add(key, delta)
+	if err != nil {
+		return auxlib.Error(ls, "%s", err.Error())
+	}
+	conv.Push(ls, sum)
+	return 1
+}
+
+// t:update(key, f) stores f(old), retrying if key changed meanwhile
+func tableUpdate(ls LuaState) int {
+	t := checkTable(ls)
+	key := checkKey(ls, 2)
+	auxlib.CheckType(ls, 3, LUA_TFUNCTION)
+	for {
+		old, ver := t.get(key)
+		ls.PushValue(3)
+		conv.Push(ls, old)
+		ls.Call(1, 1)
+		if !shareable(ls, -1) {
+			return auxlib.Error(ls, "cannot share a %s", auxlib.TypeName(ls, -1))
+		}
+		val := conv.ToGo(ls, -1)
+		if t.compareAndSet(key, ver, val) {
+			return 1
+		}
+		ls.Pop(1)
+	}
+}
+
+func tableLen(ls LuaState) int {
+	ls.PushInteger(int64(checkTable(ls).Len()))
+	return 1
+}
+
+func tableSnapshot(ls LuaState) int {
+	m := checkTable(ls).Snapshot()
+	ls.CreateTable(0, len(m))
+	for k, v := range m {
+		conv.Push(ls, k)
+		conv.Push(ls, v)
+		ls.SetTable(-3)
+	}
+	return 1
+}
+
+func tableClear(ls LuaState) int {
+	checkTable(ls).Clear()
+	return 0
+}
+
+/* atomic */
+
+// sync.atomic ([name [, init]])
+func syncAtomic(ls LuaState) int {
+	name := auxlib.OptString(ls, 1, "")
+	a := SharedAtomic(name, auxlib.OptInteger(ls, 2, 0))
+	pushObject(ls, a, ATOMIC_TYPE)
+	return 1
+}
+
+func checkAtomic(ls LuaState) *Atomic {
+	return auxlib.CheckUData(ls, 1, ATOMIC_TYPE).(*Atomic)
+}
+
+func atomicName(ls LuaState) int {
+	ls.PushString(checkAtomic(ls).Name())
+	return 1
+}
+
+func atomicGet(ls LuaState) int {
+	ls.PushInteger(checkAtomic(ls).Load())
+	return 1
+}
+
+func atomicSet(ls LuaState) int {
+	a := checkAtomic(ls)
+	a.Store(auxlib.CheckInteger(ls, 2))
+	return 0
+}
+
+func atomicAdd(ls LuaState) int {
+	a := checkAtomic(ls)
+	ls.PushInteger(a.Add(auxlib.OptInteger(ls, 2, 1)))
+	return 1
+}
+
+func atomicCas(ls LuaState) int {
+	a := checkAtomic(ls)
+	old, new := auxlib.CheckInteger(ls, 2), auxlib.CheckInteger(ls, 3)
+	ls.PushBoolean(a.CompareAndSwap(old, new))
+	return 1
+}
+
+/* mutex */
+
+// sync.mutex ([name])
+func syncMutex(ls LuaState) int {
+	pushObject(ls, SharedMutex(auxlib.OptString(ls, 1, "")), MUTEX_TYPE)
+	return 1
+}
+
+func checkMutex(ls LuaState) *Mutex {
+	return auxlib.CheckUData(ls, 1, MUTEX_TYPE).(*Mutex)
+}
+
+func mutexName(ls LuaState) int {
+	ls.PushString(checkMutex(ls).Name())
+	return 1
+}
+
+func mutexLock(ls LuaState) int {
+	checkMutex(ls).Lock()
+	return 0
+}
+
+func mutexUnlock(ls LuaState) int {
+	if err := checkMutex(ls).Unlock(); err != nil {
+		return auxlib.Error(ls, "%s", err.Error())
+	}
+	return 0
+}
+
+func mutexTryLock(ls LuaState) int {
+	ls.PushBoolean(checkMutex(ls).TryLock())
+	return 1
+}
+
+// m:with(f, ...) calls f(...) holding the lock
+func mutexWith(ls LuaState) int {
+	m := checkMutex(ls)
+	auxlib.CheckType(ls, 2, LUA_TFUNCTION)
+	n := ls.GetTop()
+	m.Lock()
+	status := ls.PCall(n-2, LUA_MULTRET, 0)
+	m.Unlock()
+	if status != LUA_OK {
+		return ls.Error()
+	}
+	return ls.GetTop() - 1
+}
+
+func checkKey(ls LuaState, arg int) interface{} {
+	key := normKey(conv.ToGo(ls, arg))
+	if key == nil {
+		return auxlib.ArgError(ls, arg, "invalid key ("+auxlib.TypeName(ls, arg)+")")
+	}
+	return key
+}
+
+// values are copied into Go, functions cannot be shared
+func shareable(ls LuaState, idx int) bool {
+	switch ls.Type(idx) {
+	case LUA_TFUNCTION, LUA_TTHREAD, LUA_TUSERDATA, LUA_TLIGHTUSERDATA:
+		return false
+	}
+	return true
+}
+
+func checkValue(ls LuaState, arg int) interface{} {
+	if !shareable(ls, arg) {
+		auxlib.ArgError(ls, arg, "cannot share a "+auxlib.TypeName(ls, arg))
+	}
+	return conv.ToGo(ls, arg)
+}
@@ -0,0 +1,292 @@
+package synclib
+
+import (
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"sync"
+	"sync/atomic"
+)
+
+/*
+进程内共享的对象，按名字查找，任何 goroutine、任何 LuaState 都可以使用。
+表中只保存普通数据（nil、布尔、数字、字符串以及由它们组成的表的副本），
+读出来的也是副本，所以不同状态之间不会共享 Lua 对象。
+*/
+
+const numShards = 32
+
+type Table struct {
+	name   string
+	shards [numShards]shard
+}
+
+type shard struct {
+	mu sync.RWMutex
+	m  map[interface{}]entry
+}
+
+type entry struct {
+	val interface{}
+	ver uint64 /* bumped on every write, used by Update */
+}
+
+type Atomic struct {
+	name string
+	val  int64
+}
+
+type Mutex struct {
+	name   string
+	mu     sync.Mutex
+	locked int32 /* so that a bad unlock is an error, not a fatal one */
+}
+
+var registry = struct {
+	sync.Mutex
+	tables  map[string]*Table
+	atomics map[string]*Atomic
+	mutexes map[string]*Mutex
+	anon    int64
+}{
+	tables:  map[string]*Table{},
+	atomics: map[string]*Atomic{},
+	mutexes: map[string]*Mutex{},
+}
+
+// anonymous objects get a generated name, so it can be handed to other states
+func newName(kind string) string {
+	registry.anon++
+	return fmt.Sprintf("%s#%d", kind, registry.anon)
+}
+
+// SharedTable returns the shared table with the given name, creating it
+// if needed. An empty name creates a new anonymous table.
+func SharedTable(name string) *Table {
+	registry.Lock()
+	defer registry.Unlock()
+	if name == "" {
+		name = newName("table")
+	}
+	t := registry.tables[name]
+	if t == nil {
+		t = &Table{name: name}
+		for i := range t.shards {
+			t.shards[i].m = map[interface{}]entry{}
+		}
+		registry.tables[name] = t
+	}
+	return t
+}
+
+// SharedAtomic returns the shared integer with the given name; init is
+// only used when it is created.
+func SharedAtomic(name string, init int64) *Atomic {
+	registry.Lock()
+	defer registry.Unlock()
+	if name == "" {
+		name = newName("atomic")
+	}
+	a := registry.atomics[name]
+	if a == nil {
+		a = &Atomic{name: name, val: init}
+		registry.atomics[name] = a
+	}
+	return a
+}
+
+// SharedMutex returns the shared mutex with the given name.
+func SharedMutex(name string) *Mutex {
+	registry.Lock()
+	defer registry.Unlock()
+	if name == "" {
+		name = newName("mutex")
+	}
+	m := registry.mutexes[name]
+	if m == nil {
+		m = &Mutex{name: name}
+		registry.mutexes[name] = m
+	}
+	return m
+}
+
+/* table */
+
+func (self *Table) Name() string {
+	return self.name
+}
+
+func (self *Table) shard(key interface{}) *shard {
+	h := fnv.New32a()
+	fmt.Fprintf(h, "%T:%v", key, key)
+	return &self.shards[h.Sum32()%numShards]
+}
+
+// normKey makes keys comparable the way Lua does: 2.0 and 2 are the
+// same key. Returns nil for values that cannot be keys.
+func normKey(key interface{}) interface{} {
+	switch k := key.(type) {
+	case int:
+		return int64(k)
+	case float64:
+		if math.IsNaN(k) {
+			return nil
+		}
+		if i := int64(k); float64(i) == k {
+			return i
+		}
+		return k
+	case int64, string, bool:
+		return k
+	}
+	return nil
+}
+
+func (self *Table) Get(key interface{}) interface{} {
+	val, _ := self.get(key)
+	return val
+}
+
+func (self *Table) get(key interface{}) (interface{}, uint64) {
+	key = normKey(key)
+	s := self.shard(key)
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	e := s.m[key]
+	return e.val, e.ver
+}
+
+// Set stores val under key, a nil val removes the key.
+func (self *Table) Set(key, val interface{}) {
+	key = normKey(key)
+	s := self.shard(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	self.put(s, key, val)
+}
+
+func (self *Table) put(s *shard, key, val interface{}) {
+	if val == nil {
+		delete(s.m, key)
+	} else {
+		s.m[key] = entry{val, s.m[key].ver + 1}
+	}
+}
+
+// compareAndSet stores val if key was not written since version ver
+func (self *Table) compareAndSet(key interface{}, ver uint64, val interface{}) bool {
+	key = normKey(key)
+	s := self.shard(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.m[key].ver != ver {
+		return false
+	}
+	self.put(s, key, val)
+	return true
+}
+
+// Add adds delta to the number stored under key (missing keys count as
+// 0) and returns the result.
+func (self *Table) Add(key interface{}, delta interface{}) (interface{}, error) {
+	key = normKey(key)
+	s := self.shard(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var sum interface{}
+	switch old := s.m[key].val.(type) {
+	case nil:
+		sum = delta
+	case int64:
+		if d, ok := delta.(int64); ok {
+			sum = old + d
+		} else {
+			sum = float64(old) + delta.(float64)
+		}
+	case float64:
+		if d, ok := delta.(int64); ok {
+			sum = old + float64(d)
+		} else {
+			sum = old + delta.(float64)
+		}
+	default:
+		return nil, fmt.Errorf("value at key '%v' is not a number", key)
+	}
+	self.put(s, key, sum)
+	return sum, nil
+}
+
+func (self *Table) Len() int {
+	n := 0
+	for i := range self.shards {
+		s := &self.shards[i]
+		s.mu.RLock()
+		n += len(s.m)
+		s.mu.RUnlock()
+	}
+	return n
+}
+
+// Snapshot copies the contents, shard by shard.
+func (self *Table) Snapshot() map[interface{}]interface{} {
+	m := map[interface{}]interface{}{}
+	for i := range self.shards {
+		s := &self.shards[i]
+		s.mu.RLock()
+		for k, e := range s.m {
+			m[k] = e.val
+		}
+		s.mu.RUnlock()
+	}
+	return m
+}
+
+func (self *Table) Clear() {
+	for i := range self.shards {
+		s := &self.shards[i]
+		s.mu.Lock()
+		s.m = map[interface{}]entry{}
+		s.mu.Unlock()
+	}
+}
+
+/* atomic */
+
+func (self *Atomic) Name() string          { return self.name }
+func (self *Atomic) Load() int64           { return atomic.LoadInt64(&self.val) }
+func (self *Atomic) Store(v int64)         { atomic.StoreInt64(&self.val, v) }
+func (self *Atomic) Add(delta int64) int64 { return atomic.AddInt64(&self.val, delta) }
+func (self *Atomic) CompareAndSwap(old, new int64) bool {
+	return atomic.CompareAndSwapInt64(&self.val, old, new)
+}
+
+/* mutex */
+
+var errNotLocked = errors.New("mutex not locked")
+
+func (self *Mutex) Name() string { return self.name }
+
+func (self *Mutex) Lock() {
+	self.mu.Lock()
+	atomic.StoreInt32(&self.locked, 1)
+}
+
+// Unlock returns an error, instead of crashing the process like
+// sync.Mutex does, if the mutex is not locked.
+func (self *Mutex) Unlock() error {
+	if !atomic.CompareAndSwapInt32(&self.locked, 1, 0) {
+		return errNotLocked
+	}
+	self.mu.Unlock()
+	return nil
+}
+
+func (self *Mutex) TryLock() bool {
+	if !self.mu.TryLock() {
+		return false
+	}
+	atomic.StoreInt32(&self.locked, 1)
+	return true
+}
@@ -0,0 +1,222 @@
+package tablelib
+
+import (
+	. "luago/api"
+	"luago/auxlib"
+	"math"
+)
+
+var tabFuncs = map[string]GoFunction{
+	"concat": tabConcat,
+	"insert": tabInsert,
+	"move":   tabMove,
+	"pack":   tabPack,
+	"remove": tabRemove,
+	"sort":   tabSort,
+	"unpack": tabUnpack,
+}
+
+// OpenTableLib returns the table table.
+// http://www.lua.org/manual/5.3/manual.html#6.6
+func OpenTableLib(ls LuaState) int {
+	ls.CreateTable(0, len(tabFuncs))
+	for name, f := range tabFuncs {
+		ls.PushGoFunction(f)
+		ls.SetField(-2, name)
+	}
+	return 1
+}
+
+/* operations that an object must define to mimic a table */
+const (
+	TAB_R  = 1               /* read */
+	TAB_W  = 2               /* write */
+	TAB_L  = 4               /* length */
+	TAB_RW = (TAB_R | TAB_W) /* read/write */
+)
+
+// table.insert (list, [pos,] value)
+// http://www.lua.org/manual/5.3/manual.html#pdf-table.insert
+func tabInsert(ls LuaState) int {
+	e := auxGetN(ls, 1, TAB_RW) + 1 /* first empty element */
+	var pos int64                             /* where to insert new element */
+	switch ls.GetTop() {
+	case 2: /* called with only 2 arguments */
+		pos = e /* insert new element at the end */
+	case 3:
+		pos = auxlib.CheckInteger(ls, 2) /* 2nd argument is the position */
+		/* check whether 'pos' is in [1, e] */
+		if uint64(pos)-1 >= uint64(e) {
+			auxlib.ArgError(ls, 2, "position out of bounds")
+		}
+		for i := e; i > pos; i-- { /* move up elements */
+			ls.GetI(1, i-1)
+			ls.SetI(1, i) /* t[i] = t[i - 1] */
+		}
+	default:
+		auxlib.Error(ls, "wrong number of arguments to 'insert'")
+	}
+	ls.SetI(1, pos) /* t[pos] = v */
+	return 0
+}
+
+// table.remove (list [, pos])
+// http://www.lua.org/manual/5.3/manual.html#pdf-table.remove
+func tabRemove(ls LuaState) int {
+	size := auxGetN(ls, 1, TAB_RW)
+	pos := auxlib.OptInteger(ls, 2, size)
+	if pos != size { /* validate 'pos' if given */
+		/* check whether 'pos' is in [1, size + 1] */
+		if uint64(pos)-1 > uint64(size) {
+			auxlib.ArgError(ls, 1, "position out of bounds")
+		}
+	}
+	ls.GetI(1, pos) /* result = t[pos] */
+	for ; pos < size; pos++ {
+		ls.GetI(1, pos+1)
+		ls.SetI(1, pos) /* t[pos] = t[pos + 1] */
+	}
+	ls.PushNil()
+	ls.SetI(1, pos) /* remove entry t[pos] */
+	return 1
+}
+
+// table.move (a1, f, e, t [,a2])
+// http://www.lua.org/manual/5.3/manual.html#pdf-table.move
+func tabMove(ls LuaState) int {
+	f := auxlib.CheckInteger(ls, 2)
+	e := auxlib.CheckInteger(ls, 3)
+	t := auxlib.CheckInteger(ls, 4)
+	tt := 1 /* destination table */
+	if !ls.IsNoneOrNil(5) {
+		tt = 5
+	}
+	checkTab(ls, 1, TAB_R)
+	checkTab(ls, tt, TAB_W)
+	if e >= f { /* otherwise, nothing to move */
+		if !(f > 0 || e < math.MaxInt64+f) {
+			auxlib.ArgError(ls, 3, "too many elements to move")
+		}
+		n := e - f /* number of elements minus 1 (avoid overflows) */
+		if t > math.MaxInt64-n {
+			auxlib.ArgError(ls, 4, "destination wrap around")
+		}
+		if t > e || t <= f || (tt != 1 && !ls.Compare(1, tt, LUA_OPEQ)) {
+			for i := int64(0); i <= n; i++ {
+				ls.GetI(1, f+i)
+				ls.SetI(tt, t+i)
+			}
+		} else {
+			for i := n; i >= 0; i-- {
+				ls.GetI(1, f+i)
+				ls.SetI(tt, t+i)
+			}
+		}
+	}
+	ls.PushValue(tt) /* return destination table */
+	return 1
+}
+
+// table.concat (list [, sep [, i [, j]]])
+// http://www.lua.org/manual/5.3/manual.html#pdf-table.concat
+func tabConcat(ls LuaState) int {
+	last := auxGetN(ls, 1, TAB_R|TAB_L)
+	sep := ""
+	if !ls.IsNoneOrNil(2) {
+		sep = auxlib.CheckString(ls, 2)
+	}
+	i := auxlib.OptInteger(ls, 3, 1)
+	last = auxlib.OptInteger(ls, 4, last)
+
+	var b auxlib.Buffer
+	b.Init(ls)
+	for ; i <= last; i++ {
+		if ls.GetI(1, i); !ls.IsString(-1) {
+			auxlib.Error(ls, "invalid value (at index %d) in table for 'concat'", i)
+		}
+		b.AddValue()
+		if i != last { /* add a separator between the elements */
+			b.AddString(sep)
+		}
+	}
+	b.PushResult()
+	return 1
+}
+
+// table.pack (···)
+// http://www.lua.org/manual/5.3/manual.html#pdf-table.pack
+func tabPack(ls LuaState) int {
+	n := ls.GetTop()          /* number of elements to pack */
+	ls.CreateTable(n, 1)      /* create result table */
+	ls.Insert(1)              /* put it at index 1 */
+	for i := n; i >= 1; i-- { /* assign elements */
+		ls.SetI(1, int64(i))
+	}
+	ls.PushInteger(int64(n))
+	ls.SetField(1, "n") /* t.n = number of elements */
+	return 1            /* return table */
+}
+
+// table.unpack (list [, i [, j]])
+// http://www.lua.org/manual/5.3/manual.html#pdf-table.unpack
+func tabUnpack(ls LuaState) int {
+	i := auxlib.OptInteger(ls, 2, 1)
+	var e int64
+	if ls.IsNoneOrNil(3) {
+		e = lenOf(ls, 1)
+	} else {
+		e = auxlib.CheckInteger(ls, 3)
+	}
+	if i > e {
+		return 0 /* empty range */
+	}
+	n := uint64(e) - uint64(i) /* number of elements minus 1 (avoid overflows) */
+	if n >= math.MaxInt32 || !ls.CheckStack(int(n+1)) {
+		auxlib.Error(ls, "too many results to unpack")
+	}
+	for ; i < e; i++ { /* push arg[i..e - 1] (to avoid overflows) */
+		ls.GetI(1, i)
+	}
+	ls.GetI(1, e) /* push last element */
+	return int(n + 1)
+}
+
+/* helpers */
+
+// checks that arg is a table or behaves like one for the operations
+// in what, then returns its length if TAB_L is asked for
+func auxGetN(ls LuaState, arg, what int) int64 {
+	checkTab(ls, arg, what|TAB_L)
+	return lenOf(ls, arg)
+}
+
+func checkTab(ls LuaState, arg, what int) {
+	if ls.Type(arg) == LUA_TTABLE {
+		return
+	}
+	n := 1                     /* number of elements to pop */
+	if ls.GetMetatable(arg) && /* must have metatable */
+		(what&TAB_R == 0 || checkField(ls, "__index", &n)) &&
+		(what&TAB_W == 0 || checkField(ls, "__newindex", &n)) &&
+		(what&TAB_L == 0 || checkField(ls, "__len", &n)) {
+		ls.Pop(n) /* pop metatable and tested metamethods */
+		return
+	}
+	auxlib.TypeError(ls, arg, "table")
+}
+
+func checkField(ls LuaState, key string, n *int) bool {
+	*n++
+	return ls.GetField(-*n+1, key) != LUA_TNIL
+}
+
+// the length of the value at idx, like luaL_len
+func lenOf(ls LuaState, idx int) int64 {
+	ls.Len(idx)
+	n, ok := ls.ToIntegerX(-1)
+	if !ok || !ls.IsInteger(-1) {
+		auxlib.Error(ls, "object length is not an integer")
+	}
+	ls.Pop(1)
+	return n
+}
@@ -0,0 +1,156 @@
+package tablelib
+
+import (
+	. "luago/api"
+	"luago/auxlib"
+	"math"
+	"time"
+)
+
+/* table.sort, the quicksort of ltablib.c */
+
+const RANLIMIT = 100 /* intervals larger than this may use a random pivot */
+
+// table.sort (list [, comp])
+// http://www.lua.org/manual/5.3/manual.html#pdf-table.sort
+func tabSort(ls LuaState) int {
+	n := auxGetN(ls, 1, TAB_RW)
+	if n > 1 { /* non-trivial interval? */
+		if n >= math.MaxInt32 {
+			auxlib.ArgError(ls, 1, "array too big")
+		}
+		if !ls.IsNoneOrNil(2) && ls.Type(2) != LUA_TFUNCTION { /* must be a function */
+			auxlib.TypeError(ls, 2, "function")
+		}
+		ls.SetTop(2) /* make sure there are two arguments */
+		auxSort(ls, 1, n, 0)
+	}
+	return 0
+}
+
+// does the value at a sort before the one at b?
+func sortComp(ls LuaState, a, b int) bool {
+	if ls.IsNil(2) { /* no function? */
+		return ls.Compare(a, b, LUA_OPLT) /* a < b */
+	}
+	ls.PushValue(2)     /* push function */
+	ls.PushValue(a - 1) /* -1 to compensate function */
+	ls.PushValue(b - 2) /* -2 to compensate function and 'a' */
+	ls.Call(2, 1)       /* call function */
+	res := ls.ToBoolean(-1)
+	ls.Pop(1)
+	return res
+}
+
+// t[i] = top value, t[j] = the one below it; pops both
+func set2(ls LuaState, i, j int64) {
+	ls.SetI(1, i)
+	ls.SetI(1, j)
+}
+
+// partitions a[lo .. up] around the pivot P on the top of the stack
+// (also in a[up - 1]), returns its final position
+func partition(ls LuaState, lo, up int64) int64 {
+	i := lo     /* will be incremented before first use */
+	j := up - 1 /* will be decremented before first use */
+	/* loop invariant: a[lo .. i] <= P <= a[j .. up], a[up - 1] == P */
+	for {
+		/* next loop: repeat ++i while a[i] < P */
+		for {
+			i++
+			ls.GetI(1, i)
+			if !sortComp(ls, -1, -2) {
+				break
+			}
+			if i == up-1 { /* a[i] < P  but a[up - 1] == P  ?? */
+				auxlib.Error(ls, "invalid order function for sorting")
+			}
+			ls.Pop(1) /* remove a[i] */
+		}
+		/* after the loop, a[i] >= P and a[lo .. i - 1] < P */
+		/* next loop: repeat --j while P < a[j] */
+		for {
+			j--
+			ls.GetI(1, j)
+			if !sortComp(ls, -3, -1) {
+				break
+			}
+			if j < i { /* j < i  but  a[j] > P ?? */
+				auxlib.Error(ls, "invalid order function for sorting")
+			}
+			ls.Pop(1) /* remove a[j] */
+		}
+		/* after the loop, a[j] <= P and a[j + 1 .. up] >= P */
+		if j < i { /* no elements to be exchanged? */
+			ls.Pop(1) /* pop a[j] */
+			/* swap pivot (a[up - 1]) with a[i] to satisfy pred.: a[i] == P */
+			set2(ls, up-1, i)
+			return i
+		}
+		/* otherwise, swap a[i] - a[j] to restore invariant and repeat */
+		set2(ls, i, j)
+	}
+}
+
+// a random pivot in the middle half of [lo, up]
+func choosePivot(lo, up int64, rnd uint64) int64 {
+	r4 := (up - lo) / 4 /* range/4 */
+	return int64(rnd%uint64(r4*2)) + (lo + r4)
+}
+
+func auxSort(ls LuaState, lo, up int64, rnd uint64) {
+	for lo < up { /* loop for tail recursion */
+		/* sort elements 'lo', 'p', and 'up' */
+		ls.GetI(1, lo)
+		ls.GetI(1, up)
+		if sortComp(ls, -1, -2) { /* a[up] < a[lo]? */
+			set2(ls, lo, up) /* swap a[lo] - a[up] */
+		} else {
+			ls.Pop(2) /* remove both values */
+		}
+		if up-lo == 1 { /* only 2 elements? */
+			break /* already sorted */
+		}
+		var p int64                       /* pivot index */
+		if up-lo < RANLIMIT || rnd == 0 { /* small interval or no randomize? */
+			p = (lo + up) / 2 /* middle element is a good pivot */
+		} else { /* for larger intervals, it is expensive to solve worst case */
+			p = choosePivot(lo, up, rnd)
+		}
+		ls.GetI(1, p)
+		ls.GetI(1, lo)
+		if sortComp(ls, -2, -1) { /* a[p] < a[lo]? */
+			set2(ls, p, lo) /* swap a[p] - a[lo] */
+		} else {
+			ls.Pop(1) /* remove second element */
+			ls.GetI(1, up)
+			if sortComp(ls, -1, -2) { /* a[up] < a[p]? */
+				set2(ls, p, up) /* swap up - p */
+			} else {
+				ls.Pop(2) /* clean stack */
+			}
+		}
+		if up-lo == 2 { /* only 3 elements? */
+			break /* already sorted */
+		}
+		ls.GetI(1, p)     /* get median (pivot) */
+		ls.PushValue(-1)  /* push pivot */
+		ls.GetI(1, up-1)  /* push a[up - 1] */
+		set2(ls, p, up-1) /* a[p] = a[up - 1]; a[up - 1] = a[p] */
+		p = partition(ls, lo, up)
+		var n int64 /* size of the smaller interval */
+		/* a[lo .. p - 1] <= a[p] == P <= a[p + 1 .. up] */
+		if p-lo < up-p { /* lower interval is shorter? */
+			auxSort(ls, lo, p-1, rnd) /* call recursively for lower interval */
+			n = p - lo
+			lo = p + 1 /* tail call for [p + 1 .. up] (upper interval) */
+		} else {
+			auxSort(ls, p+1, up, rnd) /* call recursively for upper interval */
+			n = up - p
+			up = p - 1 /* tail call for [lo .. p - 1]  (lower interval) */
+		}
+		if (up-lo)/128 > n { /* partition too imbalanced? */
+			rnd = uint64(time.Now().UnixNano()) /* try a new randomization */
+		}
+	}
+}
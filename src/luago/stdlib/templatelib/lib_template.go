@@ -0,0 +1,152 @@
+package templatelib
+
+import (
+	. "luago/api"
+	"luago/auxlib"
+	"strings"
+)
+
+/*
+etlua 风格的模板：
+
+	<% code %>      执行 Lua 代码
+	<%= exp %>      输出 HTML 转义后的值
+	<%- exp %>      输出原始值
+	-%>             结束标签并吞掉其后的换行
+
+模板中的全局变量先在 env 中查找，再在全局表中查找。
+render 每次都重新编译模板；要反复渲染同一个模板时，用 compile 得到的函数：
+
+	local page = template.compile(source)
+	page({ title = "a" })
+	page({ title = "b" })
+*/
+var templateFuncs = map[string]GoFunction{
+	"compile": tplCompile,
+	"render":  tplRender,
+	"escape":  tplEscape,
+}
+
+func OpenTemplateLib(ls LuaState) int {
+	ls.CreateTable(0, len(templateFuncs))
+	for name, f := range templateFuncs {
+		ls.PushGoFunction(f)
+		ls.SetField(-2, name)
+	}
+	return 1
+}
+
+// template.compile (source [, chunkname])
+// returns a function (env) that renders the template to a string
+func tplCompile(ls LuaState) int {
+	pushCompiled(ls, auxlib.CheckString(ls, 1), chunkName(ls, 2))
+	ls.PushGoClosure(renderCompiled, 1)
+	return 1
+}
+
+func renderCompiled(ls LuaState) int {
+	ls.PushString(render(ls, LuaUpvalueIndex(1), 1))
+	return 1
+}
+
+// template.render (source [, env [, chunkname]])
+func tplRender(ls LuaState) int {
+	pushCompiled(ls, auxlib.CheckString(ls, 1), chunkName(ls, 3))
+	ls.PushString(render(ls, -1, 2))
+	return 1
+}
+
+// template.escape (s)
+func tplEscape(ls LuaState) int {
+	ls.PushString(escapeHTML(toString(ls, 1)))
+	return 1
+}
+
+func chunkName(ls LuaState, idx int) string {
+	return auxlib.OptString(ls, idx, "=template")
+}
+
+// pushCompiled pushes the compiled chunk of the template
+func pushCompiled(ls LuaState, source, chunkName string) {
+	code, err := translate(source)
+	if err != nil {
+		ls.PushString(chunkName + ":" + err.Error())
+		ls.Error()
+	}
+	if ls.Load([]byte(code), chunkName, "t") != LUA_OK {
+		ls.Error()
+	}
+}
+
+// render runs the compiled template at fnIdx with the env table at
+// envIdx (may be nil) and returns the output
+func render(ls LuaState, fnIdx, envIdx int) string {
+	fnIdx = ls.AbsIndex(fnIdx)
+	envIdx = ls.AbsIndex(envIdx)
+
+	var out strings.Builder
+	ls.PushValue(fnIdx)
+	pushEnv(ls, envIdx)
+	ls.PushGoFunction(func(ls LuaState) int {
+		out.WriteString(toString(ls, 1))
+		return 0
+	})
+	ls.PushGoFunction(tplEscape)
+	ls.Call(3, 0)
+	return out.String()
+}
+
+// pushEnv pushes a fresh table whose missing fields are looked up in
+// env first and in the global table then
+func pushEnv(ls LuaState, envIdx int) {
+	ls.NewTable() /* env proxy, assignments stay local to the render */
+	ls.CreateTable(0, 1)
+	if ls.IsTable(envIdx) {
+		ls.PushValue(envIdx)
+	} else {
+		ls.NewTable()
+	}
+	ls.PushGoClosure(envIndex, 1)
+	ls.SetField(-2, "__index")
+	ls.SetMetatable(-2)
+}
+
+func envIndex(ls LuaState) int {
+	ls.PushValue(2)
+	if ls.GetTable(LuaUpvalueIndex(1)) != LUA_TNIL {
+		return 1
+	}
+	ls.PushGlobalTable()
+	ls.PushValue(2)
+	ls.GetTable(-2)
+	return 1
+}
+
+func toString(ls LuaState, idx int) string {
+	switch ls.Type(idx) {
+	case LUA_TNONE, LUA_TNIL:
+		return ""
+	case LUA_TBOOLEAN:
+		if ls.ToBoolean(idx) {
+			return "true"
+		}
+		return "false"
+	default:
+		if s, ok := ls.ToStringX(idx); ok {
+			return s
+		}
+		return ls.TypeName(ls.Type(idx))
+	}
+}
+
+var htmlEscaper = strings.NewReplacer(
+	"&", "&amp;",
+	"<", "&lt;",
+	">", "&gt;",
+	`"`, "&quot;",
+	"'", "&#39;",
+)
+
+func escapeHTML(s string) string {
+	return htmlEscaper.Replace(s)
+}
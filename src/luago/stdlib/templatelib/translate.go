@@ -0,0 +1,108 @@
+package templatelib
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+/*
+translate 把模板翻译成 Lua 代码：
+
+	local _ENV, _put, _esc = ...
+	_put("text") <code> _put(_esc(exp)) _put(exp) ...
+
+每段代码前插入换行，使编译错误的行号与模板行号一致。
+*/
+func translate(source string) (string, error) {
+	var buf bytes.Buffer
+	buf.WriteString("local _ENV, _put, _esc = ...;")
+
+	line := 1 /* line of source the generated code is at */
+	pos := 0
+	for pos < len(source) {
+		start := strings.Index(source[pos:], "<%")
+		if start < 0 {
+			writeText(&buf, source[pos:])
+			break
+		}
+		start += pos
+		writeText(&buf, source[pos:start])
+
+		end := strings.Index(source[start:], "%>")
+		if end < 0 {
+			return "", fmt.Errorf("%d: unclosed tag", lineAt(source, start))
+		}
+		end += start
+
+		/* keep generated lines in step with the template */
+		for target := lineAt(source, start); line < target; line++ {
+			buf.WriteByte('\n')
+		}
+
+		tag := source[start+2 : end]
+		trim := strings.HasSuffix(tag, "-")
+		if trim {
+			tag = tag[:len(tag)-1]
+		}
+		switch {
+		case strings.HasPrefix(tag, "="):
+			fmt.Fprintf(&buf, "_put(_esc(%s));", tag[1:])
+		case strings.HasPrefix(tag, "-"):
+			fmt.Fprintf(&buf, "_put(%s);", tag[1:])
+		default:
+			fmt.Fprintf(&buf, "%s\n;", tag) /* newline ends a trailing comment */
+		}
+		line += strings.Count(tag, "\n")
+		if !strings.HasPrefix(tag, "=") && !strings.HasPrefix(tag, "-") {
+			line++
+		}
+
+		pos = end + 2
+		if trim {
+			if strings.HasPrefix(source[pos:], "\r\n") {
+				pos += 2
+			} else if pos < len(source) && source[pos] == '\n' {
+				pos++
+			}
+		}
+	}
+	return buf.String(), nil
+}
+
+func lineAt(source string, pos int) int {
+	return strings.Count(source[:pos], "\n") + 1
+}
+
+func writeText(buf *bytes.Buffer, text string) {
+	if text != "" {
+		fmt.Fprintf(buf, "_put(%s);", quote(text))
+	}
+}
+
+// quote renders s as a Lua short string literal
+func quote(s string) string {
+	var buf bytes.Buffer
+	buf.WriteByte('"')
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '"', '\\':
+			buf.WriteByte('\\')
+			buf.WriteByte(c)
+		case '\n':
+			buf.WriteString(`\n`)
+		case '\r':
+			buf.WriteString(`\r`)
+		case '\t':
+			buf.WriteString(`\t`)
+		default:
+			if c < ' ' || c == 0x7f {
+				fmt.Fprintf(&buf, `\%03d`, c)
+			} else {
+				buf.WriteByte(c)
+			}
+		}
+	}
+	buf.WriteByte('"')
+	return buf.String()
+}
@@ -0,0 +1,673 @@
+package tomllib
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+/*
+TOML 解码：文档 -> map[string]interface{}
+值类型：string, int64, float64, bool, []interface{}, map[string]interface{}；
+日期时间按原文保存为字符串。
+strict 模式下重复的键、数组元素类型不一致都是错误；
+非严格模式下后出现的键覆盖先出现的。
+*/
+type decoder struct {
+	src    string
+	pos    int
+	line   int
+	strict bool
+
+	root    map[string]interface{}
+	current map[string]interface{}
+	defined map[string]bool // tables created by a [header]
+}
+
+type decodeError struct {
+	line int
+	msg  string
+}
+
+func (self *decodeError) Error() string {
+	return fmt.Sprintf("line %d: %s", self.line, self.msg)
+}
+
+func Decode(src string, strict bool) (result map[string]interface{}, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			if e, ok := r.(*decodeError); ok {
+				err = e
+			} else {
+				panic(r)
+			}
+		}
+	}()
+
+	root := map[string]interface{}{}
+	d := &decoder{
+		src:     src,
+		line:    1,
+		strict:  strict,
+		root:    root,
+		current: root,
+		defined: map[string]bool{},
+	}
+	d.parse()
+	return root, nil
+}
+
+func (self *decoder) error(f string, a ...interface{}) {
+	panic(&decodeError{self.line, fmt.Sprintf(f, a...)})
+}
+
+/* scanning */
+
+func (self *decoder) eof() bool {
+	return self.pos >= len(self.src)
+}
+
+func (self *decoder) peek() byte {
+	if self.eof() {
+		return 0
+	}
+	return self.src[self.pos]
+}
+
+func (self *decoder) hasPrefix(s string) bool {
+	return strings.HasPrefix(self.src[self.pos:], s)
+}
+
+func (self *decoder) next() byte {
+	c := self.src[self.pos]
+	self.pos++
+	if c == '\n' {
+		self.line++
+	}
+	return c
+}
+
+func (self *decoder) expect(c byte) {
+	if self.peek() != c {
+		self.error("expected '%c', found %s", c, self.describe())
+	}
+	self.next()
+}
+
+func (self *decoder) describe() string {
+	if self.eof() {
+		return "end of input"
+	}
+	r, _ := utf8.DecodeRuneInString(self.src[self.pos:])
+	return strconv.QuoteRune(r)
+}
+
+// skips spaces and tabs
+func (self *decoder) skipSpaces() {
+	for c := self.peek(); c == ' ' || c == '\t'; c = self.peek() {
+		self.next()
+	}
+}
+
+func (self *decoder) skipComment() {
+	if self.peek() == '#' {
+		for !self.eof() && self.peek() != '\n' {
+			self.next()
+		}
+	}
+}
+
+// skips whitespace, newlines and comments (inside arrays)
+func (self *decoder) skipBlank() {
+	for {
+		self.skipSpaces()
+		self.skipComment()
+		if c := self.peek(); c == '\n' || c == '\r' {
+			self.next()
+		} else {
+			return
+		}
+	}
+}
+
+func (self *decoder) endOfLine() {
+	self.skipSpaces()
+	self.skipComment()
+	if self.hasPrefix("\r\n") {
+		self.next()
+	}
+	if !self.eof() {
+		if self.peek() != '\n' {
+			self.error("unexpected %s at end of line", self.describe())
+		}
+		self.next()
+	}
+}
+
+/* document */
+
+func (self *decoder) parse() {
+	for {
+		self.skipBlank()
+		if self.eof() {
+			return
+		}
+		switch {
+		case self.hasPrefix("[["):
+			self.pos += 2
+			self.parseArrayTable()
+		case self.peek() == '[':
+			self.next()
+			self.parseTable()
+		default:
+			self.parseKeyValue(self.current)
+		}
+		self.endOfLine()
+	}
+}
+
+// [a.b.c]
+func (self *decoder) parseTable() {
+	keys := self.parseKey()
+	self.skipSpaces()
+	self.expect(']')
+
+	path := strings.Join(keys, "\x00")
+	if self.defined[path] && self.strict {
+		self.error("duplicate table [%s]", strings.Join(keys, "."))
+	}
+	self.defined[path] = true
+	self.current = self.descend(self.root, keys, true)
+}
+
+// [[a.b.c]]
+func (self *decoder) parseArrayTable() {
+	keys := self.parseKey()
+	self.skipSpaces()
+	self.expect(']')
+	self.expect(']')
+
+	parent := self.descend(self.root, keys[:len(keys)-1], true)
+	last := keys[len(keys)-1]
+	tbl := map[string]interface{}{}
+	switch x := parent[last].(type) {
+	case nil:
+		parent[last] = []interface{}{tbl}
+	case []interface{}:
+		parent[last] = append(x, tbl)
+	default:
+		self.error("key '%s' is not an array of tables", last)
+	}
+	self.current = tbl
+}
+
+// descend walks (and creates) the tables along keys. Through arrays of
+// tables it walks into the last element.
+func (self *decoder) descend(tbl map[string]interface{}, keys []string, header bool) map[string]interface{} {
+	for _, key := range keys {
+		switch x := tbl[key].(type) {
+		case nil:
+			sub := map[string]interface{}{}
+			tbl[key] = sub
+			tbl = sub
+		case map[string]interface{}:
+			tbl = x
+		case []interface{}:
+			if len(x) == 0 {
+				self.error("key '%s' is not a table", key)
+			}
+			sub, ok := x[len(x)-1].(map[string]interface{})
+			if !ok || !header {
+				self.error("key '%s' is not a table", key)
+			}
+			tbl = sub
+		default:
+			self.error("key '%s' is not a table", key)
+		}
+	}
+	return tbl
+}
+
+// key = value
+func (self *decoder) parseKeyValue(tbl map[string]interface{}) {
+	keys := self.parseKey()
+	self.skipSpaces()
+	self.expect('=')
+	self.skipSpaces()
+	val := self.parseValue()
+
+	tbl = self.descend(tbl, keys[:len(keys)-1], false)
+	last := keys[len(keys)-1]
+	if _, found := tbl[last]; found && self.strict {
+		self.error("duplicate key '%s'", strings.Join(keys, "."))
+	}
+	tbl[last] = val
+}
+
+// dotted key: a."b c".d
+func (self *decoder) parseKey() []string {
+	var keys []string
+	for {
+		self.skipSpaces()
+		switch c := self.peek(); {
+		case c == '"':
+			keys = append(keys, self.parseBasicString())
+		case c == '\'':
+			keys = append(keys, self.parseLiteralString())
+		case isBareKeyChar(c):
+			start := self.pos
+			for isBareKeyChar(self.peek()) {
+				self.next()
+			}
+			keys = append(keys, self.src[start:self.pos])
+		default:
+			self.error("expected key, found %s", self.describe())
+		}
+		self.skipSpaces()
+		if self.peek() != '.' {
+			return keys
+		}
+		self.next()
+	}
+}
+
+func isBareKeyChar(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' ||
+		c >= '0' && c <= '9' || c == '_' || c == '-'
+}
+
+/* values */
+
+func (self *decoder) parseValue() interface{} {
+	switch c := self.peek(); {
+	case self.hasPrefix(`"""`):
+		return self.parseMultilineBasicString()
+	case self.hasPrefix("'''"):
+		return self.parseMultilineLiteralString()
+	case c == '"':
+		return self.parseBasicString()
+	case c == '\'':
+		return self.parseLiteralString()
+	case c == '[':
+		return self.parseArray()
+	case c == '{':
+		return self.parseInlineTable()
+	case self.hasPrefix("true"):
+		self.pos += 4
+		return true
+	case self.hasPrefix("false"):
+		self.pos += 5
+		return false
+	default:
+		return self.parseNumberOrDate()
+	}
+}
+
+func (self *decoder) parseArray() []interface{} {
+	self.expect('[')
+	arr := []interface{}{}
+	for {
+		self.skipBlank()
+		if self.peek() == ']' {
+			self.next()
+			return arr
+		}
+		val := self.parseValue()
+		if self.strict && len(arr) > 0 && typeName(arr[0]) != typeName(val) {
+			self.error("mixed types in array (%s and %s)", typeName(arr[0]), typeName(val))
+		}
+		arr = append(arr, val)
+		self.skipBlank()
+		if self.peek() == ',' {
+			self.next()
+		} else if self.peek() != ']' {
+			self.error("expected ',' or ']' in array, found %s", self.describe())
+		}
+	}
+}
+
+func (self *decoder) parseInlineTable() map[string]interface{} {
+	self.expect('{')
+	tbl := map[string]interface{}{}
+	self.skipSpaces()
+	if self.peek() == '}' {
+		self.next()
+		return tbl
+	}
+	for {
+		strict := self.strict
+		self.strict = true /* duplicate keys are never allowed inline */
+		self.parseKeyValue(tbl)
+		self.strict = strict
+		self.skipSpaces()
+		switch self.peek() {
+		case ',':
+			self.next()
+		case '}':
+			self.next()
+			return tbl
+		default:
+			self.error("expected ',' or '}' in inline table, found %s", self.describe())
+		}
+	}
+}
+
+func typeName(v interface{}) string {
+	switch v.(type) {
+	case string:
+		return "string"
+	case int64:
+		return "integer"
+	case float64:
+		return "float"
+	case bool:
+		return "boolean"
+	case []interface{}:
+		return "array"
+	default:
+		return "table"
+	}
+}
+
+/* strings */
+
+func (self *decoder) parseBasicString() string {
+	self.expect('"')
+	var buf strings.Builder
+	for {
+		if self.eof() || self.peek() == '\n' {
+			self.error("unfinished string")
+		}
+		c := self.next()
+		switch c {
+		case '"':
+			return buf.String()
+		case '\\':
+			self.parseEscape(&buf)
+		default:
+			buf.WriteByte(c)
+		}
+	}
+}
+
+func (self *decoder) parseMultilineBasicString() string {
+	self.pos += 3
+	self.skipNewline()
+	var buf strings.Builder
+	for {
+		if self.eof() {
+			self.error("unfinished string")
+		}
+		if self.hasPrefix(`"""`) {
+			n := 3 /* up to two quotes may precede the delimiter */
+			for n < 5 && self.pos+n < len(self.src) && self.src[self.pos+n] == '"' {
+				n++
+			}
+			buf.WriteString(self.src[self.pos+3 : self.pos+n])
+			self.pos += n
+			return buf.String()
+		}
+		c := self.next()
+		if c != '\\' {
+			buf.WriteByte(c)
+			continue
+		}
+		/* line ending backslash trims the following whitespace */
+		save := self.pos
+		self.skipSpaces()
+		if c := self.peek(); c == '\n' || c == '\r' {
+			for c := self.peek(); c == ' ' || c == '\t' || c == '\n' || c == '\r'; c = self.peek() {
+				self.next()
+			}
+		} else {
+			self.pos = save
+			self.parseEscape(&buf)
+		}
+	}
+}
+
+func (self *decoder) parseLiteralString() string {
+	self.expect('\'')
+	start := self.pos
+	for self.peek() != '\'' {
+		if self.eof() || self.peek() == '\n' {
+			self.error("unfinished string")
+		}
+		self.next()
+	}
+	s := self.src[start:self.pos]
+	self.next()
+	return s
+}
+
+func (self *decoder) parseMultilineLiteralString() string {
+	self.pos += 3
+	self.skipNewline()
+	start := self.pos
+	for !self.hasPrefix("'''") {
+		if self.eof() {
+			self.error("unfinished string")
+		}
+		self.next()
+	}
+	n := 3 /* up to two quotes may precede the delimiter */
+	for n < 5 && self.pos+n < len(self.src) && self.src[self.pos+n] == '\'' {
+		n++
+	}
+	s := self.src[start : self.pos+n-3]
+	self.pos += n
+	return s
+}
+
+func (self *decoder) skipNewline() {
+	if self.hasPrefix("\r\n") {
+		self.pos++
+	}
+	if self.peek() == '\n' {
+		self.next()
+	}
+}
+
+func (self *decoder) parseEscape(buf *strings.Builder) {
+	if self.eof() {
+		self.error("unfinished string")
+	}
+	switch c := self.next(); c {
+	case 'b':
+		buf.WriteByte('\b')
+	case 't':
+		buf.WriteByte('\t')
+	case 'n':
+		buf.WriteByte('\n')
+	case 'f':
+		buf.WriteByte('\f')
+	case 'r':
+		buf.WriteByte('\r')
+	case '"':
+		buf.WriteByte('"')
+	case '\\':
+		buf.WriteByte('\\')
+	case 'u', 'U':
+		n := 4
+		if c == 'U' {
+			n = 8
+		}
+		if self.pos+n > len(self.src) {
+			self.error("invalid unicode escape")
+		}
+		code, err := strconv.ParseUint(self.src[self.pos:self.pos+n], 16, 32)
+		if err != nil || !utf8.ValidRune(rune(code)) {
+			self.error("invalid unicode escape '\\%c%s'", c, self.src[self.pos:self.pos+n])
+		}
+		self.pos += n
+		buf.WriteRune(rune(code))
+	default:
+		self.error("invalid escape sequence '\\%c'", c)
+	}
+}
+
+/* numbers and dates */
+
+func (self *decoder) parseNumberOrDate() interface{} {
+	start := self.pos
+	for c := self.peek(); c != 0 && strings.IndexByte(" \t\r\n,]}#", c) < 0; c = self.peek() {
+		self.next()
+	}
+	/* local date and time may be separated by a single space */
+	if isDate(self.src[start:self.pos]) && self.peek() == ' ' &&
+		self.pos+1 < len(self.src) && isDigit(self.src[self.pos+1]) {
+		self.next()
+		for c := self.peek(); c != 0 && strings.IndexByte(" \t\r\n,]}#", c) < 0; c = self.peek() {
+			self.next()
+		}
+	}
+	token := self.src[start:self.pos]
+	if token == "" {
+		self.error("expected value, found %s", self.describe())
+	}
+
+	if isDate(token) || isTime(token) {
+		if !validDateTime(token) {
+			self.error("invalid date or time '%s'", token)
+		}
+		return token
+	}
+	v, err := parseInteger(token)
+	if err == nil {
+		return v
+	} else if err == strconv.ErrRange {
+		self.error("integer '%s' out of range", token)
+	}
+	if v, ok := parseFloat(token); ok {
+		return v
+	}
+	self.error("invalid value '%s'", token)
+	return nil
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+// 1979-05-27...
+func isDate(s string) bool {
+	return len(s) >= 10 && isDigit(s[0]) && isDigit(s[3]) && s[4] == '-' && s[7] == '-'
+}
+
+// 07:32:00...
+func isTime(s string) bool {
+	return len(s) >= 8 && isDigit(s[0]) && isDigit(s[1]) && s[2] == ':' && s[5] == ':'
+}
+
+// the fields of a date or time must also be in range (no 2023-02-30)
+func validDateTime(s string) bool {
+	if isDate(s) {
+		if _, err := time.Parse("2006-01-02", s[:10]); err != nil {
+			return false
+		}
+		if s = s[10:]; s == "" {
+			return true
+		}
+		if s[0] != 'T' && s[0] != 't' && s[0] != ' ' {
+			return false
+		}
+		s = s[1:]
+	}
+	if !isTime(s) {
+		return false
+	}
+	if _, err := time.Parse("15:04:05", s[:8]); err != nil {
+		return false
+	}
+	s = s[8:]
+	if strings.HasPrefix(s, ".") {
+		n := 1
+		for n < len(s) && isDigit(s[n]) {
+			n++
+		}
+		if n == 1 {
+			return false
+		}
+		s = s[n:]
+	}
+	switch {
+	case s == "" || s == "Z" || s == "z":
+		return true
+	case len(s) == 6 && (s[0] == '+' || s[0] == '-'):
+		_, err := time.Parse("-07:00", s)
+		return err == nil
+	}
+	return false
+}
+
+// parseInteger returns strconv.ErrRange for integers outside int64
+func parseInteger(s string) (int64, error) {
+	if !validUnderscores(s) {
+		return 0, strconv.ErrSyntax
+	}
+	s = strings.Replace(s, "_", "", -1)
+	base := 10
+	switch {
+	case strings.HasPrefix(s, "0x"):
+		base, s = 16, s[2:]
+	case strings.HasPrefix(s, "0o"):
+		base, s = 8, s[2:]
+	case strings.HasPrefix(s, "0b"):
+		base, s = 2, s[2:]
+	default:
+		digits := strings.TrimLeft(s, "+-")
+		if len(digits) > 1 && digits[0] == '0' {
+			return 0, strconv.ErrSyntax /* leading zeros are not allowed */
+		}
+	}
+	v, err := strconv.ParseInt(s, base, 64)
+	if err != nil {
+		return 0, err.(*strconv.NumError).Err
+	}
+	return v, nil
+}
+
+func parseFloat(s string) (float64, bool) {
+	switch strings.TrimLeft(s, "+-") {
+	case "inf":
+		if s[0] == '-' {
+			return math.Inf(-1), true
+		}
+		return math.Inf(1), true
+	case "nan":
+		return math.NaN(), true
+	}
+	if !validUnderscores(s) {
+		return 0, false
+	}
+	s = strings.Replace(s, "_", "", -1)
+	if digits := strings.TrimLeft(s, "+-"); len(digits) > 1 && digits[0] == '0' && isDigit(digits[1]) {
+		return 0, false /* leading zeros are not allowed */
+	}
+	if strings.ContainsAny(s, "xXpP") || strings.HasSuffix(s, ".") ||
+		strings.Contains(s, ".e") || strings.Contains(s, ".E") ||
+		strings.HasPrefix(strings.TrimLeft(s, "+-"), ".") {
+		return 0, false
+	}
+	v, err := strconv.ParseFloat(s, 64)
+	return v, err == nil
+}
+
+// underscores must be surrounded by digits
+func validUnderscores(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] == '_' {
+			if i == 0 || i == len(s)-1 || !isHexDigit(s[i-1]) || !isHexDigit(s[i+1]) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func isHexDigit(c byte) bool {
+	return isDigit(c) || c >= 'a' && c <= 'f' || c >= 'A' && c <= 'F'
+}
@@ -0,0 +1,195 @@
+package tomllib
+
+import (
+	"bytes"
+	"fmt"
+	"luago/api"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+/*
+TOML 编码：键按字典序输出，先输出普通键值，再输出子表 [a.b]
+和表数组 [[a.b]]。
+*/
+func Encode(doc map[string]interface{}) (string, error) {
+	var buf bytes.Buffer
+	if err := encodeTable(&buf, nil, doc); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+func encodeTable(buf *bytes.Buffer, path []string, tbl map[string]interface{}) error {
+	keys := sortedKeys(tbl)
+
+	/* plain key/values first, they belong to the current header */
+	for _, key := range keys {
+		val := tbl[key]
+		if isTable(val) || isArrayOfTables(val) {
+			continue
+		}
+		s, err := encodeValue(val)
+		if err != nil {
+			return fmt.Errorf("%s: %s", joinKeys(append(path, key)), err.Error())
+		}
+		fmt.Fprintf(buf, "%s = %s\n", quoteKey(key), s)
+	}
+
+	for _, key := range keys {
+		subPath := append(path[:len(path):len(path)], key)
+		switch val := tbl[key].(type) {
+		case map[string]interface{}:
+			fmt.Fprintf(buf, "\n[%s]\n", joinKeys(subPath))
+			if err := encodeTable(buf, subPath, val); err != nil {
+				return err
+			}
+		case []interface{}:
+			if !isArrayOfTables(val) {
+				continue
+			}
+			for _, elem := range val {
+				fmt.Fprintf(buf, "\n[[%s]]\n", joinKeys(subPath))
+				if err := encodeTable(buf, subPath, elem.(map[string]interface{})); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func encodeValue(v interface{}) (string, error) {
+	switch x := v.(type) {
+	case string:
+		return quoteString(x), nil
+	case bool:
+		return strconv.FormatBool(x), nil
+	case int64:
+		return strconv.FormatInt(x, 10), nil
+	case float64:
+		switch {
+		case math.IsInf(x, 1):
+			return "inf", nil
+		case math.IsInf(x, -1):
+			return "-inf", nil
+		case math.IsNaN(x):
+			return "nan", nil
+		}
+		s := strconv.FormatFloat(x, 'g', -1, 64)
+		if !strings.ContainsAny(s, ".eIn") {
+			s += ".0"
+		}
+		return s, nil
+	case []interface{}:
+		strs := make([]string, len(x))
+		for i, elem := range x {
+			s, err := encodeValue(elem)
+			if err != nil {
+				return "", err
+			}
+			strs[i] = s
+		}
+		return "[" + strings.Join(strs, ", ") + "]", nil
+	case map[string]interface{}: /* inside arrays */
+		var strs []string
+		for _, key := range sortedKeys(x) {
+			s, err := encodeValue(x[key])
+			if err != nil {
+				return "", err
+			}
+			strs = append(strs, quoteKey(key)+" = "+s)
+		}
+		return "{" + strings.Join(strs, ", ") + "}", nil
+	default:
+		return "", fmt.Errorf("cannot encode a %s", luaTypeName(v))
+	}
+}
+
+// the Lua type of a value with no TOML counterpart
+func luaTypeName(v interface{}) string {
+	switch v.(type) {
+	case nil: /* conv.ToGo turns Lua functions and threads into nil */
+		return "function"
+	case api.GoFunction:
+		return "function"
+	default:
+		return "userdata"
+	}
+}
+
+func isTable(v interface{}) bool {
+	_, ok := v.(map[string]interface{})
+	return ok
+}
+
+func isArrayOfTables(v interface{}) bool {
+	arr, ok := v.([]interface{})
+	if !ok || len(arr) == 0 {
+		return false
+	}
+	for _, elem := range arr {
+		if !isTable(elem) {
+			return false
+		}
+	}
+	return true
+}
+
+func sortedKeys(tbl map[string]interface{}) []string {
+	keys := make([]string, 0, len(tbl))
+	for key := range tbl {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func joinKeys(keys []string) string {
+	strs := make([]string, len(keys))
+	for i, key := range keys {
+		strs[i] = quoteKey(key)
+	}
+	return strings.Join(strs, ".")
+}
+
+func quoteKey(key string) string {
+	if key == "" {
+		return `""`
+	}
+	for i := 0; i < len(key); i++ {
+		if !isBareKeyChar(key[i]) {
+			return quoteString(key)
+		}
+	}
+	return key
+}
+
+func quoteString(s string) string {
+	var buf bytes.Buffer
+	buf.WriteByte('"')
+	for _, r := range s {
+		switch r {
+		case '"':
+			buf.WriteString(`\"`)
+		case '\\':
+			buf.WriteString(`\\`)
+		case '\n':
+			buf.WriteString(`\n`)
+		case '\r':
+			buf.WriteString(`\r`)
+		case '\t':
+			buf.WriteString(`\t`)
+		default:
+			if r < 0x20 || r == 0x7f {
+				fmt.Fprintf(&buf, `\u%04X`, r)
+			} else {
+				buf.WriteRune(r)
+			}
+		}
+	}
+	buf.WriteByte('"')
+	return buf.String()
+}
@@ -0,0 +1,52 @@
+package tomllib
+
+import (
+	. "luago/api"
+	"luago/conv"
+)
+
+var tomlFuncs = map[string]GoFunction{
+	"decode": tomlDecode,
+	"encode": tomlEncode,
+}
+
+func OpenTomlLib(ls LuaState) int {
+	ls.CreateTable(0, len(tomlFuncs))
+	for name, f := range tomlFuncs {
+		ls.PushGoFunction(f)
+		ls.SetField(-2, name)
+	}
+	return 1
+}
+
+// toml.decode (s [, strict])
+// strict defaults to true; returns the table or nil and an error message
+func tomlDecode(ls LuaState) int {
+	strict := ls.IsNoneOrNil(2) || ls.ToBoolean(2)
+	doc, err := Decode(ls.ToString(1), strict)
+	if err != nil {
+		ls.PushNil()
+		ls.PushString(err.Error())
+		return 2
+	}
+	conv.Push(ls, doc)
+	return 1
+}
+
+// toml.encode (t)
+func tomlEncode(ls LuaState) int {
+	doc, ok := conv.ToGo(ls, 1).(map[string]interface{})
+	if !ok {
+		ls.PushNil()
+		ls.PushString("toml document must be a table with string keys")
+		return 2
+	}
+	s, err := Encode(doc)
+	if err != nil {
+		ls.PushNil()
+		ls.PushString(err.Error())
+		return 2
+	}
+	ls.PushString(s)
+	return 1
+}
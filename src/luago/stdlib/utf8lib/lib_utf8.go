@@ -0,0 +1,270 @@
+package utf8lib
+
+import (
+	. "luago/api"
+	"luago/auxlib"
+)
+
+/*
+和 lutf8lib.c 一样自己解码，不用 unicode/utf8：Lua 5.3 接受代理对
+（surrogates），utf8.char 最多能编码 0x7FFFFFFF（6 个字节），出错的
+位置也要和 Lua 一致。
+
+	for p, c in utf8.codes("héllo") do print(p, c) end
+	print(utf8.len("héllo"))          -- 5
+	print(utf8.char(72, 233, 0x4E2D)) -- Hé中
+*/
+
+const MAXUNICODE = 0x10FFFF
+const MAXUTF = 0x7FFFFFFF
+
+/* pattern to match a single UTF-8 character */
+const UTF8PATT = "[\x00-\x7F\xC2-\xF4][\x80-\xBF]*"
+
+var utf8Funcs = map[string]GoFunction{
+	"offset":    byteOffset,
+	"codepoint": codepoint,
+	"char":      utfChar,
+	"len":       utfLen,
+	"codes":     iterCodes,
+}
+
+// OpenUtf8Lib returns the utf8 table.
+// http://www.lua.org/manual/5.3/manual.html#6.5
+func OpenUtf8Lib(ls LuaState) int {
+	ls.CreateTable(0, len(utf8Funcs)+1)
+	for name, f := range utf8Funcs {
+		ls.PushGoFunction(f)
+		ls.SetField(-2, name)
+	}
+	ls.PushString(UTF8PATT)
+	ls.SetField(-2, "charpattern")
+	return 1
+}
+
+func isCont(s string, i int) bool {
+	return i < len(s) && s[i]&0xC0 == 0x80
+}
+
+// translates a relative string position: negative means back from end
+func uPosRelat(pos int64, l int) int64 {
+	if pos >= 0 {
+		return pos
+	} else if 0-pos > int64(l) {
+		return 0
+	}
+	return int64(l) + pos + 1
+}
+
+// decodes one UTF-8 sequence starting at s[i], it returns the code
+// and the position after the sequence, or -1 if it is invalid
+func utf8Decode(s string, i int) (code rune, next int) {
+	limits := [...]int{0xFF, 0x7F, 0x7FF, 0xFFFF}
+	c := int(s[i])
+	res := 0      /* final result */
+	if c < 0x80 { /* ascii? */
+		res = c
+	} else {
+		count := 0                   /* to count number of continuation bytes */
+		for ; c&0x40 != 0; c <<= 1 { /* still have continuation bytes? */
+			count++
+			if !isCont(s, i+count) { /* not a continuation byte? */
+				return 0, -1 /* invalid byte sequence */
+			}
+			res = res<<6 | int(s[i+count]&0x3F) /* add lower 6 bits from cont. byte */
+		}
+		res |= (c & 0x7F) << uint(count*5) /* add first byte */
+		if count > 3 || res > MAXUNICODE || res <= limits[count] {
+			return 0, -1 /* invalid byte sequence */
+		}
+		i += count /* skip continuation bytes read */
+	}
+	return rune(res), i + 1 /* +1 to include first byte */
+}
+
+// utf8.len (s [, i [, j]])
+// http://www.lua.org/manual/5.3/manual.html#pdf-utf8.len
+func utfLen(ls LuaState) int {
+	s := auxlib.CheckString(ls, 1)
+	posi := uPosRelat(auxlib.OptInteger(ls, 2, 1), len(s))
+	posj := uPosRelat(auxlib.OptInteger(ls, 3, -1), len(s))
+	posi--
+	if !(0 <= posi && posi <= int64(len(s))) {
+		auxlib.ArgError(ls, 2, "initial position out of string")
+	}
+	posj--
+	if !(posj < int64(len(s))) {
+		auxlib.ArgError(ls, 3, "final position out of string")
+	}
+	n := int64(0)
+	for posi <= posj {
+		_, next := utf8Decode(s, int(posi))
+		if next < 0 { /* conversion error? */
+			ls.PushNil()             /* return nil ... */
+			ls.PushInteger(posi + 1) /* ... and current position */
+			return 2
+		}
+		posi = int64(next)
+		n++
+	}
+	ls.PushInteger(n)
+	return 1
+}
+
+// utf8.codepoint (s [, i [, j]])
+// http://www.lua.org/manual/5.3/manual.html#pdf-utf8.codepoint
+func codepoint(ls LuaState) int {
+	s := auxlib.CheckString(ls, 1)
+	posi := uPosRelat(auxlib.OptInteger(ls, 2, 1), len(s))
+	pose := uPosRelat(auxlib.OptInteger(ls, 3, posi), len(s))
+	if posi < 1 {
+		auxlib.ArgError(ls, 2, "out of range")
+	}
+	if pose > int64(len(s)) {
+		auxlib.ArgError(ls, 3, "out of range")
+	}
+	if posi > pose {
+		return 0 /* empty interval; return no values */
+	}
+	if pose-posi >= LUAI_MAXSTACK { /* (int -> int overflow) */
+		return auxlib.Error(ls, "string slice too long")
+	}
+	n := int(pose - posi + 1)
+	if !ls.CheckStack(n) {
+		return auxlib.Error(ls, "string slice too long")
+	}
+	n = 0
+	for i := int(posi - 1); i < int(pose); n++ {
+		code, next := utf8Decode(s, i)
+		if next < 0 {
+			return auxlib.Error(ls, "invalid UTF-8 code")
+		}
+		ls.PushInteger(int64(code))
+		i = next
+	}
+	return n
+}
+
+// utf8.char (···)
+// http://www.lua.org/manual/5.3/manual.html#pdf-utf8.char
+func utfChar(ls LuaState) int {
+	n := ls.GetTop() /* number of arguments */
+	buf := make([]byte, 0, n)
+	for i := 1; i <= n; i++ {
+		code := auxlib.CheckInteger(ls, i)
+		if uint64(code) > MAXUTF {
+			auxlib.ArgError(ls, i, "value out of range")
+		}
+		buf = append(buf, utf8Esc(uint32(code))...)
+	}
+	ls.PushString(string(buf))
+	return 1
+}
+
+// encodes x in UTF-8 with up to 6 bytes, like luaO_utf8esc
+func utf8Esc(x uint32) []byte {
+	if x < 0x80 { /* ascii? */
+		return []byte{byte(x)}
+	}
+	var buf [8]byte
+	n := len(buf)       /* number of bytes put in buffer (backwards) */
+	mfb := uint32(0x3f) /* maximum that fits in first byte */
+	for {               /* add continuation bytes */
+		n--
+		buf[n] = byte(0x80 | (x & 0x3f))
+		x >>= 6       /* remove added bits */
+		mfb >>= 1     /* now there is one less bit available in first byte */
+		if x <= mfb { /* still needs continuation byte? */
+			break
+		}
+	}
+	n--
+	buf[n] = byte((^mfb << 1) | x) /* add first byte */
+	return buf[n:]
+}
+
+// utf8.offset (s, n [, i])
+// http://www.lua.org/manual/5.3/manual.html#pdf-utf8.offset
+func byteOffset(ls LuaState) int {
+	s := auxlib.CheckString(ls, 1)
+	n := auxlib.CheckInteger(ls, 2)
+	defI := int64(1)
+	if n < 0 {
+		defI = int64(len(s)) + 1
+	}
+	posi := uPosRelat(auxlib.OptInteger(ls, 3, defI), len(s))
+	posi--
+	if !(0 <= posi && posi <= int64(len(s))) {
+		auxlib.ArgError(ls, 3, "position out of range")
+	}
+	i := int(posi)
+	if n == 0 {
+		/* find beginning of current byte sequence */
+		for i > 0 && isCont(s, i) {
+			i--
+		}
+	} else {
+		if isCont(s, i) {
+			return auxlib.Error(ls, "initial position is a continuation byte")
+		}
+		if n < 0 {
+			for n < 0 && i > 0 { /* move back */
+				i-- /* at least one step */
+				for i > 0 && isCont(s, i) {
+					i--
+				}
+				n++
+			}
+		} else {
+			n-- /* do not move for 1st character */
+			for n > 0 && i < len(s) {
+				i++ /* at least one step */
+				for isCont(s, i) {
+					i++ /* (cannot pass final '\0') */
+				}
+				n--
+			}
+		}
+	}
+	if n == 0 { /* did it find given character? */
+		ls.PushInteger(int64(i) + 1)
+	} else { /* no such character */
+		ls.PushNil()
+	}
+	return 1
+}
+
+func iterAux(ls LuaState) int {
+	s := auxlib.CheckString(ls, 1)
+	n := ls.ToInteger(2) - 1
+	if n < 0 { /* first iteration? */
+		n = 0 /* start from here */
+	} else if n < int64(len(s)) {
+		n++ /* skip current byte */
+		for isCont(s, int(n)) {
+			n++ /* and its continuations */
+		}
+	}
+	if n >= int64(len(s)) {
+		return 0 /* no more codepoints */
+	}
+	code, next := utf8Decode(s, int(n))
+	if next < 0 || isCont(s, next) {
+		return auxlib.Error(ls, "invalid UTF-8 code")
+	}
+	ls.PushInteger(n + 1)
+	ls.PushInteger(int64(code))
+	return 2
+}
+
+// utf8.codes (s)
+// http://www.lua.org/manual/5.3/manual.html#pdf-utf8.codes
+func iterCodes(ls LuaState) int {
+	auxlib.CheckString(ls, 1)
+	ls.PushGoFunction(iterAux)
+	ls.PushValue(1)
+	ls.PushInteger(0)
+	return 3
+}
+
+/* helpers */
@@ -0,0 +1,698 @@
+package yamllib
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+/*
+YAML 子集解码：块映射、块序列、流式 [..] 和 {..}、
+单/双引号标量、字面块 | 和折叠块 >，以及 YAML 1.2 core schema
+的 null/bool/int/float 解析。不支持锚点、别名、标签和复杂键。
+strict 模式下重复的键是错误；非严格模式下后出现的键覆盖先出现的。
+*/
+type decoder struct {
+	lines  []line
+	idx    int
+	strict bool
+}
+
+type line struct {
+	num    int    // 1-based line number
+	indent int    // leading spaces
+	text   string // without indentation and comments
+	raw    string // without indentation, for block scalars
+}
+
+type decodeError struct {
+	line int
+	msg  string
+}
+
+func (self *decodeError) Error() string {
+	return fmt.Sprintf("line %d: %s", self.line, self.msg)
+}
+
+func Decode(src string, strict bool) (result interface{}, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			if e, ok := r.(*decodeError); ok {
+				err = e
+			} else {
+				panic(r)
+			}
+		}
+	}()
+
+	d := &decoder{strict: strict}
+	d.split(src)
+	if d.idx >= len(d.lines) {
+		return nil, nil
+	}
+	result = d.parseNode(d.lines[d.idx].indent)
+	if d.idx < len(d.lines) {
+		d.errorAt(d.lines[d.idx].num, "unexpected content (bad indentation?)")
+	}
+	return result, nil
+}
+
+func (self *decoder) errorAt(num int, f string, a ...interface{}) {
+	panic(&decodeError{num, fmt.Sprintf(f, a...)})
+}
+
+func (self *decoder) split(src string) {
+	src = strings.Replace(src, "\r\n", "\n", -1)
+	started := false
+	for i, s := range strings.Split(src, "\n") {
+		raw := strings.TrimLeft(s, " ")
+		indent := len(s) - len(raw)
+		if strings.HasPrefix(raw, "\t") {
+			self.errorAt(i+1, "tabs are not allowed for indentation")
+		}
+		text := strings.TrimRight(stripComment(raw), " \t")
+		if indent == 0 && (text == "---" || strings.HasPrefix(text, "--- ")) {
+			if started {
+				self.errorAt(i+1, "multiple documents are not supported")
+			}
+			started = true
+			if text = strings.TrimSpace(text[3:]); text == "" {
+				continue
+			}
+		} else if indent == 0 && text == "..." {
+			break
+		} else if strings.HasPrefix(text, "%") && indent == 0 {
+			continue /* directive */
+		}
+		if text != "" {
+			started = true
+		}
+		self.lines = append(self.lines, line{i + 1, indent, text, raw})
+	}
+	self.skipEmpty()
+}
+
+// removes a comment started by '#' preceded by a space, outside quotes
+func stripComment(s string) string {
+	var quote byte
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				if quote == '\'' && i+1 < len(s) && s[i+1] == '\'' {
+					i++
+				} else {
+					quote = 0
+				}
+			} else if c == '\\' && quote == '"' {
+				i++
+			}
+		case c == '"' || c == '\'':
+			if i == 0 || strings.IndexByte(" [{,:-", s[i-1]) >= 0 {
+				quote = c
+			}
+		case c == '#':
+			if i == 0 || s[i-1] == ' ' || s[i-1] == '\t' {
+				return s[:i]
+			}
+		}
+	}
+	return s
+}
+
+func (self *decoder) skipEmpty() {
+	for self.idx < len(self.lines) && self.lines[self.idx].text == "" {
+		self.idx++
+	}
+}
+
+func (self *decoder) current() *line {
+	if self.idx < len(self.lines) {
+		return &self.lines[self.idx]
+	}
+	return nil
+}
+
+func (self *decoder) advance() {
+	self.idx++
+	self.skipEmpty()
+}
+
+/* block nodes */
+
+func (self *decoder) parseNode(indent int) interface{} {
+	l := self.current()
+	switch {
+	case l == nil || l.indent < indent:
+		return nil
+	case isSeqEntry(l.text):
+		return self.parseSequence(l.indent)
+	case mappingKeyEnd(l.text) >= 0:
+		return self.parseMapping(l.indent)
+	default:
+		return self.parseMultilineScalar(l.indent)
+	}
+}
+
+func isSeqEntry(text string) bool {
+	return text == "-" || strings.HasPrefix(text, "- ")
+}
+
+func (self *decoder) parseSequence(indent int) []interface{} {
+	seq := []interface{}{}
+	for {
+		l := self.current()
+		if l == nil || l.indent < indent ||
+			l.indent == indent && !isSeqEntry(l.text) { /* "key:\n- a\nkey2:" */
+			return seq
+		}
+		if l.indent > indent {
+			self.errorAt(l.num, "bad indentation of a sequence entry")
+		}
+
+		rest := strings.TrimLeft(l.text[1:], " ")
+		if rest == "" {
+			self.advance()
+			if next := self.current(); next != nil && next.indent > indent {
+				seq = append(seq, self.parseNode(next.indent))
+			} else {
+				seq = append(seq, nil)
+			}
+			continue
+		}
+
+		/* the rest of the line is a node indented past the dash */
+		offset := len(l.text) - len(rest)
+		l.indent += offset
+		l.text = rest
+		l.raw = l.raw[offset:]
+		if isSeqEntry(rest) || mappingKeyEnd(rest) >= 0 {
+			seq = append(seq, self.parseNode(l.indent))
+		} else {
+			seq = append(seq, self.parseValue(l, rest, indent))
+		}
+	}
+}
+
+func (self *decoder) parseMapping(indent int) map[string]interface{} {
+	m := map[string]interface{}{}
+	for {
+		l := self.current()
+		if l == nil || l.indent < indent {
+			return m
+		}
+		if l.indent > indent {
+			self.errorAt(l.num, "bad indentation of a mapping entry")
+		}
+		end := mappingKeyEnd(l.text)
+		if end < 0 {
+			if isSeqEntry(l.text) {
+				self.errorAt(l.num, "sequence entry inside a mapping")
+			}
+			self.errorAt(l.num, "expected 'key: value'")
+		}
+
+		key := self.parseKey(l, strings.TrimSpace(l.text[:end]))
+		if _, found := m[key]; found && self.strict {
+			self.errorAt(l.num, "duplicate key '%s'", key)
+		}
+		rest := strings.TrimSpace(l.text[end+1:])
+		if rest == "" {
+			self.advance()
+			next := self.current()
+			switch {
+			case next != nil && next.indent > indent:
+				m[key] = self.parseNode(next.indent)
+			case next != nil && next.indent == indent && isSeqEntry(next.text):
+				m[key] = self.parseSequence(indent) /* "key:\n- a" */
+			default:
+				m[key] = nil
+			}
+		} else {
+			m[key] = self.parseValue(l, rest, indent)
+		}
+	}
+}
+
+func (self *decoder) parseKey(l *line, key string) string {
+	switch {
+	case strings.HasPrefix(key, "? "):
+		self.errorAt(l.num, "complex keys are not supported")
+	case strings.HasPrefix(key, `"`), strings.HasPrefix(key, "'"):
+		return self.parseQuoted(l.num, key)
+	case strings.HasPrefix(key, "&"), strings.HasPrefix(key, "*"), strings.HasPrefix(key, "!"):
+		self.errorAt(l.num, "anchors, aliases and tags are not supported")
+	}
+	return key
+}
+
+// mappingKeyEnd returns the index of the ':' ending a mapping key, or -1
+func mappingKeyEnd(text string) int {
+	if strings.HasPrefix(text, "[") || strings.HasPrefix(text, "{") {
+		return -1
+	}
+	var quote byte
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			} else if c == '\\' && quote == '"' {
+				i++
+			}
+		case (c == '"' || c == '\'') && i == 0:
+			quote = c
+		case c == ':':
+			if i+1 == len(text) || text[i+1] == ' ' {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// parseValue parses the value on the line after "key:" or "- "; block
+// scalars and multi-line flow collections consume further lines
+func (self *decoder) parseValue(l *line, text string, indent int) interface{} {
+	num := l.num
+	switch text[0] {
+	case '|', '>':
+		self.advance()
+		return self.parseBlockScalar(num, text, indent)
+	case '[', '{':
+		/* flow collections may continue on the next lines */
+		for !flowComplete(text) {
+			self.idx++
+			if self.idx >= len(self.lines) {
+				self.errorAt(num, "unfinished flow collection")
+			}
+			text += " " + self.lines[self.idx].text
+		}
+		self.advance()
+		f := &flowParser{src: text, line: num, decoder: self}
+		v := f.parse()
+		f.skipSpaces()
+		if f.pos < len(f.src) {
+			self.errorAt(num, "unexpected '%s' after flow collection", f.src[f.pos:])
+		}
+		return v
+	case '"', '\'':
+		for !quoteComplete(text) {
+			self.idx++
+			if self.idx >= len(self.lines) {
+				self.errorAt(num, "unfinished quoted scalar")
+			}
+			text += " " + strings.TrimSpace(self.lines[self.idx].text)
+		}
+		self.advance()
+		return self.parseQuoted(num, text)
+	case '&', '*', '!':
+		self.errorAt(num, "anchors, aliases and tags are not supported")
+	}
+
+	/* plain scalars may be folded over more indented lines */
+	self.advance()
+	for next := self.current(); next != nil && next.indent > indent &&
+		!isSeqEntry(next.text) && mappingKeyEnd(next.text) < 0; next = self.current() {
+		text += " " + next.text
+		self.advance()
+	}
+	return resolve(text)
+}
+
+func (self *decoder) parseMultilineScalar(indent int) interface{} {
+	l := self.current()
+	return self.parseValue(l, l.text, indent-1)
+}
+
+func flowComplete(text string) bool {
+	depth := 0
+	var quote byte
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			} else if c == '\\' && quote == '"' {
+				i++
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '[' || c == '{':
+			depth++
+		case c == ']' || c == '}':
+			depth--
+		}
+	}
+	return depth <= 0
+}
+
+func quoteComplete(text string) bool {
+	quote := text[0]
+	for i := 1; i < len(text); i++ {
+		switch {
+		case text[i] == '\\' && quote == '"':
+			i++
+		case text[i] == quote:
+			if quote == '\'' && i+1 < len(text) && text[i+1] == '\'' {
+				i++
+			} else {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// | and > with optional chomping indicator (- or +)
+func (self *decoder) parseBlockScalar(num int, header string, indent int) string {
+	folded := header[0] == '>'
+	chomp := byte(0)
+	for _, c := range []byte(header[1:]) {
+		switch {
+		case c == '-' || c == '+':
+			chomp = c
+		case c >= '1' && c <= '9':
+		default:
+			self.errorAt(num, "invalid block scalar header '%s'", header)
+		}
+	}
+
+	/* block lines are all lines more indented than the parent,
+	   including empty ones; use the raw lines here */
+	var lines []string
+	blockIndent := -1
+	for self.idx < len(self.lines) {
+		l := self.lines[self.idx]
+		if strings.TrimSpace(l.raw) == "" {
+			lines = append(lines, "")
+			self.idx++
+			continue
+		}
+		if l.indent <= indent {
+			break
+		}
+		if blockIndent < 0 {
+			blockIndent = l.indent
+		}
+		if l.indent < blockIndent {
+			break
+		}
+		lines = append(lines, strings.Repeat(" ", l.indent-blockIndent)+l.raw)
+		self.idx++
+	}
+	self.skipEmpty()
+
+	/* trailing empty lines only matter for keep chomping */
+	n := len(lines)
+	for n > 0 && lines[n-1] == "" {
+		n--
+	}
+	trailing := len(lines) - n
+	lines = lines[:n]
+
+	var s string
+	if folded {
+		var buf strings.Builder
+		for i, ln := range lines {
+			if i > 0 {
+				prev := lines[i-1]
+				switch {
+				case ln == "":
+					buf.WriteByte('\n')
+				case prev == "":
+					/* the empty line already broke the line */
+				case strings.HasPrefix(ln, " ") || strings.HasPrefix(prev, " "):
+					buf.WriteByte('\n')
+				default:
+					buf.WriteByte(' ')
+				}
+			}
+			buf.WriteString(ln)
+		}
+		s = buf.String()
+	} else {
+		s = strings.Join(lines, "\n")
+	}
+
+	switch chomp {
+	case '-':
+		return s
+	case '+':
+		return s + "\n" + strings.Repeat("\n", trailing)
+	default:
+		if s == "" {
+			return ""
+		}
+		return s + "\n"
+	}
+}
+
+/* scalars */
+
+func (self *decoder) parseQuoted(num int, text string) string {
+	s, rest, err := unquote(text)
+	if err != "" {
+		self.errorAt(num, "%s", err)
+	}
+	if strings.TrimSpace(rest) != "" {
+		self.errorAt(num, "unexpected '%s' after quoted scalar", rest)
+	}
+	return s
+}
+
+// unquote parses a quoted scalar at the start of text
+func unquote(text string) (s, rest, err string) {
+	quote := text[0]
+	var buf strings.Builder
+	for i := 1; i < len(text); i++ {
+		c := text[i]
+		switch {
+		case c == quote && quote == '\'' && i+1 < len(text) && text[i+1] == '\'':
+			buf.WriteByte('\'')
+			i++
+		case c == quote:
+			return buf.String(), text[i+1:], ""
+		case c == '\\' && quote == '"':
+			if i+1 >= len(text) {
+				return "", "", "unfinished escape sequence"
+			}
+			i++
+			switch e := text[i]; e {
+			case '0':
+				buf.WriteByte(0)
+			case 'a':
+				buf.WriteByte('\a')
+			case 'b':
+				buf.WriteByte('\b')
+			case 't', '\t':
+				buf.WriteByte('\t')
+			case 'n':
+				buf.WriteByte('\n')
+			case 'v':
+				buf.WriteByte('\v')
+			case 'f':
+				buf.WriteByte('\f')
+			case 'r':
+				buf.WriteByte('\r')
+			case 'e':
+				buf.WriteByte(0x1b)
+			case ' ', '"', '/', '\\':
+				buf.WriteByte(e)
+			case 'x', 'u', 'U':
+				n := map[byte]int{'x': 2, 'u': 4, 'U': 8}[e]
+				if i+n >= len(text) {
+					return "", "", "invalid escape sequence"
+				}
+				code, perr := strconv.ParseUint(text[i+1:i+1+n], 16, 32)
+				if perr != nil {
+					return "", "", "invalid escape sequence '\\" + text[i:i+1+n] + "'"
+				}
+				buf.WriteRune(rune(code))
+				i += n
+			default:
+				return "", "", fmt.Sprintf("invalid escape sequence '\\%c'", e)
+			}
+		default:
+			buf.WriteByte(c)
+		}
+	}
+	return "", "", "unfinished quoted scalar"
+}
+
+// resolve applies the YAML 1.2 core schema to a plain scalar
+func resolve(s string) interface{} {
+	switch s {
+	case "", "~", "null", "Null", "NULL":
+		return nil
+	case "true", "True", "TRUE":
+		return true
+	case "false", "False", "FALSE":
+		return false
+	case ".inf", ".Inf", ".INF", "+.inf", "+.Inf", "+.INF":
+		return math.Inf(1)
+	case "-.inf", "-.Inf", "-.INF":
+		return math.Inf(-1)
+	case ".nan", ".NaN", ".NAN":
+		return math.NaN()
+	}
+	if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return i
+	}
+	if strings.HasPrefix(s, "0x") {
+		if i, err := strconv.ParseInt(s[2:], 16, 64); err == nil {
+			return i
+		}
+	}
+	if strings.HasPrefix(s, "0o") {
+		if i, err := strconv.ParseInt(s[2:], 8, 64); err == nil {
+			return i
+		}
+	}
+	if isFloat(s) {
+		if f, err := strconv.ParseFloat(s, 64); err == nil {
+			return f
+		}
+	}
+	return s
+}
+
+// [-+]? ( \. [0-9]+ | [0-9]+ ( \. [0-9]* )? ) ( [eE] [-+]? [0-9]+ )?
+func isFloat(s string) bool {
+	i := 0
+	if i < len(s) && (s[i] == '+' || s[i] == '-') {
+		i++
+	}
+	digits := 0
+	for ; i < len(s) && s[i] >= '0' && s[i] <= '9'; i++ {
+		digits++
+	}
+	if i < len(s) && s[i] == '.' {
+		i++
+		for ; i < len(s) && s[i] >= '0' && s[i] <= '9'; i++ {
+			digits++
+		}
+	}
+	if digits == 0 {
+		return false
+	}
+	if i < len(s) && (s[i] == 'e' || s[i] == 'E') {
+		i++
+		if i < len(s) && (s[i] == '+' || s[i] == '-') {
+			i++
+		}
+		expDigits := 0
+		for ; i < len(s) && s[i] >= '0' && s[i] <= '9'; i++ {
+			expDigits++
+		}
+		if expDigits == 0 {
+			return false
+		}
+	}
+	return i == len(s)
+}
+
+/* flow collections */
+
+type flowParser struct {
+	src     string
+	pos     int
+	line    int
+	decoder *decoder
+}
+
+func (self *flowParser) error(f string, a ...interface{}) {
+	self.decoder.errorAt(self.line, f, a...)
+}
+
+func (self *flowParser) skipSpaces() {
+	for self.pos < len(self.src) && (self.src[self.pos] == ' ' || self.src[self.pos] == '\t') {
+		self.pos++
+	}
+}
+
+func (self *flowParser) peek() byte {
+	self.skipSpaces()
+	if self.pos < len(self.src) {
+		return self.src[self.pos]
+	}
+	return 0
+}
+
+func (self *flowParser) parse() interface{} {
+	switch self.peek() {
+	case '[':
+		self.pos++
+		seq := []interface{}{}
+		for {
+			if self.peek() == ']' {
+				self.pos++
+				return seq
+			}
+			seq = append(seq, self.parse())
+			self.separator(']')
+		}
+	case '{':
+		self.pos++
+		m := map[string]interface{}{}
+		for {
+			if self.peek() == '}' {
+				self.pos++
+				return m
+			}
+			k := self.parse()
+			key, ok := k.(string)
+			if !ok {
+				if isCollection(k) {
+					self.error("collection keys are not supported")
+				}
+				key, _ = encodeScalar(k) /* 1, true, null... */
+			}
+			var val interface{}
+			if self.peek() == ':' {
+				self.pos++
+				val = self.parse()
+			}
+			if _, found := m[key]; found && self.decoder.strict {
+				self.error("duplicate key '%s'", key)
+			}
+			m[key] = val
+			self.separator('}')
+		}
+	case '"', '\'':
+		s, rest, err := unquote(self.src[self.pos:])
+		if err != "" {
+			self.error("%s", err)
+		}
+		self.pos = len(self.src) - len(rest)
+		return s
+	case 0:
+		self.error("unfinished flow collection")
+		return nil
+	default:
+		start := self.pos
+		for self.pos < len(self.src) {
+			c := self.src[self.pos]
+			if c == ',' || c == ']' || c == '}' ||
+				c == ':' && (self.pos+1 == len(self.src) || strings.IndexByte(" ,]}", self.src[self.pos+1]) >= 0) {
+				break
+			}
+			self.pos++
+		}
+		return resolve(strings.TrimSpace(self.src[start:self.pos]))
+	}
+}
+
+func (self *flowParser) separator(closing byte) {
+	switch self.peek() {
+	case ',':
+		self.pos++
+	case closing:
+	default:
+		self.error("expected ',' or '%c' in flow collection", closing)
+	}
+}
@@ -0,0 +1,199 @@
+package yamllib
+
+import (
+	"bytes"
+	"fmt"
+	"luago/api"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+/*
+YAML 编码：块风格，键按字典序输出；必要时字符串使用双引号，
+空表输出为 {} 或 []。
+*/
+func Encode(v interface{}) (string, error) {
+	var buf bytes.Buffer
+	if err := encodeNode(&buf, v, 0, false); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// inline is set when the node follows "- " on the same line
+func encodeNode(buf *bytes.Buffer, v interface{}, indent int, inline bool) error {
+	pad := strings.Repeat(" ", indent)
+	switch x := v.(type) {
+	case map[string]interface{}:
+		if len(x) == 0 {
+			buf.WriteString("{}\n")
+			return nil
+		}
+		for i, key := range sortedKeys(x) {
+			if i > 0 || !inline {
+				buf.WriteString(pad)
+			}
+			buf.WriteString(quoteIfNeeded(key))
+			buf.WriteByte(':')
+			if err := encodeChild(buf, x[key], indent); err != nil {
+				return err
+			}
+		}
+	case []interface{}:
+		if len(x) == 0 {
+			buf.WriteString("[]\n")
+			return nil
+		}
+		for i, elem := range x {
+			if i > 0 || !inline {
+				buf.WriteString(pad)
+			}
+			buf.WriteString("- ")
+			if isCollection(elem) && !isEmpty(elem) {
+				if err := encodeNode(buf, elem, indent+2, true); err != nil {
+					return err
+				}
+			} else if err := encodeScalarLine(buf, elem); err != nil {
+				return err
+			}
+		}
+	default:
+		return encodeScalarLine(buf, v)
+	}
+	return nil
+}
+
+// the value of a mapping entry, after "key:"
+func encodeChild(buf *bytes.Buffer, v interface{}, indent int) error {
+	if isCollection(v) && !isEmpty(v) {
+		buf.WriteByte('\n')
+		return encodeNode(buf, v, indent+2, false)
+	}
+	buf.WriteByte(' ')
+	return encodeScalarLine(buf, v)
+}
+
+func encodeScalarLine(buf *bytes.Buffer, v interface{}) error {
+	s, err := encodeScalar(v)
+	if err != nil {
+		return err
+	}
+	buf.WriteString(s)
+	buf.WriteByte('\n')
+	return nil
+}
+
+func encodeScalar(v interface{}) (string, error) {
+	switch x := v.(type) {
+	case nil:
+		return "null", nil
+	case bool:
+		return strconv.FormatBool(x), nil
+	case int64:
+		return strconv.FormatInt(x, 10), nil
+	case float64:
+		switch {
+		case math.IsInf(x, 1):
+			return ".inf", nil
+		case math.IsInf(x, -1):
+			return "-.inf", nil
+		case math.IsNaN(x):
+			return ".nan", nil
+		}
+		s := strconv.FormatFloat(x, 'g', -1, 64)
+		if !strings.ContainsAny(s, ".e") {
+			s += ".0"
+		}
+		return s, nil
+	case string:
+		return quoteIfNeeded(x), nil
+	case map[string]interface{}:
+		return "{}", nil
+	case []interface{}:
+		return "[]", nil
+	default:
+		return "", fmt.Errorf("cannot encode a %s", luaTypeName(v))
+	}
+}
+
+// the Lua type of a value with no YAML counterpart
+func luaTypeName(v interface{}) string {
+	switch v.(type) {
+	case api.GoFunction:
+		return "function"
+	default:
+		return "userdata"
+	}
+}
+
+func isCollection(v interface{}) bool {
+	switch v.(type) {
+	case map[string]interface{}, []interface{}:
+		return true
+	}
+	return false
+}
+
+func isEmpty(v interface{}) bool {
+	switch x := v.(type) {
+	case map[string]interface{}:
+		return len(x) == 0
+	case []interface{}:
+		return len(x) == 0
+	}
+	return false
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// strings stay plain unless they would read back as something else
+func quoteIfNeeded(s string) string {
+	if s == "" || resolve(s) != s || s != strings.TrimSpace(s) ||
+		strings.ContainsAny(s[:1], "-?:,[]{}#&*!|>'\"%@`") ||
+		strings.Contains(s, ": ") || strings.Contains(s, " #") ||
+		strings.HasSuffix(s, ":") {
+		return quote(s)
+	}
+	for _, r := range s {
+		if r < 0x20 || r == 0x7f {
+			return quote(s)
+		}
+	}
+	return s
+}
+
+func quote(s string) string {
+	var buf bytes.Buffer
+	buf.WriteByte('"')
+	for _, r := range s {
+		switch r {
+		case '"':
+			buf.WriteString(`\"`)
+		case '\\':
+			buf.WriteString(`\\`)
+		case '\n':
+			buf.WriteString(`\n`)
+		case '\r':
+			buf.WriteString(`\r`)
+		case '\t':
+			buf.WriteString(`\t`)
+		default:
+			if r < 0x20 || r == 0x7f {
+				fmt.Fprintf(&buf, `\x%02X`, r)
+			} else {
+				buf.WriteRune(r)
+			}
+		}
+	}
+	buf.WriteByte('"')
+	return buf.String()
+}
@@ -0,0 +1,46 @@
+package yamllib
+
+import (
+	. "luago/api"
+	"luago/conv"
+)
+
+var yamlFuncs = map[string]GoFunction{
+	"decode": yamlDecode,
+	"encode": yamlEncode,
+}
+
+func OpenYamlLib(ls LuaState) int {
+	ls.CreateTable(0, len(yamlFuncs))
+	for name, f := range yamlFuncs {
+		ls.PushGoFunction(f)
+		ls.SetField(-2, name)
+	}
+	return 1
+}
+
+// yaml.decode (s [, strict])
+// strict defaults to true; returns the value or nil and an error message
+func yamlDecode(ls LuaState) int {
+	strict := ls.IsNoneOrNil(2) || ls.ToBoolean(2)
+	doc, err := Decode(ls.ToString(1), strict)
+	if err != nil {
+		ls.PushNil()
+		ls.PushString(err.Error())
+		return 2
+	}
+	conv.Push(ls, doc)
+	return 1
+}
+
+// yaml.encode (v)
+func yamlEncode(ls LuaState) int {
+	s, err := Encode(conv.ToGo(ls, 1))
+	if err != nil {
+		ls.PushNil()
+		ls.PushString(err.Error())
+		return 2
+	}
+	ls.PushString(s)
+	return 1
+}
@@ -11,7 +11,10 @@ func TestDumpAndUndump(data []byte, sourceFilePath string) {
 }
 
 func testDump(data []byte, fileName string) {
-	proto := compiler.Compile(string(data), fileName)
+	proto, err := compiler.Compile(string(data), fileName)
+	if err != nil {
+		panic(err)
+	}
 	fmt.Printf("%+v\n", proto)
 	//	_ = Dump(proto)
 }
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"luago/tools/astdiff"
+	"luago/tools/bcdiff"
+	"luago/tools/bench"
+	"luago/tools/compat"
+	"luago/tools/doc"
+	"luago/tools/fuzz"
+	"math/rand"
+	"os"
+	"time"
+)
+
+/*
+	子命令：luago <tool> args...
+	返回值作为进程的退出码。
+*/
+var tools = map[string]func(args []string) int{
+	"astdiff": astDiff,
+	"bcdiff":  bcDiff,
+	"bench":   benchVM,
+	"compat":  compatCheck,
+	"doc":     genDoc,
+	"fuzz":    fuzzFront,
+}
+
+// luago astdiff old.lua new.lua
+func astDiff(args []string) int {
+	if len(args) != 2 {
+		fmt.Fprintln(os.Stderr, "usage: luago astdiff old.lua new.lua")
+		return 2
+	}
+	oldData, err := ioutil.ReadFile(args[0])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	newData, err := ioutil.ReadFile(args[1])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+
+	changes, err := astdiff.Diff(string(oldData), args[0], string(newData), args[1])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err) /* chunk:line: msg */
+		return 2
+	}
+	if astdiff.Print(os.Stdout, changes, args[0], args[1]) > 0 {
+		return 1
+	}
+	return 0
+}
+
+// luago bcdiff a.luac b.luac
+func bcDiff(args []string) int {
+	if len(args) != 2 {
+		fmt.Fprintln(os.Stderr, "usage: luago bcdiff a.luac b.luac")
+		return 2
+	}
+	a, err := ioutil.ReadFile(args[0])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	b, err := ioutil.ReadFile(args[1])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+
+	if bcdiff.Diff(os.Stdout, a, b, args[0], args[1]) > 0 {
+		return 1
+	}
+	return 0
+}
+
+// luago bench [-n count] [name...]
+func benchVM(args []string) int {
+	flags := flag.NewFlagSet("bench", flag.ContinueOnError)
+	n := flags.Int("n", 5, "runs per benchmark")
+	if err := flags.Parse(args); err != nil || *n <= 0 {
+		fmt.Fprintln(os.Stderr, "usage: luago bench [-n count] [name...]")
+		return 2
+	}
+
+	if _, err := bench.Run(os.Stdout, newState, flags.Args(), *n); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
+
+// luago fuzz [-t target] [-d duration] [-timeout t] [-seed n] [-replay] [corpus [seed...]]
+func fuzzFront(args []string) int {
+	flags := flag.NewFlagSet("fuzz", flag.ContinueOnError)
+	name := flags.String("t", "", "target: lexer, parser or undump (default all)")
+	d := flags.Duration("d", time.Minute, "time per target")
+	timeout := flags.Duration("timeout", 2*time.Second, "time limit per input")
+	seed := flags.Int64("seed", time.Now().UnixNano(), "random seed")
+	replay := flags.Bool("replay", false, "rerun the saved crashers")
+	if err := flags.Parse(args); err != nil {
+		fmt.Fprintln(os.Stderr, "usage: luago fuzz [-t target] [-d duration] [-replay] [corpus [seed...]]")
+		return 2
+	}
+
+	targets := fuzz.Targets
+	if *name != "" {
+		t := fuzz.FindTarget(*name)
+		if t == nil {
+			fmt.Fprintln(os.Stderr, "unknown fuzz target: "+*name)
+			return 2
+		}
+		targets = []fuzz.Target{*t}
+	}
+	dir, extra := "", []string(nil)
+	if flags.NArg() > 0 {
+		dir, extra = flags.Arg(0), flags.Args()[1:]
+	}
+
+	failed := false
+	for i := range targets {
+		t := &targets[i]
+		if *replay {
+			failed = replayCrashers(t, dir, *timeout) || failed
+			continue
+		}
+		seeds, err := fuzz.LoadSeeds(dir, t.Name, extra)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 2
+		}
+		rng := rand.New(rand.NewSource(*seed))
+		stats := fuzz.Run(t, seeds, rng, *d, *timeout, func(c *fuzz.Crash) {
+			fmt.Printf("%s: %s\n", t.Name, c.Msg)
+			if dir == "" {
+				return
+			}
+			if file, err := fuzz.SaveCrash(dir, t.Name, c); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+			} else {
+				fmt.Printf("  saved %s\n", file)
+			}
+		})
+		fmt.Printf("%s: %d execs, %d crashes (seed %d)\n",
+			t.Name, stats.Execs, len(stats.Crashes), *seed)
+		failed = failed || len(stats.Crashes) > 0
+	}
+	if failed {
+		return 1
+	}
+	return 0
+}
+
+// reruns saved crashers, removing the ones that have been fixed
+func replayCrashers(t *fuzz.Target, dir string, timeout time.Duration) bool {
+	crashers, err := fuzz.LoadCrashers(dir, t.Name)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return true
+	}
+	failed := false
+	for file, data := range crashers {
+		if c := fuzz.Check(t, data, timeout); c != nil {
+			fmt.Printf("%s: %s\n  %s\n", t.Name, c.Msg, file)
+			failed = true
+		} else {
+			fmt.Printf("%s: fixed, removing %s\n", t.Name, file)
+			fuzz.RemoveCrash(file)
+		}
+	}
+	return failed
+}
+
+// luago compat file.lua...
+func compatCheck(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, "usage: luago compat file.lua...")
+		return 2
+	}
+	tools := compat.FindTools()
+	if tools.Lua == "" && tools.Luac == "" {
+		fmt.Println("compat: no Lua 5.3 lua/luac in PATH, skipped")
+		return 0
+	}
+
+	failed := 0
+	for _, file := range args {
+		if tools.Luac != "" {
+			if err := compat.RoundTrip(tools.Luac, file); err != nil {
+				fmt.Printf("FAIL %s (luac round trip): %v\n", file, err)
+				failed++
+			}
+		}
+		if tools.Lua != "" {
+			if err := compat.RunDumped(tools.Lua, file); err != nil {
+				fmt.Printf("FAIL %s (run under lua): %v\n", file, err)
+				failed++
+			}
+		}
+	}
+	if failed > 0 {
+		return 1
+	}
+	fmt.Printf("compat: %d file(s) ok\n", len(args))
+	return 0
+}
+
+// luago doc [-f md|html] [-o dir] path...
+func genDoc(args []string) int {
+	flags := flag.NewFlagSet("doc", flag.ContinueOnError)
+	format := flags.String("f", "md", "output format, md or html")
+	outDir := flags.String("o", "doc", "output directory")
+	if err := flags.Parse(args); err != nil || flags.NArg() == 0 ||
+		doc.NewFormat(*format, nil) == nil {
+		fmt.Fprintln(os.Stderr, "usage: luago doc [-f md|html] [-o dir] path...")
+		return 2
+	}
+
+	n, err := doc.Generate(flags.Args(), *format, *outDir)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	fmt.Printf("doc: %d module(s) written to %s\n", n, *outDir)
+	return 0
+}
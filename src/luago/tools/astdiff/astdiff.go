@@ -0,0 +1,406 @@
+package astdiff
+
+import (
+	"fmt"
+	"io"
+	"luago/compiler"
+	. "luago/compiler/ast"
+	"strings"
+)
+
+const (
+	ADDED   = '+'
+	REMOVED = '-'
+	CHANGED = '~'
+)
+
+// a single difference between two chunks
+type Change struct {
+	Kind    byte   // ADDED, REMOVED or CHANGED
+	Scope   string // enclosing function, "main chunk" for top level, "" for functions
+	What    string // short description of the function or statement
+	OldLine int    // 0 if the node only exists in the new chunk
+	NewLine int    // 0 if the node only exists in the old chunk
+}
+
+type function struct {
+	name string
+	exp  *FuncDefExp
+}
+
+// Diff parses both chunks and compares them ignoring formatting and
+// comments. Function-level changes come first, followed by the
+// statement-level changes of every scope that differs. A syntax error
+// in either chunk is returned as a *compiler.CompileError.
+func Diff(oldChunk, oldName, newChunk, newName string) ([]Change, error) {
+	oldBlock, err := compiler.Parse(oldChunk, oldName)
+	if err != nil {
+		return nil, err
+	}
+	newBlock, err := compiler.Parse(newChunk, newName)
+	if err != nil {
+		return nil, err
+	}
+	return DiffBlocks(oldBlock, newBlock), nil
+}
+
+func DiffBlocks(oldBlock, newBlock *Block) []Change {
+	oldFuncs := collectFuncs(oldBlock)
+	newFuncs := collectFuncs(newBlock)
+
+	var changes []Change
+	var stats []Change
+
+	stats = append(stats, diffStats("main chunk", oldBlock, newBlock)...)
+	for _, of := range oldFuncs {
+		nf := findFunc(newFuncs, of.name)
+		if nf == nil {
+			changes = append(changes, Change{REMOVED, "", "function " + of.name,
+				firstLine(of.exp), 0})
+		} else if fingerprint(of.exp.Block, true) != fingerprint(nf.exp.Block, true) ||
+			fingerprint(of.exp, true) != fingerprint(nf.exp, true) {
+			changes = append(changes, Change{CHANGED, "", "function " + of.name,
+				firstLine(of.exp), firstLine(nf.exp)})
+			stats = append(stats, diffStats(of.name, of.exp.Block, nf.exp.Block)...)
+		}
+	}
+	for _, nf := range newFuncs {
+		if findFunc(oldFuncs, nf.name) == nil {
+			changes = append(changes, Change{ADDED, "", "function " + nf.name,
+				0, firstLine(nf.exp)})
+		}
+	}
+
+	return append(changes, stats...)
+}
+
+func findFunc(funcs []function, name string) *function {
+	for i := range funcs {
+		if funcs[i].name == name {
+			return &funcs[i]
+		}
+	}
+	return nil
+}
+
+/* functions */
+
+func collectFuncs(block *Block) []function {
+	var funcs []function
+	seen := map[string]int{}
+	add := func(name string, fd *FuncDefExp) string {
+		seen[name]++
+		if n := seen[name]; n > 1 {
+			name = fmt.Sprintf("%s#%d", name, n)
+		}
+		funcs = append(funcs, function{name, fd})
+		return name
+	}
+
+	var walkBlock func(prefix string, block *Block)
+	var walkExp func(prefix, name string, exp Exp)
+
+	walkExp = func(prefix, name string, exp Exp) {
+		switch x := exp.(type) {
+		case *FuncDefExp:
+			if name == "" {
+				name = "<anonymous>"
+			}
+			walkBlock(add(prefix+name, x)+".", x.Block)
+		case *UnopExp:
+			walkExp(prefix, "", x.Exp)
+		case *BinopExp:
+			walkExp(prefix, "", x.Exp1)
+			walkExp(prefix, "", x.Exp2)
+		case *ConcatExp:
+			for _, e := range x.Exps {
+				walkExp(prefix, "", e)
+			}
+		case *TableConstructorExp:
+			for i, v := range x.ValExps {
+				key := ""
+				if k, ok := x.KeyExps[i].(*StringExp); ok {
+					key = k.Str
+				}
+				walkExp(prefix, key, v)
+			}
+		case *ParensExp:
+			walkExp(prefix, "", x.Exp)
+		case *TableAccessExp:
+			walkExp(prefix, "", x.PrefixExp)
+			walkExp(prefix, "", x.KeyExp)
+		case *FuncCallExp:
+			walkExp(prefix, "", x.PrefixExp)
+			for _, arg := range x.Args {
+				walkExp(prefix, "", arg)
+			}
+		}
+	}
+
+	walkBlock = func(prefix string, block *Block) {
+		for _, stat := range block.Stats {
+			switch x := stat.(type) {
+			case *LocalFuncDefStat:
+				walkExp(prefix, x.Name, x.Exp)
+			case *LocalVarDeclStat:
+				for i, exp := range x.ExpList {
+					name := ""
+					if i < len(x.NameList) {
+						name = x.NameList[i]
+					}
+					walkExp(prefix, name, exp)
+				}
+			case *AssignStat:
+				for i, exp := range x.ExpList {
+					name := ""
+					if i < len(x.VarList) {
+						name = expToString(x.VarList[i])
+					}
+					walkExp(prefix, name, exp)
+				}
+			case *FuncCallStat:
+				walkExp(prefix, "", (*FuncCallExp)(x))
+			case *DoStat:
+				walkBlock(prefix, x.Block)
+			case *WhileStat:
+				walkExp(prefix, "", x.Exp)
+				walkBlock(prefix, x.Block)
+			case *RepeatStat:
+				walkBlock(prefix, x.Block)
+				walkExp(prefix, "", x.Exp)
+			case *IfStat:
+				for i, exp := range x.Exps {
+					walkExp(prefix, "", exp)
+					walkBlock(prefix, x.Blocks[i])
+				}
+			case *ForNumStat:
+				walkBlock(prefix, x.Block)
+			case *ForInStat:
+				for _, exp := range x.ExpList {
+					walkExp(prefix, "", exp)
+				}
+				walkBlock(prefix, x.Block)
+			}
+		}
+		for _, exp := range block.RetExps {
+			walkExp(prefix, "", exp)
+		}
+	}
+
+	walkBlock("", block)
+	return funcs
+}
+
+/* statements */
+
+type retStat struct {
+	Exps []Exp
+}
+
+func statsOf(block *Block) []Stat {
+	stats := block.Stats
+	if block.RetExps != nil {
+		stats = append(stats[:len(stats):len(stats)], &retStat{block.RetExps})
+	}
+	return stats
+}
+
+// diffStats aligns the statements of two blocks by their longest
+// common subsequence. A removal immediately followed by an addition
+// is reported as a single change.
+func diffStats(scope string, oldBlock, newBlock *Block) []Change {
+	a, b := statsOf(oldBlock), statsOf(newBlock)
+	fa := make([]string, len(a))
+	fb := make([]string, len(b))
+	for i, stat := range a {
+		fa[i] = fingerprint(stat, true)
+	}
+	for j, stat := range b {
+		fb[j] = fingerprint(stat, true)
+	}
+
+	// lcs[i][j] = length of LCS of fa[i:] and fb[j:]
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if fa[i] == fb[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	/* function definitions are already reported as functions */
+	var changes []Change
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && fa[i] == fb[j]:
+			i++
+			j++
+		case i < len(a) && j < len(b) && lcs[i+1][j+1] == lcs[i][j]:
+			if !definesFunc(a[i]) || !definesFunc(b[j]) {
+				changes = append(changes, Change{CHANGED, scope, describeStat(b[j]),
+					firstLine(a[i]), firstLine(b[j])})
+			}
+			i++
+			j++
+		case j >= len(b) || i < len(a) && lcs[i+1][j] >= lcs[i][j+1]:
+			if !definesFunc(a[i]) {
+				changes = append(changes, Change{REMOVED, scope, describeStat(a[i]),
+					firstLine(a[i]), 0})
+			}
+			i++
+		default:
+			if !definesFunc(b[j]) {
+				changes = append(changes, Change{ADDED, scope, describeStat(b[j]),
+					0, firstLine(b[j])})
+			}
+			j++
+		}
+	}
+	return changes
+}
+
+// whether stat only defines functions: function f() ... end,
+// local function f() ... end or an assignment of function expressions
+func definesFunc(stat Stat) bool {
+	var exps []Exp
+	switch x := stat.(type) {
+	case *LocalFuncDefStat:
+		return true
+	case *LocalVarDeclStat:
+		exps = x.ExpList
+	case *AssignStat:
+		exps = x.ExpList
+	}
+	for _, exp := range exps {
+		if _, ok := exp.(*FuncDefExp); !ok {
+			return false
+		}
+	}
+	return len(exps) > 0
+}
+
+func describeStat(stat Stat) string {
+	switch x := stat.(type) {
+	case *retStat:
+		return "return " + expsToString(x.Exps)
+	case *BreakStat:
+		return "break"
+	case *LabelStat:
+		return "::" + x.Name + "::"
+	case *GotoStat:
+		return "goto " + x.Name
+	case *DoStat:
+		return "do ... end"
+	case *WhileStat:
+		return "while " + expToString(x.Exp) + " do ... end"
+	case *RepeatStat:
+		return "repeat ... until " + expToString(x.Exp)
+	case *IfStat:
+		return "if " + expToString(x.Exps[0]) + " then ... end"
+	case *ForNumStat:
+		return "for " + x.VarName + " = ... do ... end"
+	case *ForInStat:
+		return "for " + strings.Join(x.NameList, ", ") + " in ... do ... end"
+	case *LocalFuncDefStat:
+		return "local function " + x.Name
+	case *LocalVarDeclStat:
+		return "local " + strings.Join(x.NameList, ", ")
+	case *AssignStat:
+		if len(x.ExpList) == 1 {
+			if _, ok := x.ExpList[0].(*FuncDefExp); ok {
+				return "function " + expsToString(x.VarList)
+			}
+		}
+		return expsToString(x.VarList) + " = " + expsToString(x.ExpList)
+	case *FuncCallStat:
+		return expToString((*FuncCallExp)(x))
+	default:
+		return fmt.Sprintf("%T", stat)
+	}
+}
+
+func expsToString(exps []Exp) string {
+	strs := make([]string, len(exps))
+	for i, exp := range exps {
+		strs[i] = expToString(exp)
+	}
+	return strings.Join(strs, ", ")
+}
+
+// expToString renders short expressions and elides long ones
+func expToString(exp Exp) string {
+	switch x := exp.(type) {
+	case *NilExp:
+		return "nil"
+	case *TrueExp:
+		return "true"
+	case *FalseExp:
+		return "false"
+	case *VarargExp:
+		return "..."
+	case *IntegerExp:
+		return fmt.Sprintf("%d", x.Val)
+	case *FloatExp:
+		return fmt.Sprintf("%g", x.Val)
+	case *StringExp:
+		return fmt.Sprintf("%q", x.Str)
+	case *NameExp:
+		return x.Name
+	case *ParensExp:
+		return "(" + expToString(x.Exp) + ")"
+	case *TableAccessExp:
+		if k, ok := x.KeyExp.(*StringExp); ok {
+			return expToString(x.PrefixExp) + "." + k.Str
+		}
+		return expToString(x.PrefixExp) + "[" + expToString(x.KeyExp) + "]"
+	case *FuncCallExp:
+		s := expToString(x.PrefixExp)
+		if x.NameExp != nil {
+			s += ":" + x.NameExp.Str
+		}
+		return s + "(" + expsToString(x.Args) + ")"
+	case *FuncDefExp:
+		return "function"
+	case *TableConstructorExp:
+		return "{...}"
+	default:
+		return "..."
+	}
+}
+
+/* report */
+
+// Print writes the changes in a diff-like format and returns the
+// number of changes written.
+func Print(w io.Writer, changes []Change, oldName, newName string) int {
+	scope := "?"
+	for _, c := range changes {
+		if c.Scope != scope {
+			scope = c.Scope
+			if scope == "" {
+				fmt.Fprintf(w, "@@ functions @@\n")
+			} else {
+				fmt.Fprintf(w, "@@ %s @@\n", scope)
+			}
+		}
+		fmt.Fprintf(w, "%c %s", c.Kind, c.What)
+		switch c.Kind {
+		case ADDED:
+			fmt.Fprintf(w, "  (%s:%d)\n", newName, c.NewLine)
+		case REMOVED:
+			fmt.Fprintf(w, "  (%s:%d)\n", oldName, c.OldLine)
+		default:
+			fmt.Fprintf(w, "  (%s:%d -> %s:%d)\n", oldName, c.OldLine, newName, c.NewLine)
+		}
+	}
+	return len(changes)
+}
@@ -0,0 +1,109 @@
+package astdiff
+
+import (
+	"bytes"
+	"fmt"
+	. "luago/compiler/ast"
+	"reflect"
+)
+
+// position fields are formatting, not semantics
+var positionFields = map[string]bool{
+	"Line":      true,
+	"LastLine":  true,
+	"LineOfFor": true,
+	"LineOfDo":  true,
+	"Column":    true,
+}
+
+// fingerprint renders a node as a canonical string that ignores
+// line numbers, so two nodes are semantically equal iff their
+// fingerprints are equal. When shallow is set, nested function
+// bodies are reduced to their signature.
+func fingerprint(node interface{}, shallow bool) string {
+	var buf bytes.Buffer
+	writeNode(&buf, reflect.ValueOf(node), shallow)
+	return buf.String()
+}
+
+func writeNode(buf *bytes.Buffer, v reflect.Value, shallow bool) {
+	switch v.Kind() {
+	case reflect.Invalid:
+		buf.WriteString("nil")
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			buf.WriteString("nil")
+			return
+		}
+		if fd, ok := v.Interface().(*FuncDefExp); ok && shallow {
+			fmt.Fprintf(buf, "function%v%t", fd.ParList, fd.IsVararg)
+			return
+		}
+		writeNode(buf, v.Elem(), shallow)
+	case reflect.Struct:
+		buf.WriteString(v.Type().Name())
+		buf.WriteByte('{')
+		for i := 0; i < v.NumField(); i++ {
+			name := v.Type().Field(i).Name
+			if positionFields[name] {
+				continue
+			}
+			buf.WriteString(name)
+			buf.WriteByte(':')
+			writeNode(buf, v.Field(i), shallow)
+			buf.WriteByte(' ')
+		}
+		buf.WriteByte('}')
+	case reflect.Slice:
+		buf.WriteByte('[')
+		for i := 0; i < v.Len(); i++ {
+			writeNode(buf, v.Index(i), shallow)
+			buf.WriteByte(',')
+		}
+		buf.WriteByte(']')
+	case reflect.String:
+		fmt.Fprintf(buf, "%q", v.String())
+	default:
+		fmt.Fprintf(buf, "%v", v.Interface())
+	}
+}
+
+// firstLine returns the smallest line number recorded in the subtree,
+// or 0 if the node carries no position information at all.
+func firstLine(node interface{}) int {
+	return _firstLine(reflect.ValueOf(node))
+}
+
+func _firstLine(v reflect.Value) int {
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return 0
+		}
+		return _firstLine(v.Elem())
+	case reflect.Struct:
+		line := 0
+		for i := 0; i < v.NumField(); i++ {
+			var l int
+			if positionFields[v.Type().Field(i).Name] {
+				l = int(v.Field(i).Int())
+			} else {
+				l = _firstLine(v.Field(i))
+			}
+			if l > 0 && (line == 0 || l < line) {
+				line = l
+			}
+		}
+		return line
+	case reflect.Slice:
+		line := 0
+		for i := 0; i < v.Len(); i++ {
+			if l := _firstLine(v.Index(i)); l > 0 && (line == 0 || l < line) {
+				line = l
+			}
+		}
+		return line
+	default:
+		return 0
+	}
+}
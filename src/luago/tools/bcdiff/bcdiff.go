@@ -0,0 +1,202 @@
+package bcdiff
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"luago/binchunk"
+)
+
+/*
+header layout of a lua 5.3 binary chunk:
+signature(4) version(1) format(1) luacData(6) cintSize(1) sizetSize(1)
+instructionSize(1) luaIntegerSize(1) luaNumberSize(1) luacInt(8) luacNum(8)
+sizeUpvalues(1)
+*/
+var headerFields = []struct {
+	name       string
+	start, end int
+}{
+	{"signature", 0, 4},
+	{"version", 4, 5},
+	{"format", 5, 6},
+	{"luac_data", 6, 12},
+	{"sizeof(int)", 12, 13},
+	{"sizeof(size_t)", 13, 14},
+	{"sizeof(Instruction)", 14, 15},
+	{"sizeof(lua_Integer)", 15, 16},
+	{"sizeof(lua_Number)", 16, 17},
+	{"luac_int", 17, 25},
+	{"luac_num", 25, 33},
+	{"sizeupvalues", 33, 34},
+}
+
+type differ struct {
+	w     io.Writer
+	nDiff int
+}
+
+// Diff compares two binary chunks and writes the differences in
+// disassembled form. It returns the number of differences found.
+func Diff(w io.Writer, a, b []byte, nameA, nameB string) int {
+	d := &differ{w: w}
+	fmt.Fprintf(w, "--- %s\n+++ %s\n", nameA, nameB)
+	d.diffHeader(a, b)
+
+	protoA, errA := undump(a)
+	protoB, errB := undump(b)
+	if errA != nil || errB != nil {
+		d.field("undump", errString(errA), errString(errB))
+		return d.nDiff
+	}
+
+	d.diffProto("main", protoA, protoB)
+	return d.nDiff
+}
+
+func undump(data []byte) (*binchunk.Prototype, error) {
+	return binchunk.Load(data, "?")
+}
+
+func errString(err error) string {
+	if err == nil {
+		return "ok"
+	}
+	return err.Error()
+}
+
+func (self *differ) field(name string, a, b interface{}) {
+	sa, sb := fmt.Sprint(a), fmt.Sprint(b)
+	if sa != sb {
+		self.nDiff++
+		fmt.Fprintf(self.w, "  %s: %s | %s\n", name, sa, sb)
+	}
+}
+
+func (self *differ) diffHeader(a, b []byte) {
+	for _, f := range headerFields {
+		self.field(f.name, headerBytes(a, f.start, f.end), headerBytes(b, f.start, f.end))
+	}
+}
+
+func headerBytes(data []byte, start, end int) string {
+	if len(data) < end {
+		return "<truncated>"
+	}
+	return fmt.Sprintf("% x", data[start:end])
+}
+
+// sub functions are aligned by their position in the prototype tree
+func (self *differ) diffProto(path string, a, b *binchunk.Prototype) {
+	if a == nil || b == nil {
+		self.nDiff++
+		if a == nil {
+			fmt.Fprintf(self.w, "+ function %s <%s:%d,%d>\n",
+				path, b.Source, b.LineDefined, b.LastLineDefined)
+		} else {
+			fmt.Fprintf(self.w, "- function %s <%s:%d,%d>\n",
+				path, a.Source, a.LineDefined, a.LastLineDefined)
+		}
+		return
+	}
+
+	fmt.Fprintf(self.w, "function %s <%s:%d,%d> <%s:%d,%d>\n", path,
+		a.Source, a.LineDefined, a.LastLineDefined,
+		b.Source, b.LineDefined, b.LastLineDefined)
+	self.field("source", a.Source, b.Source)
+	self.field("linedefined", a.LineDefined, b.LineDefined)
+	self.field("lastlinedefined", a.LastLineDefined, b.LastLineDefined)
+	self.field("numparams", a.NumParams, b.NumParams)
+	self.field("is_vararg", a.IsVararg, b.IsVararg)
+	self.field("maxstacksize", a.MaxStackSize, b.MaxStackSize)
+	self.field("upvalues", upvaluesToString(a), upvaluesToString(b))
+	self.diffLines("constants", constantsToLines(a), constantsToLines(b))
+	self.diffLines("code", codeToLines(a), codeToLines(b))
+
+	n := len(a.Protos)
+	if len(b.Protos) > n {
+		n = len(b.Protos)
+	}
+	for i := 0; i < n; i++ {
+		var pa, pb *binchunk.Prototype
+		if i < len(a.Protos) {
+			pa = a.Protos[i]
+		}
+		if i < len(b.Protos) {
+			pb = b.Protos[i]
+		}
+		self.diffProto(fmt.Sprintf("%s/%d", path, i), pa, pb)
+	}
+}
+
+func upvaluesToString(f *binchunk.Prototype) string {
+	var buf bytes.Buffer
+	for i, uv := range f.Upvalues {
+		if i > 0 {
+			buf.WriteByte(' ')
+		}
+		fmt.Fprintf(&buf, "%d:%d", uv.Instack, uv.Idx)
+	}
+	return buf.String()
+}
+
+func constantsToLines(f *binchunk.Prototype) []string {
+	lines := make([]string, len(f.Constants))
+	for i, k := range f.Constants {
+		lines[i] = binchunk.FormatConstant(k)
+	}
+	return lines
+}
+
+func codeToLines(f *binchunk.Prototype) []string {
+	lines := make([]string, len(f.Code))
+	for pc, c := range f.Code {
+		lines[pc] = binchunk.FormatInstruction(c)
+	}
+	return lines
+}
+
+// diffLines aligns two listings by their longest common subsequence
+// and prints unmatched entries with their 1-based index.
+func (self *differ) diffLines(title string, a, b []string) {
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	printedTitle := false
+	emit := func(sign byte, idx int, line string) {
+		if !printedTitle {
+			fmt.Fprintf(self.w, "  %s:\n", title)
+			printedTitle = true
+		}
+		self.nDiff++
+		fmt.Fprintf(self.w, "  %c\t%d\t%s\n", sign, idx+1, line)
+	}
+
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			i++
+			j++
+		case j >= len(b) || i < len(a) && lcs[i+1][j] >= lcs[i][j+1]:
+			emit('-', i, a[i])
+			i++
+		default:
+			emit('+', j, b[j])
+			j++
+		}
+	}
+}
@@ -0,0 +1,143 @@
+package bench
+
+import (
+	"fmt"
+	"io"
+	. "luago/api"
+	"runtime"
+	"time"
+)
+
+/*
+虚拟机的微基准：每个脚本集中测试一种开销（指令分派、常量操作数、
+函数调用、表访问等），修改 vm / state 前后各跑一次，对比 ns/op。
+
+	luago bench               全部运行
+	luago bench -n 10 call    只运行 call，重复 10 次
+*/
+type Benchmark struct {
+	Name   string
+	Source string
+}
+
+var Benchmarks = []Benchmark{
+	{"loop", `
+		local s = 0
+		for i = 1, 3000000 do s = s + i end`},
+	{"arith", `
+		local x, y = 0, 1.5
+		for i = 1, 1000000 do
+			x = (x + i * 3 - 7) % 1000003
+			y = y * 1.000001 / 1.0000005
+		end`},
+	{"const", `
+		local a, b = 0, 0
+		for i = 1, 1000000 do
+			a = a + 1
+			if a > 10 then a = 0 end
+			b = b ~ 0xFF
+		end`},
+	{"move", `
+		local a, b, c = 1, 2, 3
+		for i = 1, 2000000 do a, b, c = b, c, a end`},
+	{"call", `
+		local function f(a) return a + 1 end
+		local x = 0
+		for i = 1, 500000 do x = f(x) end`},
+	{"fib", `
+		local function fib(n) if n < 2 then return n end return fib(n-1) + fib(n-2) end
+		fib(22)`},
+	{"upvalue", `
+		local n = 0
+		local function inc() n = n + 1 end
+		for i = 1, 500000 do inc() end`},
+	{"table", `
+		local t = {}
+		for i = 1, 200000 do t[i] = i end
+		local s = 0
+		for i = 1, #t do s = s + t[i] end`},
+	{"array", `
+		local t = {}
+		for i = 1, 1000 do t[i] = i end
+		for r = 1, 300 do
+			for i = 1, 1000 do t[i] = t[i] + 1 end
+		end`},
+	{"sparse", `
+		local t = {}
+		for i = 1, 100000 do t[i * 7] = i end
+		local s = 0
+		for i = 1, 100000 do s = s + t[i * 7] + t[i * 7.0] end`},
+	{"field", `
+		local o = {x = 0, y = 0}
+		for i = 1, 500000 do o.x = o.x + 1 o.y = o.x end`},
+	{"global", `
+		g = 0
+		for i = 1, 500000 do g = g + 1 end`},
+	{"longkey", `
+		local s = "abcdefghij"
+		for i = 1, 16 do s = s .. s end
+		local t = {[s] = 0}
+		for i = 1, 20000 do t[s] = t[s] + 1 end`},
+	{"concat", `
+		local s
+		for i = 1, 200000 do s = "a" .. i .. "b" end`},
+}
+
+type Result struct {
+	Name        string
+	N           int
+	NsPerOp     int64
+	AllocsPerOp uint64
+}
+
+// Run runs the selected benchmarks (all if names is empty) n times
+// each on fresh states and writes a line per benchmark to w.
+func Run(w io.Writer, newState func() LuaState, names []string, n int) ([]Result, error) {
+	var results []Result
+	for _, b := range Benchmarks {
+		if !selected(b.Name, names) {
+			continue
+		}
+		r, err := run(b, newState, n)
+		if err != nil {
+			return results, err
+		}
+		fmt.Fprintf(w, "%-10s %5d %14d ns/op %12d allocs/op\n",
+			r.Name, r.N, r.NsPerOp, r.AllocsPerOp)
+		results = append(results, r)
+	}
+	return results, nil
+}
+
+func run(b Benchmark, newState func() LuaState, n int) (Result, error) {
+	var total time.Duration
+	var allocs uint64
+	var before, after runtime.MemStats
+	for i := 0; i < n; i++ {
+		ls := newState()
+		if ls.Load([]byte(b.Source), "="+b.Name, "t") != LUA_OK {
+			return Result{}, fmt.Errorf("%s: %s", b.Name, ls.ToString(-1))
+		}
+		runtime.ReadMemStats(&before)
+		start := time.Now()
+		if ls.PCall(0, 0, 0) != LUA_OK {
+			return Result{}, fmt.Errorf("%s: %s", b.Name, ls.ToString(-1))
+		}
+		total += time.Since(start)
+		runtime.ReadMemStats(&after)
+		allocs += after.Mallocs - before.Mallocs
+	}
+	return Result{b.Name, n, total.Nanoseconds() / int64(n), allocs / uint64(n)}, nil
+}
+
+func selected(name string, names []string) bool {
+	if len(names) == 0 {
+		return true
+	}
+	for _, n := range names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
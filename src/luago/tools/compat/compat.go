@@ -0,0 +1,159 @@
+package compat
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"luago/binchunk"
+	"luago/compiler"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+/*
+和 PUC-Lua 5.3 的二进制 chunk 互通性检查，需要 PATH 里有参考实现
+（lua5.3 / lua、luac5.3 / luac），找不到时跳过：
+
+	luago compat a.lua b.lua
+
+对每个脚本：
+	1. luac 编译（带调试信息和 -s 各一次），用 binchunk.Load 读入再
+	   DumpBytes 写出，结果必须与 luac 的输出逐字节相同；
+	2. 用本项目的编译器编译并 dump，交给 lua 执行，输出和退出码
+	   必须与 lua 直接执行源文件相同。
+*/
+
+// Tools are the reference binaries, "" when not found.
+type Tools struct {
+	Lua  string
+	Luac string
+}
+
+// FindTools looks up the 5.3 reference binaries in PATH.
+func FindTools() Tools {
+	return Tools{
+		Lua:  findTool("lua5.3", "lua"),
+		Luac: findTool("luac5.3", "luac"),
+	}
+}
+
+func findTool(names ...string) string {
+	for _, name := range names {
+		path, err := exec.LookPath(name)
+		if err != nil {
+			continue
+		}
+		out, _ := exec.Command(path, "-v").CombinedOutput()
+		if strings.Contains(string(out), "Lua 5.3") {
+			return path
+		}
+	}
+	return ""
+}
+
+// RoundTrip checks that the chunks luac produces for file come out of
+// Load and DumpBytes unchanged.
+func RoundTrip(luac, file string) error {
+	for _, flags := range [][]string{nil, {"-s"}} {
+		data, err := luacCompile(luac, file, flags)
+		if err != nil {
+			return err
+		}
+		proto, err := binchunk.Load(data, file)
+		if err != nil {
+			return err
+		}
+		dumped, err := binchunk.DumpBytes(proto)
+		if err != nil {
+			return err
+		}
+		if n := firstDifference(data, dumped); n >= 0 {
+			return fmt.Errorf("luac %s: dump differs at byte %d (luac %d bytes, luago %d bytes)",
+				strings.Join(flags, " "), n, len(data), len(dumped))
+		}
+	}
+	return nil
+}
+
+func luacCompile(luac, file string, flags []string) ([]byte, error) {
+	out, err := ioutil.TempFile("", "luac")
+	if err != nil {
+		return nil, err
+	}
+	out.Close()
+	defer os.Remove(out.Name())
+
+	args := append(append([]string{}, flags...), "-o", out.Name(), file)
+	if msg, err := exec.Command(luac, args...).CombinedOutput(); err != nil {
+		return nil, fmt.Errorf("luac: %v: %s", err, bytes.TrimSpace(msg))
+	}
+	return ioutil.ReadFile(out.Name())
+}
+
+// RunDumped checks that lua runs the chunk dumped by luago for file
+// like the source itself.
+func RunDumped(lua, file string) error {
+	src, err := ioutil.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	proto, err := compiler.Compile(string(src), "@"+file)
+	if err != nil {
+		return err
+	}
+	data, err := binchunk.DumpBytes(proto)
+	if err != nil {
+		return err
+	}
+
+	out, err := ioutil.TempFile("", "luago")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(out.Name())
+	_, err = out.Write(data)
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+
+	want, wantCode := run(lua, file)
+	got, gotCode := run(lua, out.Name())
+	if wantCode != gotCode {
+		return fmt.Errorf("exit status %d, want %d\n%s", gotCode, wantCode, got)
+	}
+	if n := firstDifference(want, got); n >= 0 {
+		return fmt.Errorf("output differs at byte %d\n--- source:\n%s\n--- dumped:\n%s", n, want, got)
+	}
+	return nil
+}
+
+// stdout and stderr, and the exit status
+func run(lua, file string) ([]byte, int) {
+	out, err := exec.Command(lua, file).CombinedOutput()
+	if e, ok := err.(*exec.ExitError); ok {
+		return out, e.ExitCode()
+	} else if err != nil {
+		return []byte(err.Error()), -1
+	}
+	return out, 0
+}
+
+// -1 if a and b are equal
+func firstDifference(a, b []byte) int {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if a[i] != b[i] {
+			return i
+		}
+	}
+	if len(a) != len(b) {
+		if len(a) < len(b) {
+			return len(a)
+		}
+		return len(b)
+	}
+	return -1
+}
@@ -0,0 +1,386 @@
+package doc
+
+import (
+	"luago/compiler"
+	. "luago/compiler/ast"
+	"luago/compiler/lexer"
+	"path/filepath"
+	"strings"
+)
+
+/*
+从 LDoc 风格的注释生成 Lua 模块的文档：以 --- 开头、紧接在函数定义
+前面的注释块描述这个函数，不挨着函数的注释块可以用 @module、
+@classmod 描述模块，用 @type 描述类（名字是类名前缀的函数归到类里）。
+
+	--- Shapes and their areas.
+	-- @module shapes
+
+	--- A circle.
+	-- @type Circle
+	-- @field radius the radius
+
+	--- Area of a circle.
+	-- @tparam Circle c the circle
+	-- @treturn number the area
+	function Circle.area(c) ... end
+
+支持的标签：@param、@tparam、@return、@treturn、@usage、@field、
+@tfield、@module、@classmod、@type、@local（不生成文档）。
+没有写 @param 的函数按参数表列出参数。
+*/
+type Module struct {
+	Name        string
+	File        string
+	Summary     string
+	Description string
+	Usage       []string
+	Classes     []*Class
+	Functions   []*Function // not in a class
+}
+
+type Class struct {
+	Name        string
+	Summary     string
+	Description string
+	Usage       []string
+	Fields      []*Param
+	Functions   []*Function
+}
+
+type Function struct {
+	Name        string // qualified, M.f or M:f
+	Params      []*Param
+	Returns     []*Return
+	Summary     string
+	Description string
+	Usage       []string
+	Line        int
+}
+
+type Param struct {
+	Name string
+	Type string
+	Desc string
+}
+
+type Return struct {
+	Type string
+	Desc string
+}
+
+// Extract parses a Lua source file and collects its documentation.
+func Extract(src, file string) (*Module, error) {
+	block, comments, err := compiler.ParseWithComments(src, file)
+	if err != nil {
+		return nil, err
+	}
+
+	m := &Module{Name: moduleName(file), File: file}
+	blocks := docBlocks(comments)
+	attached := map[*docBlock]bool{}
+	for _, stat := range block.Stats {
+		name, fd := funcDef(stat)
+		if fd == nil {
+			continue
+		}
+		b := blockBefore(blocks, fd.Line)
+		if b == nil || b.has("module") || b.has("classmod") || b.has("type") {
+			continue
+		}
+		attached[b] = true
+		if !b.has("local") {
+			m.addFunction(newFunction(name, fd, b))
+		}
+	}
+
+	for _, b := range blocks {
+		if attached[b] {
+			continue
+		}
+		switch {
+		case b.has("module") || b.has("classmod"):
+			if name := b.first("module") + b.first("classmod"); name != "" {
+				m.Name = name
+			}
+			m.Summary, m.Description = b.summary, b.description
+			m.Usage = b.all("usage")
+		case b.has("type"):
+			c := m.class(b.first("type"))
+			c.Summary, c.Description = b.summary, b.description
+			c.Usage = b.all("usage")
+			c.Fields = b.params("field", "tfield")
+		}
+	}
+	m.sortClassFunctions()
+	return m, nil
+}
+
+// a.b.lua => a.b, a/init.lua => a
+func moduleName(file string) string {
+	name := strings.TrimSuffix(filepath.ToSlash(file), ".lua")
+	name = strings.TrimSuffix(name, "/init")
+	return strings.Replace(strings.TrimPrefix(name, "./"), "/", ".", -1)
+}
+
+// the function defined by a top level statement, nil for other statements
+func funcDef(stat Stat) (string, *FuncDefExp) {
+	switch stat := stat.(type) {
+	case *AssignStat:
+		if len(stat.VarList) == 1 && len(stat.ExpList) == 1 {
+			if fd, ok := stat.ExpList[0].(*FuncDefExp); ok {
+				if name := qualifiedName(stat.VarList[0]); name != "" {
+					return methodName(name, fd), fd
+				}
+			}
+		}
+	case *LocalVarDeclStat:
+		if len(stat.NameList) == 1 && len(stat.ExpList) == 1 {
+			if fd, ok := stat.ExpList[0].(*FuncDefExp); ok {
+				return stat.NameList[0], fd
+			}
+		}
+	case *LocalFuncDefStat:
+		return stat.Name, stat.Exp
+	}
+	return "", nil
+}
+
+// a.b.c for names and fields with name keys, "" otherwise
+func qualifiedName(exp Exp) string {
+	switch exp := exp.(type) {
+	case *NameExp:
+		return exp.Name
+	case *TableAccessExp:
+		key, ok := exp.KeyExp.(*StringExp)
+		prefix := qualifiedName(exp.PrefixExp)
+		if ok && prefix != "" {
+			return prefix + "." + key.Str
+		}
+	}
+	return ""
+}
+
+// function a.b:c() is parsed as a.b.c = function(self), show it as a.b:c
+func methodName(name string, fd *FuncDefExp) string {
+	if i := strings.LastIndex(name, "."); i >= 0 &&
+		len(fd.ParList) > 0 && fd.ParList[0] == "self" {
+		return name[:i] + ":" + name[i+1:]
+	}
+	return name
+}
+
+func newFunction(name string, fd *FuncDefExp, b *docBlock) *Function {
+	f := &Function{
+		Name:        name,
+		Summary:     b.summary,
+		Description: b.description,
+		Usage:       b.all("usage"),
+		Params:      b.params("param", "tparam"),
+		Line:        fd.Line,
+	}
+	if len(f.Params) == 0 { /* undocumented, list the parameters */
+		for i, param := range fd.ParList {
+			if i > 0 || param != "self" || !strings.Contains(name, ":") {
+				f.Params = append(f.Params, &Param{Name: param})
+			}
+		}
+		if fd.IsVararg {
+			f.Params = append(f.Params, &Param{Name: "..."})
+		}
+	}
+	for _, t := range b.tags {
+		switch t.name {
+		case "return":
+			f.Returns = append(f.Returns, &Return{Desc: t.text})
+		case "treturn":
+			typ, desc := splitWord(t.text)
+			f.Returns = append(f.Returns, &Return{Type: typ, Desc: desc})
+		}
+	}
+	return f
+}
+
+func (self *Module) class(name string) *Class {
+	for _, c := range self.Classes {
+		if c.Name == name {
+			return c
+		}
+	}
+	c := &Class{Name: name}
+	self.Classes = append(self.Classes, c)
+	return c
+}
+
+func (self *Module) addFunction(f *Function) {
+	self.Functions = append(self.Functions, f)
+}
+
+// moves the functions named after a class (Class.f or Class:f) into it,
+// once all classes are known
+func (self *Module) sortClassFunctions() {
+	var rest []*Function
+	for _, f := range self.Functions {
+		var class *Class
+		for _, c := range self.Classes {
+			if strings.HasPrefix(f.Name, c.Name+".") ||
+				strings.HasPrefix(f.Name, c.Name+":") {
+				class = c
+			}
+		}
+		if class != nil {
+			class.Functions = append(class.Functions, f)
+		} else {
+			rest = append(rest, f)
+		}
+	}
+	self.Functions = rest
+}
+
+/* doc comments */
+
+// a --- comment and the -- comments on the lines that follow it
+type docBlock struct {
+	lastLine    int
+	summary     string
+	description string
+	tags        []docTag
+}
+
+type docTag struct {
+	name string
+	text string
+}
+
+func docBlocks(comments []lexer.Comment) []*docBlock {
+	var blocks []*docBlock
+	for i := 0; i < len(comments); i++ {
+		c := comments[i]
+		if !strings.HasPrefix(c.Text, "-") ||
+			strings.Trim(c.Text, "-") == "" { /* ------ separator */
+			continue
+		}
+		if c.LastLine > c.Line { /* --[[-- long comment ]] */
+			blocks = append(blocks, parseDocBlock(strings.Split(c.Text[1:], "\n"), c.LastLine))
+			continue
+		}
+		lines := []string{c.Text[1:]}
+		lastLine := c.Line
+		for i+1 < len(comments) && comments[i+1].Line == lastLine+1 &&
+			comments[i+1].LastLine == comments[i+1].Line &&
+			!strings.HasPrefix(comments[i+1].Text, "-") {
+			i++
+			lines = append(lines, comments[i].Text)
+			lastLine = comments[i].Line
+		}
+		blocks = append(blocks, parseDocBlock(lines, lastLine))
+	}
+	return blocks
+}
+
+func parseDocBlock(lines []string, lastLine int) *docBlock {
+	b := &docBlock{lastLine: lastLine}
+	var text []string
+	for _, line := range lines {
+		line = strings.TrimPrefix(line, " ")
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "@") {
+			name, rest := splitWord(trimmed[1:])
+			b.tags = append(b.tags, docTag{name, rest})
+		} else if len(b.tags) > 0 { /* continues the last tag */
+			t := &b.tags[len(b.tags)-1]
+			if t.name == "usage" {
+				t.text += "\n" + line
+			} else if trimmed != "" {
+				t.text = strings.TrimSpace(t.text + " " + trimmed)
+			}
+		} else {
+			text = append(text, trimmed)
+		}
+	}
+	for i := range b.tags {
+		if b.tags[i].name == "usage" {
+			b.tags[i].text = strings.Trim(b.tags[i].text, "\n")
+		}
+	}
+	b.summary, b.description = splitSummary(strings.TrimSpace(strings.Join(text, "\n")))
+	return b
+}
+
+// the doc block that ends right before line
+func blockBefore(blocks []*docBlock, line int) *docBlock {
+	for _, b := range blocks {
+		if b.lastLine == line-1 {
+			return b
+		}
+	}
+	return nil
+}
+
+func (self *docBlock) has(tag string) bool {
+	for _, t := range self.tags {
+		if t.name == tag {
+			return true
+		}
+	}
+	return false
+}
+
+func (self *docBlock) first(tag string) string {
+	for _, t := range self.tags {
+		if t.name == tag {
+			return t.text
+		}
+	}
+	return ""
+}
+
+func (self *docBlock) all(tag string) []string {
+	var texts []string
+	for _, t := range self.tags {
+		if t.name == tag {
+			texts = append(texts, t.text)
+		}
+	}
+	return texts
+}
+
+// @param name desc and @tparam type name desc, or @field and @tfield
+func (self *docBlock) params(tag, typedTag string) []*Param {
+	var params []*Param
+	for _, t := range self.tags {
+		switch t.name {
+		case tag:
+			name, desc := splitWord(t.text)
+			params = append(params, &Param{Name: name, Desc: desc})
+		case typedTag:
+			typ, rest := splitWord(t.text)
+			name, desc := splitWord(rest)
+			params = append(params, &Param{Name: name, Type: typ, Desc: desc})
+		}
+	}
+	return params
+}
+
+// the first sentence (or paragraph) and the rest
+func splitSummary(text string) (string, string) {
+	end := len(text)
+	if i := strings.Index(text, "\n\n"); i >= 0 {
+		end = i
+	}
+	if i := strings.Index(text[:end], ". "); i >= 0 {
+		end = i + 1
+	} else if i := strings.Index(text[:end], ".\n"); i >= 0 {
+		end = i + 1
+	}
+	summary := strings.Replace(text[:end], "\n", " ", -1)
+	return summary, strings.TrimSpace(text[end:])
+}
+
+func splitWord(s string) (string, string) {
+	s = strings.TrimSpace(s)
+	if i := strings.IndexAny(s, " \t"); i >= 0 {
+		return s[:i], strings.TrimSpace(s[i+1:])
+	}
+	return s, ""
+}
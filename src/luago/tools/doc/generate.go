@@ -0,0 +1,60 @@
+package doc
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Generate documents the .lua files under the given paths, writing one
+// file per module and an index to outDir. It returns the number of
+// modules.
+func Generate(paths []string, format, outDir string) (int, error) {
+	var modules []*Module
+	for _, root := range paths {
+		err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+			if err != nil || info.IsDir() || !strings.HasSuffix(path, ".lua") {
+				return err
+			}
+			src, err := ioutil.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			/* module names are relative to the directory given */
+			name := filepath.Base(path)
+			if rel, err := filepath.Rel(root, path); err == nil && rel != "." {
+				name = rel
+			}
+			m, err := Extract(string(src), name)
+			if err != nil {
+				return err
+			}
+			modules = append(modules, m)
+			return nil
+		})
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	if err := os.MkdirAll(outDir, 0755); err != nil {
+		return 0, err
+	}
+	for _, m := range modules {
+		m := m
+		if err := writeDoc(format, outDir, m.Name, func(f Format) { Render(f, m) }); err != nil {
+			return 0, err
+		}
+	}
+	err := writeDoc(format, outDir, "index", func(f Format) { RenderIndex(f, modules) })
+	return len(modules), err
+}
+
+func writeDoc(format, outDir, name string, render func(f Format)) error {
+	var buf bytes.Buffer
+	f := NewFormat(format, &buf)
+	render(f)
+	return ioutil.WriteFile(filepath.Join(outDir, name+f.Ext()), buf.Bytes(), 0644)
+}
@@ -0,0 +1,246 @@
+package doc
+
+import (
+	"fmt"
+	"html"
+	"io"
+	"strings"
+)
+
+// Format is an output format, Markdown or HTML.
+type Format interface {
+	Ext() string
+	begin(title string)
+	end()
+	heading(level int, text, code string)
+	para(text string)
+	code(text string)
+	list(ordered bool, items []string)
+	param(name, typ, desc string) string
+	link(text, href string) string
+}
+
+// NewFormat returns the format named "md" or "html", nil for others.
+func NewFormat(name string, w io.Writer) Format {
+	switch name {
+	case "md", "markdown":
+		return &markdown{w}
+	case "html":
+		return &htmlFormat{w}
+	}
+	return nil
+}
+
+// Render writes the documentation of a module.
+func Render(f Format, m *Module) {
+	f.begin(m.Name)
+	f.heading(1, "Module ", m.Name)
+	f.para(m.Summary)
+	f.para(m.Description)
+	renderUsage(f, m.Usage)
+
+	if len(m.Functions) > 0 {
+		f.heading(2, "Functions", "")
+		for _, fn := range m.Functions {
+			renderFunction(f, fn)
+		}
+	}
+	for _, c := range m.Classes {
+		f.heading(2, "Class ", c.Name)
+		f.para(c.Summary)
+		f.para(c.Description)
+		renderUsage(f, c.Usage)
+		if len(c.Fields) > 0 {
+			f.para("Fields:")
+			f.list(false, paramItems(f, c.Fields))
+		}
+		for _, fn := range c.Functions {
+			renderFunction(f, fn)
+		}
+	}
+	f.end()
+}
+
+// RenderIndex writes a list of the modules, linking to files named
+// after them.
+func RenderIndex(f Format, modules []*Module) {
+	f.begin("Modules")
+	f.heading(1, "Modules", "")
+	items := make([]string, len(modules))
+	for i, m := range modules {
+		items[i] = f.link(m.Name, m.Name+f.Ext())
+		if m.Summary != "" {
+			items[i] += " — " + m.Summary
+		}
+	}
+	f.list(false, items)
+	f.end()
+}
+
+func renderFunction(f Format, fn *Function) {
+	names := make([]string, len(fn.Params))
+	for i, p := range fn.Params {
+		names[i] = p.Name
+	}
+	f.heading(3, "", fn.Name+"("+strings.Join(names, ", ")+")")
+	f.para(fn.Summary)
+	f.para(fn.Description)
+	if len(fn.Params) > 0 {
+		f.para("Parameters:")
+		f.list(false, paramItems(f, fn.Params))
+	}
+	if len(fn.Returns) > 0 {
+		items := make([]string, len(fn.Returns))
+		for i, r := range fn.Returns {
+			items[i] = f.param("", r.Type, r.Desc)
+		}
+		f.para("Returns:")
+		f.list(true, items)
+	}
+	renderUsage(f, fn.Usage)
+}
+
+func paramItems(f Format, params []*Param) []string {
+	items := make([]string, len(params))
+	for i, p := range params {
+		items[i] = f.param(p.Name, p.Type, p.Desc)
+	}
+	return items
+}
+
+func renderUsage(f Format, usage []string) {
+	for _, u := range usage {
+		f.para("Usage:")
+		f.code(u)
+	}
+}
+
+/* Markdown */
+
+type markdown struct {
+	w io.Writer
+}
+
+func (self *markdown) Ext() string        { return ".md" }
+func (self *markdown) begin(title string) {}
+func (self *markdown) end()               {}
+
+func (self *markdown) heading(level int, text, code string) {
+	if code != "" {
+		text += "`" + code + "`"
+	}
+	fmt.Fprintf(self.w, "%s %s\n\n", strings.Repeat("#", level), text)
+}
+
+func (self *markdown) para(text string) {
+	if text != "" {
+		fmt.Fprintf(self.w, "%s\n\n", text)
+	}
+}
+
+func (self *markdown) code(text string) {
+	fmt.Fprintf(self.w, "```lua\n%s\n```\n\n", text)
+}
+
+func (self *markdown) list(ordered bool, items []string) {
+	for i, item := range items {
+		if ordered {
+			fmt.Fprintf(self.w, "%d. %s\n", i+1, item)
+		} else {
+			fmt.Fprintf(self.w, "- %s\n", item)
+		}
+	}
+	fmt.Fprintln(self.w)
+}
+
+func (self *markdown) param(name, typ, desc string) string {
+	var parts []string
+	if name != "" {
+		parts = append(parts, "`"+name+"`")
+	}
+	if typ != "" {
+		parts = append(parts, "*"+typ+"*")
+	}
+	s := strings.Join(parts, " ")
+	if desc != "" {
+		if s != "" {
+			s += ": "
+		}
+		s += desc
+	}
+	return s
+}
+
+func (self *markdown) link(text, href string) string {
+	return "[" + text + "](" + href + ")"
+}
+
+/* HTML */
+
+type htmlFormat struct {
+	w io.Writer
+}
+
+func (self *htmlFormat) Ext() string { return ".html" }
+
+func (self *htmlFormat) begin(title string) {
+	fmt.Fprintf(self.w, "<!DOCTYPE html>\n<html>\n<head>\n<meta charset=\"utf-8\">\n<title>%s</title>\n</head>\n<body>\n",
+		html.EscapeString(title))
+}
+
+func (self *htmlFormat) end() {
+	fmt.Fprintln(self.w, "</body>\n</html>")
+}
+
+func (self *htmlFormat) heading(level int, text, code string) {
+	s := html.EscapeString(text)
+	if code != "" {
+		s += "<code>" + html.EscapeString(code) + "</code>"
+	}
+	fmt.Fprintf(self.w, "<h%d>%s</h%d>\n", level, s, level)
+}
+
+func (self *htmlFormat) para(text string) {
+	if text != "" {
+		fmt.Fprintf(self.w, "<p>%s</p>\n", html.EscapeString(text))
+	}
+}
+
+func (self *htmlFormat) code(text string) {
+	fmt.Fprintf(self.w, "<pre><code>%s</code></pre>\n", html.EscapeString(text))
+}
+
+// the items are HTML already, made by param and link
+func (self *htmlFormat) list(ordered bool, items []string) {
+	tag := "ul"
+	if ordered {
+		tag = "ol"
+	}
+	fmt.Fprintf(self.w, "<%s>\n", tag)
+	for _, item := range items {
+		fmt.Fprintf(self.w, "<li>%s</li>\n", item)
+	}
+	fmt.Fprintf(self.w, "</%s>\n", tag)
+}
+
+func (self *htmlFormat) param(name, typ, desc string) string {
+	var parts []string
+	if name != "" {
+		parts = append(parts, "<code>"+html.EscapeString(name)+"</code>")
+	}
+	if typ != "" {
+		parts = append(parts, "<em>"+html.EscapeString(typ)+"</em>")
+	}
+	s := strings.Join(parts, " ")
+	if desc != "" {
+		if s != "" {
+			s += ": "
+		}
+		s += html.EscapeString(desc)
+	}
+	return s
+}
+
+func (self *htmlFormat) link(text, href string) string {
+	return "<a href=\"" + html.EscapeString(href) + "\">" + html.EscapeString(text) + "</a>"
+}
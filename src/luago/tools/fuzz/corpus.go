@@ -0,0 +1,92 @@
+package fuzz
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+/*
+语料目录的布局：
+
+	<corpus>/<target>/*           种子输入
+	<corpus>/<target>/crashers/*  引发崩溃的输入，文件名是内容的 sha1
+	<corpus>/<target>/crashers/*.txt  对应的 panic 信息
+*/
+
+// LoadSeeds reads the seed inputs of a target plus any extra files given.
+// A missing corpus directory is not an error.
+func LoadSeeds(dir, target string, extra []string) ([][]byte, error) {
+	var seeds [][]byte
+	if dir != "" {
+		files, err := ioutil.ReadDir(filepath.Join(dir, target))
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		for _, fi := range files {
+			if fi.IsDir() {
+				continue
+			}
+			data, err := ioutil.ReadFile(filepath.Join(dir, target, fi.Name()))
+			if err != nil {
+				return nil, err
+			}
+			seeds = append(seeds, data)
+		}
+	}
+	for _, name := range extra {
+		data, err := ioutil.ReadFile(name)
+		if err != nil {
+			return nil, err
+		}
+		seeds = append(seeds, data)
+	}
+	return seeds, nil
+}
+
+// SaveCrash writes a crashing input and its report, returning the input path.
+func SaveCrash(dir, target string, c *Crash) (string, error) {
+	crashDir := filepath.Join(dir, target, "crashers")
+	if err := os.MkdirAll(crashDir, 0755); err != nil {
+		return "", err
+	}
+	sum := sha1.Sum(c.Input)
+	name := filepath.Join(crashDir, hex.EncodeToString(sum[:]))
+	if err := ioutil.WriteFile(name, c.Input, 0644); err != nil {
+		return "", err
+	}
+	return name, ioutil.WriteFile(name+".txt", []byte(c.String()), 0644)
+}
+
+// LoadCrashers returns the saved crashing inputs of a target, by file name.
+func LoadCrashers(dir, target string) (map[string][]byte, error) {
+	crashDir := filepath.Join(dir, target, "crashers")
+	files, err := ioutil.ReadDir(crashDir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	crashers := map[string][]byte{}
+	for _, fi := range files {
+		if fi.IsDir() || strings.HasSuffix(fi.Name(), ".txt") {
+			continue
+		}
+		name := filepath.Join(crashDir, fi.Name())
+		data, err := ioutil.ReadFile(name)
+		if err != nil {
+			return nil, err
+		}
+		crashers[name] = data
+	}
+	return crashers, nil
+}
+
+// RemoveCrash deletes a crasher that no longer reproduces.
+func RemoveCrash(name string) {
+	os.Remove(name)
+	os.Remove(name + ".txt")
+}
@@ -0,0 +1,185 @@
+package fuzz
+
+import (
+	"fmt"
+	"luago/binchunk"
+	"luago/compiler"
+	"luago/compiler/lexer"
+	"math/rand"
+	"regexp"
+	"runtime/debug"
+	"time"
+)
+
+/*
+词法分析、语法分析和 Undump 的模糊测试：从语料变异出输入，
+要求任何输入都不能引发 Go 运行时 panic（越界、空指针等）或死循环。
+目标把语法错误和格式错误作为 error 返回（词法分析器内部 panic 的
+*CompileError 也在这里转成 error），属于正常结果，其他 panic 都是崩溃。
+
+	luago fuzz                              三个目标轮流跑 1 分钟
+	luago fuzz -t undump -d 10m corpus/     指定目标、时长和语料目录
+	luago fuzz -replay corpus/              重跑保存下来的崩溃输入
+
+崩溃输入保存在 <corpus>/<target>/crashers/ 下，同名 .txt 是 panic 信息和栈。
+内存耗尽之类的 fatal error 无法 recover，会直接结束进程。
+
+同样的目标也是 Go 原生的模糊测试（见 fuzz_test.go）：
+
+	go test -fuzz FuzzParser luago/tools/fuzz
+*/
+type Target struct {
+	Name string
+	Fn   func(data []byte) error
+}
+
+var Targets = []Target{
+	{"lexer", fuzzLexer},
+	{"parser", fuzzParser},
+	{"undump", fuzzUndump},
+}
+
+func FindTarget(name string) *Target {
+	for i := range Targets {
+		if Targets[i].Name == name {
+			return &Targets[i]
+		}
+	}
+	return nil
+}
+
+func fuzzLexer(data []byte) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			e, ok := r.(*lexer.CompileError)
+			if !ok {
+				panic(r)
+			}
+			err = e
+		}
+	}()
+	lex := lexer.NewLexer(string(data), "fuzz")
+	for {
+		if _, kind, _ := lex.NextToken(); kind == lexer.TOKEN_EOF {
+			return nil
+		}
+	}
+}
+
+func fuzzParser(data []byte) error {
+	_, err := compiler.Parse(string(data), "fuzz")
+	return err
+}
+
+func fuzzUndump(data []byte) error {
+	_, err := binchunk.Load(data, "fuzz")
+	return err
+}
+
+// seeds for undump are the source seeds compiled to binary chunks
+func compileSeed(src []byte) []byte {
+	proto, err := compiler.Compile(string(src), "seed")
+	if err != nil {
+		return nil
+	}
+	data, _ := binchunk.DumpBytes(proto)
+	return data
+}
+
+type Crash struct {
+	Input []byte
+	Hang  bool
+	Msg   string
+	Stack string
+}
+
+func (self *Crash) String() string {
+	if self.Hang {
+		return "hang: " + self.Msg
+	}
+	return "panic: " + self.Msg + "\n\n" + self.Stack
+}
+
+// Check runs the target on one input. Returned errors are the expected
+// way to reject bad input; a panic, or not returning within timeout, is
+// a crash.
+func Check(t *Target, data []byte, timeout time.Duration) *Crash {
+	done := make(chan *Crash, 1)
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				done <- &Crash{Input: data, Msg: fmt.Sprint(r), Stack: string(debug.Stack())}
+			}
+		}()
+		t.Fn(data)
+		done <- nil
+	}()
+
+	select {
+	case c := <-done:
+		return c
+	case <-time.After(timeout):
+		/* the goroutine cannot be stopped, it is left running */
+		return &Crash{Input: data, Hang: true, Msg: fmt.Sprintf("no result after %v", timeout)}
+	}
+}
+
+type Stats struct {
+	Execs   int
+	Crashes []*Crash
+}
+
+// Run mutates inputs from the corpus until the duration runs out or the
+// target hangs. New crashes are passed to found as they are discovered.
+func Run(t *Target, corpus [][]byte, rng *rand.Rand, d, timeout time.Duration,
+	found func(*Crash)) Stats {
+
+	if t.Name == "undump" {
+		var chunks [][]byte
+		for _, src := range corpus {
+			if binchunk.IsBinaryChunk(src) {
+				chunks = append(chunks, src)
+			} else if chunk := compileSeed(src); chunk != nil {
+				chunks = append(chunks, chunk)
+			}
+		}
+		corpus = chunks
+	}
+	if len(corpus) == 0 {
+		corpus = [][]byte{{}}
+	}
+
+	var stats Stats
+	seen := map[string]bool{}
+	deadline := time.Now().Add(d)
+	for time.Now().Before(deadline) {
+		input := mutate(rng, corpus[rng.Intn(len(corpus))], corpus)
+		stats.Execs++
+		c := Check(t, input, timeout)
+		if c == nil {
+			continue
+		}
+		key := crashKey(c)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		stats.Crashes = append(stats.Crashes, c)
+		found(c)
+		if c.Hang {
+			break
+		}
+	}
+	return stats
+}
+
+// crashes with the same message and innermost frame are the same bug,
+// whatever the indexes in the message
+func crashKey(c *Crash) string {
+	if c.Hang {
+		return "hang"
+	}
+	return digits.ReplaceAllString(c.Msg, "N") + "\n" + topFrame(c.Stack)
+}
+
+var digits = regexp.MustCompile(`[0-9]+`)
@@ -0,0 +1,69 @@
+package fuzz
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+// seed inputs for all three targets, together with the scripts in lua/
+var seedSources = []string{
+	"",
+	"local x = 1",
+	"print('hello' .. \"world\\n\" .. [[long\nstring]])",
+	"local t = {1, 2.5, 0x10, 1e10, a = {b = true}, [f()] = ...}",
+	"function M.f(a, b, ...) return a // b, a % b, #t, ~a, a >> 1 end",
+	"for i = 1, 10, 2 do if i > 5 then break elseif i then goto done end end ::done::",
+	"for k, v in pairs(t) do while k do repeat k = nil until not k end end",
+	"local function f() return f() end local a <const>, b <close> = 1, nil",
+	"obj:method(1, 'a', {}) -- comment\n--[==[ long comment ]==]",
+	"x = 'unfinished",
+	"x = = 1",
+}
+
+// seeds returns the seed sources plus the scripts of lua/, if found
+func seeds(f *testing.F) [][]byte {
+	var data [][]byte
+	for _, src := range seedSources {
+		data = append(data, []byte(src))
+	}
+	files, _ := filepath.Glob(filepath.Join("..", "..", "..", "lua", "*.lua"))
+	for _, name := range files {
+		src, err := ioutil.ReadFile(name)
+		if err != nil {
+			f.Fatal(err)
+		}
+		data = append(data, src)
+	}
+	return data
+}
+
+func FuzzLexer(f *testing.F) {
+	for _, src := range seeds(f) {
+		f.Add(src)
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		fuzzLexer(data)
+	})
+}
+
+func FuzzParser(f *testing.F) {
+	for _, src := range seeds(f) {
+		f.Add(src)
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		fuzzParser(data)
+	})
+}
+
+// the seeds of undump are the sources that compile, as binary chunks
+func FuzzUndump(f *testing.F) {
+	for _, src := range seeds(f) {
+		if chunk := compileSeed(src); chunk != nil {
+			f.Add(chunk)
+		}
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		fuzzUndump(data)
+	})
+}
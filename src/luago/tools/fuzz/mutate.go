@@ -0,0 +1,89 @@
+package fuzz
+
+import (
+	"math/rand"
+	"strings"
+)
+
+// fragments that tend to reach deeper into the lexer and parser
+var dictionary = []string{
+	"local ", "function ", "end", "if ", "then ", "else ", "elseif ", "while ", "do ",
+	"for ", "in ", "repeat ", "until ", "return ", "break ", "goto ", "::", "...",
+	"(", ")", "[", "]", "{", "}", "[[", "]]", "[==[", "]==]", "--", "--[[",
+	"\"", "'", "\\", "\\x", "\\u{", "\\z", "\\9", "0x", "0x.p", "1e", ".5", "..",
+	"=", "==", "~=", "<=", ">=", "//", "<<", ">>", "~", "#", "^", "%",
+	"\n", "\r\n", " ", "\t", "\x00", "\xff",
+}
+
+// values that make sizes and counts in binary chunks interesting
+var interestingBytes = []byte{0, 1, 0x7f, 0x80, 0xfe, 0xff}
+
+func mutate(rng *rand.Rand, data []byte, corpus [][]byte) []byte {
+	out := append([]byte(nil), data...)
+	for n := 1 + rng.Intn(4); n > 0; n-- {
+		out = mutateOnce(rng, out, corpus)
+	}
+	return out
+}
+
+func mutateOnce(rng *rand.Rand, data []byte, corpus [][]byte) []byte {
+	if len(data) == 0 {
+		return []byte(dictionary[rng.Intn(len(dictionary))])
+	}
+	pos := rng.Intn(len(data))
+	switch rng.Intn(8) {
+	case 0: /* flip a bit */
+		data[pos] ^= 1 << uint(rng.Intn(8))
+	case 1: /* set an interesting byte */
+		data[pos] = interestingBytes[rng.Intn(len(interestingBytes))]
+	case 2: /* random byte */
+		data[pos] = byte(rng.Intn(256))
+	case 3: /* delete a range */
+		end := pos + 1 + rng.Intn(min(16, len(data)-pos))
+		data = append(data[:pos], data[end:]...)
+	case 4: /* insert a dictionary word */
+		word := dictionary[rng.Intn(len(dictionary))]
+		data = insert(data, pos, []byte(word))
+	case 5: /* duplicate a range */
+		end := pos + 1 + rng.Intn(min(64, len(data)-pos))
+		data = insert(data, pos, append([]byte(nil), data[pos:end]...))
+	case 6: /* splice in part of another input */
+		other := corpus[rng.Intn(len(corpus))]
+		if len(other) > 0 {
+			start := rng.Intn(len(other))
+			end := start + 1 + rng.Intn(min(64, len(other)-start))
+			data = insert(data, pos, other[start:end])
+		}
+	case 7: /* truncate */
+		data = data[:pos]
+	}
+	return data
+}
+
+func insert(data []byte, pos int, b []byte) []byte {
+	out := make([]byte, 0, len(data)+len(b))
+	out = append(out, data[:pos]...)
+	out = append(out, b...)
+	return append(out, data[pos:]...)
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// the innermost frame of a panic stack outside the runtime and this package
+func topFrame(stack string) string {
+	lines := strings.Split(stack, "\n")
+	for i := 1; i < len(lines); i += 2 {
+		fn := strings.TrimSpace(lines[i])
+		if fn == "" || strings.HasPrefix(fn, "runtime") || strings.HasPrefix(fn, "panic(") ||
+			strings.Contains(fn, "luago/tools/fuzz.") {
+			continue
+		}
+		return fn
+	}
+	return ""
+}
@@ -0,0 +1,39 @@
+//go:build !js
+// +build !js
+
+package main
+
+import (
+	"fmt"
+	. "luago/api"
+	"luago/replay"
+	"os"
+)
+
+/*
+	LUAGO_RECORD=run.trace luago script.lua   记录不确定的输入
+	LUAGO_REPLAY=run.trace luago script.lua   按记录重放
+	见 replay 包。
+*/
+func startTrace(ls LuaState) *replay.Session {
+	open, path := replay.Record, os.Getenv("LUAGO_RECORD")
+	if p := os.Getenv("LUAGO_REPLAY"); p != "" {
+		open, path = replay.Replay, p
+	}
+	if path == "" {
+		return nil
+	}
+	trace, err := open(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "luago: %v\n", err)
+		os.Exit(1)
+	}
+	trace.Install(ls)
+	return trace
+}
+
+func stopTrace(trace *replay.Session) {
+	if err := trace.Close(); err != nil {
+		fmt.Fprintf(os.Stderr, "luago: %v\n", err)
+	}
+}
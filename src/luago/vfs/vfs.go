@@ -0,0 +1,138 @@
+package vfs
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+)
+
+// 解释器对宿主文件系统的全部依赖。
+// 在没有真实文件系统的平台（如浏览器）上，宿主可以替换 FS。
+type FileSystem interface {
+	ReadFile(name string) ([]byte, error)
+	WriteFile(name string, data []byte) error
+	Exists(name string) bool
+	Open(name string) (io.ReadCloser, error)    // for streaming reads
+	Create(name string) (io.WriteCloser, error) // for streaming writes
+}
+
+var FS FileSystem = OSFileSystem{}
+
+// 能以 os.OpenFile 的各种方式打开文件的文件系统，io.open 的 "a"、"r+"
+// 等模式需要它。返回值按需实现 io.Reader、io.Writer 和 io.Seeker。
+type FileOpener interface {
+	OpenFile(name string, flag int, perm os.FileMode) (io.Closer, error)
+}
+
+func ReadFile(name string) ([]byte, error) {
+	return FS.ReadFile(name)
+}
+
+func WriteFile(name string, data []byte) error {
+	return FS.WriteFile(name, data)
+}
+
+func Exists(name string) bool {
+	return FS.Exists(name)
+}
+
+func Open(name string) (io.ReadCloser, error) {
+	return FS.Open(name)
+}
+
+func Create(name string) (io.WriteCloser, error) {
+	return FS.Create(name)
+}
+
+// OpenFile opens name like os.OpenFile. A FileSystem that is not a
+// FileOpener can only open files for reading or create them.
+func OpenFile(name string, flag int, perm os.FileMode) (io.Closer, error) {
+	if fs, ok := FS.(FileOpener); ok {
+		return fs.OpenFile(name, flag, perm)
+	}
+	switch flag {
+	case os.O_RDONLY:
+		return FS.Open(name)
+	case os.O_WRONLY | os.O_CREATE | os.O_TRUNC:
+		return FS.Create(name)
+	}
+	return nil, &os.PathError{Op: "open", Path: name, Err: errors.New("operation not supported")}
+}
+
+/* OSFileSystem */
+
+type OSFileSystem struct{}
+
+func (OSFileSystem) ReadFile(name string) ([]byte, error) {
+	return ioutil.ReadFile(name)
+}
+
+func (OSFileSystem) WriteFile(name string, data []byte) error {
+	return ioutil.WriteFile(name, data, 0644)
+}
+
+func (OSFileSystem) Exists(name string) bool {
+	_, err := os.Stat(name)
+	return !os.IsNotExist(err)
+}
+
+func (OSFileSystem) Open(name string) (io.ReadCloser, error) {
+	return os.Open(name)
+}
+
+func (OSFileSystem) Create(name string) (io.WriteCloser, error) {
+	return os.Create(name)
+}
+
+func (OSFileSystem) OpenFile(name string, flag int, perm os.FileMode) (io.Closer, error) {
+	return os.OpenFile(name, flag, perm)
+}
+
+/* MapFileSystem */
+
+// 内存文件系统，文件名到文件内容的映射
+type MapFileSystem map[string][]byte
+
+func (self MapFileSystem) ReadFile(name string) ([]byte, error) {
+	if data, found := self[name]; found {
+		return data, nil
+	}
+	return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrNotExist}
+}
+
+func (self MapFileSystem) WriteFile(name string, data []byte) error {
+	self[name] = append([]byte(nil), data...)
+	return nil
+}
+
+func (self MapFileSystem) Exists(name string) bool {
+	_, found := self[name]
+	return found
+}
+
+func (self MapFileSystem) Open(name string) (io.ReadCloser, error) {
+	data, err := self.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.NopCloser(bytes.NewReader(data)), nil
+}
+
+// the file content is stored when the writer is closed
+func (self MapFileSystem) Create(name string) (io.WriteCloser, error) {
+	self[name] = nil
+	return &mapFile{fs: self, name: name}, nil
+}
+
+type mapFile struct {
+	bytes.Buffer
+	fs   MapFileSystem
+	name string
+}
+
+func (self *mapFile) Close() error {
+	self.fs[self.name] = self.Bytes()
+	return nil
+}
@@ -0,0 +1,57 @@
+package vm
+
+import (
+	"fmt"
+	"luago/api"
+)
+
+/*
+OP_TBC 之后直到 63 的操作码保留给宿主程序：用 RegisterExtOp
+注册处理函数，就能加入专用的快速指令而不用改虚拟机。扩展指令都是
+iABC 格式，编译器的内建函数（见 codegen.RegisterIntrinsic）按下面的
+约定生成它们，自己生成代码时也可以用别的约定：
+
+	R(A) := op(R(B), ..., R(B+C-1))
+
+	vm.RegisterExtOp(vm.OP_EXT0, "CLAMP", func(i vm.Instruction, ls api.LuaVM) {
+		a, b, _ := i.ABC()
+		ls.PushValue(b + 1)
+		...
+		ls.Replace(a + 1)
+	})
+
+注册表是全局的且不加锁，要在运行任何代码之前注册（比如在 init 里）。
+*/
+const (
+	OP_EXT0    = OP_TBC + 1
+	NUM_EXTOPS = 1<<6 - OP_EXT0
+)
+
+func init() {
+	for op := OP_EXT0; op < OP_EXT0+NUM_EXTOPS; op++ {
+		name := fmt.Sprintf("EXT%d", op-OP_EXT0)
+		opcodes = append(opcodes, extOpcode(name, nil))
+	}
+}
+
+// RegisterExtOp installs the action of an extension opcode, the name
+// is what listings show.
+func RegisterExtOp(op int, name string, action func(i Instruction, vm api.LuaVM)) {
+	if op < OP_EXT0 || op >= OP_EXT0+NUM_EXTOPS {
+		panic(fmt.Sprintf("opcode %d is not an extension opcode", op))
+	}
+	if action == nil {
+		panic("extension opcode without action")
+	}
+	opcodes[op] = extOpcode(name, action)
+}
+
+// IsExtOp reports whether op is an extension opcode with an action.
+func IsExtOp(op int) bool {
+	return op >= OP_EXT0 && op < OP_EXT0+NUM_EXTOPS &&
+		opcodes[op].action != nil
+}
+
+func extOpcode(name string, action func(i Instruction, vm api.LuaVM)) opcode {
+	return opcode{0, 1, OpArgR, OpArgU, IABC, fmt.Sprintf("%-8s", name), action}
+}
@@ -1,33 +1,65 @@
 package vm
 
 import . "luago/api"
+import "luago/number"
 
-// R(A)-=R(A+2); pc+=sBx
+// prepares the loop like forprep of Lua 5.4 and enters it with
+// R(A+3)=R(A), or skips it with pc+=sBx+1 (past FORLOOP). An integer
+// loop keeps the count of the iterations left in R(A+1); a float loop
+// converts the control values to floats.
 func forPrep(i Instruction, vm LuaVM) {
 	a, sBx := i.AsBx()
 	a += 1
 
-	if vm.Type(a) == LUA_TSTRING {
-		vm.PushNumber(vm.ToNumber(a))
+	if vm.IsInteger(a) && vm.IsInteger(a+2) {
+		init, step := vm.ToInteger(a), vm.ToInteger(a+2)
+		if step == 0 {
+			forError(vm, "'for' step is zero")
+		}
+		limit, ok := vm.ToIntegerX(a + 1)
+		if !ok {
+			f, ok := vm.ToNumberX(a + 1)
+			if !ok {
+				forTypeError(vm, a+1, "limit")
+			}
+			var skip bool
+			if limit, skip = number.ForLimit(f, step); skip {
+				vm.AddPC(sBx + 1)
+				return
+			}
+		}
+		count, skip := number.ForCount(init, limit, step)
+		if skip {
+			vm.AddPC(sBx + 1)
+			return
+		}
+		vm.PushInteger(int64(count))
+		vm.Replace(a + 1)
+	} else {
+		limit := forNumber(vm, a+1, "limit")
+		step := forNumber(vm, a+2, "step")
+		init := forNumber(vm, a, "initial value")
+		if step == 0 {
+			forError(vm, "'for' step is zero")
+		}
+		if 0 < step && limit < init || !(0 < step) && init < limit {
+			vm.AddPC(sBx + 1)
+			return
+		}
+		vm.PushNumber(init)
 		vm.Replace(a)
-	}
-	if vm.Type(a+1) == LUA_TSTRING {
-		vm.PushNumber(vm.ToNumber(a + 1))
+		vm.PushNumber(limit)
 		vm.Replace(a + 1)
-	}
-	if vm.Type(a+2) == LUA_TSTRING {
-		vm.PushNumber(vm.ToNumber(a + 2))
+		vm.PushNumber(step)
 		vm.Replace(a + 2)
 	}
-
-	vm.PushValue(a)
-	vm.PushValue(a + 2)
-	vm.Arith(LUA_OPSUB)
-	vm.Replace(a)
-	vm.AddPC(sBx)
+	vm.Copy(a, a+3)
 }
 
-// R(A)+=R(A+2);
+// integer loop: if R(A+1) > 0 then {
+//   R(A+1)-=1; R(A)+=R(A+2); pc+=sBx; R(A+3)=R(A)
+// }
+// float loop: R(A)+=R(A+2);
 // if R(A) <?= R(A+1) then {
 //   pc+=sBx; R(A+3)=R(A)
 // }
@@ -35,22 +67,52 @@ func forLoop(i Instruction, vm LuaVM) {
 	a, sBx := i.AsBx()
 	a += 1
 
-	// R(A)+=R(A+2);
-	vm.PushValue(a + 2)
-	vm.PushValue(a)
-	vm.Arith(LUA_OPADD)
-	vm.Replace(a)
+	if vm.IsInteger(a + 2) {
+		if count := vm.ToInteger(a + 1); count != 0 {
+			vm.PushInteger(count - 1)
+			vm.Replace(a + 1)
+			vm.PushInteger(vm.ToInteger(a) + vm.ToInteger(a+2))
+			vm.Replace(a)
+			vm.AddPC(sBx)
+			vm.Copy(a, a+3)
+		}
+		return
+	}
 
-	isPositiveStep := vm.ToNumber(a+2) >= 0
-	if isPositiveStep && vm.Compare(a, a+1, LUA_OPLE) ||
-		!isPositiveStep && vm.Compare(a+1, a, LUA_OPLE) {
+	step := vm.ToNumber(a + 2)
+	idx := vm.ToNumber(a) + step
+	if 0 < step && idx <= vm.ToNumber(a+1) ||
+		!(0 < step) && vm.ToNumber(a+1) <= idx {
 
-		// pc+=sBx; R(A+3)=R(A)
+		vm.PushNumber(idx)
+		vm.Replace(a)
 		vm.AddPC(sBx)
 		vm.Copy(a, a+3)
 	}
 }
 
+// converts a control value of a float loop, strings included
+func forNumber(vm LuaVM, idx int, what string) float64 {
+	n, ok := vm.ToNumberX(idx)
+	if !ok {
+		forTypeError(vm, idx, what)
+	}
+	return n
+}
+
+func forTypeError(vm LuaVM, idx int, what string) {
+	forError(vm, "bad 'for' "+what+" (number expected, got "+
+		vm.TypeName(vm.Type(idx))+")")
+}
+
+// raises msg with the position of the loop
+func forError(vm LuaVM, msg string) {
+	vm.Where(0)
+	vm.PushString(msg)
+	vm.Concat(2)
+	vm.Error()
+}
+
 // if R(A+1) ~= nil then {
 //   R(A)=R(A+1); pc += sBx
 // }
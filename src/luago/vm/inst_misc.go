@@ -12,6 +12,7 @@ func move(i Instruction, vm LuaVM) {
 }
 
 // pc+=sBx; if (A) close all upvalues >= R(A - 1)
+// (and the to-be-closed variables, like OP_CLOSE of Lua 5.4)
 func jmp(i Instruction, vm LuaVM) {
 	a, sBx := i.AsBx()
 
@@ -20,3 +21,9 @@ func jmp(i Instruction, vm LuaVM) {
 		vm.CloseUpvalues(a)
 	}
 }
+
+// mark variable R(A) "to be closed", from Lua 5.4
+func tbc(i Instruction, vm LuaVM) {
+	a, _, _ := i.ABC()
+	vm.ToClose(a + 1)
+}
@@ -1,9 +1,14 @@
 package vm
 
-import "luago/api"
+import (
+	"fmt"
+	"luago/api"
+)
 
 const MAXARG_Bx = 1<<18 - 1       // 262143
 const MAXARG_sBx = MAXARG_Bx >> 1 // 131071
+const MAXARG_C = 1<<9 - 1         // 511
+const MAXARG_Ax = 1<<26 - 1       // 67108863
 
 /*
  31       22       13       5    0
@@ -62,7 +67,15 @@ func (self Instruction) CMode() byte {
 	return opcodes[self.Opcode()].argCMode
 }
 
+// TestAMode reports whether the instruction sets register A.
+func (self Instruction) TestAMode() bool {
+	return opcodes[self.Opcode()].setAFlag == 1
+}
+
 func (self Instruction) Execute(vm api.LuaVM) {
+	if self.Opcode() >= len(opcodes) {
+		panic(fmt.Sprintf("unknown opcode %d", self.Opcode()))
+	}
 	action := opcodes[self.Opcode()].action
 	if action != nil {
 		action(self, vm)